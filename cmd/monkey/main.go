@@ -2,13 +2,41 @@ package main
 
 import (
 	"fmt"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/disasm"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/objfile"
+	"github.com/maxild/monkey/internal/parser"
 	"github.com/maxild/monkey/internal/repl"
+	"github.com/maxild/monkey/internal/vm"
+	"io/ioutil"
 	"os"
 	"os/user"
 )
 
+const usage = `usage:
+  monkey                      start the REPL
+  monkey run FILE             run a source or object file
+  monkey compile FILE OUTPUT  compile a source file to an object file
+  monkey disasm FILE          print the bytecode of a source or object file
+`
+
 //TODO: Only way to quit is Ctrl+C
 func main() {
+	if len(os.Args) > 1 {
+		switch {
+		case os.Args[1] == "run" && len(os.Args) == 3:
+			os.Exit(run(os.Args[2]))
+		case os.Args[1] == "compile" && len(os.Args) == 4:
+			os.Exit(compile(os.Args[2], os.Args[3]))
+		case os.Args[1] == "disasm" && len(os.Args) == 3:
+			os.Exit(disassemble(os.Args[2]))
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -18,3 +46,92 @@ func main() {
 	repl.Start(os.Stdin, os.Stdout)
 }
 
+// run executes the file and prints the value of the program, returning the exit code
+func run(filename string) int {
+	bytecode, ok := load(filename)
+	if !ok {
+		return 1
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", filename, err)
+		return 1
+	}
+	if result := machine.LastPoppedStackElem(); result != nil {
+		fmt.Println(result.Inspect())
+	}
+	return 0
+}
+
+// compile writes the object file of the source file, returning the exit code
+func compile(filename, output string) int {
+	bytecode, ok := load(filename)
+	if !ok {
+		return 1
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := objfile.Write(f, bytecode); err != nil {
+		f.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// disassemble prints the listing of the file, returning the exit code
+func disassemble(filename string) int {
+	bytecode, ok := load(filename)
+	if !ok {
+		return 1
+	}
+
+	if err := disasm.Disassemble(os.Stdout, bytecode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// load reads an object file, or compiles a source file. Errors are printed.
+func load(filename string) (*compiler.Bytecode, bool) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+
+	if objfile.IsObjectFile(src) {
+		bytecode, err := objfile.Decode(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return nil, false
+		}
+		return bytecode, true
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, msg)
+		}
+		return nil, false
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", filename, err)
+		return nil, false
+	}
+	return c.Bytecode(), true
+}
@@ -5,6 +5,8 @@ package ast
 import (
 	"bytes"
 	"github.com/maxild/monkey/internal/token"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -55,6 +57,7 @@ func (p *Program) String() string {
 type LetStatement struct {
 	Token token.Token 	// The token.LET token (kind)
 	Name *Identifier
+	Type TypeExpr		// optional annotation (nil when omitted)
 	Value Expression
 }
 
@@ -65,6 +68,9 @@ func (ls *LetStatement) String() string {
 
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 	// TODO: How can Value be nil?
 	if ls.Value != nil {
@@ -127,12 +133,81 @@ func (i *Identifier) String() string { return i.Value }
 type IntegerLiteral struct {
 	Token token.Token 	// The token.INT token (kind)
 	Value int64
+	Big   *big.Int		// The value when it does not fit in an int64 (then Value is 0)
 }
 
 func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Lexeme }
 func (il *IntegerLiteral) String() string { return il.Token.Lexeme }
 
+// 1.5, 2e-3
+type FloatLiteral struct {
+	Token token.Token 	// The token.FLOAT token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Lexeme }
+func (fl *FloatLiteral) String() string { return fl.Token.Lexeme }
+
+// "hello, world"
+type StringLiteral struct {
+	Token token.Token	// The token.STRING token
+	Value string		// The characters between the quotes, with the escapes decoded
+}
+
+func (sl *StringLiteral) expressionNode() {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Lexeme }
+func (sl *StringLiteral) String() string { return strconv.Quote(sl.Value) }
+
+// /ab+c/i
+type RegexLiteral struct {
+	Token token.Token	// The token.REGEX token
+	Pattern string		// The source between the slashes
+	Flags string		// The letters after the closing slash
+}
+
+func (rl *RegexLiteral) expressionNode() {}
+func (rl *RegexLiteral) TokenLiteral() string { return rl.Token.Lexeme }
+func (rl *RegexLiteral) String() string { return "/" + rl.Pattern + "/" + rl.Flags }
+
+// [a, b, c]
+type ArrayLiteral struct {
+	Token token.Token	// The '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Lexeme }
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, e := range al.Elements {
+		elements = append(elements, e.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// {k1: v1, k2: v2}
+type HashLiteral struct {
+	Token token.Token	// The '{' token
+	Pairs []*KeyValue	// in source order
+}
+
+type KeyValue struct {
+	Key Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Lexeme }
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
 // Aka UnaryExpression
 type PrefixExpression struct {
 	Token token.Token	// The prefix token kind (e.g. ! or -)
@@ -225,6 +300,11 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token token.Token 	// The 'fn' token
 	Parameters []*Identifier
+	// ParameterTypes[i] is the optional annotation of Parameters[i]. Entries are nil
+	// when a parameter is unannotated, and the slice itself can be nil (or short) when
+	// the literal is built by hand, so use ParameterType(i) to read it.
+	ParameterTypes []TypeExpr
+	ReturnType TypeExpr		// optional annotation (nil when omitted)
 	Body *BlockStatement
 }
 
@@ -241,8 +321,15 @@ func (fl *FunctionLiteral) String() string {
 			out.WriteString(", ")
 		}
 		out.WriteString(p.String())
+		if t := fl.ParameterType(i); t != nil {
+			out.WriteString(": " + t.String())
+		}
 	}
-	out.WriteString(") ")
+	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(": " + fl.ReturnType.String())
+	}
+	out.WriteString(" ")
 
 	// body
 	out.WriteString(fl.Body.String())
@@ -250,6 +337,14 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// ParameterType returns the annotation of the i'th parameter, or nil if it has none.
+func (fl *FunctionLiteral) ParameterType(i int) TypeExpr {
+	if i < len(fl.ParameterTypes) {
+		return fl.ParameterTypes[i]
+	}
+	return nil
+}
+
 type CallExpression struct {
 	Token token.Token 	// The '(' token
 	Function Expression
@@ -273,3 +368,330 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+// s[i]
+type IndexExpression struct {
+	Token token.Token	// The '[' token
+	Left Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Lexeme }
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// s[low:high], where either bound can be omitted (s[low:] and s[:high])
+type SliceExpression struct {
+	Token token.Token	// The '[' token
+	Left Expression
+	Low Expression		// nil for 0
+	High Expression		// nil for the length
+}
+
+func (se *SliceExpression) expressionNode() {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Lexeme }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(" + se.Left.String() + "[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+//
+// Records (structs)
+//
+
+// struct Point { x, y = 0 }
+type StructDeclaration struct {
+	Token token.Token	// The 'struct' token
+	Name *Identifier
+	Fields []*StructField
+}
+
+// A field of a struct declaration with an optional default value
+type StructField struct {
+	Name *Identifier
+	Default Expression	// nil when the field has no default
+}
+
+func (sd *StructDeclaration) statementNode() {}
+func (sd *StructDeclaration) TokenLiteral() string { return sd.Token.Lexeme }
+func (sd *StructDeclaration) String() string {
+	fields := []string{}
+	for _, f := range sd.Fields {
+		if f.Default != nil {
+			fields = append(fields, f.Name.String()+" = "+f.Default.String())
+		} else {
+			fields = append(fields, f.Name.String())
+		}
+	}
+	return "struct " + sd.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// Field returns the declared field with the given name, or nil.
+func (sd *StructDeclaration) Field(name string) *StructField {
+	for _, f := range sd.Fields {
+		if f.Name.Value == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Point{x: 1, y: 2}
+type StructLiteral struct {
+	Token token.Token	// The token.IDENT token of the struct name
+	Name *Identifier
+	Fields []*FieldValue	// in source order
+}
+
+// x: 1
+type FieldValue struct {
+	Name *Identifier
+	Value Expression
+}
+
+func (sl *StructLiteral) expressionNode() {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Lexeme }
+func (sl *StructLiteral) String() string {
+	fields := []string{}
+	for _, f := range sl.Fields {
+		fields = append(fields, f.Name.String()+": "+f.Value.String())
+	}
+	return sl.Name.String() + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// p.x
+type FieldAccessExpression struct {
+	Token token.Token	// The '.' token
+	Object Expression
+	Field *Identifier
+}
+
+func (fa *FieldAccessExpression) expressionNode() {}
+func (fa *FieldAccessExpression) TokenLiteral() string { return fa.Token.Lexeme }
+func (fa *FieldAccessExpression) String() string {
+	return fa.Object.String() + "." + fa.Field.String()
+}
+
+//
+// Tagged unions (enums)
+//
+
+// enum Shape { Circle(r), Rect(w, h), Empty }
+//
+// Every variant name is bound to a constructor: Circle(1) and Rect(2, 3) build values
+// of the enum, and Empty is a value by itself. A LetCondition discriminates them.
+type EnumDeclaration struct {
+	Token token.Token	// The 'enum' token
+	Name *Identifier
+	Variants []*EnumVariant
+}
+
+// Circle(r) or Empty (no fields)
+type EnumVariant struct {
+	Name *Identifier
+	Fields []*Identifier
+}
+
+func (ev *EnumVariant) String() string {
+	if len(ev.Fields) == 0 {
+		return ev.Name.String()
+	}
+	fields := []string{}
+	for _, f := range ev.Fields {
+		fields = append(fields, f.String())
+	}
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (ed *EnumDeclaration) statementNode() {}
+func (ed *EnumDeclaration) TokenLiteral() string { return ed.Token.Lexeme }
+func (ed *EnumDeclaration) String() string {
+	variants := []string{}
+	for _, v := range ed.Variants {
+		variants = append(variants, v.String())
+	}
+	return "enum " + ed.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// Variant returns the variant with the given name, or nil.
+func (ed *EnumDeclaration) Variant(name string) *EnumVariant {
+	for _, v := range ed.Variants {
+		if v.Name.Value == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// The destructuring condition of an if expression: if (let Circle(r) = shape) { r }
+//
+// It is true when Value is the variant named by Pattern, and then the fields of the
+// variant are bound to the identifiers of the pattern inside the if arm.
+type LetCondition struct {
+	Token token.Token	// The 'let' token
+	Pattern *VariantPattern
+	Value Expression
+}
+
+func (lc *LetCondition) expressionNode() {}
+func (lc *LetCondition) TokenLiteral() string { return lc.Token.Lexeme }
+func (lc *LetCondition) String() string {
+	return "let " + lc.Pattern.String() + " = " + lc.Value.String()
+}
+
+// Circle(r), Rect(_, h) or Empty. The identifier _ ignores a field.
+type VariantPattern struct {
+	Token token.Token	// The token.IDENT token of the variant name
+	Name *Identifier
+	Bindings []*Identifier	// nil when the pattern has no parenthesis
+}
+
+func (vp *VariantPattern) TokenLiteral() string { return vp.Token.Lexeme }
+func (vp *VariantPattern) String() string {
+	if vp.Bindings == nil {
+		return vp.Name.String()
+	}
+	bindings := []string{}
+	for _, b := range vp.Bindings {
+		bindings = append(bindings, b.String())
+	}
+	return vp.Name.String() + "(" + strings.Join(bindings, ", ") + ")"
+}
+
+//
+// Exceptions
+//
+
+// throw expr;
+//
+// Throwing a value unwinds the evaluation: statements following the throw are
+// skipped, and every enclosing CallExpression returns immediately (without a value)
+// to its caller, until the value is caught by the nearest enclosing TryExpression
+// with a catch arm. A value that is never caught aborts the program.
+type ThrowStatement struct {
+	Token token.Token	// The 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Lexeme }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// try { ... } catch (e) { ... } finally { ... }
+//
+// At least one of the catch and finally arms is present. The value of the expression
+// is the value of the try block, or if a value is thrown from it, the value of the
+// catch arm with the thrown value bound to the catch parameter. Without a catch arm
+// the thrown value continues to unwind after the finally arm.
+//
+// The finally arm always runs when control leaves the try block or catch arm: after a
+// normal completion, a throw or a return. Its value is discarded, unless it completes
+// abruptly itself (a throw or return in the finally arm replaces the pending one).
+type TryExpression struct {
+	Token token.Token		// The 'try' token
+	Body *BlockStatement
+	CatchParam *Identifier	// nil without a catch arm
+	Catch *BlockStatement	// nil without a catch arm
+	Finally *BlockStatement	// nil without a finally arm
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Lexeme }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.CatchParam.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+//
+// Type expressions (optional annotations)
+//
+
+// TypeExpr is the syntax of a type annotation. It is only ever found in annotation
+// positions (after ':' in let statements and function literals), never as a value.
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// int, bool, string, or any other named type
+type NamedType struct {
+	Token token.Token	// The token.IDENT token
+	Name string
+}
+
+func (nt *NamedType) typeNode() {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Lexeme }
+func (nt *NamedType) String() string { return nt.Name }
+
+// [int]
+type ArrayType struct {
+	Token token.Token	// The '[' token
+	Element TypeExpr
+}
+
+func (at *ArrayType) typeNode() {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Lexeme }
+func (at *ArrayType) String() string { return "[" + at.Element.String() + "]" }
+
+// {string: int}
+type HashType struct {
+	Token token.Token	// The '{' token
+	Key TypeExpr
+	Value TypeExpr
+}
+
+func (ht *HashType) typeNode() {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Lexeme }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// fn(int, bool) -> int
+type FunctionType struct {
+	Token token.Token	// The 'fn' token
+	Parameters []TypeExpr
+	Return TypeExpr
+}
+
+func (ft *FunctionType) typeNode() {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Lexeme }
+func (ft *FunctionType) String() string {
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + ft.Return.String()
+}
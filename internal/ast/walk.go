@@ -0,0 +1,129 @@
+package ast
+
+import "reflect"
+
+// Inspect traverses the AST in depth-first order (like go/ast.Inspect): it calls
+// f(node), and if f returns true, Inspect is called recursively for each of the
+// non-nil children of node.
+//
+// NOTE: Every identifier is visited, also those that are not variable references
+// (e.g. the name of a struct field).
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Inspect(s, f)
+		}
+	case *LetStatement:
+		Inspect(n.Name, f)
+		Inspect(n.Type, f)
+		Inspect(n.Value, f)
+	case *ReturnStatement:
+		Inspect(n.ReturnValue, f)
+	case *ExpressionStatement:
+		Inspect(n.Expression, f)
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Inspect(s, f)
+		}
+	case *PrefixExpression:
+		Inspect(n.Right, f)
+	case *InfixExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *IfExpression:
+		Inspect(n.Condition, f)
+		Inspect(n.IfArm, f)
+		Inspect(n.ElseArm, f)
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			Inspect(p, f)
+			Inspect(n.ParameterType(i), f)
+		}
+		Inspect(n.ReturnType, f)
+		Inspect(n.Body, f)
+	case *CallExpression:
+		Inspect(n.Function, f)
+		for _, a := range n.Arguments {
+			Inspect(a, f)
+		}
+	case *StructDeclaration:
+		Inspect(n.Name, f)
+		for _, field := range n.Fields {
+			Inspect(field.Name, f)
+			Inspect(field.Default, f)
+		}
+	case *StructLiteral:
+		Inspect(n.Name, f)
+		for _, field := range n.Fields {
+			Inspect(field.Name, f)
+			Inspect(field.Value, f)
+		}
+	case *EnumDeclaration:
+		Inspect(n.Name, f)
+		for _, v := range n.Variants {
+			Inspect(v.Name, f)
+			for _, field := range v.Fields {
+				Inspect(field, f)
+			}
+		}
+	case *LetCondition:
+		Inspect(n.Pattern, f)
+		Inspect(n.Value, f)
+	case *VariantPattern:
+		Inspect(n.Name, f)
+		for _, b := range n.Bindings {
+			Inspect(b, f)
+		}
+	case *ThrowStatement:
+		Inspect(n.Value, f)
+	case *TryExpression:
+		Inspect(n.Body, f)
+		Inspect(n.CatchParam, f)
+		Inspect(n.Catch, f)
+		Inspect(n.Finally, f)
+	case *FieldAccessExpression:
+		Inspect(n.Object, f)
+		Inspect(n.Field, f)
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			Inspect(e, f)
+		}
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			Inspect(pair.Key, f)
+			Inspect(pair.Value, f)
+		}
+	case *IndexExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Index, f)
+	case *SliceExpression:
+		Inspect(n.Left, f)
+		Inspect(n.Low, f)
+		Inspect(n.High, f)
+	case *ArrayType:
+		Inspect(n.Element, f)
+	case *HashType:
+		Inspect(n.Key, f)
+		Inspect(n.Value, f)
+	case *FunctionType:
+		for _, p := range n.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(n.Return, f)
+	}
+}
+
+// The parser leaves nil nodes behind on errors (and optional parts of a node are nil),
+// and a nil pointer stored in an interface is not == nil.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
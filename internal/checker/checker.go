@@ -0,0 +1,272 @@
+// Package checker implements the static checks that can be done right after
+// parsing, without knowing the types of expressions (see package types for that).
+package checker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem found at Pos in the source.
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Msg)
+}
+
+// HasErrors reports whether any of the diagnostics is an error (not just a warning).
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+type checker struct {
+	structs     map[string]*ast.StructDeclaration
+	enums       map[string]*ast.EnumDeclaration
+	variants    map[string]*ast.EnumDeclaration // variant name -> its enum
+	chained     map[*ast.IfExpression]bool      // else-if links already checked for exhaustiveness
+	diagnostics []Diagnostic
+}
+
+// Check returns the diagnostics found in program. Declarations are collected up front,
+// so a struct or enum can be used before it is declared.
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{
+		structs:  map[string]*ast.StructDeclaration{},
+		enums:    map[string]*ast.EnumDeclaration{},
+		variants: map[string]*ast.EnumDeclaration{},
+		chained:  map[*ast.IfExpression]bool{},
+	}
+	c.collectDeclarations(program)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.StructDeclaration:
+			c.checkStructDeclaration(node)
+		case *ast.StructLiteral:
+			c.checkStructLiteral(node)
+		case *ast.EnumDeclaration:
+			c.checkEnumDeclaration(node)
+		case *ast.LetCondition:
+			c.checkLetCondition(node)
+		case *ast.IfExpression:
+			c.checkExhaustiveness(node)
+		}
+		return true
+	})
+	return c.diagnostics
+}
+
+func (c *checker) errorf(pos token.Position, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Pos:      pos,
+		Severity: Error,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) warnf(pos token.Position, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Pos:      pos,
+		Severity: Warning,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) collectDeclarations(program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch decl := node.(type) {
+		case *ast.StructDeclaration:
+			if prev, ok := c.structs[decl.Name.Value]; ok {
+				c.errorf(decl.Name.Token.Pos, "struct %s redeclared (previous declaration at %s)",
+					decl.Name.Value, prev.Name.Token.Pos)
+				return true
+			}
+			c.structs[decl.Name.Value] = decl
+		case *ast.EnumDeclaration:
+			if prev, ok := c.enums[decl.Name.Value]; ok {
+				c.errorf(decl.Name.Token.Pos, "enum %s redeclared (previous declaration at %s)",
+					decl.Name.Value, prev.Name.Token.Pos)
+				return true
+			}
+			c.enums[decl.Name.Value] = decl
+			for _, v := range decl.Variants {
+				if prev, ok := c.variants[v.Name.Value]; ok && prev != decl {
+					c.errorf(v.Name.Token.Pos, "variant %s redeclared (previous declaration in enum %s)",
+						v.Name.Value, prev.Name.Value)
+					continue
+				}
+				c.variants[v.Name.Value] = decl
+			}
+		}
+		return true
+	})
+}
+
+//
+// Records (structs)
+//
+
+func (c *checker) checkStructDeclaration(decl *ast.StructDeclaration) {
+	seen := map[string]bool{}
+	for _, f := range decl.Fields {
+		if seen[f.Name.Value] {
+			c.errorf(f.Name.Token.Pos, "duplicate field %s in struct %s", f.Name.Value, decl.Name.Value)
+		}
+		seen[f.Name.Value] = true
+	}
+}
+
+func (c *checker) checkStructLiteral(lit *ast.StructLiteral) {
+	decl, ok := c.structs[lit.Name.Value]
+	if !ok {
+		c.errorf(lit.Token.Pos, "unknown struct %s", lit.Name.Value)
+		return
+	}
+
+	given := map[string]bool{}
+	for _, f := range lit.Fields {
+		name := f.Name.Value
+		switch {
+		case decl.Field(name) == nil:
+			c.errorf(f.Name.Token.Pos, "unknown field %s in struct %s", name, decl.Name.Value)
+		case given[name]:
+			c.errorf(f.Name.Token.Pos, "duplicate field %s in %s literal", name, decl.Name.Value)
+		}
+		given[name] = true
+	}
+
+	for _, f := range decl.Fields {
+		if !given[f.Name.Value] && f.Default == nil {
+			c.errorf(lit.Token.Pos, "missing field %s in %s literal", f.Name.Value, decl.Name.Value)
+		}
+	}
+}
+
+//
+// Tagged unions (enums)
+//
+
+func (c *checker) checkEnumDeclaration(decl *ast.EnumDeclaration) {
+	seen := map[string]bool{}
+	for _, v := range decl.Variants {
+		if seen[v.Name.Value] {
+			c.errorf(v.Name.Token.Pos, "duplicate variant %s in enum %s", v.Name.Value, decl.Name.Value)
+		}
+		seen[v.Name.Value] = true
+	}
+}
+
+func (c *checker) checkLetCondition(cond *ast.LetCondition) {
+	pattern := cond.Pattern
+	enum, ok := c.variants[pattern.Name.Value]
+	if !ok {
+		c.errorf(pattern.Token.Pos, "unknown variant %s", pattern.Name.Value)
+		return
+	}
+	// A pattern without parenthesis only tests the variant
+	variant := enum.Variant(pattern.Name.Value)
+	if pattern.Bindings != nil && len(pattern.Bindings) != len(variant.Fields) {
+		c.errorf(pattern.Token.Pos, "wrong number of fields in pattern %s: want=%d, got=%d",
+			pattern.Name.Value, len(variant.Fields), len(pattern.Bindings))
+	}
+}
+
+// checkExhaustiveness warns about a chain of
+//
+//	if (let A = x) { ... } else if (let B = x) { ... }
+//
+// over the same value that neither covers all variants of the enum nor ends in a
+// plain else arm.
+func (c *checker) checkExhaustiveness(ifx *ast.IfExpression) {
+	if c.chained[ifx] {
+		return // reported by the head of the chain
+	}
+	first, ok := ifx.Condition.(*ast.LetCondition)
+	if !ok {
+		return
+	}
+	enum, ok := c.variants[first.Pattern.Name.Value]
+	if !ok {
+		return
+	}
+	scrutinee := first.Value.String()
+
+	covered := map[string]bool{}
+	for link := ifx; ; {
+		cond := link.Condition.(*ast.LetCondition)
+		name := cond.Pattern.Name.Value
+		if c.variants[name] != enum {
+			c.errorf(cond.Pattern.Token.Pos, "variant %s is not a variant of enum %s", name, enum.Name.Value)
+			return
+		}
+		covered[name] = true
+
+		if link.ElseArm == nil {
+			break
+		}
+		next := elseIfLink(link, scrutinee)
+		if next == nil {
+			// An else arm that does not test the same value. If it is not a conditional
+			// we have a catch-all, otherwise we cannot tell.
+			return
+		}
+		c.chained[next] = true
+		link = next
+	}
+
+	missing := []string{}
+	for _, v := range enum.Variants {
+		if !covered[v.Name.Value] {
+			missing = append(missing, v.Name.Value)
+		}
+	}
+	if len(missing) > 0 {
+		c.warnf(ifx.Token.Pos, "non-exhaustive conditional over %s: missing %s",
+			enum.Name.Value, strings.Join(missing, ", "))
+	}
+}
+
+// elseIfLink returns the if expression of `else if (let ... = scrutinee)`, or nil.
+func elseIfLink(ifx *ast.IfExpression, scrutinee string) *ast.IfExpression {
+	if len(ifx.ElseArm.Statements) != 1 {
+		return nil
+	}
+	stmt, ok := ifx.ElseArm.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	next, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok || next == nil {
+		return nil
+	}
+	cond, ok := next.Condition.(*ast.LetCondition)
+	if !ok || cond == nil || cond.Value.String() != scrutinee {
+		return nil
+	}
+	return next
+}
@@ -0,0 +1,156 @@
+package checker
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/parser"
+)
+
+func TestStructChecks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"struct Point { x, y }; Point{x: 1, y: 2}", nil},
+		{"struct Point { x, y = 0 }; Point{x: 1}", nil},
+		{"let p = Point{x: 1, y: 2}; struct Point { x, y }", nil},
+		{
+			"struct Point { x, y }; Point{x: 1, z: 2}",
+			[]string{
+				"1:36: error: unknown field z in struct Point",
+				"1:24: error: missing field y in Point literal",
+			},
+		},
+		{
+			"struct Point { x, y = 0 }; Point{}",
+			[]string{"1:28: error: missing field x in Point literal"},
+		},
+		{
+			"struct Point { x }; Point{x: 1, x: 2}",
+			[]string{"1:33: error: duplicate field x in Point literal"},
+		},
+		{
+			"Point{x: 1}",
+			[]string{"1:1: error: unknown struct Point"},
+		},
+		{
+			"struct P { x, x }",
+			[]string{"1:15: error: duplicate field x in struct P"},
+		},
+		{
+			"struct P { x }\nstruct P { y }",
+			[]string{"2:8: error: struct P redeclared (previous declaration at 1:8)"},
+		},
+		{
+			"struct P { x }; let f = fn() { P{y: 1} };",
+			[]string{
+				"1:34: error: unknown field y in struct P",
+				"1:32: error: missing field x in P literal",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		diagnostics := Check(program)
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%d (%v)",
+				tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+		for i, want := range tt.expected {
+			if diagnostics[i].String() != want {
+				t.Errorf("diagnostics[%d] wrong for %q. want=%q, got=%q",
+					i, tt.input, want, diagnostics[i])
+			}
+		}
+	}
+}
+
+func TestEnumChecks(t *testing.T) {
+	shape := "enum Shape { Circle(r), Rect(w, h), Empty }\n"
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{shape + "if (let Circle(r) = s) { r } else if (let Rect(w, h) = s) { w * h } else if (let Empty = s) { 0 }", nil},
+		{shape + "if (let Circle(r) = s) { r } else { 0 }", nil},
+		{shape + "if (let Circle = s) { 1 } else if (let Rect(_, h) = s) { h } else { if (let Empty = s) { 0 } }", nil},
+		{
+			shape + "if (let Circle(r) = s) { r }",
+			[]string{"2:1: warning: non-exhaustive conditional over Shape: missing Rect, Empty"},
+		},
+		{
+			shape + "let area = fn(s) { if (let Circle(r) = s) { r } else if (let Rect(w, h) = s) { w * h } };",
+			[]string{"2:20: warning: non-exhaustive conditional over Shape: missing Empty"},
+		},
+		{
+			// the else arm tests another value, and starts a chain of its own
+			shape + "if (let Circle(r) = s) { r } else if (let Rect(w, h) = t) { w * h }",
+			[]string{"2:35: warning: non-exhaustive conditional over Shape: missing Circle, Empty"},
+		},
+		{
+			shape + "if (let Square(x) = s) { x }",
+			[]string{"2:9: error: unknown variant Square"},
+		},
+		{
+			shape + "if (let Rect(w) = s) { w } else { 0 }",
+			[]string{"2:9: error: wrong number of fields in pattern Rect: want=2, got=1"},
+		},
+		{
+			shape + "enum Color { Red, Green }\nif (let Circle(r) = s) { r } else if (let Red = s) { 0 } else { 1 }",
+			[]string{"3:43: error: variant Red is not a variant of enum Shape"},
+		},
+		{
+			"enum E { A, B, A }",
+			[]string{"1:16: error: duplicate variant A in enum E"},
+		},
+		{
+			shape + "enum Other { Circle }",
+			[]string{"2:14: error: variant Circle redeclared (previous declaration in enum Shape)"},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		diagnostics := Check(program)
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%d (%v)",
+				tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+		for i, want := range tt.expected {
+			if diagnostics[i].String() != want {
+				t.Errorf("diagnostics[%d] wrong for %q. want=%q, got=%q",
+					i, tt.input, want, diagnostics[i])
+			}
+		}
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	if HasErrors(nil) {
+		t.Errorf("HasErrors(nil) should be false")
+	}
+	if HasErrors([]Diagnostic{{Severity: Warning}}) {
+		t.Errorf("a warning is not an error")
+	}
+	if !HasErrors([]Diagnostic{{Severity: Warning}, {Severity: Error}}) {
+		t.Errorf("HasErrors should find the error")
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
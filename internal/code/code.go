@@ -0,0 +1,310 @@
+// Package code defines the bytecode instructions executed by package vm.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Instructions is a sequence of encoded instructions: an opcode byte followed by
+// its operands (big endian).
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// Arithmetic and comparison (pop two operands, push the result)
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	// Prefix operators
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpCurrentClosure
+
+	OpClosure
+	OpCall
+	OpTailCall
+	OpReturnValue
+
+	// Records (structs)
+	OpStructDef
+	OpStruct
+	OpInitField
+	OpEndStruct
+	OpGetField
+
+	// Tagged unions (enums)
+	OpMatchVariant
+
+	// Exceptions
+	OpThrow
+	OpPushHandler
+	OpPopHandler
+	OpCaught
+
+	// Sequences (pop the operands, push the element or the slice)
+	OpIndex
+	OpSlice
+	OpArray
+	OpHash
+)
+
+// Definition describes an opcode: its name (used in listings) and the number of
+// bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	// the operand is the index of the constant
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	// the operand is the absolute offset of the target instruction
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	// the operands are the constant index of the function and the number of free
+	// variables (on the stack)
+	OpClosure: {"OpClosure", []int{2, 1}},
+	// the operand is the number of arguments. The callee of OpTailCall (a call whose
+	// value is returned) replaces the frame of the caller.
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	// the operand is the constant index of the struct definition (a template without
+	// the initializers of the default fields, which are on the stack)
+	OpStructDef: {"OpStructDef", []int{2}},
+	// starts a struct literal of the definition on top of the stack
+	OpStruct: {"OpStruct", []int{}},
+	// the operand is the index of the field name (see Bytecode.Names)
+	OpInitField: {"OpInitField", []int{2}},
+	// completes the struct literal (checks missing fields and applies defaults)
+	OpEndStruct: {"OpEndStruct", []int{}},
+	OpGetField:  {"OpGetField", []int{2}},
+
+	// the operands are the name index of the variant and the number of bindings of
+	// the pattern (NoBindings for a pattern without parenthesis)
+	OpMatchVariant: {"OpMatchVariant", []int{2, 1}},
+
+	OpThrow: {"OpThrow", []int{}},
+	// the operand is the absolute offset of the handler
+	OpPushHandler: {"OpPushHandler", []int{2}},
+	OpPopHandler:  {"OpPopHandler", []int{}},
+	// replaces the caught error on top of the stack by the thrown value (if any)
+	OpCaught: {"OpCaught", []int{}},
+
+	// the operands are the sequence and the index
+	OpIndex: {"OpIndex", []int{}},
+	// the operands are the sequence and the bounds (null when omitted)
+	OpSlice: {"OpSlice", []int{}},
+	// the operand is the number of elements (on the stack)
+	OpArray: {"OpArray", []int{2}},
+	// the operand is the number of keys and values (on the stack, alternating)
+	OpHash: {"OpHash", []int{2}},
+}
+
+// NoBindings is the binding count operand of OpMatchVariant for a pattern without
+// parenthesis (it tests the variant without binding its fields).
+const NoBindings = 255
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// MaxOperand is the largest operand of the given width
+func MaxOperand(width int) int {
+	return 1<<(8*uint(width)) - 1
+}
+
+// Make encodes an instruction. It returns an empty slice for an unknown opcode, and
+// panics on an operand that does not fit its width: the compiler checks the operands
+// of the program it compiles (see compiler.Error).
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		if o < 0 || o > MaxOperand(width) {
+			panic(fmt.Sprintf("code.Make: operand %d of %s out of range [0, %d]", o, def.Name, MaxOperand(width)))
+		}
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction of def from ins, and returns
+// them with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// SourcePos records that the instructions from Offset (up to the next entry) were
+// compiled from Node, at Pos in the source. Node is nil when the bytecode was not
+// compiled from an AST (e.g. loaded from a file).
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+	Node   ast.Node
+}
+
+// SourceMap maps instruction offsets back to the source. Entries are ordered by offset.
+type SourceMap []SourcePos
+
+// Lookup returns the position of the source the instruction at offset was compiled
+// from (an invalid position if it is unknown).
+func (sm SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return sm[i-1].Pos
+}
+
+// LookupNode returns the node the instruction at offset was compiled from (or nil)
+func (sm SourceMap) LookupNode(offset int) ast.Node {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return nil
+	}
+	return sm[i-1].Node
+}
@@ -0,0 +1,919 @@
+// Package compiler lowers a Monkey program to the bytecode executed by package vm.
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Bytecode is the output of the compiler: the instructions of the program (outside
+// any function), the constants pool referenced by OpConstant and OpClosure, and the
+// names (of fields and variants) referenced by OpInitField, OpGetField and
+// OpMatchVariant.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	Names        []string
+	SourceMap    code.SourceMap
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// tryEntry is a try expression whose handler is active while compiling
+type tryEntry struct {
+	finally *ast.BlockStatement // nil for the handler of a catch arm
+}
+
+// CompilationScope holds the instructions of the function being compiled (or of the
+// program)
+type CompilationScope struct {
+	instructions        code.Instructions
+	sourceMap           code.SourceMap
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	tries               []tryEntry
+}
+
+type Compiler struct {
+	constants []object.Object
+	names     []string
+	nameIndex map[string]int
+
+	symbolTable *SymbolTable
+	undefined   map[int]bool // the globals of top-level lets not compiled yet
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	node ast.Node       // being compiled
+	pos  token.Position // of the node being compiled
+	err  error          // the first operand that does not fit its instruction
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:   []object.Object{},
+		nameIndex:   map[string]int{},
+		symbolTable: NewSymbolTable(),
+		undefined:   map[int]bool{},
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+	}
+}
+
+// NewWithState returns a compiler that continues where a previous one stopped (in
+// a REPL): it shares the symbol table, constants and names.
+func NewWithState(s *SymbolTable, constants []object.Object, names []string) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	compiler.names = names
+	for i, name := range names {
+		compiler.nameIndex[name] = i
+	}
+	return compiler
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Names:        c.names,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+	}
+}
+
+// SymbolTable is the table of the global scope (and the blocks of the program)
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Error is an error of the program detected by the compiler (e.g. an undefined name,
+// or more locals than an instruction can address)
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+func (c *Compiler) errorf(pos token.Position, format string, a ...interface{}) error {
+	return &Error{Pos: pos, Message: fmt.Sprintf(format, a...)}
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	defer func() {
+		if err == nil {
+			err = c.err
+		}
+	}()
+	if pos := nodePos(node); pos.IsValid() {
+		savedNode, savedPos := c.node, c.pos
+		c.node, c.pos = node, pos
+		defer func() { c.node, c.pos = savedNode, savedPos }()
+	}
+
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		c.declareGlobals(node)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// A function literal can refer to itself (let-rec), so the name is defined
+		// before the literal is compiled. Other values see the previous binding.
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			symbol := c.define(node.Name.Value)
+			if err := c.compileFunctionLiteral(fn, node.Name.Value); err != nil {
+				return err
+			}
+			c.setSymbol(symbol)
+			break
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.setSymbol(c.define(node.Name.Value))
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTries(); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.StructDeclaration:
+		return c.compileStructDeclaration(node)
+
+	case *ast.EnumDeclaration:
+		c.compileEnumDeclaration(node)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(object.IntegerLiteral(node)))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(object.FloatLiteral(node)))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.RegexLiteral:
+		// compiled once, and shared by the runs: a *regexp.Regexp is safe for concurrent use
+		re, err := object.RegexLiteral(node)
+		if err != nil {
+			return c.errorf(node.Token.Pos, "invalid regex %s: %s", node, err)
+		}
+		c.emit(code.OpConstant, c.addConstant(re))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok || c.scopeIndex == 0 && symbol.Scope == GlobalScope && c.undefined[symbol.Index] {
+			return c.errorf(node.Token.Pos, "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return c.errorf(node.Token.Pos, "unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.StructLiteral:
+		return c.compileStructLiteral(node)
+
+	case *ast.FieldAccessExpression:
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+		c.emitAt(node.Field.Token.Pos, code.OpGetField, c.addName(node.Field.Value))
+
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			if err := c.Compile(e); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, 2*len(node.Pairs))
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+			} else if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	default:
+		return c.errorf(c.pos, "cannot compile %T", node)
+	}
+
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+}
+
+// compileBlockValue compiles a block used as an expression (an arm or a body): it
+// leaves the value of its last expression statement on the stack, or null.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	n := len(block.Statements)
+	if n > 0 {
+		if _, ok := block.Statements[n-1].(*ast.ExpressionStatement); ok && c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+			return nil
+		}
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	var jumpNotTruthyPos int
+
+	if cond, ok := node.Condition.(*ast.LetCondition); ok {
+		// if (let Circle(r) = s): the arm binds the fields in a block scope of its own
+		if err := c.Compile(cond.Value); err != nil {
+			return err
+		}
+		pattern := cond.Pattern
+		bindings := code.NoBindings
+		if pattern.Bindings != nil {
+			bindings = len(pattern.Bindings)
+		}
+		c.emitAt(pattern.Token.Pos, code.OpMatchVariant, c.addName(pattern.Name.Value), bindings)
+		jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		for i := len(pattern.Bindings) - 1; i >= 0; i-- {
+			if b := pattern.Bindings[i]; b.Value == "_" {
+				c.emit(code.OpPop)
+			} else {
+				c.setSymbol(c.symbolTable.Define(b.Value))
+			}
+		}
+		err := c.compileBlockValue(node.IfArm)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockValue(node.IfArm); err != nil {
+			return err
+		}
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.ElseArm == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.ElseArm); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFunctionLiteral compiles the literal to a closure. A non-empty name is the
+// name the closure is bound to, and can be used in the body to call itself.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.compileBlockValue(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	c.leaveFunctionScope(len(node.Parameters), name)
+	return nil
+}
+
+// leaveFunctionScope ends the function started by enterScope and emits the
+// instructions building the closure.
+func (c *Compiler) leaveFunctionScope(numParameters int, name string) *object.CompiledFunction {
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+	markTailCalls(instructions)
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: numParameters,
+		Name:          name,
+		SourceMap:     sourceMap,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+	return fn
+}
+
+// markTailCalls replaces the calls of a function whose value is returned (the next
+// instruction, after following jumps, is OpReturnValue) with tail calls. No handler of
+// the function is active at an OpReturnValue, as a return statement leaves the try
+// expressions first.
+func markTailCalls(ins code.Instructions) {
+	for offset := 0; offset < len(ins); {
+		def, _ := code.Lookup(ins[offset])
+		_, read := code.ReadOperands(def, ins[offset+1:])
+		next := offset + 1 + read
+
+		if code.Opcode(ins[offset]) == code.OpCall {
+			target := next
+			for target < len(ins) && code.Opcode(ins[target]) == code.OpJump {
+				target = int(code.ReadUint16(ins[target+1:]))
+			}
+			if target < len(ins) && code.Opcode(ins[target]) == code.OpReturnValue {
+				ins[offset] = byte(code.OpTailCall)
+			}
+		}
+		offset = next
+	}
+}
+
+//
+// Records (structs)
+//
+
+// compileStructDeclaration binds the name of the struct to a definition built from a
+// template constant and the initializers of the fields with a default: closures
+// without parameters returning the default, so that it is evaluated (in the scope of
+// the declaration) for every literal that omits the field.
+func (c *Compiler) compileStructDeclaration(node *ast.StructDeclaration) error {
+	template := &object.StructDef{
+		Name:         node.Name.Value,
+		Initializers: map[string]*object.Closure{},
+	}
+	for _, f := range node.Fields {
+		template.Fields = append(template.Fields, f.Name.Value)
+		if f.Default == nil {
+			continue
+		}
+		// the template only records which fields have an initializer (on the stack)
+		template.Initializers[f.Name.Value] = nil
+
+		c.enterScope()
+		if err := c.Compile(f.Default); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		c.leaveFunctionScope(0, node.Name.Value+"."+f.Name.Value)
+	}
+
+	c.emit(code.OpStructDef, c.addConstant(template))
+	c.setSymbol(c.symbolTable.Define(node.Name.Value))
+	return nil
+}
+
+func (c *Compiler) compileStructLiteral(node *ast.StructLiteral) error {
+	symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+	if !ok {
+		return c.errorf(node.Token.Pos, "unknown struct %s", node.Name.Value)
+	}
+	c.loadSymbol(symbol)
+	c.emit(code.OpStruct)
+
+	for _, f := range node.Fields {
+		if err := c.Compile(f.Value); err != nil {
+			return err
+		}
+		c.emitAt(f.Name.Token.Pos, code.OpInitField, c.addName(f.Name.Value))
+	}
+
+	c.emit(code.OpEndStruct)
+	return nil
+}
+
+//
+// Tagged unions (enums)
+//
+
+// compileEnumDeclaration binds every variant name to a constructor (or, for variants
+// without fields, to the only value of the variant).
+func (c *Compiler) compileEnumDeclaration(node *ast.EnumDeclaration) {
+	for _, v := range node.Variants {
+		var value object.Object
+		if len(v.Fields) == 0 {
+			value = &object.Variant{Enum: node.Name.Value, Name: v.Name.Value}
+		} else {
+			constructor := &object.Constructor{Enum: node.Name.Value, Name: v.Name.Value}
+			for _, f := range v.Fields {
+				constructor.Fields = append(constructor.Fields, f.Value)
+			}
+			value = constructor
+		}
+		c.emit(code.OpConstant, c.addConstant(value))
+		c.setSymbol(c.symbolTable.Define(v.Name.Value))
+	}
+}
+
+//
+// Exceptions
+//
+
+// compileTryExpression compiles
+//
+//	try { body } catch (e) { arm } finally { fin }
+//
+// to
+//
+//	      OpPushHandler FIN
+//	      OpPushHandler CATCH
+//	      <body>
+//	      OpPopHandler
+//	      OpJump DONE
+//	CATCH OpCaught             (the VM pushes the error and pops the handler)
+//	      <bind e>
+//	      <arm>
+//	DONE  OpPopHandler
+//	      <fin> OpPop
+//	      OpJump END
+//	FIN   <fin> OpPop          (the VM pushes the error and pops the handler)
+//	      OpThrow
+//	END
+//
+// A return leaving the body or the arm pops the handlers itself and runs the
+// finally arm before returning (see leaveTries).
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	var finallyHandlerPos int
+	if node.Finally != nil {
+		finallyHandlerPos = c.emit(code.OpPushHandler, 9999)
+		c.pushTry(node.Finally)
+	}
+
+	if node.Catch != nil {
+		catchHandlerPos := c.emit(code.OpPushHandler, 9999)
+		c.pushTry(nil)
+		err := c.compileBlockValue(node.Body)
+		c.popTry()
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPopHandler)
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(catchHandlerPos, len(c.currentInstructions()))
+		c.emit(code.OpCaught)
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		c.setSymbol(c.symbolTable.Define(node.CatchParam.Value))
+		err = c.compileBlockValue(node.Catch)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	} else if err := c.compileBlockValue(node.Body); err != nil {
+		return err
+	}
+
+	if node.Finally == nil {
+		return nil
+	}
+	c.popTry()
+
+	c.emit(code.OpPopHandler)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(finallyHandlerPos, len(c.currentInstructions()))
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFinally compiles a finally arm, discarding its value
+func (c *Compiler) compileFinally(block *ast.BlockStatement) error {
+	if err := c.compileBlockValue(block); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+func (c *Compiler) pushTry(finally *ast.BlockStatement) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, tryEntry{finally: finally})
+}
+
+func (c *Compiler) popTry() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+// leaveTries emits the instructions that leave the active try expressions of the
+// function before a return: it pops their handlers, running the finally arms on the
+// way (with only the try expressions enclosing the arm still active).
+func (c *Compiler) leaveTries() error {
+	scope := &c.scopes[c.scopeIndex]
+	tries := scope.tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= 0; i-- {
+		c.emit(code.OpPopHandler)
+		if tries[i].finally == nil {
+			continue
+		}
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		if err := c.compileFinally(tries[i].finally); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+// Helpers
+//
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) addName(name string) int {
+	if i, ok := c.nameIndex[name]; ok {
+		return i
+	}
+	c.names = append(c.names, name)
+	c.nameIndex[name] = len(c.names) - 1
+	return len(c.names) - 1
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// declareGlobals defines the names of the top-level lets of the program up front, so
+// that a function can refer to a global defined after it (mutual recursion). A name
+// stays undefined for the top-level code until its let has been compiled.
+func (c *Compiler) declareGlobals(program *ast.Program) {
+	for _, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if _, ok := c.symbolTable.store[let.Name.Value]; !ok {
+			c.undefined[c.symbolTable.Define(let.Name.Value).Index] = true
+		}
+	}
+}
+
+// define binds name in the current table for a let statement
+func (c *Compiler) define(name string) Symbol {
+	symbol := c.symbolTable.Define(name)
+	if symbol.Scope == GlobalScope {
+		delete(c.undefined, symbol.Index)
+	}
+	return symbol
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// emit appends an instruction to the current scope and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	return c.emitAt(c.pos, op, operands...)
+}
+
+// emitAt emits an instruction compiled from the source at pos
+func (c *Compiler) emitAt(pos token.Position, op code.Opcode, operands ...int) int {
+	ins := code.Make(op, c.checkOperands(pos, op, operands)...)
+	scope := &c.scopes[c.scopeIndex]
+
+	posNewInstruction := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	if n := len(scope.sourceMap); n == 0 || scope.sourceMap[n-1].Pos != pos || scope.sourceMap[n-1].Node != c.node {
+		scope.sourceMap = append(scope.sourceMap, code.SourcePos{Offset: posNewInstruction, Pos: pos, Node: c.node})
+	}
+
+	c.setLastInstruction(op, posNewInstruction)
+
+	return posNewInstruction
+}
+
+// The limits of the program set by the widths of the operands, by opcode and operand
+var operandLimits = map[code.Opcode][]string{
+	code.OpConstant:      {"too many constants"},
+	code.OpClosure:       {"too many constants", "too many free variables"},
+	code.OpStructDef:     {"too many constants"},
+	code.OpGetGlobal:     {"too many global variables"},
+	code.OpSetGlobal:     {"too many global variables"},
+	code.OpGetLocal:      {"too many local variables"},
+	code.OpSetLocal:      {"too many local variables"},
+	code.OpGetFree:       {"too many free variables"},
+	code.OpCall:          {"too many arguments"},
+	code.OpTailCall:      {"too many arguments"},
+	code.OpArray:         {"too many elements in array literal"},
+	code.OpHash:          {"too many pairs in hash literal"},
+	code.OpInitField:     {"too many field names"},
+	code.OpGetField:      {"too many field names"},
+	code.OpMatchVariant:  {"too many variant names", "too many bindings"},
+	code.OpJump:          {"code too long"},
+	code.OpJumpNotTruthy: {"code too long"},
+	code.OpPushHandler:   {"code too long"},
+}
+
+// checkOperands returns the operands of an instruction, or, if one does not fit its
+// width, records the error (returned by Compile) and returns operands that do.
+func (c *Compiler) checkOperands(pos token.Position, op code.Opcode, operands []int) []int {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return operands
+	}
+	for i, o := range operands {
+		max := code.MaxOperand(def.OperandWidths[i])
+		if op == code.OpMatchVariant && i == 1 && o != code.NoBindings {
+			max = code.NoBindings - 1
+		}
+		if o <= max {
+			continue
+		}
+		if c.err == nil {
+			limit := "operand out of range"
+			if limits := operandLimits[op]; i < len(limits) {
+				limit = limits[i]
+			}
+			c.err = c.errorf(pos, "%s (the limit is %d)", limit, max+1)
+		}
+		return make([]int, len(operands))
+	}
+	return operands
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	last := scope.lastInstruction
+
+	scope.instructions = scope.instructions[:last.Position]
+	for n := len(scope.sourceMap); n > 0 && scope.sourceMap[n-1].Offset >= last.Position; n-- {
+		scope.sourceMap = scope.sourceMap[:n-1]
+	}
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, c.checkOperands(c.pos, op, []int{operand})...)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{instructions: code.Instructions{}}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// nodePos returns the position of the token of node
+func nodePos(node ast.Node) token.Position {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token.Pos
+	case *ast.ReturnStatement:
+		return node.Token.Pos
+	case *ast.ExpressionStatement:
+		return node.Token.Pos
+	case *ast.BlockStatement:
+		return node.Token.Pos
+	case *ast.StructDeclaration:
+		return node.Token.Pos
+	case *ast.EnumDeclaration:
+		return node.Token.Pos
+	case *ast.ThrowStatement:
+		return node.Token.Pos
+	case *ast.Identifier:
+		return node.Token.Pos
+	case *ast.IntegerLiteral:
+		return node.Token.Pos
+	case *ast.FloatLiteral:
+		return node.Token.Pos
+	case *ast.StringLiteral:
+		return node.Token.Pos
+	case *ast.RegexLiteral:
+		return node.Token.Pos
+	case *ast.ArrayLiteral:
+		return node.Token.Pos
+	case *ast.HashLiteral:
+		return node.Token.Pos
+	case *ast.Boolean:
+		return node.Token.Pos
+	case *ast.PrefixExpression:
+		return node.Token.Pos
+	case *ast.InfixExpression:
+		return node.Token.Pos
+	case *ast.IfExpression:
+		return node.Token.Pos
+	case *ast.FunctionLiteral:
+		return node.Token.Pos
+	case *ast.CallExpression:
+		return node.Token.Pos
+	case *ast.StructLiteral:
+		return node.Token.Pos
+	case *ast.FieldAccessExpression:
+		return node.Token.Pos
+	case *ast.IndexExpression:
+		return node.Token.Pos
+	case *ast.SliceExpression:
+		return node.Token.Pos
+	case *ast.TryExpression:
+		return node.Token.Pos
+	}
+	return token.Position{}
+}
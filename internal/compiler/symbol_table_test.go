@@ -0,0 +1,118 @@
+package compiler
+
+import "testing"
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	tests := []struct {
+		table               *SymbolTable
+		expectedSymbols     []Symbol
+		expectedFreeSymbols []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+			[]Symbol{},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: FreeScope, Index: 0},
+				{Name: "e", Scope: LocalScope, Index: 0},
+			},
+			[]Symbol{
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+
+		if len(tt.table.FreeSymbols) != len(tt.expectedFreeSymbols) {
+			t.Errorf("wrong number of free symbols. got=%d, want=%d",
+				len(tt.table.FreeSymbols), len(tt.expectedFreeSymbols))
+			continue
+		}
+		for i, sym := range tt.expectedFreeSymbols {
+			if result := tt.table.FreeSymbols[i]; result != sym {
+				t.Errorf("wrong free symbol. got=%+v, want=%+v", result, sym)
+			}
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	// a block of the program allocates globals
+	block := NewBlockSymbolTable(global)
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 1}
+	if result := block.Define("a"); result != expected {
+		t.Errorf("expected a to be %+v, got=%+v", expected, result)
+	}
+	if result, _ := global.Resolve("a"); result.Index != 0 {
+		t.Errorf("block binding leaked into the enclosing scope: %+v", result)
+	}
+	if global.NumDefinitions() != 2 {
+		t.Errorf("wrong number of definitions. got=%d, want=2", global.NumDefinitions())
+	}
+
+	// a block of a function allocates locals of the function, and names of the
+	// function are not free in the block
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+	localBlock := NewBlockSymbolTable(local)
+	expected = Symbol{Name: "c", Scope: LocalScope, Index: 1}
+	if result := localBlock.Define("c"); result != expected {
+		t.Errorf("expected c to be %+v, got=%+v", expected, result)
+	}
+	expected = Symbol{Name: "b", Scope: LocalScope, Index: 0}
+	if result, _ := localBlock.Resolve("b"); result != expected {
+		t.Errorf("expected b to resolve to %+v, got=%+v", expected, result)
+	}
+	if local.NumDefinitions() != 2 {
+		t.Errorf("wrong number of locals. got=%d, want=2", local.NumDefinitions())
+	}
+
+	// a function in the block captures the locals of the block
+	inner := NewEnclosedSymbolTable(localBlock)
+	expected = Symbol{Name: "c", Scope: FreeScope, Index: 0}
+	if result, _ := inner.Resolve("c"); result != expected {
+		t.Errorf("expected c to resolve to %+v, got=%+v", expected, result)
+	}
+	if inner.FreeSymbols[0] != (Symbol{Name: "c", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong free symbol: %+v", inner.FreeSymbols[0])
+	}
+}
+
+func TestRedefine(t *testing.T) {
+	global := NewSymbolTable()
+	first := global.Define("a")
+	second := global.Define("a")
+	if first != second || global.NumDefinitions() != 1 {
+		t.Errorf("redefinition does not reuse the slot: %+v, %+v", first, second)
+	}
+}
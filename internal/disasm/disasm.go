@@ -0,0 +1,169 @@
+// Package disasm prints human-readable listings of compiled Monkey programs.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// maxSourceLen is the length the source of a node is cut to in listings
+const maxSourceLen = 60
+
+// Disassemble writes the listing of the program and of every function in its
+// constants pool to w. Each listing is preceded by a header line, and each run of
+// instructions compiled from the same AST node by a line with the position and the
+// source of the node:
+//
+//	main:
+//	; 1:9 1
+//	  0000  OpConstant 0             ; 1
+//	; 1:1 let x = 1;
+//	  0003  OpSetGlobal 0
+func Disassemble(w io.Writer, bytecode *compiler.Bytecode) error {
+	d := &disassembler{bytecode: bytecode}
+
+	d.function("main", bytecode.Instructions, bytecode.SourceMap)
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		d.out.WriteString("\n")
+		header := fmt.Sprintf("fn %s (constant %d, %d parameters, %d locals)",
+			functionName(fn), i, fn.NumParameters, fn.NumLocals)
+		d.function(header, fn.Instructions, fn.SourceMap)
+	}
+
+	_, err := w.Write(d.out.Bytes())
+	return err
+}
+
+// String returns the listing of the program (see Disassemble)
+func String(bytecode *compiler.Bytecode) string {
+	var out bytes.Buffer
+	Disassemble(&out, bytecode)
+	return out.String()
+}
+
+type disassembler struct {
+	bytecode *compiler.Bytecode
+	out      bytes.Buffer
+	pos      token.Position // of the last source line written
+}
+
+func (d *disassembler) function(header string, ins code.Instructions, sm code.SourceMap) {
+	d.out.WriteString(header + ":\n")
+	d.pos = token.Position{}
+
+	entry := 0
+	for offset := 0; offset < len(ins); {
+		for entry < len(sm) && sm[entry].Offset <= offset {
+			d.source(sm[entry])
+			entry++
+		}
+
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			fmt.Fprintf(&d.out, "  %04d  ERROR: %s\n", offset, err)
+			offset++
+			continue
+		}
+		if offset+1+operandsWidth(def) > len(ins) {
+			fmt.Fprintf(&d.out, "  %04d  ERROR: truncated %s\n", offset, def.Name)
+			break
+		}
+
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		line := def.Name
+		for _, o := range operands {
+			line += fmt.Sprintf(" %d", o)
+		}
+		if comment := d.comment(code.Opcode(ins[offset]), operands); comment != "" {
+			line = fmt.Sprintf("%-24s ; %s", line, comment)
+		}
+		fmt.Fprintf(&d.out, "  %04d  %s\n", offset, line)
+
+		offset += 1 + read
+	}
+}
+
+// source writes the line mapping the following instructions back to the source. Without
+// the AST (a loaded program) only changes of the position are written.
+func (d *disassembler) source(sp code.SourcePos) {
+	if sp.Node == nil {
+		if sp.Pos != d.pos {
+			fmt.Fprintf(&d.out, "; %s\n", sp.Pos)
+		}
+		d.pos = sp.Pos
+		return
+	}
+	d.pos = sp.Pos
+	src := strings.Join(strings.Fields(sp.Node.String()), " ")
+	if len(src) > maxSourceLen {
+		src = src[:maxSourceLen-3] + "..."
+	}
+	fmt.Fprintf(&d.out, "; %s %s\n", sp.Pos, src)
+}
+
+// comment decodes the operands referring to the constants pool or the names
+func (d *disassembler) comment(op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant:
+		return d.constant(operands[0])
+	case code.OpClosure:
+		return fmt.Sprintf("%s, %d free", d.constant(operands[0]), operands[1])
+	case code.OpStructDef:
+		return d.constant(operands[0])
+	case code.OpInitField, code.OpGetField:
+		return d.name(operands[0])
+	case code.OpMatchVariant:
+		if operands[1] == code.NoBindings {
+			return d.name(operands[0]) + ", no bindings"
+		}
+		return fmt.Sprintf("%s, %d bindings", d.name(operands[0]), operands[1])
+	}
+	return ""
+}
+
+func (d *disassembler) constant(index int) string {
+	if index >= len(d.bytecode.Constants) {
+		return "invalid constant"
+	}
+	switch c := d.bytecode.Constants[index].(type) {
+	case *object.CompiledFunction:
+		return "fn " + functionName(c)
+	case *object.Constructor:
+		return "constructor " + c.Inspect()
+	default:
+		return c.Inspect()
+	}
+}
+
+func (d *disassembler) name(index int) string {
+	if index >= len(d.bytecode.Names) {
+		return "invalid name"
+	}
+	return d.bytecode.Names[index]
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+func operandsWidth(def *code.Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
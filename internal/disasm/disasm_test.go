@@ -0,0 +1,119 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let x = 1;
+let f = fn(a) {
+  a + x
+};
+struct P { y = 2 }
+P{}.y + f(3)`
+
+	expected := `main:
+; 1:9 1
+  0000  OpConstant 0             ; 1
+; 1:1 let x = 1;
+  0003  OpSetGlobal 0
+; 2:1 let f = fn(a) { (a + x) };
+  0006  OpClosure 1 0            ; fn f, 0 free
+  0010  OpSetGlobal 1
+; 5:1 struct P { y = 2 }
+  0013  OpClosure 3 0            ; fn P.y, 0 free
+  0017  OpStructDef 4            ; struct P
+  0020  OpSetGlobal 2
+; 6:1 P{}
+  0023  OpGetGlobal 2
+  0026  OpStruct
+  0027  OpEndStruct
+; 6:5 P{}.y
+  0028  OpGetField 0             ; y
+; 6:9 f
+  0031  OpGetGlobal 1
+; 6:11 3
+  0034  OpConstant 5             ; 3
+; 6:10 f(3)
+  0037  OpCall 1
+; 6:7 (P{}.y + f(3))
+  0039  OpAdd
+; 6:1 (P{}.y + f(3))
+  0040  OpPop
+
+fn f (constant 1, 1 parameters, 1 locals):
+; 3:3 a
+  0000  OpGetLocal 0
+; 3:7 x
+  0002  OpGetGlobal 0
+; 3:5 (a + x)
+  0005  OpAdd
+; 2:1 let f = fn(a) { (a + x) };
+  0006  OpReturnValue
+
+fn P.y (constant 3, 0 parameters, 0 locals):
+; 5:16 2
+  0000  OpConstant 2             ; 2
+; 5:1 struct P { y = 2 }
+  0003  OpReturnValue
+`
+
+	actual := String(compile(t, input))
+	if actual != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func TestDisassembleEnums(t *testing.T) {
+	input := `enum Shape { Circle(r), Empty }
+let e = Empty;
+if (let Circle(r) = e) { r } else { 0 }`
+
+	actual := String(compile(t, input))
+	for _, want := range []string{
+		"OpMatchVariant 0 1       ; Circle, 1 bindings",
+		"OpConstant 0             ; constructor Shape.Circle(r)",
+	} {
+		if !strings.Contains(actual, want) {
+			t.Errorf("listing does not contain %q:\n%s", want, actual)
+		}
+	}
+}
+
+func TestDisassembleMalformed(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: append(code.Make(code.OpConstant, 7), 0xfe, byte(code.OpJump), 0),
+		Constants:    []object.Object{},
+	}
+
+	expected := `main:
+  0000  OpConstant 7             ; invalid constant
+  0003  ERROR: opcode 254 undefined
+  0004  ERROR: truncated OpJump
+`
+	actual := String(bytecode)
+	if actual != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
@@ -0,0 +1,710 @@
+// Package evaluator implements a tree-walking interpreter for Monkey programs.
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// There is only ever one null, true and false value
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+// Eval evaluates node in env. Errors (also uncaught thrown values) are returned as
+// *object.Error values.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	case *ast.ReturnStatement:
+		// the value is in tail position (see tailCall)
+		val := evalTail(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.StructDeclaration:
+		evalStructDeclaration(node, env)
+
+	case *ast.EnumDeclaration:
+		evalEnumDeclaration(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.Error{
+			Message: "uncaught exception: " + val.Inspect(),
+			Pos:     node.Token.Pos,
+			Thrown:  val,
+		}
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return object.IntegerLiteral(node)
+	case *ast.FloatLiteral:
+		return object.FloatLiteral(node)
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.RegexLiteral:
+		re, err := object.RegexLiteral(node)
+		if err != nil {
+			return newError(node.Token.Pos, "invalid regex %s: %s", node, err)
+		}
+		return re
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node, right)
+
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node, left, right)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env, evalBlockStatement)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(node, function, args)
+
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
+
+	case *ast.FieldAccessExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalFieldAccess(node, obj)
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		result, err := object.Index(left, index)
+		if err != nil {
+			return newError(node.Token.Pos, "%s", err)
+		}
+		return result
+
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	}
+
+	return nil
+}
+
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return completeTailCall(result.Value)
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// Unlike evalProgram, a block does not unwrap return values (or stop errors). They
+// have to bubble up to the function call (or the program).
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL // empty block, or a block ending in a let statement
+	}
+	return result
+}
+
+// evalTailBlock evaluates a block in tail position: the value of its last expression
+// statement is the value of the enclosing function.
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for i, statement := range block.Statements {
+		if es, ok := statement.(*ast.ExpressionStatement); ok && i == len(block.Statements)-1 {
+			result = evalTail(es.Expression, env)
+		} else {
+			result = Eval(statement, env)
+		}
+
+		if isAbrupt(result) {
+			return result
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	return newError(node.Token.Pos, "identifier not found: "+node.Value)
+}
+
+func evalPrefixExpression(node *ast.PrefixExpression, right object.Object) object.Object {
+	switch node.Operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		if !object.IsNumber(right) {
+			return newError(node.Token.Pos, "unknown operator: -%s", right.Type())
+		}
+		return object.Negate(right)
+	default:
+		return newError(node.Token.Pos, "unknown operator: %s%s", node.Operator, right.Type())
+	}
+}
+
+func evalInfixExpression(node *ast.InfixExpression, left, right object.Object) object.Object {
+	operator := node.Operator
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(node, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		if result, ok := object.FloatInfix(operator, left, right); ok {
+			return result
+		}
+		return newError(node.Token.Pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		if result, ok := object.StringInfix(operator, left.(*object.String), right.(*object.String)); ok {
+			return result
+		}
+		return newError(node.Token.Pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	// all other values are compared by identity (true, false and null are singletons)
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError(node.Token.Pos, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError(node.Token.Pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(node *ast.InfixExpression, left, right object.Object) object.Object {
+	switch node.Operator {
+	case "+", "-", "*", "/":
+		result, err := object.IntegerArithmetic(node.Operator, left, right)
+		if err != nil {
+			return newError(node.Token.Pos, "%s", err)
+		}
+		return result
+	case "<":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) != 0)
+	default:
+		return newError(node.Token.Pos, "unknown operator: %s %s %s", left.Type(), node.Operator, right.Type())
+	}
+}
+
+// evalHashLiteral evaluates the keys and values in source order
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+		if !hash.Set(key, value) {
+			return newError(node.Token.Pos, "unusable as hash key: %s", key.Type())
+		}
+	}
+	return hash
+}
+
+// evalSliceExpression evaluates s[low:high]. An omitted bound is NULL.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	bounds := [2]object.Object{NULL, NULL}
+	for i, bound := range [2]ast.Expression{node.Low, node.High} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	result, err := object.Slice(left, bounds[0], bounds[1])
+	if err != nil {
+		return newError(node.Token.Pos, "%s", err)
+	}
+	return result
+}
+
+// evalIfExpression evaluates the arms with evalArm (evalTailBlock for an if expression
+// in tail position).
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment, evalArm blockEvaluator) object.Object {
+	if cond, ok := ie.Condition.(*ast.LetCondition); ok {
+		return evalIfLetExpression(ie, cond, env, evalArm)
+	}
+
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return evalArm(ie.IfArm, env)
+	} else if ie.ElseArm != nil {
+		return evalArm(ie.ElseArm, env)
+	} else {
+		return NULL
+	}
+}
+
+type blockEvaluator func(*ast.BlockStatement, *object.Environment) object.Object
+
+// if (let Circle(r) = shape) { ... } evaluates the if arm in an environment where
+// the fields of the variant are bound to the names of the pattern.
+func evalIfLetExpression(ie *ast.IfExpression, cond *ast.LetCondition, env *object.Environment, evalArm blockEvaluator) object.Object {
+	val := Eval(cond.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	variant, ok := val.(*object.Variant)
+	if !ok || variant.Name != cond.Pattern.Name.Value {
+		if ie.ElseArm != nil {
+			return evalArm(ie.ElseArm, env)
+		}
+		return NULL
+	}
+
+	if cond.Pattern.Bindings != nil && len(cond.Pattern.Bindings) != len(variant.Values) {
+		return newError(cond.Pattern.Token.Pos, "wrong number of fields in pattern %s: want=%d, got=%d",
+			variant.Name, len(variant.Values), len(cond.Pattern.Bindings))
+	}
+	armEnv := object.NewEnclosedEnvironment(env)
+	for i, b := range cond.Pattern.Bindings {
+		if b.Value != "_" {
+			armEnv.Set(b.Value, variant.Values[i])
+		}
+	}
+	return evalArm(ie.IfArm, armEnv)
+}
+
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// applyFunction calls fn, and then the tail calls it ends with, in a loop
+func applyFunction(call *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
+	for {
+		var result object.Object
+
+		switch fn := fn.(type) {
+		case *object.Function:
+			if len(args) != len(fn.Parameters) {
+				return newError(call.Token.Pos, "wrong number of arguments: want=%d, got=%d",
+					len(fn.Parameters), len(args))
+			}
+			extendedEnv := extendFunctionEnv(fn, args)
+			result = unwrapReturnValue(evalTailBlock(fn.Body, extendedEnv))
+
+		case *object.Constructor:
+			if len(args) != len(fn.Fields) {
+				return newError(call.Token.Pos, "wrong number of arguments: want=%d, got=%d",
+					len(fn.Fields), len(args))
+			}
+			return &object.Variant{Enum: fn.Enum, Name: fn.Name, Values: args}
+
+		case *object.Builtin:
+			return applyBuiltin(call, fn, args)
+
+		default:
+			return newError(call.Token.Pos, "not a function: %s", fn.Type())
+		}
+
+		tc, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+		call, fn, args = tc.call, tc.fn, tc.args
+	}
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for i, param := range fn.Parameters {
+		env.Set(param.Value, args[i])
+	}
+
+	return env
+}
+
+// applyBuiltin calls the builtin, and positions its error at the call (as are the
+// errors of the calls made by a higher-order builtin)
+func applyBuiltin(call *ast.CallExpression, fn *object.Builtin, args []object.Object) object.Object {
+	result := fn.Call(func(f object.Object, args ...object.Object) object.Object {
+		return applyFunction(call, f, args)
+	}, args...)
+	if result == nil {
+		return NULL
+	}
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = call.Token.Pos
+	}
+	return result
+}
+
+// stop the return value from bubbling up past the function call
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+//
+// Tail calls
+//
+
+// tailCall is a call in tail position (the value of a return statement, or the last
+// expression of a function body, possibly in the arms of if expressions), evaluated
+// up to the application of the function. The function it is returned from applies it
+// in the same loop as its own call, so that a recursion made of tail calls (e.g. a
+// loop) runs in constant stack space.
+type tailCall struct {
+	call *ast.CallExpression
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.Type { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string   { return "tail call " + tc.call.String() }
+
+// evalTail evaluates an expression in tail position
+func evalTail(node ast.Expression, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return &tailCall{call: node, fn: function, args: args}
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env, evalTailBlock)
+
+	default:
+		return Eval(node, env)
+	}
+}
+
+// completeTailCall applies a tail call returned from a block where control cannot
+// leave yet (the program, or a try block or catch arm). Other values are returned as
+// is.
+func completeTailCall(obj object.Object) object.Object {
+	if tc, ok := obj.(*tailCall); ok {
+		return applyFunction(tc.call, tc.fn, tc.args)
+	}
+	return obj
+}
+
+//
+// Records (structs)
+//
+
+func evalStructDeclaration(decl *ast.StructDeclaration, env *object.Environment) {
+	def := &object.StructDef{
+		Name:     decl.Name.Value,
+		Defaults: map[string]ast.Expression{},
+		Env:      env,
+	}
+	for _, f := range decl.Fields {
+		def.Fields = append(def.Fields, f.Name.Value)
+		if f.Default != nil {
+			def.Defaults[f.Name.Value] = f.Default
+		}
+	}
+	env.Set(def.Name, def)
+}
+
+func evalStructLiteral(lit *ast.StructLiteral, env *object.Environment) object.Object {
+	obj, ok := env.Get(lit.Name.Value)
+	if !ok {
+		return newError(lit.Token.Pos, "unknown struct %s", lit.Name.Value)
+	}
+	def, ok := obj.(*object.StructDef)
+	if !ok {
+		return newError(lit.Token.Pos, "not a struct: %s", obj.Type())
+	}
+
+	s := &object.Struct{Def: def, Fields: map[string]object.Object{}}
+	for _, f := range lit.Fields {
+		if !def.HasField(f.Name.Value) {
+			return newError(f.Name.Token.Pos, "unknown field %s in struct %s", f.Name.Value, def.Name)
+		}
+		val := Eval(f.Value, env)
+		if isError(val) {
+			return val
+		}
+		s.Fields[f.Name.Value] = val
+	}
+
+	// The defaults are evaluated (in the scope of the declaration) for every literal
+	for _, name := range def.Fields {
+		if _, ok := s.Fields[name]; ok {
+			continue
+		}
+		expr, ok := def.Defaults[name]
+		if !ok {
+			return newError(lit.Token.Pos, "missing field %s in %s literal", name, lit.Name.Value)
+		}
+		val := Eval(expr, def.Env)
+		if isError(val) {
+			return val
+		}
+		s.Fields[name] = val
+	}
+
+	return s
+}
+
+func evalFieldAccess(node *ast.FieldAccessExpression, obj object.Object) object.Object {
+	name := node.Field.Value
+	switch obj := obj.(type) {
+	case *object.Struct:
+		if val, ok := obj.Fields[name]; ok {
+			return val
+		}
+		return newError(node.Field.Token.Pos, "no field %s in struct %s", name, obj.Def.Name)
+	case *object.Module:
+		if val, ok := obj.Members[name]; ok {
+			return val
+		}
+		return newError(node.Field.Token.Pos, "no member %s in module %s", name, obj.Name)
+	default:
+		return newError(node.Field.Token.Pos, "type %s has no field %s", obj.Type(), name)
+	}
+}
+
+//
+// Tagged unions (enums)
+//
+
+// evalEnumDeclaration binds every variant name to a constructor (or, for variants
+// without fields, to the only value of the variant).
+func evalEnumDeclaration(decl *ast.EnumDeclaration, env *object.Environment) {
+	for _, v := range decl.Variants {
+		if len(v.Fields) == 0 {
+			env.Set(v.Name.Value, &object.Variant{Enum: decl.Name.Value, Name: v.Name.Value})
+			continue
+		}
+		c := &object.Constructor{Enum: decl.Name.Value, Name: v.Name.Value}
+		for _, f := range v.Fields {
+			c.Fields = append(c.Fields, f.Value)
+		}
+		env.Set(v.Name.Value, c)
+	}
+}
+
+//
+// Exceptions
+//
+
+// See ast.TryExpression for the semantics. Runtime errors are caught like thrown
+// values, with the *object.Error itself bound to the catch parameter.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := completeReturn(Eval(te.Body, env))
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		var caught object.Object = err
+		if err.Thrown != nil {
+			caught = err.Thrown
+		}
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.CatchParam.Value, caught)
+		result = completeReturn(Eval(te.Catch, catchEnv))
+	}
+
+	if te.Finally != nil {
+		// An abrupt completion of the finally arm replaces the pending result
+		if f := Eval(te.Finally, env); isAbrupt(f) {
+			return f
+		}
+	}
+
+	return result
+}
+
+// completeReturn completes the tail call of a return statement in a try block or catch
+// arm, so that the call is made while the catch and finally arms are pending.
+func completeReturn(result object.Object) object.Object {
+	rv, ok := result.(*object.ReturnValue)
+	if !ok {
+		return result
+	}
+	val := completeTailCall(rv.Value)
+	if isError(val) {
+		return val
+	}
+	return &object.ReturnValue{Value: val}
+}
+
+//
+// Helpers
+//
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// null and false are falsy, everything else is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(pos token.Position, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Pos: pos}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+// isAbrupt reports whether obj stops the evaluation of a block (a return or an error)
+func isAbrupt(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.RETURN_VALUE_OBJ
+	}
+	return false
+}
@@ -0,0 +1,791 @@
+package evaluator
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+	"github.com/maxild/monkey/internal/stdlib"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"-9223372036854775808", "-9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"99999999999999999999 - 99999999999999999998", "1"},
+		{"100000000000000000000 / 3", "33333333333333333333"},
+		{"100000000000000000000 > 9223372036854775807", "true"},
+		{"-100000000000000000000 < 1", "true"},
+		{"(9223372036854775807 + 1) - 1 == 9223372036854775807", "true"},
+		{"18446744073709551616 == 4294967296 * 4294967296", "true"},
+		{"18446744073709551616 == 18446744073709551617", "false"},
+		{"let factorial = fn(n) { if (n == 0) { 1 } else { n * factorial(n - 1) } }; factorial(50)",
+			"30414093201713378043612608166064768844377641568960512000000000000"},
+		{"100000000000000000000 / 0", "ERROR: 1:23: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// results that fit in an int64 are small integers again
+	testIntegerObject(t, testEval("(9223372036854775807 + 10) - 10"), 9223372036854775807)
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"1 == true", false},
+		{"1 != true", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+		{"!if (false) { 1 }", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (true) { }", nil},
+		{"if (true) { let x = 5; }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+  return x;
+  x + 10;
+};
+f(10);`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+   let result = x + 10;
+   return result;
+   return 10;
+};
+f(10);`,
+			20,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"true + false;", "1:6: unknown operator: BOOLEAN + BOOLEAN"},
+		{"true + false + true + false;", "1:6: unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "1:9: unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "1:20: unknown operator: BOOLEAN + BOOLEAN"},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+			"4:17: unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{"foobar", "1:1: identifier not found: foobar"},
+		{"1 / 0", "1:3: division by zero"},
+		{"let x = 5; x(1)", "1:13: not a function: INTEGER"},
+		{"let f = fn(a, b) { a }; f(1)", "1:26: wrong number of arguments: want=2, got=1"},
+		{"let f = fn(x) { x + true }; f(1)", "1:19: type mismatch: INTEGER + BOOLEAN"},
+		{`"a" - "b"`, "1:5: unknown operator: STRING - STRING"},
+		{`"a" + 1`, "1:5: type mismatch: STRING + INTEGER"},
+		{`"héllo"[5]`, "1:9: index out of range: 5 with length 5"},
+		{`"abc"[-1]`, "1:6: index out of range: -1 with length 3"},
+		{`"abc"[true]`, "1:6: index must be INTEGER, got BOOLEAN"},
+		{`"abc"[2:1]`, "1:6: slice bounds out of range: [2:1] with length 3"},
+		{`"abc"[:4]`, "1:6: slice bounds out of range: [:4] with length 3"},
+		{`5[0]`, "1:2: index operator not supported: INTEGER"},
+		{`[1, 2][2]`, "1:7: index out of range: 2 with length 2"},
+		{`[1, 2][1:3]`, "1:7: slice bounds out of range: [1:3] with length 2"},
+		{`[1, true + 1]`, "1:10: type mismatch: BOOLEAN + INTEGER"},
+		{`{[1]: 2}`, "1:1: unusable as hash key: ARRAY"},
+		{`{"a": 1}[[]]`, "1:9: unusable as hash key: ARRAY"},
+		{`1.5 + "a"`, "1:5: type mismatch: FLOAT + STRING"},
+		{`{1.5: 1}`, "1:1: unusable as hash key: FLOAT"},
+		{`/a/ + 1`, "1:5: type mismatch: REGEX + INTEGER"},
+		{`{/a/: 1}`, "1:1: unusable as hash key: REGEX"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if msg := errObj.Pos.String() + ": " + errObj.Message; msg != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, msg)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a: int = 5; a;", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "{ (x + 2) }"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let add = fn(a: int, b: int): int { a + b }; add(1, 2)", 3},
+		{"let fact = fn(n) { if (n == 0) { return 1; } n * fact(n - 1) }; fact(10)", 3628800},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEmptyFunctionBody(t *testing.T) {
+	testNullObject(t, testEval("fn() {}()"))
+	testNullObject(t, testEval("fn() { let x = 1; }()"))
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + p.y", 3},
+		{"struct Point { x, y = 10 }; Point{x: 1}.y", 10},
+		{"struct Point { x, y = 10 }; Point{x: 1, y: 2}.y", 2},
+		{"struct Line { from, to }; struct P { x }; Line{from: P{x: 1}, to: P{x: 5}}.to.x", 5},
+		{"struct Box { f }; let b = Box{f: fn(x) { x * 2 }}; b.f(21)", 42},
+		{"let d = 3; struct P { x = d * 2 }; P{}.x", 6},
+		{"struct P { x }; let p = P{x: 1}; p == p", true},
+		{"struct P { x }; P{x: 1} == P{x: 1}", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	evaluated := testEval("struct Point { x, y = 0 }; Point{x: 1}")
+	if evaluated.Inspect() != "Point{x: 1, y: 0}" {
+		t.Errorf("wrong struct value. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"Point{x: 1}", "unknown struct Point"},
+		{"struct P { x }; P{y: 1}", "unknown field y in struct P"},
+		{"struct P { x, y }; P{x: 1}", "missing field y in P literal"},
+		{"struct P { x }; P{x: 1}.y", "no field y in struct P"},
+		{"let n = 1; n.x", "type INTEGER has no field x"},
+		{"let P = 1; P{x: 1}", "not a struct: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expectedMessage)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"mon" + "key"`, "monkey"},
+		{`"a\tb\n\"c\"\\"`, "a\tb\n\"c\"\\"},
+		{`"abc" == "ab" + "c"`, true},
+		{`"abc" != "abc"`, false},
+		{`"abc" < "abd"`, true},
+		{`"b" > "abc"`, true},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[1:4]`, "éll"},
+		{`"héllo"[:2]`, "hé"},
+		{`"héllo"[3:]`, "lo"},
+		{`"héllo"[:]`, "héllo"},
+		{`"日本語"[2:3]`, "語"},
+		{`let s = "abc"; let i = 1; s[i + 1]`, "c"},
+		{`"abc"[3:3]`, ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, expected, str.Value)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestRegexLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`/a\/b+/iU`, "/a\\/b+/iU"},
+		{`let a = 8; let b = 2; [a / b / 2, /x/]`, "[2, /x/]"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1.5`, "1.5"},
+		{`-2.5e3`, "-2500.0"},
+		{`1.5 + 2.25`, "3.75"},
+		{`0.1 + 0.2`, "0.30000000000000004"},
+		{`3.0 * 2`, "6.0"},
+		{`7 / 2`, "3"},
+		{`7 / 2.0`, "3.5"},
+		{`-7.0 / 2`, "-3.5"},
+		{`1 - 0.5`, "0.5"},
+		{`1.0 / 0`, "inf"},
+		{`-1 / 0.0`, "-inf"},
+		{`0.0 / 0`, "nan"},
+		{`let nan = 0.0 / 0; nan == nan`, "false"},
+		{`1 == 1.0`, "true"},
+		{`1 != 1.5`, "true"},
+		{`1 < 1.5`, "true"},
+		{`2.5 > 3`, "false"},
+		{`9223372036854775808 == 9223372036854775808.0`, "true"},
+		{`let f = fn(x) { x * 2 }; [f(1), f(1.5)]`, "[2, 3.0]"},
+		{`if (0.0) { 1 } else { 2 }`, "1"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestArrays(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[]`, "[]"},
+		{`[1, 2 * 3, "x", [true]]`, "[1, 6, x, [true]]"},
+		{`let a = [1, 2, 3]; a[0] + a[2]`, "4"},
+		{`[[1, 2], [3]][0][1]`, "2"},
+		{`let a = [1, 2, 3, 4]; [a[1:3], a[:1], a[3:], a[:]]`, "[[2, 3], [1], [4], [1, 2, 3, 4]]"},
+		{`let f = fn(x) { [x, x + 1] }; f(1)`, "[1, 2]"},
+		// hashes
+		{`{}`, "{}"},
+		{`{"b": 1, "a": 2, "b": 3}`, "{b: 3, a: 2}"},
+		{`let k = "x"; {k: 1, 1 + 1: [2], true: {}}`, "{x: 1, 2: [2], true: {}}"},
+		{`let h = {"a": {"b": 5}}; h["a"]["b"]`, "5"},
+		{`{1: "one"}[2]`, "null"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	shape := `
+enum Shape { Circle(r), Rect(w, h), Empty }
+let area = fn(s) {
+  if (let Circle(r) = s) {
+    3 * r * r
+  } else if (let Rect(w, h) = s) {
+    w * h
+  } else {
+    0
+  }
+};
+`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{shape + "area(Circle(2))", 12},
+		{shape + "area(Rect(2, 3))", 6},
+		{shape + "area(Empty)", 0},
+		{shape + "if (let Rect(_, h) = Rect(1, 7)) { h }", 7},
+		{shape + "if (let Rect = Rect(1, 7)) { 1 } else { 2 }", 1},
+		{shape + "if (let Circle(r) = Rect(1, 7)) { r }", nil},
+		{shape + "if (let Circle(r) = 5) { r } else { 2 }", 2},
+		{shape + "Empty == Empty", true},
+		{shape + "let r = 1; if (let Circle(r) = Circle(5)) { r }; r", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	if got := testEval(shape + "Rect(2, 3)").Inspect(); got != "Rect(2, 3)" {
+		t.Errorf("wrong variant value. got=%q", got)
+	}
+	testErrorObject(t, testEval(shape+"Circle(1, 2)"), "wrong number of arguments: want=1, got=2")
+	testErrorObject(t, testEval(shape+"if (let Rect(w) = Rect(1, 2)) { w }"),
+		"wrong number of fields in pattern Rect: want=2, got=1")
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e * 2 }", 10},
+		{"try { 1 + true } catch (e) { 2 }", 2},
+		{"let x = try { throw 3; } catch (e) { e }; x + 1", 4},
+		// unwinds through calls
+		{"let f = fn(n) { if (n == 0) { throw 42; } f(n - 1) + 1 }; try { f(10) } catch (e) { e }", 42},
+		{"let g = fn() { throw 1; 2 }; let h = fn() { g() + 10 }; try { h() } catch (e) { e + 100 }", 101},
+		// nested, rethrow
+		{"try { try { throw 1; } catch (e) { throw e + 1; } } catch (e) { e + 1 }", 3},
+		{"try { try { throw 1; } finally { 5 } } catch (e) { e }", 1},
+		// the value of finally is discarded
+		{"try { 1 } finally { 2 }", 1},
+		{"try { throw 1; } catch (e) { 2 } finally { 3 }", 2},
+		// return through finally
+		{"let f = fn() { try { return 1; } finally { 2 } }; f()", 1},
+		{"let f = fn() { try { return 1; } finally { return 2; } }; f()", 2},
+		{"let f = fn() { try { throw 1; } finally { return 2; } }; f()", 2},
+		{"let f = fn() { try { throw 1; } catch (e) { return e + 10; } 99 }; f()", 11},
+		{"let f = fn() { try { 1 } catch (e) { 2 } }; f()", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	// the runtime error itself is caught
+	evaluated := testEval("try { 1 / 0 } catch (e) { e }")
+	if evaluated.Inspect() != "ERROR: 1:9: division by zero" {
+		t.Errorf("wrong caught error. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestFinallyAlwaysRuns(t *testing.T) {
+	input := `
+struct Counter { n }
+let log = fn(c) { c };
+let run = fn(k, mode) {
+  try {
+    if (mode == 0) { return k; }
+    if (mode == 1) { throw k; }
+    k
+  } finally {
+    throw 100 + k;
+  }
+};
+`
+	// the throw in finally replaces normal completion, return and throw
+	for mode := 0; mode < 3; mode++ {
+		evaluated := testEval(input + "try { run(7, " + string(rune('0'+mode)) + ") } catch (e) { e }")
+		testIntegerObject(t, evaluated, 107)
+	}
+}
+
+func TestUncaughtException(t *testing.T) {
+	evaluated := testEval("let f = fn() { throw 5; }; f(); 10")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "uncaught exception: 5" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	testIntegerObject(t, errObj.Thrown, 5)
+	if errObj.Pos.String() != "1:16" {
+		t.Errorf("wrong error position. got=%s", errObj.Pos)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// a million levels of recursion run in constant stack space
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)", 1000000},
+		{"let count = fn(n, acc) { if (n == 0) { return acc; } return count(n - 1, acc + 1); }; count(1000000, 0)", 1000000},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+even(1000000)`, true},
+		{"enum L { Cons(h, t), Nil }; let len = fn(l, acc) { if (let Cons(h, t) = l) { len(t, acc + 1) } else { acc } }; len(Cons(1, Cons(2, Nil)), 0)", 2},
+		// calls that are not in tail position
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)", 100},
+		{"let f = fn() { let x = fn() { 5 }(); x }; f()", 5},
+		// the finally arm runs after the call returned by the try block
+		{"let g = fn() { throw 1; }; let f = fn() { try { return g(); } catch (e) { e + 10 } }; f()", 11},
+		{"let g = fn() { throw 1; }; let f = fn() { try { g() } catch (e) { e + 20 } }; f()", 21},
+		{"let g = fn(x) { x * 2 }; return g(21);", 42},
+		{"enum S { C(r) }; let f = fn() { C(5) }; if (let C(r) = f()) { r }", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	// errors of a tail call are reported at the call
+	testErrorObject(t, testEval("let g = fn(a) { a }; let f = fn() { g(1, 2) }; f()"), "wrong number of arguments: want=1, got=2")
+	testErrorObject(t, testEval("let f = fn() { 5() }; f()"), "not a function: INTEGER")
+}
+
+func TestBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	stdlib.Define(env, &stdlib.Host{
+		Capabilities: stdlib.Capabilities{stdlib.CapStdout},
+		Stdout:       &out,
+		Now:          func() time.Time { return time.Unix(2, 0) },
+	})
+	eval := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	if evaluated := eval(`print(1 < 2, 1 + 1)`); evaluated != NULL {
+		t.Errorf("print should return null. got=%s", evaluated.Inspect())
+	}
+	if out.String() != "true 2\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	errObj, ok := eval("let f = fn() { time.now() }; f()").(*object.Error)
+	if !ok {
+		t.Fatalf("expected a permission error")
+	}
+	if errObj.Pos.String() != "1:24" || errObj.Message != "permission denied: time.now requires the capability clock" {
+		t.Errorf("wrong error. got=%s: %s", errObj.Pos, errObj.Message)
+	}
+
+	testErrorObject(t, eval("random.gauss"), "no member gauss in module random")
+
+	if got := eval(`[regex.match(/^A+$/i, "aa"), regex.find_all(/(\w)(?P<n>\d)/, "a1 b2")[1]["n"]]`).Inspect(); got != "[true, 2]" {
+		t.Errorf("wrong value of the regex functions. got=%s", got)
+	}
+
+	// the higher-order builtins call the functions of the program
+	if got := eval(`map(filter(range(10), fn(x) { x > 6 }), fn(x) { x * x })`).Inspect(); got != "[49, 64, 81]" {
+		t.Errorf("wrong value of map. got=%s", got)
+	}
+	if got := eval(`try { map([1, 2], fn(x) { throw x * 10; }) } catch (e) { e }`).Inspect(); got != "10" {
+		t.Errorf("the thrown value should be caught. got=%s", got)
+	}
+	result := eval("let f = fn(a, b) { a }; map([1], f)")
+	errObj, ok = result.(*object.Error)
+	if !ok || errObj.Pos.String() != "1:28" || errObj.Message != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong error of the call made by map. got=%s", result.Inspect())
+	}
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Message: "parser errors: " + p.Errors()[0]}
+	}
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	t.Helper()
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	t.Helper()
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expectedMessage string) bool {
+	t.Helper()
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("no error object returned. got=%T(%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expectedMessage {
+		t.Errorf("wrong error message. expected=%q, got=%q", expectedMessage, errObj.Message)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+// Package interp is the entry point for running Monkey programs that are not trusted:
+// it parses, compiles and runs a program on the virtual machine within a budget, so
+// that a runaway program (e.g. fn(x) { x(x) }(fn(x) { x(x) })) is aborted cleanly
+// with a *LimitError instead of hanging or exhausting the memory of the host.
+package interp
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+	"github.com/maxild/monkey/internal/stdlib"
+	"github.com/maxild/monkey/internal/vm"
+)
+
+// Limits bound the steps (instructions), call depth and allocated bytes of a run. A
+// zero field is no limit.
+type Limits = vm.Limits
+
+// LimitError is returned by Run when the run is aborted: its context is done or it
+// exceeded a limit. It cannot be caught by a try expression of the program.
+type LimitError = vm.LimitError
+
+// RuntimeError is returned by Run for an error, or a thrown value, the program did not
+// catch.
+type RuntimeError = vm.RuntimeError
+
+// Clock is the clock of the time module
+type Clock = stdlib.Clock
+
+// Rand is the source of the random module, e.g. a *rand.Rand with a fixed seed
+type Rand = stdlib.Rand
+
+// FS is the file system of the fs module, e.g. a stdlib.DirFS
+type FS = stdlib.FS
+
+// Recording is the log of the nondeterministic values of a run (its times and random
+// numbers), which can be replayed to reproduce the run exactly
+type Recording = stdlib.Recording
+
+// ParseError is returned by Run for a program with syntax errors
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse errors: " + strings.Join(e.Errors, "; ")
+}
+
+// Config configures an Interpreter
+type Config struct {
+	Limits Limits // of every run
+
+	// Capabilities are granted to the builtins, e.g. "io.stdout", "clock" or
+	// "fs.read:/data". A builtin called without the capability it requires fails with
+	// a permission error.
+	Capabilities []string
+	Stdout       io.Writer        // written by print (nil to discard the output)
+	Now          func() time.Time // read by time.now (nil for the Now of the Clock)
+	Clock        Clock            // of the time module (nil for the system clock)
+	Rand         Rand             // of the random module (nil for the global source of math/rand)
+	FS           FS               // the root of the fs module (nil for no file system)
+
+	// Record, if not nil, records the values the runs get from the clock and the
+	// random source. Replay, if not nil, feeds the recorded values back to the runs
+	// instead of using the sources: a replayed run that diverges from the recording
+	// fails with a runtime error.
+	Record *Recording
+	Replay *Recording
+}
+
+// Interpreter runs programs with the same configuration. It can run several programs
+// concurrently.
+type Interpreter struct {
+	config     Config
+	registered []stdlib.Global
+}
+
+func New(config Config) *Interpreter {
+	return &Interpreter{config: config}
+}
+
+// Register binds name, in the global scope of the programs, to a builtin calling the
+// Go function fn. The arguments and the result are converted between Monkey and Go
+// values: integers, booleans, strings, slices (arrays), maps (hashes) and structs. The
+// function may also return an error (as its last result), which is a runtime error of
+// the program. Register must not be called concurrently with Run.
+//
+//	it.Register("httpStatus", func(code int64) (string, error) { ... })
+func (it *Interpreter) Register(name string, fn interface{}) error {
+	b, err := stdlib.GoFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	it.registered = append(it.registered, stdlib.Global{Name: name, Value: b})
+	return nil
+}
+
+// Run runs the program src while ctx is not done, and returns its value: the value of
+// its last expression statement (or of its return statement).
+func (it *Interpreter) Run(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	compiled, err := it.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Run(ctx)
+}
+
+// Program is a program compiled by an interpreter. It can be run several times, also
+// concurrently.
+type Program struct {
+	bytecode   *compiler.Bytecode
+	config     Config
+	registered []stdlib.Global
+}
+
+// Compile compiles the parsed program, with the builtins of the interpreter in its
+// global scope
+func (it *Interpreter) Compile(program *ast.Program) (*Program, error) {
+	p := &Program{config: it.config, registered: it.registered}
+	symbolTable, _ := p.globals(nil)
+
+	c := compiler.NewWithState(symbolTable, nil, nil)
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	p.bytecode = c.Bytecode()
+	return p, nil
+}
+
+// globals returns the global scope of the program and its initial globals, the
+// builtins of a run with ctx (which interrupts a sleep)
+func (p *Program) globals(ctx context.Context) (*compiler.SymbolTable, []object.Object) {
+	symbolTable := compiler.NewSymbolTable()
+	var builtins []object.Object
+	for _, g := range append(stdlib.Globals(p.host(ctx)), p.registered...) {
+		symbol := symbolTable.Define(g.Name)
+		if symbol.Index == len(builtins) {
+			builtins = append(builtins, g.Value)
+		} else {
+			builtins[symbol.Index] = g.Value // redefined
+		}
+	}
+	return symbolTable, builtins
+}
+
+// Run runs the program while ctx is not done, and returns its value
+func (p *Program) Run(ctx context.Context) (object.Object, error) {
+	_, builtins := p.globals(ctx)
+	globals := make([]object.Object, vm.GlobalsSize)
+	copy(globals, builtins)
+
+	machine := vm.NewWithGlobalsStore(p.bytecode, globals)
+	if err := machine.RunContext(ctx, p.config.Limits); err != nil {
+		return nil, err
+	}
+	if result := machine.LastPoppedStackElem(); result != nil {
+		return result, nil
+	}
+	return vm.Null, nil
+}
+
+func (p *Program) host(ctx context.Context) *stdlib.Host {
+	return &stdlib.Host{
+		Capabilities: stdlib.Capabilities(p.config.Capabilities),
+		Stdout:       p.config.Stdout,
+		Now:          p.config.Now,
+		Clock:        p.config.Clock,
+		Rand:         p.config.Rand,
+		FS:           p.config.FS,
+		Record:       p.config.Record,
+		Replay:       p.config.Replay,
+		Context:      ctx,
+	}
+}
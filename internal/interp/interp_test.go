@@ -0,0 +1,503 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/maxild/monkey/internal/stdlib"
+)
+
+const omega = "fn(x) { x(x) }(fn(x) { x(x) })"
+
+func TestRun(t *testing.T) {
+	it := New(Config{Limits: Limits{Steps: 100000, Depth: 100, Bytes: 1 << 20}})
+
+	result, err := it.Run(context.Background(), "let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(10)")
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	if result.Inspect() != "55" {
+		t.Errorf("wrong result. want=55, got=%s", result.Inspect())
+	}
+
+	result, err = it.Run(context.Background(), "let x = 1;")
+	if err != nil || result.Inspect() != "null" {
+		t.Errorf("wrong result of a program without value. got=%v, %v", result, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+	}{
+		{omega, Limits{Steps: 10000}, "1:26: steps limit exceeded (10000)"},
+		// a try expression does not catch the error
+		{"try { " + omega + " } catch (e) { 0 }", Limits{Steps: 10000}, "1:30: steps limit exceeded (10000)"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", Limits{Depth: 100}, "1:22: depth limit exceeded (100)"},
+		{"try { let f = fn(n) { 1 + f(n + 1) }; f(0) } catch (e) { 0 }", Limits{Depth: 100}, "1:28: depth limit exceeded (100)"},
+		{
+			"enum L { Cons(h, t), Nil }; let f = fn(n, l) { f(n + 1, Cons(n, l)) }; f(0, Nil)",
+			Limits{Bytes: 1 << 20},
+			"1:61: bytes limit exceeded (1048576)",
+		},
+		{"let f = fn(a) { fn() { a } }; let g = fn(n) { f(n); g(n + 1) }; g(0)", Limits{Bytes: 1000}, "1:17: bytes limit exceeded (1000)"},
+		{"let f = fn(n) { f(n * 2) }; f(2)", Limits{Bytes: 100000}, "1:21: bytes limit exceeded (100000)"},
+		// the values held by the result of a builtin are counted
+		{`json.parse("[[1, 2, 3, 4, 5, 6, 7, 8], [1, 2, 3, 4, 5, 6, 7, 8]]")`, Limits{Bytes: 400}, "1:11: bytes limit exceeded (400)"},
+		// a builtin fails before building a string exceeding the limit
+		{`let t = strings.join(map(range(1000), fn(i) { "abcdefgh" }), ""); strings.replace(t, "", t)`, Limits{Bytes: 1 << 20}, "1:82: bytes limit exceeded (1048576)"},
+		{"range(10000000)", Limits{Bytes: 1 << 20}, "1:6: bytes limit exceeded (1048576)"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(Config{Limits: tt.limits}).Run(context.Background(), tt.input)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("%q: expected a *LimitError. got=%v", tt.input, err)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	it := New(Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := it.Run(ctx, omega)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error. got=%v", err)
+	}
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "context" {
+		t.Errorf("expected a *LimitError of the context. got=%#v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := it.Run(ctx, omega); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error. got=%v", err)
+	}
+
+	// a sleep is interrupted, and cannot be caught
+	it = New(Config{Capabilities: []string{"clock"}})
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = it.Run(ctx, "try { time.sleep(10 * time.second) } catch (e) { 1 }")
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "context" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a *LimitError of the context. got=%#v", err)
+	} else if err.Error() != "1:17: aborted: context deadline exceeded" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the sleep was not interrupted: %s", elapsed)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	it := New(Config{})
+
+	_, err := it.Run(context.Background(), "let = 1;")
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected a *ParseError. got=%#v", err)
+	}
+
+	_, err = it.Run(context.Background(), "x")
+	if err == nil || err.Error() != "1:1: identifier not found: x" {
+		t.Errorf("wrong compile error. got=%v", err)
+	}
+
+	_, err = it.Run(context.Background(), "1 / 0")
+	if _, ok := err.(*RuntimeError); !ok || err.Error() != "1:3: division by zero" {
+		t.Errorf("wrong runtime error. got=%v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	var out bytes.Buffer
+	now := func() time.Time { return time.Unix(1500, 0) }
+
+	tests := []struct {
+		input        string
+		capabilities []string
+		expected     string // the result, or the error
+	}{
+		{`print(1, fn(x) { x })`, nil, "1:6: permission denied: print requires the capability io.stdout"},
+		{`let p = print; if (true) { p(1) }`, []string{"clock"}, "1:29: permission denied: print requires the capability io.stdout"},
+		{`print(1, 2); 3`, []string{"io.stdout"}, "3"},
+		{`time.now()`, []string{"io.stdout"}, "1:9: permission denied: time.now requires the capability clock"},
+		{`time.now() / 1000`, []string{"clock"}, "1500"},
+		{`time.now(1)`, []string{"clock"}, "1:9: wrong number of arguments to time.now: want=0, got=1"},
+		{`let r = random.int(3, 4); r`, []string{"random"}, "3"},
+		{`random.int(1, true)`, []string{"random"}, "1:11: argument 2 to random.int must be INTEGER, got BOOLEAN"},
+		{`time.later()`, []string{"clock"}, "1:6: no member later in module time"},
+		// a permission error is caught like any other error
+		{`try { print(1) } catch (e) { 0 }`, nil, "0"},
+	}
+
+	for _, tt := range tests {
+		it := New(Config{Capabilities: tt.capabilities, Stdout: &out, Now: now})
+		result, err := it.Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	if out.String() != "1 2\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "1 2\n", out.String())
+	}
+}
+
+func TestCollections(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`filter(range(10), fn(x) { x / 3 * 3 == x })`, "[0, 3, 6, 9]"},
+		{`reduce(range(1, 5), fn(acc, x) { acc * x }, 1)`, "24"},
+		{`reduce([], fn(acc, x) { acc + x }, 0)`, "0"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`[range(3), range(2, 5), range(10, 0, -4), range(3, 3)]`, "[[0, 1, 2], [2, 3, 4], [10, 6, 2], []]"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort(["bb", "a", "cc", "d"], fn(a, b) { len(a) < len(b) })`, "[a, d, bb, cc]"},
+		{`group_by(range(6), fn(x) { x - x / 3 * 3 })`, "{0: [0, 3], 1: [1, 4], 2: [2, 5]}"},
+		{`[any([1, 2], fn(x) { x > 1 }), any([], fn(x) { true }), all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`,
+			"[true, false, false, true]"},
+		{`flatten([[1, 2], 3, [], [[4]]])`, "[1, 2, 3, [4]]"},
+		{`enum O { Some(x) }; map([1, 2], Some)`, "[Some(1), Some(2)]"},
+		{`map([[1], [2, 3]], len)`, "[1, 2]"},
+		// a closure can call the higher-order builtins
+		{`let sum = fn(xs) { reduce(xs, fn(a, b) { a + b }, 0) }; map([[1, 2], [3]], sum)`, "[3, 3]"},
+		// errors
+		{`map([1], 2)`, "1:4: argument 2 to map must be a function, got INTEGER"},
+		{`map([1], fn(a, b) { a })`, "1:4: wrong number of arguments: want=2, got=1"},
+		{`map([1, 2], fn(x) { x + true })`, "1:23: type mismatch: INTEGER + BOOLEAN"},
+		{`try { map([1, 2], fn(x) { throw x; }) } catch (e) { e + 10 }`, "11"},
+		{`sort([1, "a"])`, "1:5: sort: cannot compare STRING and INTEGER (pass a less function)"},
+		{`sort([2, 1], fn(a, b) { a + true })`, "1:27: type mismatch: INTEGER + BOOLEAN"},
+		{`group_by([1], fn(x) { [x] })`, "1:9: group_by: unusable as hash key: ARRAY"},
+		{`range(1, 2, 0)`, "1:6: range: step must not be 0"},
+		{`range(0, 100000000)`, "1:6: range: too many elements: 100000000 (the maximum is 16777216)"},
+	}
+
+	for _, tt := range tests {
+		it := New(Config{Limits: Limits{Steps: 100000}})
+		result, err := it.Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// the calls made by a builtin count against the budget of the run
+	_, err := New(Config{Limits: Limits{Steps: 1000}}).Run(context.Background(), `map(range(1000), fn(x) { x })`)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Errorf("expected a *LimitError. got=%v", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		{
+			`let payload = json.parse("{\"users\": [{\"name\": \"ann\", \"age\": 31}, {\"name\": \"bob\", \"age\": 25}]}");
+let names = map(filter(payload["users"], fn(u) { u["age"] > 30 }), fn(u) { u["name"] });
+json.stringify({"names": names, "count": len(names)})`,
+			`{"names":["ann"],"count":1}`,
+		},
+		{`json.stringify({"b": 1.5, "a": [true]}, 1, {"sort_keys": true})`, "{\n \"a\": [\n  true\n ],\n \"b\": 1.5\n}"},
+		{`struct P { x, y }; json.stringify(P{x: 1, y: "2"})`, `{"x":1,"y":"2"}`},
+		{`json.parse("[1,")`, "1:11: json.parse: 1:4: unexpected end of input looking for a value"},
+		{`json.stringify(fn() { 1 })`, "1:15: json.stringify: unsupported value: CLOSURE"},
+		{`try { json.parse("x") } catch (e) { "invalid" }`, "invalid"},
+	}
+
+	for _, tt := range tests {
+		result, err := New(Config{}).Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		{`let hypot = fn(a, b) { math.sqrt(a * a + b * b) }; hypot(3, 4)`, "5.0"},
+		{`let area = fn(r) { math.pi * math.pow(r, 2) }; math.floor(area(2) * 100)`, "1256"},
+		{`[math.pow(2, 100), math.pow(2, -1), math.pow(2.0, 3)]`, "[1267650600228229401496703205376, 0.5, 8.0]"},
+		{`[math.floor(-1.5), math.ceil(-1.5), math.floor(7), math.abs(-3), math.abs(-0.5)]`, "[-2, -1, 7, 3, 0.5]"},
+		{`[math.min(3, 1.5, 2), math.max([1, 7, 2]), math.max(1, math.nan)]`, "[1.5, 7, nan]"},
+		{`[math.sin(0), math.cos(0), -math.inf, math.inf > 1e308]`, "[0.0, 1.0, -inf, true]"},
+		{`sort([2, 1.5, -1, 1e3])`, "[-1, 1.5, 2, 1000.0]"},
+		{`math.floor(math.nan)`, "1:11: math.floor: cannot convert nan to an integer"},
+		{`math.sqrt("4")`, "1:10: argument 1 to math.sqrt must be INTEGER or FLOAT, got STRING"},
+		{`math.pow(10, 1000000)`, "1:9: math.pow: result too large: 10 ** 1000000"},
+	}
+
+	for _, tt := range tests {
+		result, err := New(Config{}).Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		{`regex.find_all(/(?P<key>\w+)=(\d+)?/, "a=1 b= c=3")`,
+			"[{0: a=1, 1: a, key: a, 2: 1}, {0: b=, 1: b, key: b, 2: null}, {0: c=3, 1: c, key: c, 2: 3}]"},
+		{`regex.find_all(/\d+/, "1 22 333")`, "[1, 22, 333]"},
+		{`[regex.match(/^\d+$/, "42"), regex.match("^\\d+$", "4x"), regex.match(/ab/i, "xAB")]`, "[true, false, true]"},
+		{`regex.replace(/(\w+)@(\w+)/, "me@host, you@there", "${2}: $1 $$")`, "host: me $, there: you $"},
+		{`let x = 10; let y = 2; [x / y / 5, x/y/1, [x][0] / y]`, "[1, 5, 5]"},
+		{`let re = regex.compile("a.b", "s"); [re, regex.match(re, "a\nb"), regex.match(/a.b/, "a\nb")]`, "[/a.b/s, true, false]"},
+		{`let words = fn(s) { regex.find_all(/[a-z]+/i, s) }; map(["Hi there", ""], fn(s) { len(words(s)) })`, "[2, 0]"},
+		{`regex.compile("x(")`, "1:14: regex.compile: invalid regex /x(/: missing closing )"},
+		{`regex.compile("x", "g")`, "1:14: regex.compile: invalid regex /x/g: invalid flag 'g'"},
+		{`regex.match("(", "")`, `1:12: regex.match: invalid regex "(": missing closing )`},
+		{`regex.match(1, "")`, "1:12: argument 1 to regex.match must be REGEX or STRING, got INTEGER"},
+		{`regex.replace(/a/, "a")`, "1:14: wrong number of arguments to regex.replace: want=3, got=2"},
+		{"let re = /a(/;", "parse errors: invalid regex /a(/: missing closing )"},
+	}
+
+	for _, tt := range tests {
+		result, err := New(Config{}).Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	fs := stdlib.NewMemFS(map[string]string{
+		"config.json":    `{"title": "Sales", "regions": ["north", "south"]}`,
+		"data/north.csv": "10",
+		"data/south.csv": "32",
+		"reports/":       "",
+	})
+	config := Config{Capabilities: []string{"fs.read", "fs.write:/reports"}, FS: fs}
+
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		{`
+let config = json.parse(fs.read("config.json"));
+let files = filter(fs.list("data"), fn(name) { fs.exists("data/" + name) });
+fs.write("reports/summary.txt", config["title"] + ": " + strings.join(files, ", "));
+fs.stat("/reports/summary.txt")["size"]`, "27"},
+		{`fs.read("reports/summary.txt")`, "Sales: north.csv, south.csv"},
+		{`fs.walk("/")`, "[config.json, data, data/north.csv, data/south.csv, reports, reports/summary.txt]"},
+		{`fs.write("reports/2024/q1.txt", "")`, "1:9: fs.write: reports/2024/q1.txt: no such file or directory"},
+		{`fs.write("config.json", "{}")`, "1:9: permission denied: fs.write requires the capability fs.write for /config.json"},
+		{`fs.read("data/../../etc/passwd")`, `1:8: fs.read: invalid path "data/../../etc/passwd": .. is not allowed`},
+	}
+
+	for _, tt := range tests {
+		result, err := New(config).Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	src := `
+let start = time.now();
+let dice = map(range(5), fn(i) { random.int(1, 7) });
+time.sleep(time.millisecond);
+[dice, random.choice(["a", "b", "c"]), random.shuffle([1, 2, 3]), time.since(start) > 0]`
+	capabilities := []string{"clock", "random"}
+
+	recording := &Recording{}
+	want, err := New(Config{Capabilities: capabilities, Record: recording}).Run(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the replay gets the recorded values, not the ones of its sources
+	replay := &Recording{Events: recording.Events}
+	config := Config{Capabilities: capabilities, Rand: rand.New(rand.NewSource(1)), Replay: replay}
+	got, err := New(config).Run(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Inspect() != want.Inspect() {
+		t.Errorf("wrong replay. want=%s, got=%s", want.Inspect(), got.Inspect())
+	}
+
+	// a seeded source gives the same values in every run
+	seeded := func() string {
+		config := Config{Capabilities: capabilities, Rand: rand.New(rand.NewSource(42))}
+		result, err := New(config).Run(context.Background(), "random.shuffle(range(10))")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Inspect()
+	}
+	if a, b := seeded(), seeded(); a != b {
+		t.Errorf("different values for the same seed: %s and %s", a, b)
+	}
+
+	// a program that does not do what was recorded fails where it diverges
+	replay = &Recording{Events: recording.Events}
+	_, err = New(Config{Capabilities: capabilities, Replay: replay}).Run(context.Background(), "time.now();\nrandom.float()")
+	if err == nil || err.Error() != "2:13: replay: event 1 is random(9007199254740992), but random(6) was recorded" {
+		t.Errorf("wrong error for a diverging replay. got=%v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	type Point struct {
+		X, Y  int
+		Label string `monkey:"label"`
+	}
+
+	it := New(Config{})
+	functions := map[string]interface{}{
+		"httpStatus": func(code int64) (string, error) {
+			if code == 404 {
+				return "Not Found", nil
+			}
+			return "", fmt.Errorf("unknown status %d", code)
+		},
+		"length":  func(s string) int { return len(s) },
+		"numbers": func(n int) []int64 { return make([]int64, n) },
+		"sum": func(xs ...int64) int64 {
+			var sum int64
+			for _, x := range xs {
+				sum += x
+			}
+			return sum
+		},
+		"sumAll":  func(xs []int64) int64 { return int64(len(xs)) },
+		"ports":   func() map[string]uint16 { return map[string]uint16{"http": 80, "https": 443} },
+		"port":    func(ports map[string]uint16, name string) uint16 { return ports[name] },
+		"point":   func(x, y int) *Point { return &Point{X: x, Y: y, Label: "p"} },
+		"norm":    func(p Point) int { return p.X*p.X + p.Y*p.Y },
+		"byte":    func(b uint8) uint8 { return b },
+		"not":     func(b bool) bool { return !b },
+		"fail":    func() error { return errors.New("failed") },
+		"nothing": func() {},
+		"crash":   func() int { panic("boom") },
+		"any":     func(v interface{}) string { return fmt.Sprintf("%T", v) },
+	}
+	for name, fn := range functions {
+		if err := it.Register(name, fn); err != nil {
+			t.Fatalf("register %s: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string // the result, or the error
+	}{
+		{"httpStatus(404)", "Not Found"},
+		{"length(httpStatus(404))", "9"},
+		{"httpStatus(500)", "1:11: unknown status 500"},
+		{"try { httpStatus(500) } catch (e) { 0 }", "0"},
+		{"numbers(3)", "[0, 0, 0]"},
+		{"sum(1, 2, 3)", "6"},
+		{"sum()", "0"},
+		{"sumAll(numbers(4))", "4"},
+		{"ports()", "{http: 80, https: 443}"},
+		{"port(ports(), httpStatus(404))", "0"},
+		{"point(1, 2)", "Point{X: 1, Y: 2, label: p}"},
+		{"point(3, 4).Y", "4"},
+		{"norm(point(3, 4))", "25"},
+		{"not(true)", "false"},
+		{"nothing()", "null"},
+		{"fail()", "1:5: failed"},
+		{"crash()", "1:6: crash: panic: boom"},
+		{"any(numbers(1))", "[]interface {}"},
+		{"any(ports())", "map[string]interface {}"},
+		{"any(point(0, 0))", "map[string]interface {}"},
+		{"any(fn() { 1 })", "*object.Closure"},
+		// conversion errors name the argument
+		{"httpStatus(true)", "1:11: argument 1 to httpStatus: cannot use BOOLEAN as int64"},
+		{"port(ports(), 1)", "1:5: argument 2 to port: cannot use INTEGER as string"},
+		{"sum(1, 2, true)", "1:4: argument 3 to sum: cannot use BOOLEAN as int64"},
+		{"byte(256)", "1:5: argument 1 to byte: integer 256 overflows uint8"},
+		{"byte(-1)", "1:5: argument 1 to byte: integer -1 overflows uint8"},
+		{"length(numbers(1))", "1:7: argument 1 to length: cannot use ARRAY as string"},
+		{"norm(ports())", "1:5: argument 1 to norm: cannot use HASH as interp.Point"},
+		{"httpStatus(1, 2)", "1:11: wrong number of arguments to httpStatus: want=1, got=2"},
+	}
+
+	for _, tt := range tests {
+		result, err := it.Run(context.Background(), tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	if err := it.Register("x", 1); err == nil {
+		t.Errorf("expected an error registering a value that is not a function")
+	}
+	if err := it.Register("x", func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("expected an error registering a function with two values")
+	}
+}
@@ -1,16 +1,22 @@
 package lexer
 
-import "github.com/maxild/monkey/internal/token"
+import (
+	"github.com/maxild/monkey/internal/token"
+	"strings"
+)
 
 type Lexer struct {
 	input string
 	position int		// current position in input (points to current char)
 	readPosition int	// current reading position in input (after current char)
 	ch byte				// TODO: Implement Unicode support (byte to rune)
+	line int			// line of current char
+	column int			// column of current char
+	prev token.Type		// type of the last token, which decides if a slash starts a regex
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // position := 0, readPosition := 1, ch := 0 or input[0]
 	return l
 }
@@ -35,13 +41,28 @@ func (l *Lexer) readChar() {
 	// because other procedures in the lexer uses them to slice out values
 	l.position = l.readPosition
 	l.readPosition += 1
+	// the char we just left behind decides if we moved to a new line
+	if l.position > 0 && l.position <= len(l.input) && l.input[l.position-1] == '\n' {
+		l.line += 1
+		l.column = 1
+	} else {
+		l.column += 1
+	}
 }
 
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	l.prev = tok.Type
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
 
+	pos := token.Position{Line: l.line, Column: l.column}
+
 	switch l.ch {
 	// Important to scan for keywords, operators, punctuation before calling anything an identifier
 	case '=':
@@ -56,7 +77,14 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		next := l.peekChar()
+		if next == '>' {
+			prev := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Lexeme: string(prev) + string(next)}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		next := l.peekChar()
 		if next == '=' {
@@ -69,6 +97,11 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '/':
+		if l.regexAllowed() {
+			if lexeme, ok := l.readRegex(); ok {
+				return token.Token{Type: token.REGEX, Lexeme: lexeme, Pos: pos}
+			}
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '<':
 		tok = newToken(token.LT, l.ch)
@@ -78,6 +111,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -86,6 +123,20 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		if value, ok := l.readString(); ok {
+			tok = token.Token{Type: token.STRING, Lexeme: value}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Lexeme: value}
+			if l.ch == 0 { // unterminated
+				tok.Pos = pos
+				return tok
+			}
+		}
 	case 0:
 		//tok = token.Token{Type: token.EOF, Lexeme: ""}
 		tok.Type = token.EOF
@@ -95,10 +146,11 @@ func (l *Lexer) NextToken() token.Token {
 			lexeme := l.readIdentifier()
 			tok.Lexeme = lexeme
 			tok.Type = token.LookupIdent(lexeme)
+			tok.Pos = pos
 			return tok // do not call readChar, readIdentifier has done it already
 		} else if isNumber(l.ch) {
-			tok.Lexeme = l.readNumber()
-			tok.Type = token.INT
+			tok.Lexeme, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -107,6 +159,7 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	}
 
+	tok.Pos = pos
 	l.readChar()
 	return tok
 }
@@ -127,6 +180,82 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// "..." with the escapes \n, \t, \r, \" and \\. Returns the characters between the
+// quotes (leaving the closing quote as the current char), or the source of an
+// unterminated string or of a string with an invalid escape.
+func (l *Lexer) readString() (string, bool) {
+	position := l.position
+	var out strings.Builder
+	valid := true
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			if !valid {
+				return l.input[position:l.readPosition], false
+			}
+			return out.String(), true
+		case 0:
+			return l.input[position:l.position], false
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			case '"', '\\':
+				out.WriteByte(l.ch)
+			case 0:
+				return l.input[position:l.position], false
+			default:
+				valid = false
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+// regexAllowed reports whether a slash starts a regex literal: where an operand is
+// expected, that is not right after one (where it is the division). So a / b and
+// f(x) / 2 divide, but split(/,\s*/, s) and x = /ab+c/i are regexes.
+func (l *Lexer) regexAllowed() bool {
+	switch l.prev {
+	case token.IDENT, token.INT, token.FLOAT, token.STRING, token.REGEX, token.TRUE, token.FALSE,
+		token.RPAREN, token.RBRACKET, token.RBRACE:
+		return false
+	}
+	return true
+}
+
+// /pattern/flags, where the pattern is on one line and \/ is a slash (the other
+// escapes are left to the regex). Returns the source of the literal (leaving the char
+// after it as the current char), or false, without reading anything, if the slash is
+// not closed on its line: then it is a division (or a syntax error).
+func (l *Lexer) readRegex() (string, bool) {
+	end := l.readPosition
+	for ; end < len(l.input) && l.input[end] != '/' && l.input[end] != '\n'; end++ {
+		if l.input[end] == '\\' && end+1 < len(l.input) && (l.input[end+1] == '/' || l.input[end+1] == '\\') {
+			end++
+		}
+	}
+	if end == len(l.input) || l.input[end] != '/' {
+		return "", false
+	}
+
+	position := l.position
+	for l.position <= end {
+		l.readChar()
+	}
+	for isLetter(l.ch) {
+		l.readChar()
+	}
+	return l.input[position:l.position], true
+}
+
 // [0-9]+ is a very simplified regex for defining numbers
 // We are missing
 //  - float
@@ -135,12 +264,39 @@ func (l *Lexer) readIdentifier() string {
 //  - hex
 //  - scientific notation
 //  - negative numbers
-func (l *Lexer) readNumber() string {
+// 123, or a float: 1.5, 1e9, 2.5e-3 (a fraction needs a digit after the dot, so that
+// 1.x is still a field access)
+func (l *Lexer) readNumber() (string, token.Type) {
 	position := l.position
+	typ := token.Type(token.INT)
+	l.readDigits()
+	if l.ch == '.' && isNumber(l.peekChar()) {
+		typ = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		sign := next == '+' || next == '-'
+		if sign && l.readPosition+1 < len(l.input) {
+			next = l.input[l.readPosition+1]
+		}
+		if isNumber(next) {
+			typ = token.FLOAT
+			l.readChar()
+			if sign {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return l.input[position: l.position], typ
+}
+
+func (l *Lexer) readDigits() {
 	for isNumber(l.ch) {
 		l.readChar()
 	}
-	return l.input[position: l.position]
 }
 
 // [a-zA-Z_]
@@ -182,3 +182,233 @@ func TestBug(t *testing.T) {
 	}
 }
 
+
+func TestTypeAnnotationTokens(t *testing.T) {
+	input := `let f: fn([int], {string: int}) -> int;`
+
+	tests := []struct{
+		expectedType token.Type
+		expectedLexeme string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "f"},
+		{token.COLON, ":"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.LBRACKET, "["},
+		{token.IDENT, "int"},
+		{token.RBRACKET, "]"},
+		{token.COMMA, ","},
+		{token.LBRACE, "{"},
+		{token.IDENT, "string"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RBRACE, "}"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "int"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, test.expectedType, tok.Type)
+		}
+
+		if tok.Lexeme != test.expectedLexeme {
+			t.Fatalf("tests[%d] - lexeme wrong. expected=%q, got=%q",
+				i, test.expectedLexeme, tok.Lexeme)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + 10;
+`
+
+	tests := []struct{
+		expectedLexeme string
+		expectedLine int
+		expectedColumn int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"10", 2, 7},
+		{";", 2, 9},
+		{"", 3, 1},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Lexeme != test.expectedLexeme {
+			t.Fatalf("tests[%d] - lexeme wrong. expected=%q, got=%q",
+				i, test.expectedLexeme, tok.Lexeme)
+		}
+
+		if tok.Pos.Line != test.expectedLine || tok.Pos.Column != test.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%s",
+				i, test.expectedLine, test.expectedColumn, tok.Pos)
+		}
+	}
+}
+
+func TestStringTokens(t *testing.T) {
+	input := `"foobar" "foo bar" "" "a\n\t\"b\"\\" x["é":]
+"unterminated`
+
+	tests := []struct{
+		expectedType token.Type
+		expectedLexeme string
+		expectedColumn int
+	}{
+		{token.STRING, "foobar", 1},
+		{token.STRING, "foo bar", 10},
+		{token.STRING, "", 20},
+		{token.STRING, "a\n\t\"b\"\\", 23},
+		{token.IDENT, "x", 38},
+		{token.LBRACKET, "[", 39},
+		{token.STRING, "é", 40},
+		{token.COLON, ":", 44},
+		{token.RBRACKET, "]", 45},
+		{token.ILLEGAL, `"unterminated`, 1},
+		{token.EOF, "", 14},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType || tok.Lexeme != test.expectedLexeme {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, test.expectedType, test.expectedLexeme, tok.Type, tok.Lexeme)
+		}
+		if tok.Pos.Column != test.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%s", i, test.expectedColumn, tok.Pos)
+		}
+	}
+
+	if tok := New(`"a\qb"`).NextToken(); tok.Type != token.ILLEGAL || tok.Lexeme != `"a\qb"` {
+		t.Errorf("expected an illegal escape. got=%s %q", tok.Type, tok.Lexeme)
+	}
+}
+
+func TestNumberTokens(t *testing.T) {
+	input := `5 1.5 0.25e2 1e9 2E-3 7e+1 p.x 1.x 3. 2e`
+
+	tests := []struct{
+		expectedType token.Type
+		expectedLexeme string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, "0.25e2"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "2E-3"},
+		{token.FLOAT, "7e+1"},
+		{token.IDENT, "p"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "1"},	// a fraction needs a digit after the dot
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "3"},
+		{token.DOT, "."},
+		{token.INT, "2"},	// as does an exponent
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType || tok.Lexeme != test.expectedLexeme {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, test.expectedType, test.expectedLexeme, tok.Type, tok.Lexeme)
+		}
+	}
+}
+
+func TestRegexTokens(t *testing.T) {
+	input := `a / b / c;
+f(x) / 2 [1] / /x/i;
+split(/,\s*/, s);
+let re = /a\/b\\/gU / 2;
+-/*5;
+/unclosed
+`
+
+	tests := []struct{
+		expectedType token.Type
+		expectedLexeme string
+	}{
+		{token.IDENT, "a"},
+		{token.SLASH, "/"},	// after an operand, a slash is the division
+		{token.IDENT, "b"},
+		{token.SLASH, "/"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.SLASH, "/"},
+		{token.REGEX, "/x/i"},	// elsewhere, it starts a regex
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "split"},
+		{token.LPAREN, "("},
+		{token.REGEX, `/,\s*/`},
+		{token.COMMA, ","},
+		{token.IDENT, "s"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "re"},
+		{token.ASSIGN, "="},
+		{token.REGEX, `/a\/b\\/gU`},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.MINUS, "-"},
+		{token.SLASH, "/"},	// not closed on its line
+		{token.ASTERISK, "*"},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.SLASH, "/"},
+		{token.IDENT, "unclosed"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != test.expectedType || tok.Lexeme != test.expectedLexeme {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, test.expectedType, test.expectedLexeme, tok.Type, tok.Lexeme)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// The conversions between Go values and Monkey values:
+//
+//	Go                                   Monkey
+//	bool                                 boolean
+//	int, int8, ..., uint64, *big.Int     integer
+//	float32, float64                     float
+//	string                               string
+//	slice, array                         array
+//	map                                  hash
+//	struct (its exported fields)         struct
+//	nil pointer, interface, slice, map   null
+//	Object                               the value itself
+//
+// A pointer converts like the value it points to. A struct field is named by its
+// `monkey` tag, or else by the Go name of the field. A Monkey value converts to an
+// interface{} as a bool, int64 (or *big.Int), float64, string, []interface{},
+// map[string]interface{} (map[interface{}]interface{} if not all its keys are
+// strings), nil, or else the Object itself.
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// FromGo converts the Go value v to a Monkey value
+func FromGo(v interface{}) (Object, error) {
+	return fromGo(reflect.ValueOf(v))
+}
+
+func fromGo(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+	if v.Type().Implements(objectType) {
+		if isNil(v) {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return NewBigInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return NewBigInteger(new(big.Int).SetUint64(u)), nil
+		}
+		return NewInteger(int64(v.Uint())), nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			e, err := fromGo(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %s", i, err)
+			}
+			elements[i] = e
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return mapFromGo(v)
+
+	case reflect.Struct:
+		return structFromGo(v)
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGo(v.Elem())
+	}
+
+	return nil, fmt.Errorf("unsupported Go type %s", v.Type())
+}
+
+// mapFromGo converts a map to a hash, with the keys sorted (as the order of a Go map
+// is not defined)
+func mapFromGo(v reflect.Value) (Object, error) {
+	type entry struct {
+		key        HashKey
+		k, element Object
+	}
+	entries := make([]entry, 0, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		k, err := fromGo(iter.Key())
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %s", iter.Key(), err)
+		}
+		hashable, ok := k.(Hashable)
+		if !ok {
+			return nil, fmt.Errorf("key %v: unusable as hash key: %s", iter.Key(), k.Type())
+		}
+		element, err := fromGo(iter.Value())
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %s", iter.Key(), err)
+		}
+		entries = append(entries, entry{hashable.HashKey(), k, element})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Int != b.Int {
+			return a.Int < b.Int
+		}
+		return a.Str < b.Str
+	})
+
+	h := NewHash()
+	for _, e := range entries {
+		h.Set(e.k, e.element)
+	}
+	return h, nil
+}
+
+// the struct definitions of the Go struct types (a reflect.Type → *goStruct)
+var goStructs sync.Map
+
+type goStruct struct {
+	def    *StructDef
+	fields []int // the index of the Go field of each field of def
+}
+
+func goStructOf(t reflect.Type) *goStruct {
+	if s, ok := goStructs.Load(t); ok {
+		return s.(*goStruct)
+	}
+
+	s := &goStruct{def: &StructDef{Name: t.Name()}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // not exported
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		s.def.Fields = append(s.def.Fields, name)
+		s.fields = append(s.fields, i)
+	}
+
+	actual, _ := goStructs.LoadOrStore(t, s)
+	return actual.(*goStruct)
+}
+
+func structFromGo(v reflect.Value) (Object, error) {
+	s := goStructOf(v.Type())
+	fields := make(map[string]Object, len(s.fields))
+	for i, name := range s.def.Fields {
+		f, err := fromGo(v.Field(s.fields[i]))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", name, err)
+		}
+		fields[name] = f
+	}
+	return &Struct{Def: s.def, Fields: fields}, nil
+}
+
+// ToGo converts the Monkey value obj to a Go value of type t
+func ToGo(obj Object, t reflect.Type) (reflect.Value, error) {
+	// an interface{} gets the natural Go value below, other interfaces (like Object)
+	// the value itself
+	if t.NumMethod() > 0 && reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj).Convert(t), nil
+	}
+	if t == bigIntType {
+		switch obj := obj.(type) {
+		case *Integer:
+			return reflect.ValueOf(big.NewInt(obj.Value)), nil
+		case *BigInteger:
+			return reflect.ValueOf(new(big.Int).Set(obj.Value)), nil
+		}
+		return mismatch(obj, t)
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.SetBool(b.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok || v.OverflowInt(i.Value) {
+			return integerMismatch(obj, t)
+		}
+		v.SetInt(i.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch i := obj.(type) {
+		case *Integer:
+			if i.Value < 0 {
+				return integerMismatch(obj, t)
+			}
+			u = uint64(i.Value)
+		case *BigInteger:
+			if !i.Value.IsUint64() {
+				return integerMismatch(obj, t)
+			}
+			u = i.Value.Uint64()
+		default:
+			return mismatch(obj, t)
+		}
+		if v.OverflowUint(u) {
+			return integerMismatch(obj, t)
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		// an integer converts to the nearest float
+		if !IsNumber(obj) {
+			return mismatch(obj, t)
+		}
+		v.SetFloat(FloatValue(obj))
+
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.SetString(s.Value)
+
+	case reflect.Slice:
+		if obj == NULL {
+			return v, nil
+		}
+		a, ok := obj.(*Array)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.Set(reflect.MakeSlice(t, len(a.Elements), len(a.Elements)))
+		if err := elementsToGo(a, v); err != nil {
+			return v, err
+		}
+
+	case reflect.Array:
+		a, ok := obj.(*Array)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		if len(a.Elements) != t.Len() {
+			return v, fmt.Errorf("cannot use an array of %d elements as %s", len(a.Elements), t)
+		}
+		if err := elementsToGo(a, v); err != nil {
+			return v, err
+		}
+
+	case reflect.Map:
+		if obj == NULL {
+			return v, nil
+		}
+		h, ok := obj.(*Hash)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		v.Set(reflect.MakeMapWithSize(t, h.Len()))
+		for _, k := range h.Keys {
+			pair := h.Pairs[k]
+			key, err := ToGo(pair.Key, t.Key())
+			if err != nil {
+				return v, fmt.Errorf("key %s: %s", pair.Key.Inspect(), err)
+			}
+			element, err := ToGo(pair.Value, t.Elem())
+			if err != nil {
+				return v, fmt.Errorf("key %s: %s", pair.Key.Inspect(), err)
+			}
+			v.SetMapIndex(key, element)
+		}
+
+	case reflect.Struct:
+		s, ok := obj.(*Struct)
+		if !ok {
+			return mismatch(obj, t)
+		}
+		gs := goStructOf(t)
+		for i, name := range gs.def.Fields {
+			f, ok := s.Fields[name]
+			if !ok {
+				continue
+			}
+			fv, err := ToGo(f, t.Field(gs.fields[i]).Type)
+			if err != nil {
+				return v, fmt.Errorf("field %s: %s", name, err)
+			}
+			v.Field(gs.fields[i]).Set(fv)
+		}
+
+	case reflect.Ptr:
+		if obj == NULL {
+			return v, nil
+		}
+		elem, err := ToGo(obj, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+
+	case reflect.Interface:
+		if obj == NULL {
+			return v, nil
+		}
+		natural := toNaturalGo(obj)
+		if !reflect.TypeOf(natural).AssignableTo(t) {
+			return mismatch(obj, t)
+		}
+		v.Set(reflect.ValueOf(natural))
+
+	default:
+		return v, fmt.Errorf("unsupported Go type %s", t)
+	}
+	return v, nil
+}
+
+func elementsToGo(a *Array, v reflect.Value) error {
+	for i, e := range a.Elements {
+		ev, err := ToGo(e, v.Type().Elem())
+		if err != nil {
+			return fmt.Errorf("element %d: %s", i, err)
+		}
+		v.Index(i).Set(ev)
+	}
+	return nil
+}
+
+// toNaturalGo converts obj to the Go value it is most naturally represented by
+func toNaturalGo(obj Object) interface{} {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value)
+	case *Float:
+		return obj.Value
+	case *Boolean:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Null:
+		return nil
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elements[i] = toNaturalGo(e)
+		}
+		return elements
+	case *Hash:
+		stringKeys := true
+		for _, k := range obj.Keys {
+			stringKeys = stringKeys && k.Type == STRING_OBJ
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, obj.Len())
+			obj.Each(func(k, v Object) { m[k.(*String).Value] = toNaturalGo(v) })
+			return m
+		}
+		m := make(map[interface{}]interface{}, obj.Len())
+		obj.Each(func(k, v Object) { m[toNaturalGo(k)] = toNaturalGo(v) })
+		return m
+	case *Struct:
+		m := make(map[string]interface{}, len(obj.Fields))
+		for name, f := range obj.Fields {
+			m[name] = toNaturalGo(f)
+		}
+		return m
+	}
+	return obj
+}
+
+func mismatch(obj Object, t reflect.Type) (reflect.Value, error) {
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
+
+func integerMismatch(obj Object, t reflect.Type) (reflect.Value, error) {
+	if obj.Type() != INTEGER_OBJ {
+		return mismatch(obj, t)
+	}
+	return reflect.Value{}, fmt.Errorf("integer %s overflows %s", obj.Inspect(), t)
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type account struct {
+	Owner   string
+	Balance *big.Int `monkey:"balance"`
+	Tags    []string
+	Ignored int `monkey:"-"`
+	private int
+}
+
+func TestGoRoundTrip(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		inspect string
+	}{
+		{true, "true"},
+		{int8(-5), "-5"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{"monkey", "monkey"},
+		{2.5, "2.5"},
+		{float32(-1), "-1.0"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{map[int][]string{2: {"x"}, -1: nil}, "{-1: null, 2: [x]}"},
+		{account{Owner: "ann", Balance: big.NewInt(10), Tags: []string{"vip"}}, "account{Owner: ann, balance: 10, Tags: [vip]}"},
+		{&account{Owner: "bob", Balance: new(big.Int).Lsh(big.NewInt(1), 100)}, "account{Owner: bob, balance: 1267650600228229401496703205376, Tags: null}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+		if err != nil {
+			t.Errorf("%#v: %s", tt.value, err)
+			continue
+		}
+		if obj.Inspect() != tt.inspect {
+			t.Errorf("%#v: wrong value. want=%s, got=%s", tt.value, tt.inspect, obj.Inspect())
+		}
+
+		back, err := ToGo(obj, reflect.TypeOf(tt.value))
+		if err != nil {
+			t.Errorf("%#v: %s", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(back.Interface(), tt.value) {
+			t.Errorf("wrong round trip. want=%#v, got=%#v", tt.value, back.Interface())
+		}
+	}
+}
+
+func TestToGoNatural(t *testing.T) {
+	h := NewHash()
+	h.Set(&String{Value: "xs"}, &Array{Elements: []Object{NewInteger(1), NULL, TRUE}})
+	var v interface{}
+
+	got, err := ToGo(h, reflect.TypeOf(&v).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"xs": []interface{}{int64(1), nil, true}}
+	if !reflect.DeepEqual(got.Interface(), expected) {
+		t.Errorf("wrong value. want=%#v, got=%#v", expected, got.Interface())
+	}
+
+	// other interfaces get the value itself
+	got, err = ToGo(h, reflect.TypeOf((*Object)(nil)).Elem())
+	if err != nil || got.Interface() != h {
+		t.Errorf("expected the hash itself. got=%v, %v", got, err)
+	}
+}
+
+func TestToGoFloat(t *testing.T) {
+	// an integer converts to the nearest float
+	got, err := ToGo(NewBigInteger(new(big.Int).Lsh(big.NewInt(1), 70)), reflect.TypeOf(0.0))
+	if err != nil || got.Float() != math.Ldexp(1, 70) {
+		t.Errorf("wrong float. got=%v, %v", got, err)
+	}
+	var v interface{}
+	got, err = ToGo(&Float{Value: 0.5}, reflect.TypeOf(&v).Elem())
+	if err != nil || got.Interface() != 0.5 {
+		t.Errorf("wrong natural value. got=%#v, %v", got.Interface(), err)
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	array := &Array{Elements: []Object{NewInteger(1), &String{Value: "x"}}}
+	tests := []struct {
+		obj      Object
+		typ      interface{}
+		expected string
+	}{
+		{TRUE, 0, "cannot use BOOLEAN as int"},
+		{NewInteger(-1), uint(0), "integer -1 overflows uint"},
+		{NewInteger(128), int8(0), "integer 128 overflows int8"},
+		{NewBigInteger(new(big.Int).Lsh(big.NewInt(1), 64)), int64(0), "integer 18446744073709551616 overflows int64"},
+		{array, []int{}, "element 1: cannot use STRING as int"},
+		{array, [3]int{}, "cannot use an array of 2 elements as [3]int"},
+		{&Struct{Def: &StructDef{Name: "a"}, Fields: map[string]Object{"Owner": TRUE}}, account{}, "field Owner: cannot use BOOLEAN as string"},
+		{NULL, "", "cannot use NULL as string"},
+		{&Float{Value: 1}, 0, "cannot use FLOAT as int"},
+		{&String{Value: "1"}, 0.0, "cannot use STRING as float64"},
+		{NewInteger(1), make(chan int), "unsupported Go type chan int"},
+	}
+
+	for _, tt := range tests {
+		_, err := ToGo(tt.obj, reflect.TypeOf(tt.typ))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s to %T: want=%q, got=%v", tt.obj.Inspect(), tt.typ, tt.expected, err)
+		}
+	}
+
+	if _, err := FromGo(map[string]func(){"f": nil}); err == nil || err.Error() != "key f: unsupported Go type func()" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package object
+
+// Environment binds names to values. A function call gets its own environment,
+// enclosed by the environment where the function was defined.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get looks name up in this environment and then in the enclosing ones.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name in this environment (shadowing any outer binding).
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
@@ -0,0 +1,102 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/maxild/monkey/internal/ast"
+)
+
+// Integers and floats form a numeric tower: an operation on an integer and a float
+// converts the integer to the nearest float, and an operation on two integers stays
+// exact. So 7 / 2 is the integer division 3, and 7 / 2.0 the float division 3.5. The
+// float arithmetic is IEEE 754: 1.0 / 0 is inf, and 0.0 / 0 is nan.
+
+// Float is a double precision floating point number
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() Type      { return FLOAT_OBJ }
+func (f *Float) Inspect() string { return FormatFloat(f.Value) }
+
+// FormatFloat returns the shortest representation of f that reads back as f, with a
+// fraction or an exponent (1.0, not 1) to tell it from an integer. The infinities and
+// NaN are inf, -inf and nan.
+func FormatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// FloatLiteral returns the value of the literal
+func FloatLiteral(lit *ast.FloatLiteral) *Float {
+	return &Float{Value: lit.Value}
+}
+
+// IsNumber reports whether obj is an integer or a float
+func IsNumber(obj Object) bool {
+	t := obj.Type()
+	return t == INTEGER_OBJ || t == FLOAT_OBJ
+}
+
+// FloatValue returns the value of the number x (an integer or a float) as a float64,
+// the nearest one for a large integer
+func FloatValue(x Object) float64 {
+	switch x := x.(type) {
+	case *Float:
+		return x.Value
+	case *Integer:
+		return float64(x.Value)
+	case *BigInteger:
+		f, _ := new(big.Float).SetInt(x.Value).Float64()
+		return f
+	}
+	return math.NaN()
+}
+
+// FloatInfix returns the value of the infix operation on two numbers, at least one of
+// them a float: the arithmetic (+, -, * and /) or a comparison (==, !=, < and >) of
+// their values as floats. ok is false for other operators.
+func FloatInfix(operator string, x, y Object) (result Object, ok bool) {
+	a, b := FloatValue(x), FloatValue(y)
+	switch operator {
+	case "+":
+		return &Float{Value: a + b}, true
+	case "-":
+		return &Float{Value: a - b}, true
+	case "*":
+		return &Float{Value: a * b}, true
+	case "/":
+		return &Float{Value: a / b}, true
+	case "==":
+		return nativeBool(a == b), true
+	case "!=":
+		return nativeBool(a != b), true
+	case "<":
+		return nativeBool(a < b), true
+	case ">":
+		return nativeBool(a > b), true
+	}
+	return nil, false
+}
+
+// Negate returns -x for a number x
+func Negate(x Object) Object {
+	if f, ok := x.(*Float); ok {
+		return &Float{Value: -f.Value}
+	}
+	return NegateInteger(x)
+}
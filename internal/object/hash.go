@@ -0,0 +1,88 @@
+package object
+
+import "strings"
+
+// HashKey identifies a value usable as a key of a hash: equal values (like two
+// strings with the same characters) have the same key.
+type HashKey struct {
+	Type Type
+	Int  int64  // of an integer or a boolean
+	Str  string // of a string, or of an integer that does not fit in an int64
+}
+
+// Hashable is implemented by the values usable as keys of a hash
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey    { return HashKey{Type: INTEGER_OBJ, Int: i.Value} }
+func (i *BigInteger) HashKey() HashKey { return HashKey{Type: INTEGER_OBJ, Str: i.Value.String()} }
+func (s *String) HashKey() HashKey     { return HashKey{Type: STRING_OBJ, Str: s.Value} }
+func (b *Boolean) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: BOOLEAN_OBJ, Int: 1}
+	}
+	return HashKey{Type: BOOLEAN_OBJ}
+}
+
+// HashPair is an entry of a hash: the key (the value, not the HashKey) and its value
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values. Its entries are kept in the order their keys were first
+// set.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // in insertion order
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+func (h *Hash) Type() Type { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, k := range h.Keys {
+		pair := h.Pairs[k]
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Len is the number of entries
+func (h *Hash) Len() int { return len(h.Keys) }
+
+// Get returns the value of key, and whether the hash has the key
+func (h *Hash) Get(key Object) (Object, bool) {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return nil, false
+	}
+	pair, ok := h.Pairs[hashable.HashKey()]
+	return pair.Value, ok
+}
+
+// Set sets the value of key. It returns false if the key is not hashable.
+func (h *Hash) Set(key, value Object) bool {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return false
+	}
+	k := hashable.HashKey()
+	if _, ok := h.Pairs[k]; !ok {
+		h.Keys = append(h.Keys, k)
+	}
+	h.Pairs[k] = HashPair{Key: key, Value: value}
+	return true
+}
+
+// Each calls f with the entries in insertion order
+func (h *Hash) Each(f func(key, value Object)) {
+	for _, k := range h.Keys {
+		pair := h.Pairs[k]
+		f(pair.Key, pair.Value)
+	}
+}
@@ -0,0 +1,158 @@
+package object
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"github.com/maxild/monkey/internal/ast"
+)
+
+// Integers are arbitrary-precision. A value that fits in an int64 is always an
+// *Integer, and only larger values are a *BigInteger, so that the arithmetic on small
+// integers takes a fast path without big.Int, and the values of both types compare
+// equal exactly when they are the same number.
+//
+// The fast path allocates nothing for a result in -128..1023 (the preallocated
+// integers), and one *Integer for any other result that fits in an int64.
+
+// BigInteger is an integer that does not fit in an int64
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (i *BigInteger) Type() Type      { return INTEGER_OBJ }
+func (i *BigInteger) Inspect() string { return i.Value.String() }
+
+// the preallocated small integers returned by NewInteger
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 1023
+)
+
+var cachedIntegers = func() []Integer {
+	cache := make([]Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range cache {
+		cache[i].Value = int64(i + minCachedInteger)
+	}
+	return cache
+}()
+
+// NewInteger returns the integer v. The integers in -128..1023 are preallocated, so
+// that computing them does not allocate; any other integer allocates an *Integer.
+func NewInteger(v int64) *Integer {
+	if v >= minCachedInteger && v <= maxCachedInteger {
+		return &cachedIntegers[v-minCachedInteger]
+	}
+	return &Integer{Value: v}
+}
+
+// NewBigInteger returns the integer v, an *Integer if it fits in an int64. v must not
+// be modified afterwards.
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return NewInteger(v.Int64())
+	}
+	return &BigInteger{Value: v}
+}
+
+// IntegerLiteral returns the value of the literal
+func IntegerLiteral(lit *ast.IntegerLiteral) Object {
+	if lit.Big != nil {
+		return &BigInteger{Value: lit.Big}
+	}
+	return NewInteger(lit.Value)
+}
+
+// ErrDivisionByZero is returned by IntegerArithmetic for a division by zero
+var ErrDivisionByZero = errors.New("division by zero")
+
+// IntegerArithmetic returns the result of the operator (+, -, * or /) applied to the
+// integers x and y. The division truncates towards zero.
+func IntegerArithmetic(operator string, x, y Object) (Object, error) {
+	if a, ok := x.(*Integer); ok {
+		if b, ok := y.(*Integer); ok {
+			if r, ok := int64Arithmetic(operator, a.Value, b.Value); ok {
+				return NewInteger(r), nil
+			}
+		}
+	}
+
+	a, b := bigValue(x), bigValue(y)
+	r := new(big.Int)
+	switch operator {
+	case "+":
+		r.Add(a, b)
+	case "-":
+		r.Sub(a, b)
+	case "*":
+		r.Mul(a, b)
+	case "/":
+		if b.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		r.Quo(a, b)
+	}
+	return NewBigInteger(r), nil
+}
+
+// int64Arithmetic is the fast path of IntegerArithmetic. It reports false when the
+// result overflows (or for a division by zero, left to the slow path).
+func int64Arithmetic(operator string, a, b int64) (int64, bool) {
+	switch operator {
+	case "+":
+		r := a + b
+		// overflow iff both operands have the sign the result does not have
+		return r, (a^r)&(b^r) >= 0
+	case "-":
+		r := a - b
+		return r, (a^b)&(a^r) >= 0
+	case "*":
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		r := a * b
+		if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) || r/b != a {
+			return 0, false
+		}
+		return r, true
+	case "/":
+		if b == 0 || (a == math.MinInt64 && b == -1) {
+			return 0, false
+		}
+		return a / b, true
+	}
+	return 0, false
+}
+
+// NegateInteger returns -x
+func NegateInteger(x Object) Object {
+	if a, ok := x.(*Integer); ok && a.Value != math.MinInt64 {
+		return NewInteger(-a.Value)
+	}
+	return NewBigInteger(new(big.Int).Neg(bigValue(x)))
+}
+
+// CompareIntegers returns -1, 0 or +1 when x is less than, equal to or greater than y
+func CompareIntegers(x, y Object) int {
+	if a, ok := x.(*Integer); ok {
+		if b, ok := y.(*Integer); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1
+			case a.Value > b.Value:
+				return 1
+			}
+			return 0
+		}
+	}
+	return bigValue(x).Cmp(bigValue(y))
+}
+
+// bigValue returns the value of the integer x as a big.Int (not to be modified)
+func bigValue(x Object) *big.Int {
+	if i, ok := x.(*BigInteger); ok {
+		return i.Value
+	}
+	return big.NewInt(x.(*Integer).Value)
+}
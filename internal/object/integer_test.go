@@ -0,0 +1,89 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestIntegerArithmetic(t *testing.T) {
+	bigInt := func(s string) Object {
+		v, _ := new(big.Int).SetString(s, 10)
+		return NewBigInteger(v)
+	}
+
+	tests := []struct {
+		operator string
+		x, y     Object
+		expected string
+	}{
+		{"+", NewInteger(1), NewInteger(2), "3"},
+		{"+", NewInteger(math.MaxInt64), NewInteger(1), "9223372036854775808"},
+		{"+", NewInteger(math.MinInt64), NewInteger(-1), "-9223372036854775809"},
+		{"-", NewInteger(math.MinInt64), NewInteger(1), "-9223372036854775809"},
+		{"-", NewInteger(0), NewInteger(math.MinInt64), "9223372036854775808"},
+		{"-", NewInteger(-1), NewInteger(math.MaxInt64), "-9223372036854775808"},
+		{"*", NewInteger(math.MaxInt64), NewInteger(2), "18446744073709551614"},
+		{"*", NewInteger(math.MinInt64), NewInteger(-1), "9223372036854775808"},
+		{"*", NewInteger(-1), NewInteger(math.MinInt64), "9223372036854775808"},
+		{"*", NewInteger(math.MinInt64), NewInteger(1), "-9223372036854775808"},
+		{"*", NewInteger(-4294967296), NewInteger(2147483648), "-9223372036854775808"},
+		{"/", NewInteger(math.MinInt64), NewInteger(-1), "9223372036854775808"},
+		{"/", NewInteger(-7), NewInteger(2), "-3"},
+		{"/", bigInt("-100000000000000000001"), NewInteger(10), "-10000000000000000000"},
+		{"-", bigInt("9223372036854775808"), NewInteger(1), "9223372036854775807"},
+		{"*", bigInt("18446744073709551616"), NewInteger(0), "0"},
+	}
+
+	for _, tt := range tests {
+		result, err := IntegerArithmetic(tt.operator, tt.x, tt.y)
+		if err != nil {
+			t.Fatalf("%s %s %s: unexpected error %s", tt.x.Inspect(), tt.operator, tt.y.Inspect(), err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s %s %s: want=%s, got=%s", tt.x.Inspect(), tt.operator, tt.y.Inspect(), tt.expected, result.Inspect())
+		}
+		// the results that fit in an int64 are small
+		_, small := result.(*Integer)
+		if fits := bigValue(result).IsInt64(); small != fits {
+			t.Errorf("%s %s %s: wrong representation %T", tt.x.Inspect(), tt.operator, tt.y.Inspect(), result)
+		}
+	}
+
+	if _, err := IntegerArithmetic("/", bigInt("18446744073709551616"), NewInteger(0)); err != ErrDivisionByZero {
+		t.Errorf("wrong error for a division by zero. got=%v", err)
+	}
+	if got := NegateInteger(NewInteger(math.MinInt64)).Inspect(); got != "9223372036854775808" {
+		t.Errorf("wrong negation. got=%s", got)
+	}
+	if got := CompareIntegers(bigInt("-18446744073709551616"), NewInteger(math.MinInt64)); got != -1 {
+		t.Errorf("wrong comparison. want=-1, got=%d", got)
+	}
+}
+
+// The arithmetic on int64 integers allocates nothing for a result in the preallocated
+// range -128..1023, and one *Integer for a result outside it
+func TestSmallIntegerAllocations(t *testing.T) {
+	tests := []struct {
+		x, y     int64
+		expected float64
+	}{
+		{600, 400, 0},
+		{1000, 23, 0},
+		{1000, 24, 1},
+		{-100, -28, 0},
+		{-100, -29, 1},
+		{2000, 3000, 1},
+	}
+
+	for _, tt := range tests {
+		x, y := NewInteger(tt.x), NewInteger(tt.y)
+		allocs := testing.AllocsPerRun(100, func() {
+			IntegerArithmetic("+", x, y)
+			CompareIntegers(x, y)
+		})
+		if allocs != tt.expected {
+			t.Errorf("%d + %d: wrong number of allocations. want=%v, got=%v", tt.x, tt.y, tt.expected, allocs)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Package object defines the runtime values of Monkey programs.
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/token"
+)
+
+type Type string
+
+const (
+	INTEGER_OBJ           = "INTEGER"
+	BOOLEAN_OBJ           = "BOOLEAN"
+	NULL_OBJ              = "NULL"
+	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	ERROR_OBJ             = "ERROR"
+	FUNCTION_OBJ          = "FUNCTION"
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	STRUCT_DEF_OBJ        = "STRUCT_DEF"
+	STRUCT_OBJ            = "STRUCT"
+	CONSTRUCTOR_OBJ       = "CONSTRUCTOR"
+	VARIANT_OBJ           = "VARIANT"
+	BUILTIN_OBJ           = "BUILTIN"
+	MODULE_OBJ            = "MODULE"
+	STRING_OBJ            = "STRING"
+	ARRAY_OBJ             = "ARRAY"
+	HASH_OBJ              = "HASH"
+	FLOAT_OBJ             = "FLOAT"
+	REGEX_OBJ             = "REGEX"
+)
+
+// There is only ever one null, true and false value (shared by the evaluator, the
+// virtual machines and the builtins, as they are compared by identity)
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// Every value is represented by a type implementing Object.
+type Object interface {
+	Type() Type
+	Inspect() string // only used for debugging, testing and the REPL
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() Type      { return INTEGER_OBJ }
+func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() Type      { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
+
+// Null is the absence of a value (e.g. the value of `if (false) { 1 }`)
+type Null struct{}
+
+func (n *Null) Type() Type      { return NULL_OBJ }
+func (n *Null) Inspect() string { return "null" }
+
+// ReturnValue wraps the value of a return statement while it travels up to the
+// enclosing function call (or the program).
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() Type      { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
+
+// Error is a runtime error, or a value thrown by a throw statement (then Thrown is
+// the value). Like a ReturnValue it travels up, through the calls, until it is
+// caught by a try expression (or reaches the program).
+type Error struct {
+	Message string
+	Pos     token.Position // where the error happened
+	Thrown  Object         // nil for runtime errors
+}
+
+func (e *Error) Type() Type { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// Function is a closure: a function literal together with the environment it
+// was defined in.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() Type { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode of a function literal (a constant of the compiled
+// program). At runtime it is wrapped in a Closure.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string // the name it is bound to by a let statement (if any)
+	SourceMap     code.SourceMap
+}
+
+func (cf *CompiledFunction) Type() Type { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function together with the values of its free variables
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() Type { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+//
+// Records (structs)
+//
+
+// StructDef is the value a struct declaration binds its name to. The defaults of
+// the fields are either expressions (tree-walking evaluator) or compiled closures
+// without parameters (vm).
+type StructDef struct {
+	Name         string
+	Fields       []string
+	Defaults     map[string]ast.Expression // evaluated in Env when a literal omits the field
+	Env          *Environment
+	Initializers map[string]*Closure // called when a literal omits the field
+}
+
+func (sd *StructDef) Type() Type      { return STRUCT_DEF_OBJ }
+func (sd *StructDef) Inspect() string { return "struct " + sd.Name }
+
+// HasField reports whether the struct declares a field called name.
+func (sd *StructDef) HasField(name string) bool {
+	for _, f := range sd.Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+type Struct struct {
+	Def    *StructDef
+	Fields map[string]Object
+}
+
+func (s *Struct) Type() Type { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	fields := []string{}
+	for _, name := range s.Def.Fields {
+		fields = append(fields, name+": "+s.Fields[name].Inspect())
+	}
+	return s.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+//
+// Tagged unions (enums)
+//
+
+// Constructor is the value a variant with fields is bound to. Calling it
+// builds a Variant.
+type Constructor struct {
+	Enum   string
+	Name   string
+	Fields []string
+}
+
+func (c *Constructor) Type() Type { return CONSTRUCTOR_OBJ }
+func (c *Constructor) Inspect() string {
+	return c.Enum + "." + c.Name + "(" + strings.Join(c.Fields, ", ") + ")"
+}
+
+type Variant struct {
+	Enum   string
+	Name   string
+	Values []Object // one per field of the variant
+}
+
+func (v *Variant) Type() Type { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	if len(v.Values) == 0 {
+		return v.Name
+	}
+	values := []string{}
+	for _, val := range v.Values {
+		values = append(values, val.Inspect())
+	}
+	return v.Name + "(" + strings.Join(values, ", ") + ")"
+}
+
+//
+// Strings and arrays (hashes are in hash.go)
+//
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() Type      { return STRING_OBJ }
+func (s *String) Inspect() string { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() Type { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+//
+// Builtins
+//
+
+// BuiltinFunction is the Go implementation of a builtin. It returns nil for null, and
+// an *Error for a runtime error, which is positioned at the call when its Pos is not
+// set.
+type BuiltinFunction func(args ...Object) Object
+
+// CallFunction calls a function value of the program (a function, a constructor or a
+// builtin) with args, and returns its value, or an *Error for an error or a value
+// thrown by the function. It is provided to the higher-order builtins by the backend
+// running the program.
+type CallFunction func(fn Object, args ...Object) Object
+
+// HigherOrderFunction is the Go implementation of a builtin taking functions as
+// arguments, which it calls with call. An *Error returned by call is returned as is,
+// so that a thrown value keeps bubbling up.
+type HigherOrderFunction func(call CallFunction, args ...Object) Object
+
+// SizeFunction projects the size (see SizeOf) of the value a builtin returns for args,
+// without building it. It returns 0 for arguments the builtin rejects.
+type SizeFunction func(args ...Object) int
+
+// Builtin is a function implemented by the host, by either Fn or HigherOrder. A
+// builtin that can build a value much bigger than its arguments has a Size, which a
+// backend limiting the memory of a run checks before the call.
+type Builtin struct {
+	Name        string // qualified by the module, e.g. "time.now"
+	Fn          BuiltinFunction
+	HigherOrder HigherOrderFunction
+	Size        SizeFunction
+}
+
+// Call calls the builtin, with call for calling the functions it is passed
+func (b *Builtin) Call(call CallFunction, args ...Object) Object {
+	if b.HigherOrder != nil {
+		return b.HigherOrder(call, args...)
+	}
+	return b.Fn(args...)
+}
+
+func (b *Builtin) Type() Type      { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string { return "builtin " + b.Name }
+
+// Module is a namespace of builtins (and other values), whose members are accessed
+// like the fields of a struct, e.g. time.now()
+type Module struct {
+	Name    string
+	Members map[string]Object
+}
+
+func (m *Module) Type() Type      { return MODULE_OBJ }
+func (m *Module) Inspect() string { return "module " + m.Name }
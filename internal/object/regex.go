@@ -0,0 +1,55 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/maxild/monkey/internal/ast"
+)
+
+// Regular expressions have the RE2 syntax of Go's regexp package, which matches in
+// time linear in the length of the input. A literal /pattern/flags has the flags i
+// (case-insensitive), m (multi-line: ^ and $ match at the lines), s (. matches \n) and
+// U (ungreedy).
+
+// Regex is a compiled regular expression
+type Regex struct {
+	Pattern string
+	Flags   string
+	Value   *regexp.Regexp
+}
+
+func (r *Regex) Type() Type      { return REGEX_OBJ }
+func (r *Regex) Inspect() string { return "/" + r.Pattern + "/" + r.Flags }
+
+// NewRegex compiles the pattern with the flags
+func NewRegex(pattern, flags string) (*Regex, error) {
+	for i, f := range flags {
+		if !strings.ContainsRune("imsU", f) {
+			return nil, fmt.Errorf("invalid flag %q", f)
+		}
+		if strings.ContainsRune(flags[:i], f) {
+			return nil, fmt.Errorf("duplicate flag %q", f)
+		}
+	}
+	expr := pattern
+	if flags != "" {
+		expr = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(expr)
+	if syntaxErr, ok := err.(*syntax.Error); ok {
+		return nil, errors.New(string(syntaxErr.Code)) // without the pattern
+	} else if err != nil {
+		return nil, err
+	}
+	return &Regex{Pattern: pattern, Flags: flags, Value: re}, nil
+}
+
+// RegexLiteral returns the value of the literal, whose pattern and flags the parser
+// has checked
+func RegexLiteral(lit *ast.RegexLiteral) (*Regex, error) {
+	return NewRegex(lit.Pattern, lit.Flags)
+}
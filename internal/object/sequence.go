@@ -0,0 +1,142 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// The indexing operators on sequences (strings and arrays) and hashes. Arrays, like
+// strings, are immutable: the operators and the builtins return new arrays.
+
+// Len returns the number of elements of a string (its runes), an array or a hash, or
+// false if obj has no length
+func Len(obj Object) (int, bool) {
+	switch obj := obj.(type) {
+	case *String:
+		return utf8.RuneCountInString(obj.Value), true
+	case *Array:
+		return len(obj.Elements), true
+	case *Hash:
+		return obj.Len(), true
+	}
+	return 0, false
+}
+
+// Index returns the element of obj at index: the rune of a string (as a string), the
+// element of an array, or the value of a key of a hash (NULL if the hash has no such
+// key)
+func Index(obj, index Object) (Object, error) {
+	switch obj := obj.(type) {
+	case *String:
+		i, err := indexValue(index)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range obj.Value {
+			if i == 0 {
+				return &String{Value: string(r)}, nil
+			}
+			i--
+		}
+		return nil, fmt.Errorf("index out of range: %s with length %d", index.Inspect(), utf8.RuneCountInString(obj.Value))
+
+	case *Array:
+		i, err := indexValue(index)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= len(obj.Elements) {
+			return nil, fmt.Errorf("index out of range: %s with length %d", index.Inspect(), len(obj.Elements))
+		}
+		return obj.Elements[i], nil
+
+	case *Hash:
+		if _, ok := index.(Hashable); !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		if value, ok := obj.Get(index); ok {
+			return value, nil
+		}
+		return NULL, nil
+	}
+	return nil, fmt.Errorf("index operator not supported: %s", obj.Type())
+}
+
+// Slice returns the elements of a string or an array from low up to (not including)
+// high. A NULL bound is the start (low) or the end (high).
+func Slice(obj, low, high Object) (Object, error) {
+	switch obj := obj.(type) {
+	case *String:
+		length := utf8.RuneCountInString(obj.Value)
+		from, to, err := sliceBounds(low, high, length)
+		if err != nil {
+			return nil, err
+		}
+		start, end := runeOffset(obj.Value, from), runeOffset(obj.Value, to)
+		return &String{Value: obj.Value[start:end]}, nil
+
+	case *Array:
+		from, to, err := sliceBounds(low, high, len(obj.Elements))
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, to-from)
+		copy(elements, obj.Elements[from:to])
+		return &Array{Elements: elements}, nil
+	}
+	return nil, fmt.Errorf("slice operator not supported: %s", obj.Type())
+}
+
+// runeOffset returns the byte offset of the rune at index i of s (len(s) for the end)
+func runeOffset(s string, i int) int {
+	for offset := range s {
+		if i == 0 {
+			return offset
+		}
+		i--
+	}
+	return len(s)
+}
+
+// indexValue returns the integer index. A negative index is out of range (-1 is
+// returned as is).
+func indexValue(index Object) (int, error) {
+	i, ok := index.(*Integer)
+	if !ok {
+		if index.Type() == INTEGER_OBJ { // a big integer
+			return -1, nil
+		}
+		return 0, fmt.Errorf("index must be INTEGER, got %s", index.Type())
+	}
+	if i.Value < 0 || i.Value > int64(^uint(0)>>1) {
+		return -1, nil
+	}
+	return int(i.Value), nil
+}
+
+// sliceBounds checks the bounds of a slice of a sequence of the length
+func sliceBounds(low, high Object, length int) (int, int, error) {
+	from, to := 0, length
+	var err error
+	if low != NULL {
+		if from, err = indexValue(low); err != nil {
+			return 0, 0, err
+		}
+	}
+	if high != NULL {
+		if to, err = indexValue(high); err != nil {
+			return 0, 0, err
+		}
+	}
+	if from < 0 || to < 0 || from > to || to > length {
+		return 0, 0, fmt.Errorf("slice bounds out of range: [%s:%s] with length %d", boundString(low), boundString(high), length)
+	}
+	return from, to, nil
+}
+
+func boundString(bound Object) string {
+	if bound == NULL {
+		return ""
+	}
+	return bound.Inspect()
+}
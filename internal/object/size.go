@@ -0,0 +1,97 @@
+package object
+
+// The estimated sizes of values, in bytes (of a 64-bit Go runtime), by which a backend
+// limits the memory a run allocates
+const (
+	SizeWord    = 8
+	SizeInteger = 2 * SizeWord
+	SizeFloat   = 2 * SizeWord
+	SizeClosure = 6 * SizeWord // the object, and the header of its free variables
+	SizeStruct  = 8 * SizeWord // the object and its map of fields
+	SizeField   = 4 * SizeWord
+	SizeVariant = 6 * SizeWord
+	SizeString  = 3 * SizeWord // and the bytes
+	SizeArray   = 4 * SizeWord // and the elements
+	SizeHash    = 8 * SizeWord // and the entries
+	SizeEntry   = 6 * SizeWord
+	SizeRegex   = 16 * SizeWord // and its program, about 2 words a byte of the pattern
+)
+
+// SizeOf estimates the size of a value with the values it holds (the elements of an
+// array, the keys and values of a hash, the fields of a struct or a variant). A value
+// held more than once is counted once.
+func SizeOf(obj Object) int {
+	s := sizer{}
+	return s.size(obj)
+}
+
+type sizer struct {
+	seen map[Object]bool // the strings and the containers counted
+}
+
+// counted reports whether obj has been counted already, and marks it counted
+func (s *sizer) counted(obj Object) bool {
+	if s.seen == nil {
+		s.seen = map[Object]bool{}
+	}
+	if s.seen[obj] {
+		return true
+	}
+	s.seen[obj] = true
+	return false
+}
+
+func (s *sizer) size(obj Object) int {
+	switch obj := obj.(type) {
+	case *String:
+		if s.counted(obj) {
+			return 0
+		}
+		return SizeString + len(obj.Value)
+	case *Array:
+		if s.counted(obj) {
+			return 0
+		}
+		n := SizeArray + len(obj.Elements)*SizeWord
+		for _, e := range obj.Elements {
+			n += s.size(e)
+		}
+		return n
+	case *Hash:
+		if s.counted(obj) {
+			return 0
+		}
+		n := SizeHash + obj.Len()*SizeEntry
+		obj.Each(func(key, value Object) {
+			n += s.size(key) + s.size(value)
+		})
+		return n
+	case *Struct:
+		if s.counted(obj) {
+			return 0
+		}
+		n := SizeStruct + len(obj.Fields)*SizeField
+		for _, v := range obj.Fields {
+			n += s.size(v)
+		}
+		return n
+	case *Variant:
+		if s.counted(obj) {
+			return 0
+		}
+		n := SizeVariant + len(obj.Values)*SizeWord
+		for _, v := range obj.Values {
+			n += s.size(v)
+		}
+		return n
+	case *Float:
+		return SizeFloat
+	case *Regex:
+		return SizeRegex + len(obj.Pattern)*2*SizeWord
+	case *BigInteger:
+		return SizeInteger + 3*SizeWord + len(obj.Value.Bits())*SizeWord
+	case *Boolean, *Null:
+		return 0
+	}
+	return SizeInteger
+}
@@ -0,0 +1,30 @@
+package object
+
+import "testing"
+
+func TestSizeOf(t *testing.T) {
+	s := &String{Value: "abcd"}
+	pair := &Array{Elements: []Object{s, s}}
+	hash := NewHash()
+	hash.Set(&String{Value: "k"}, pair)
+
+	tests := []struct {
+		obj      Object
+		expected int
+	}{
+		{NewInteger(1), SizeInteger},
+		{TRUE, 0},
+		{s, SizeString + 4},
+		// a value held twice is counted once
+		{pair, SizeArray + 2*SizeWord + SizeString + 4},
+		{&Array{Elements: []Object{pair, pair, NULL}}, SizeArray + 3*SizeWord + SizeArray + 2*SizeWord + SizeString + 4},
+		{hash, SizeHash + SizeEntry + SizeString + 1 + SizeArray + 2*SizeWord + SizeString + 4},
+		{&Variant{Enum: "L", Name: "Cons", Values: []Object{NewInteger(1), NULL}}, SizeVariant + 2*SizeWord + SizeInteger},
+	}
+
+	for i, tt := range tests {
+		if got := SizeOf(tt.obj); got != tt.expected {
+			t.Errorf("tests[%d]: wrong size of %s. want=%d, got=%d", i, tt.obj.Inspect(), tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package object
+
+// Strings are immutable sequences of Unicode characters (runes), encoded in UTF-8. Their
+// length, indexes and slices count runes, not bytes.
+
+// StringInfix returns the value of the infix operation on two strings: the
+// concatenation (+), or a comparison (==, !=, < and > in lexical order of the bytes,
+// which is the order of the runes). ok is false for other operators.
+func StringInfix(operator string, x, y *String) (result Object, ok bool) {
+	switch operator {
+	case "+":
+		return &String{Value: x.Value + y.Value}, true
+	case "==":
+		return nativeBool(x.Value == y.Value), true
+	case "!=":
+		return nativeBool(x.Value != y.Value), true
+	case "<":
+		return nativeBool(x.Value < y.Value), true
+	case ">":
+		return nativeBool(x.Value > y.Value), true
+	}
+	return nil, false
+}
+
+func nativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
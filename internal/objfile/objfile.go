@@ -0,0 +1,467 @@
+// Package objfile reads and writes compiled programs, so that a script can be run
+// without lexing, parsing and compiling it again.
+//
+// An object file is laid out as follows (integers are unsigned varints unless noted,
+// strings are a length followed by the bytes):
+//
+//	magic       "\x00MKY"
+//	version     uint16, big endian
+//	names       count, then the names
+//	constants   count, then a tag byte and the payload of every constant
+//	main        the code of the program
+//	checksum    uint32, big endian: CRC-32 (IEEE) of everything before it
+//
+// The code of the program and of every function is the length and the bytes of the
+// instructions followed by the source map: the number of entries, then the offset
+// (relative to the previous entry), line and column of every entry. The AST nodes of
+// the source map are not written, so they are nil in a loaded program.
+//
+// Read verifies the checksum, and then that every instruction is well-formed and refers
+// to existing constants, names, locals, free variables and jump targets. A truncated,
+// corrupted or otherwise malformed file is rejected with a *FormatError. The checksum
+// detects accidental damage, not forgery: the stack discipline of the instructions is
+// not verified, so only load files written by Write.
+package objfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Magic starts every object file
+const Magic = "\x00MKY"
+
+// Version is the version of the format written by Write. Read only accepts files of
+// this version. It changes with the numbering of the opcodes (version 2 added
+// OpTailCall).
+const Version = 2
+
+const (
+	headerSize   = len(Magic) + 2
+	checksumSize = 4
+)
+
+// The tags of the constants
+const (
+	tagInteger byte = iota + 1
+	tagFunction
+	tagStructDef
+	tagConstructor
+	tagVariant
+	tagBigInteger // in decimal, as a string
+	tagString
+	tagFloat // the IEEE 754 bits, uint64 little endian
+	tagRegex // the pattern and the flags, compiled when read
+)
+
+// FormatError reports a malformed object file
+type FormatError struct {
+	Offset int // of the malformed data in the file, -1 for malformed instructions
+	Msg    string
+}
+
+func (e *FormatError) Error() string {
+	if e.Offset < 0 {
+		return "objfile: " + e.Msg
+	}
+	return fmt.Sprintf("objfile: offset %d: %s", e.Offset, e.Msg)
+}
+
+// IsObjectFile reports whether data starts with the magic of an object file
+func IsObjectFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+//
+// Writing
+//
+
+// Write writes bytecode to w in the object file format
+func Write(w io.Writer, bytecode *compiler.Bytecode) error {
+	data, err := Encode(bytecode)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Encode returns bytecode in the object file format
+func Encode(bytecode *compiler.Bytecode) ([]byte, error) {
+	e := &encoder{}
+	e.buf.WriteString(Magic)
+	e.buf.Write([]byte{Version >> 8, Version & 0xff})
+
+	e.uint(len(bytecode.Names))
+	for _, name := range bytecode.Names {
+		e.string(name)
+	}
+
+	e.uint(len(bytecode.Constants))
+	for i, c := range bytecode.Constants {
+		if err := e.constant(c); err != nil {
+			return nil, fmt.Errorf("objfile: constant %d: %s", i, err)
+		}
+	}
+
+	e.code(bytecode.Instructions, bytecode.SourceMap)
+
+	var sum [checksumSize]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(e.buf.Bytes()))
+	e.buf.Write(sum[:])
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(n int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func (e *encoder) int(n int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutVarint(b[:], n)])
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uint(len(ss))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.int(obj.Value)
+
+	case *object.BigInteger:
+		e.buf.WriteByte(tagBigInteger)
+		e.string(obj.Value.String())
+
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+
+	case *object.Float:
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(obj.Value))
+		e.buf.WriteByte(tagFloat)
+		e.buf.Write(b[:])
+
+	case *object.Regex:
+		e.buf.WriteByte(tagRegex)
+		e.string(obj.Pattern)
+		e.string(obj.Flags)
+
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.string(obj.Name)
+		e.uint(obj.NumParameters)
+		e.uint(obj.NumLocals)
+		e.code(obj.Instructions, obj.SourceMap)
+
+	case *object.StructDef:
+		// a template: only whether a field has an initializer is recorded
+		e.buf.WriteByte(tagStructDef)
+		e.string(obj.Name)
+		e.uint(len(obj.Fields))
+		for _, f := range obj.Fields {
+			e.string(f)
+			if _, ok := obj.Initializers[f]; ok {
+				e.buf.WriteByte(1)
+			} else {
+				e.buf.WriteByte(0)
+			}
+		}
+
+	case *object.Constructor:
+		e.buf.WriteByte(tagConstructor)
+		e.string(obj.Enum)
+		e.string(obj.Name)
+		e.strings(obj.Fields)
+
+	case *object.Variant:
+		if len(obj.Values) != 0 {
+			return fmt.Errorf("cannot write variant %s with values", obj.Name)
+		}
+		e.buf.WriteByte(tagVariant)
+		e.string(obj.Enum)
+		e.string(obj.Name)
+
+	default:
+		return fmt.Errorf("cannot write constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+func (e *encoder) code(ins code.Instructions, sm code.SourceMap) {
+	e.uint(len(ins))
+	e.buf.Write(ins)
+
+	e.uint(len(sm))
+	prev := 0
+	for _, sp := range sm {
+		e.uint(sp.Offset - prev)
+		e.uint(sp.Pos.Line)
+		e.uint(sp.Pos.Column)
+		prev = sp.Offset
+	}
+}
+
+//
+// Reading
+//
+
+// Read reads a program in the object file format from r
+func Read(r io.Reader) (*compiler.Bytecode, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// Decode returns the program encoded in data (see Encode)
+func Decode(data []byte) (*compiler.Bytecode, error) {
+	if len(data) < headerSize+checksumSize {
+		return nil, &FormatError{Offset: len(data), Msg: "file too short"}
+	}
+	if !IsObjectFile(data) {
+		return nil, &FormatError{Offset: 0, Msg: "not an object file"}
+	}
+	if v := binary.BigEndian.Uint16(data[len(Magic):]); v != Version {
+		return nil, &FormatError{Offset: len(Magic), Msg: fmt.Sprintf("unsupported version %d (want %d)", v, Version)}
+	}
+	body := data[:len(data)-checksumSize]
+	if binary.BigEndian.Uint32(data[len(body):]) != crc32.ChecksumIEEE(body) {
+		return nil, &FormatError{Offset: len(body), Msg: "checksum mismatch"}
+	}
+
+	d := &decoder{data: body, off: headerSize}
+	bytecode := &compiler.Bytecode{}
+
+	if n := d.count(); n > 0 {
+		bytecode.Names = make([]string, n)
+		for i := range bytecode.Names {
+			bytecode.Names[i] = d.string()
+		}
+	}
+	if n := d.count(); n > 0 {
+		bytecode.Constants = make([]object.Object, n)
+		for i := range bytecode.Constants {
+			bytecode.Constants[i] = d.constant()
+		}
+	}
+	bytecode.Instructions, bytecode.SourceMap = d.code()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.off != len(body) {
+		return nil, &FormatError{Offset: d.off, Msg: "unexpected data after the program"}
+	}
+	if err := verify(bytecode); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+// decoder reads the body of a file. After the first error, it reads zero values and
+// keeps that error.
+type decoder struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = &FormatError{Offset: d.off, Msg: fmt.Sprintf(format, a...)}
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.off >= len(d.data) {
+		d.fail("unexpected end of file")
+		return 0
+	}
+	b := d.data[d.off]
+	d.off++
+	return b
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data[d.off:])
+	if size <= 0 || n > 1<<31-1 {
+		d.fail("malformed unsigned integer")
+		return 0
+	}
+	d.off += size
+	return int(n)
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Varint(d.data[d.off:])
+	if size <= 0 {
+		d.fail("malformed integer")
+		return 0
+	}
+	d.off += size
+	return n
+}
+
+// count reads the number of elements of a list. Every element takes at least one
+// byte, so a count larger than the rest of the file is malformed (and not allocated).
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data)-d.off {
+		d.fail("count %d exceeds the size of the file", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[d.off:])
+	d.off += n
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	var ss []string
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		ss = append(ss, d.string())
+	}
+	return ss
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: d.int()}
+
+	case tagBigInteger:
+		s := d.string()
+		v, ok := new(big.Int).SetString(s, 10)
+		if d.err == nil && (!ok || v.IsInt64()) {
+			d.fail("malformed big integer %q", s)
+		}
+		return &object.BigInteger{Value: v}
+
+	case tagString:
+		return &object.String{Value: d.string()}
+
+	case tagFloat:
+		if len(d.data)-d.off < 8 {
+			d.fail("unexpected end of file")
+			return &object.Float{}
+		}
+		bits := binary.LittleEndian.Uint64(d.data[d.off:])
+		d.off += 8
+		return &object.Float{Value: math.Float64frombits(bits)}
+
+	case tagRegex:
+		pattern, flags := d.string(), d.string()
+		re, err := object.NewRegex(pattern, flags)
+		if err != nil {
+			d.fail("malformed regex /%s/%s: %s", pattern, flags, err)
+			return &object.Regex{Pattern: pattern, Flags: flags}
+		}
+		return re
+
+	case tagFunction:
+		fn := &object.CompiledFunction{Name: d.string()}
+		fn.NumParameters = d.uint()
+		fn.NumLocals = d.uint()
+		if fn.NumLocals > code.NoBindings || fn.NumParameters > fn.NumLocals {
+			d.fail("function %s has %d parameters and %d locals", fn.Name, fn.NumParameters, fn.NumLocals)
+		}
+		fn.Instructions, fn.SourceMap = d.code()
+		return fn
+
+	case tagStructDef:
+		def := &object.StructDef{Name: d.string(), Initializers: map[string]*object.Closure{}}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			name := d.string()
+			def.Fields = append(def.Fields, name)
+			switch d.byte() {
+			case 0:
+			case 1:
+				def.Initializers[name] = nil
+			default:
+				d.fail("malformed field %s of struct %s", name, def.Name)
+			}
+		}
+		return def
+
+	case tagConstructor:
+		c := &object.Constructor{Enum: d.string(), Name: d.string()}
+		c.Fields = d.strings()
+		return c
+
+	case tagVariant:
+		return &object.Variant{Enum: d.string(), Name: d.string()}
+
+	default:
+		if d.err == nil {
+			d.off--
+			d.fail("unknown constant tag %d", tag)
+		}
+		return nil
+	}
+}
+
+func (d *decoder) code() (code.Instructions, code.SourceMap) {
+	ins := code.Instructions(d.bytes())
+
+	var sm code.SourceMap
+	offset := 0
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		offset += d.uint()
+		if offset > len(ins) {
+			d.fail("source map offset %d out of range", offset)
+		}
+		pos := token.Position{Line: d.uint(), Column: d.uint()}
+		sm = append(sm, code.SourcePos{Offset: offset, Pos: pos})
+	}
+	return ins, sm
+}
@@ -0,0 +1,304 @@
+package objfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+	"github.com/maxild/monkey/internal/vm"
+)
+
+const program = `
+let fibonacci = fn(x) { if (x < 2) { x } else { fibonacci(x - 1) + fibonacci(x - 2) } };
+let adder = fn(a) { fn(b) { a + b } };
+struct Point { x, y = -2 }
+enum Shape { Circle(r), Empty }
+let area = fn(s) { if (let Circle(r) = s) { 3 * r * r } else { 0 } };
+let safe = fn(n) { try { 10 / n } catch (e) { -1 } finally { 0 } };
+let big = 100000000000000000000;
+let name = fn(s) { if ("mon" + s[1:] == "monkey") { 1 } else { 0 } };
+let half = 0.5;
+let words = /\w+/i;
+fibonacci(10) + adder(1)(2) + Point{x: 4}.y + area(Circle(2)) + area(Empty) + safe(0) + (big - 99999999999999999999) + name("dkey") + (if (half * 4 == 2) { 1 } else { 0 })
+`
+
+func TestRoundTrip(t *testing.T) {
+	bytecode := compile(t, program)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, bytecode); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	loaded, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+
+	if got, want := run(t, loaded), run(t, bytecode); got != want {
+		t.Errorf("wrong result of the loaded program. want=%s, got=%s", want, got)
+	}
+	// 55 + 3 + -2 + 12 + 0 + -1 + 1 + 1 + 1
+	if got := run(t, loaded); got != "70" {
+		t.Errorf("wrong result. want=70, got=%s", got)
+	}
+
+	// a regex is compiled again when read
+	regexes := 0
+	for _, c := range loaded.Constants {
+		if re, ok := c.(*object.Regex); ok {
+			regexes++
+			if re.Inspect() != `/\w+/i` || !re.Value.MatchString("W") {
+				t.Errorf("wrong regex. got=%s", re.Inspect())
+			}
+		}
+	}
+	if regexes != 1 {
+		t.Errorf("wrong number of regexes. want=1, got=%d", regexes)
+	}
+
+	if !bytes.Equal(loaded.Instructions, bytecode.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%s\ngot =%s", bytecode.Instructions, loaded.Instructions)
+	}
+	if len(loaded.Names) != len(bytecode.Names) {
+		t.Errorf("wrong names. want=%v, got=%v", bytecode.Names, loaded.Names)
+	}
+	for i, sp := range bytecode.SourceMap {
+		got := loaded.SourceMap[i]
+		if got.Offset != sp.Offset || got.Pos != sp.Pos || got.Node != nil {
+			t.Errorf("wrong source map entry %d. want=%d %s, got=%d %s %v",
+				i, sp.Offset, sp.Pos, got.Offset, got.Pos, got.Node)
+		}
+	}
+
+	for i, c := range bytecode.Constants {
+		if c.Inspect() != loaded.Constants[i].Inspect() && c.Type() != object.COMPILED_FUNCTION_OBJ {
+			t.Errorf("wrong constant %d. want=%s, got=%s", i, c.Inspect(), loaded.Constants[i].Inspect())
+		}
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			got, ok := loaded.Constants[i].(*object.CompiledFunction)
+			if !ok || got.Name != fn.Name || got.NumParameters != fn.NumParameters || got.NumLocals != fn.NumLocals {
+				t.Errorf("wrong function constant %d. want=%+v, got=%+v", i, fn, loaded.Constants[i])
+			}
+		}
+	}
+}
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	loaded, err := Decode(encode(t, compile(t, "let f = fn(x) {\n  x / 0\n};\nf(1)")))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	err = vm.New(loaded).Run()
+	if err == nil || err.Error() != "2:5: division by zero" {
+		t.Errorf("wrong runtime error. want=%q, got=%v", "2:5: division by zero", err)
+	}
+}
+
+func TestTruncatedFiles(t *testing.T) {
+	data := encode(t, compile(t, program))
+
+	for n := 0; n < len(data); n++ {
+		_, err := Decode(data[:n])
+		if _, ok := err.(*FormatError); !ok {
+			t.Fatalf("file truncated to %d bytes: expected *FormatError, got %v", n, err)
+		}
+	}
+}
+
+func TestCorruptedFiles(t *testing.T) {
+	data := encode(t, compile(t, program))
+
+	for i := range data {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] ^= 0x20
+		if _, err := Decode(corrupted); err == nil {
+			t.Fatalf("byte %d flipped: expected an error", i)
+		}
+	}
+}
+
+// TestMalformedFiles decodes files with a valid checksum but malformed content
+func TestMalformedFiles(t *testing.T) {
+	valid := compile(t, "let f = fn(x) { x + 1 }; f(2)")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{
+			"wrong magic",
+			[]byte("\x00MKZ\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00"),
+			"objfile: offset 0: not an object file",
+		},
+		{
+			"unsupported version",
+			withChecksum([]byte(Magic + "\x00\x01\x00\x00\x00\x00")),
+			"objfile: offset 4: unsupported version 1 (want 2)",
+		},
+		{
+			"huge count",
+			withChecksum([]byte(Magic + "\x00\x02\xff\xff\xff\x07")),
+			"objfile: offset 10: count 16777215 exceeds the size of the file",
+		},
+		{
+			"unknown constant tag",
+			withChecksum([]byte(Magic + "\x00\x02\x00\x01\xff")),
+			"objfile: offset 8: unknown constant tag 255",
+		},
+		{
+			"invalid regex",
+			withChecksum([]byte(Magic + "\x00\x02\x00\x01\x09\x01(\x00")),
+			"objfile: offset 12: malformed regex /(/: missing closing )",
+		},
+		{
+			"big integer in the range of an int64",
+			withChecksum([]byte(Magic + "\x00\x02\x00\x01\x06\x0212")),
+			"objfile: offset 12: malformed big integer \"12\"",
+		},
+		{
+			"trailing data",
+			withChecksum(append(body(t, valid), 0)),
+			"unexpected data after the program",
+		},
+		{
+			"undefined opcode",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				b.Instructions = append(b.Instructions, 0xfe)
+			}),
+			"objfile: main: instruction 0016: opcode 254 undefined",
+		},
+		{
+			"truncated instruction",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				b.Instructions = append(b.Instructions, byte(code.OpConstant), 0)
+			}),
+			"main: instruction 0016: truncated OpConstant",
+		},
+		{
+			"constant out of range",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				b.Instructions = append(b.Instructions, code.Make(code.OpConstant, 99)...)
+			}),
+			"main: instruction 0016: constant 99 out of range",
+		},
+		{
+			"closure of an integer",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				b.Instructions = append(b.Instructions, code.Make(code.OpClosure, 0, 0)...)
+			}),
+			"main: instruction 0016: constant 0 is not a function",
+		},
+		{
+			"local out of range",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				fn := b.Constants[1].(*object.CompiledFunction)
+				fn.Instructions = append(code.Make(code.OpGetLocal, 1), fn.Instructions...)
+			}),
+			"function 1: instruction 0000: local 1 out of range",
+		},
+		{
+			"free variable out of range",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				fn := b.Constants[1].(*object.CompiledFunction)
+				fn.Instructions = append(code.Make(code.OpGetFree, 0), fn.Instructions...)
+			}),
+			"function 1: instruction 0000: free variable 0 out of range",
+		},
+		{
+			"jump into an instruction",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				b.Instructions = append(b.Instructions, code.Make(code.OpJump, 1)...)
+			}),
+			"main: instruction 0016: jump target 1 is not an instruction",
+		},
+		{
+			"name out of range",
+			recode(t, valid, func(b *compiler.Bytecode) {
+				b.Instructions = append(b.Instructions, code.Make(code.OpGetField, 0)...)
+			}),
+			"main: instruction 0016: name 0 out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if _, ok := err.(*FormatError); !ok || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestUnsupportedConstants(t *testing.T) {
+	bytecode := &compiler.Bytecode{Constants: []object.Object{&object.Boolean{Value: true}}}
+	if _, err := Encode(bytecode); err == nil || err.Error() != "objfile: constant 0: cannot write constant of type BOOLEAN" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
+
+func encode(t *testing.T, bytecode *compiler.Bytecode) []byte {
+	t.Helper()
+	data, err := Encode(bytecode)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	return data
+}
+
+// body returns the file of bytecode without its checksum
+func body(t *testing.T, bytecode *compiler.Bytecode) []byte {
+	data := encode(t, bytecode)
+	return data[:len(data)-checksumSize]
+}
+
+func withChecksum(body []byte) []byte {
+	var sum [checksumSize]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(body))
+	return append(body, sum[:]...)
+}
+
+// recode returns the file of bytecode after modifying a decoded copy of it
+func recode(t *testing.T, bytecode *compiler.Bytecode, modify func(*compiler.Bytecode)) []byte {
+	t.Helper()
+	copy, err := Decode(encode(t, bytecode))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	modify(copy)
+	return encode(t, copy)
+}
+
+func run(t *testing.T, bytecode *compiler.Bytecode) string {
+	t.Helper()
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return machine.LastPoppedStackElem().Inspect()
+}
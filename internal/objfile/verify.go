@@ -0,0 +1,141 @@
+package objfile
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/object"
+)
+
+// verify checks that the instructions of the program and of its functions can be
+// executed by the vm: every opcode is defined with all of its operands, and every
+// operand refers to an existing constant (of the right type), name, local, free
+// variable or instruction.
+func verify(bytecode *compiler.Bytecode) error {
+	v := &verifier{bytecode: bytecode, free: map[int]int{}}
+
+	if err := v.code("main", -1, bytecode.Instructions, 0); err != nil {
+		return err
+	}
+	for i, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			where := fmt.Sprintf("function %d", i)
+			if err := v.code(where, i, fn.Instructions, fn.NumLocals); err != nil {
+				return err
+			}
+		}
+	}
+
+	// a function is always closed over the same number of free variables
+	for _, use := range v.getFree {
+		if n, ok := v.free[use.fn]; ok && use.index >= n {
+			return v.errorf(use.where, use.offset, "free variable %d out of range", use.index)
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	bytecode *compiler.Bytecode
+
+	free    map[int]int // the constant index of a function -> its number of free variables
+	getFree []freeUse
+}
+
+// freeUse is an OpGetFree to check once the number of free variables of every
+// function is known
+type freeUse struct {
+	where  string
+	fn     int
+	offset int
+	index  int
+}
+
+func (v *verifier) errorf(where string, offset int, format string, a ...interface{}) error {
+	return &FormatError{Offset: -1, Msg: fmt.Sprintf("%s: instruction %04d: %s", where, offset, fmt.Sprintf(format, a...))}
+}
+
+// code verifies the instructions of main (fnIndex -1) or of the function constant at
+// fnIndex
+func (v *verifier) code(where string, fnIndex int, ins code.Instructions, numLocals int) error {
+	starts := map[int]bool{}
+	var jumps []int // offsets of the jump instructions
+
+	for offset := 0; offset < len(ins); {
+		starts[offset] = true
+
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return v.errorf(where, offset, "%s", err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(ins) {
+			return v.errorf(where, offset, "truncated %s", def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[offset+1:])
+
+		switch code.Opcode(ins[offset]) {
+		case code.OpConstant:
+			if _, err := v.constant(operands[0]); err != nil {
+				return v.errorf(where, offset, "%s", err)
+			}
+		case code.OpClosure:
+			c, err := v.constant(operands[0])
+			if err != nil {
+				return v.errorf(where, offset, "%s", err)
+			}
+			if _, ok := c.(*object.CompiledFunction); !ok {
+				return v.errorf(where, offset, "constant %d is not a function", operands[0])
+			}
+			if n, ok := v.free[operands[0]]; ok && n != operands[1] {
+				return v.errorf(where, offset, "function %d closed over %d and %d free variables", operands[0], n, operands[1])
+			}
+			v.free[operands[0]] = operands[1]
+		case code.OpStructDef:
+			c, err := v.constant(operands[0])
+			if err != nil {
+				return v.errorf(where, offset, "%s", err)
+			}
+			if _, ok := c.(*object.StructDef); !ok {
+				return v.errorf(where, offset, "constant %d is not a struct definition", operands[0])
+			}
+		case code.OpInitField, code.OpGetField, code.OpMatchVariant:
+			if operands[0] >= len(v.bytecode.Names) {
+				return v.errorf(where, offset, "name %d out of range", operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if operands[0] >= numLocals {
+				return v.errorf(where, offset, "local %d out of range", operands[0])
+			}
+		case code.OpGetFree:
+			if fnIndex < 0 {
+				return v.errorf(where, offset, "free variable outside of a function")
+			}
+			v.getFree = append(v.getFree, freeUse{where: where, fn: fnIndex, offset: offset, index: operands[0]})
+		case code.OpJump, code.OpJumpNotTruthy, code.OpPushHandler:
+			jumps = append(jumps, offset)
+		}
+
+		offset += 1 + width
+	}
+
+	// a jump targets the start of an instruction (or the end of the code)
+	for _, offset := range jumps {
+		target := int(code.ReadUint16(ins[offset+1:]))
+		if !starts[target] && target != len(ins) {
+			return v.errorf(where, offset, "jump target %d is not an instruction", target)
+		}
+	}
+	return nil
+}
+
+func (v *verifier) constant(index int) (object.Object, error) {
+	if index >= len(v.bytecode.Constants) {
+		return nil, fmt.Errorf("constant %d out of range", index)
+	}
+	return v.bytecode.Constants[index], nil
+}
@@ -0,0 +1,322 @@
+// Package optimizer rewrites the AST of a program into an equivalent one that is
+// cheaper to execute.
+package optimizer
+
+import (
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Optimize rewrites program in place and returns it:
+//
+//   - prefix and infix expressions on integer and boolean literals are folded into a
+//     literal, unless evaluating them is an error (e.g. 1 / 0 or -true), which is left
+//     for the evaluation to report (an integer overflowing an int64 is folded into a big
+//     integer literal, as the evaluation promotes it)
+//   - an if expression with a literal condition keeps only the arm that is taken, and
+//     is replaced by that arm when it is a single expression
+//   - the statements of a block following a return (or throw) statement are removed
+//     (so the compiler does not report undefined identifiers in them anymore)
+//
+// The folded literals are positioned at the start of the expression they replace.
+func Optimize(program *ast.Program) *ast.Program {
+	for i, s := range program.Statements {
+		program.Statements[i] = statement(s)
+	}
+	return program
+}
+
+func statement(s ast.Statement) ast.Statement {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		s.Value = expression(s.Value)
+	case *ast.ReturnStatement:
+		s.ReturnValue = expression(s.ReturnValue)
+	case *ast.ExpressionStatement:
+		s.Expression = expression(s.Expression)
+	case *ast.ThrowStatement:
+		s.Value = expression(s.Value)
+	case *ast.StructDeclaration:
+		for _, f := range s.Fields {
+			f.Default = expression(f.Default)
+		}
+	}
+	return s
+}
+
+// block optimizes the statements of b and drops the unreachable ones
+func block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	for i, s := range b.Statements {
+		b.Statements[i] = statement(s)
+		switch s.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement:
+			b.Statements = b.Statements[:i+1]
+			return
+		}
+	}
+}
+
+func expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		e.Right = expression(e.Right)
+		if folded := foldPrefix(e); folded != nil {
+			return folded
+		}
+
+	case *ast.InfixExpression:
+		e.Left = expression(e.Left)
+		e.Right = expression(e.Right)
+		if folded := foldInfix(e); folded != nil {
+			return folded
+		}
+
+	case *ast.IfExpression:
+		return ifExpression(e)
+
+	case *ast.FunctionLiteral:
+		block(e.Body)
+
+	case *ast.CallExpression:
+		e.Function = expression(e.Function)
+		for i, a := range e.Arguments {
+			e.Arguments[i] = expression(a)
+		}
+
+	case *ast.StructLiteral:
+		for _, f := range e.Fields {
+			f.Value = expression(f.Value)
+		}
+
+	case *ast.FieldAccessExpression:
+		e.Object = expression(e.Object)
+
+	case *ast.ArrayLiteral:
+		for i, el := range e.Elements {
+			e.Elements[i] = expression(el)
+		}
+
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			pair.Key = expression(pair.Key)
+			pair.Value = expression(pair.Value)
+		}
+
+	case *ast.IndexExpression:
+		e.Left = expression(e.Left)
+		e.Index = expression(e.Index)
+
+	case *ast.SliceExpression:
+		e.Left = expression(e.Left)
+		if e.Low != nil {
+			e.Low = expression(e.Low)
+		}
+		if e.High != nil {
+			e.High = expression(e.High)
+		}
+
+	case *ast.TryExpression:
+		block(e.Body)
+		block(e.Catch)
+		block(e.Finally)
+
+	case *ast.BlockStatement:
+		block(e)
+	}
+	return e
+}
+
+func ifExpression(e *ast.IfExpression) ast.Expression {
+	if cond, ok := e.Condition.(*ast.LetCondition); ok {
+		cond.Value = expression(cond.Value)
+	} else {
+		e.Condition = expression(e.Condition)
+	}
+	block(e.IfArm)
+	block(e.ElseArm)
+
+	taken, ok := literalTruthiness(e.Condition)
+	if !ok {
+		return e
+	}
+
+	// the condition becomes true, or false when no arm is left
+	arm := e.IfArm
+	if !taken {
+		arm = e.ElseArm
+	}
+	e.ElseArm = nil
+	if arm == nil {
+		e.IfArm = &ast.BlockStatement{Token: e.IfArm.Token}
+		e.Condition = newBoolean(e.Condition, false)
+		return e
+	}
+	if len(arm.Statements) == 1 {
+		if es, ok := arm.Statements[0].(*ast.ExpressionStatement); ok {
+			return es.Expression
+		}
+	}
+	e.IfArm = arm
+	e.Condition = newBoolean(e.Condition, true)
+	return e
+}
+
+// literalTruthiness reports whether e is a literal, and if so, whether it is truthy
+func literalTruthiness(e ast.Expression) (truthy, ok bool) {
+	switch e := e.(type) {
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+func foldPrefix(e *ast.PrefixExpression) ast.Expression {
+	switch e.Operator {
+	case "!":
+		if truthy, ok := literalTruthiness(e.Right); ok {
+			return newBoolean(e, !truthy)
+		}
+	case "-":
+		switch right := e.Right.(type) {
+		case *ast.IntegerLiteral:
+			return newInteger(e, object.NegateInteger(object.IntegerLiteral(right)))
+		case *ast.FloatLiteral:
+			return newFloat(e, -right.Value)
+		}
+	}
+	return nil
+}
+
+func foldInfix(e *ast.InfixExpression) ast.Expression {
+	left, lok := e.Left.(*ast.IntegerLiteral)
+	right, rok := e.Right.(*ast.IntegerLiteral)
+	if lok && rok {
+		return foldIntegerInfix(e, object.IntegerLiteral(left), object.IntegerLiteral(right))
+	}
+	if x, ok := numberLiteral(e.Left); ok {
+		if y, ok := numberLiteral(e.Right); ok {
+			switch result, _ := object.FloatInfix(e.Operator, x, y); result := result.(type) {
+			case *object.Float:
+				return newFloat(e, result.Value)
+			case *object.Boolean:
+				return newBoolean(e, result.Value)
+			}
+			return nil
+		}
+	}
+
+	// all other values are compared by identity (true and false are singletons)
+	if _, ok := literalTruthiness(e.Left); !ok {
+		return nil
+	}
+	if _, ok := literalTruthiness(e.Right); !ok {
+		return nil
+	}
+	equal := false
+	if l, ok := e.Left.(*ast.Boolean); ok {
+		if r, ok := e.Right.(*ast.Boolean); ok {
+			equal = l.Value == r.Value
+		}
+	}
+	switch e.Operator {
+	case "==":
+		return newBoolean(e, equal)
+	case "!=":
+		return newBoolean(e, !equal)
+	}
+	return nil
+}
+
+// foldIntegerInfix folds the operation with the arithmetic of the evaluation, so that
+// a result that overflows an int64 is a big integer literal
+func foldIntegerInfix(e *ast.InfixExpression, left, right object.Object) ast.Expression {
+	switch e.Operator {
+	case "+", "-", "*", "/":
+		result, err := object.IntegerArithmetic(e.Operator, left, right)
+		if err != nil {
+			return nil
+		}
+		return newInteger(e, result)
+	case "<":
+		return newBoolean(e, object.CompareIntegers(left, right) < 0)
+	case ">":
+		return newBoolean(e, object.CompareIntegers(left, right) > 0)
+	case "==":
+		return newBoolean(e, object.CompareIntegers(left, right) == 0)
+	case "!=":
+		return newBoolean(e, object.CompareIntegers(left, right) != 0)
+	}
+	return nil
+}
+
+// newInteger returns a literal of the integer value (an *object.Integer or
+// *object.BigInteger)
+func newInteger(replaced ast.Expression, value object.Object) *ast.IntegerLiteral {
+	lit := &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Lexeme: value.Inspect(), Pos: start(replaced)},
+	}
+	switch value := value.(type) {
+	case *object.Integer:
+		lit.Value = value.Value
+	case *object.BigInteger:
+		lit.Big = value.Value
+	}
+	return lit
+}
+
+// numberLiteral returns the value of an integer or float literal
+func numberLiteral(e ast.Expression) (object.Object, bool) {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return object.IntegerLiteral(e), true
+	case *ast.FloatLiteral:
+		return object.FloatLiteral(e), true
+	}
+	return nil, false
+}
+
+func newFloat(replaced ast.Expression, value float64) *ast.FloatLiteral {
+	return &ast.FloatLiteral{
+		Token: token.Token{Type: token.FLOAT, Lexeme: object.FormatFloat(value), Pos: start(replaced)},
+		Value: value,
+	}
+}
+
+func newBoolean(replaced ast.Expression, value bool) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Lexeme: "false", Pos: start(replaced)}
+	if value {
+		tok.Type, tok.Lexeme = token.TRUE, "true"
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
+
+// start returns the position where the source of e starts
+func start(e ast.Expression) token.Position {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return start(e.Left)
+	case *ast.PrefixExpression:
+		return e.Token.Pos
+	case *ast.IntegerLiteral:
+		return e.Token.Pos
+	case *ast.FloatLiteral:
+		return e.Token.Pos
+	case *ast.StringLiteral:
+		return e.Token.Pos
+	case *ast.ArrayLiteral:
+		return e.Token.Pos
+	case *ast.HashLiteral:
+		return e.Token.Pos
+	case *ast.Boolean:
+		return e.Token.Pos
+	case *ast.IfExpression:
+		return e.Token.Pos
+	}
+	return token.Position{}
+}
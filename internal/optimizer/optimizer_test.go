@@ -0,0 +1,167 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/evaluator"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+	"github.com/maxild/monkey/internal/vm"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(5 + 5) * 2", "20"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"-(2 + 3)", "-5"},
+		{"--5", "5"},
+		{"7 / -2", "-3"},
+		{"1 < 2", "true"},
+		{"2 > 1 == false", "false"},
+		{"3 != 3", "false"},
+		{"true == true", "true"},
+		{"true != false", "true"},
+		{"1 == true", "false"},
+		{"!true", "false"},
+		{"!!5", "true"},
+		{"x + (1 + 2)", "(x + 3)"},
+		{"(1 + 2) + x", "(3 + x)"},
+		{"let f = fn(a) { a * (2 * 3) };", "let f = fn(a) { (a * 6) };"},
+		{"f(1 + 1, 2 * 2)", "f(2, 4)"},
+		{"struct P { x = 1 + 1 }", "struct P { x = 2 }"},
+		{"P{x: 2 * 3}.x", "P{x: 6}.x"},
+		// overflows are folded into big integers
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"4294967296 * 4294967296 / 2", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"18446744073709551616 - 18446744073709551615", "1"},
+		{"18446744073709551616 > 1", "true"},
+		// floats, and integers converted to floats
+		{"1.5 * 2", "3.0"},
+		{"-(0.5 + 1)", "-1.5"},
+		{"7 / 2.0", "3.5"},
+		{"1.0 == 1.0", "true"},
+		{"1 == 1.0", "true"},
+		{"0.5 < 1", "true"},
+		{"1.0 / 0", "inf"},
+		{"!1.5", "false"},
+		// errors are left for the evaluation to report
+		{"1 / 0", "(1 / 0)"},
+		{"-true", "(-true)"},
+		{"true + false", "(true + false)"},
+		{"1 + true", "(1 + true)"},
+		{"true < false", "(true < false)"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input))
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestDeadCodeElimination(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { a } else { b }", "a"},
+		{"if (false) { a } else { b }", "b"},
+		{"if (1 > 2) { a } else { b }", "b"},
+		{"if (5) { a }", "a"},
+		{"if (false) { a }", "if (false) {  }"},
+		{"if (true) { let x = 1; x } else { b }", "if (true) { let x = 1;x }"},
+		{"if (false) { a } else { let y = 2; y }", "if (true) { let y = 2;y }"},
+		{"if (false) { a } else if (true) { b } else { c }", "b"},
+		{"if (x) { 1 + 1 } else { 2 }", "if (x) { 2 } else { 2 }"},
+		{"if (let Circle(r) = if (true) { s }) { r }", "if (let Circle(r) = s) { r }"},
+		{"fn() { return 1; 2; 3 }", "fn() { return 1; }"},
+		{"fn() { if (x) { return 1; let y = 2; } 3 }", "fn() { if (x) { return 1; }3 }"},
+		{"fn() { throw 1; 2 }", "fn() { throw 1; }"},
+		{"try { return 1; 2 } finally { 3 }", "try { return 1; } finally { 3 }"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input))
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestFoldedPositions(t *testing.T) {
+	program := Optimize(parse(t, "let x =\n  (5 + 5) * 2;"))
+	literal := program.Statements[0].(*ast.LetStatement).Value.(*ast.IntegerLiteral)
+	if literal.Token.Pos.String() != "2:4" {
+		t.Errorf("wrong position of the folded literal. want=2:4, got=%s", literal.Token.Pos)
+	}
+}
+
+// TestSemanticsPreserved evaluates and runs the programs before and after optimizing
+// them and compares the results.
+func TestSemanticsPreserved(t *testing.T) {
+	inputs := []string{
+		"(5 + 5) * 2",
+		"let x = 10; if (x > 5 * 2) { 1 } else { 2 }",
+		"if (true) { let x = 1; x } else { 2 }",
+		"let x = 1; if (false) { let x = 2; } x",
+		"if (false) { 1 }",
+		"!(if (false) { 5 })",
+		"-9223372036854775807 - 2",
+		"(9223372036854775807 + 1) * 2 - 9223372036854775807",
+		"let f = fn(n) { if (n < 2 * 1) { return n; n * 100 } f(n - 1) + f(n - 2) }; f(10)",
+		"let f = fn() { return 1; 2 }; f()",
+		"1 / 0",
+		"1 + (2 == 2)",
+		"let g = fn() { throw 1 + 1; 5 }; try { g() } catch (e) { e * (10 + 11) }",
+		"struct P { x = 2 * 3, y }; P{y: 1 == 1}.x",
+		"enum E { A(v), B }; if (let A(v) = A(1 + 1)) { v * 3 } else { 0 }",
+		"if (1 == true) { 1 } else if (!false) { 2 } else { 3 }",
+		"(1.5 + 2) * 2 == 7.0",
+		"1 / 0.0 > 1e308",
+	}
+
+	for _, input := range inputs {
+		want := evaluator.Eval(parse(t, input), object.NewEnvironment()).Inspect()
+		got := evaluator.Eval(Optimize(parse(t, input)), object.NewEnvironment()).Inspect()
+		if got != want {
+			t.Errorf("%q: evaluator results differ. want=%s, got=%s", input, want, got)
+		}
+
+		want = run(parse(t, input))
+		got = run(Optimize(parse(t, input)))
+		if got != want {
+			t.Errorf("%q: vm results differ. want=%s, got=%s", input, want, got)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// run returns the value of the program, or the compile or runtime error
+func run(program *ast.Program) string {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return err.Error()
+	}
+	machine := vm.New(c.Bytecode())
+	if err := machine.Run(); err != nil {
+		return err.Error()
+	}
+	return machine.LastPoppedStackElem().Inspect()
+}
@@ -5,7 +5,11 @@ import (
 	"github.com/maxild/monkey/internal/ast"
 	"github.com/maxild/monkey/internal/lexer"
 	"github.com/maxild/monkey/internal/token"
+	"math/big"
+	"regexp"
+	"regexp/syntax"
 	"strconv"
+	"strings"
 )
 
 // Precedence: Highest binds the most/first
@@ -21,6 +25,10 @@ const (
 	PREFIX // -X or !X
 	// function application
 	CALL // myFunc(X)
+	// field access
+	SELECTOR // obj.field
+	// indexing and slicing
+	INDEX // s[i] or s[i:j]
 )
 
 // Table of precedence per token (kind) is defined for all infix operators
@@ -36,6 +44,8 @@ var precedences = map[token.Type]int{
 	// NOTE that '(' can act like a binary operator, where "left" operand
 	// is function and "right" operand are the args
 	token.LPAREN:   CALL,
+	token.DOT:      SELECTOR,
+	token.LBRACKET: INDEX,
 	// not defined for prefix operators (-, !)
 }
 
@@ -53,8 +63,8 @@ type Parser struct {
 	currToken token.Token
 	peekToken token.Token
 
-	// TODO: Add line, column number to errors and lexer/tokens
-	errors []string
+	errors    []string
+	positions []token.Position // of the errors
 
 	prefixParseFns map[token.Type]prefixParseFn
 	infixParseFns  map[token.Type]infixParseFn
@@ -69,6 +79,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.REGEX, p.parseRegexLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
@@ -76,6 +92,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 
 	// left denotations ("leds")
 	p.infixParseFns = make(map[token.Type]infixParseFn)
@@ -88,6 +105,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.DOT, p.parseFieldAccessExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// read two tokens so currToken and peekToken are both defined
 	// (even though this seems a little weird, l.NextToken can be called multiple times after EOF)
@@ -117,7 +136,7 @@ func (p *Parser) match(t token.Type) bool {
 	} else {
 		msg := fmt.Sprintf("expected next token to be %s, got %s instead.",
 			t, p.currToken.Type)
-		p.errors = append(p.errors, msg)
+		p.addError(p.currToken.Pos, msg)
 		return false
 	}
 }
@@ -129,7 +148,7 @@ func (p *Parser) matchPeek(t token.Type) bool {
 	} else {
 		msg := fmt.Sprintf("expected next token to be %s, got %s instead.",
 			t, p.peekToken.Type)
-		p.errors = append(p.errors, msg)
+		p.addError(p.peekToken.Pos, msg)
 		return false
 	}
 }
@@ -138,6 +157,30 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// SyntaxError is an error of Errors together with its position in the source
+type SyntaxError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e SyntaxError) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// SyntaxErrors returns the errors with their positions
+func (p *Parser) SyntaxErrors() []SyntaxError {
+	errs := make([]SyntaxError, len(p.errors))
+	for i, msg := range p.errors {
+		errs[i] = SyntaxError{Pos: p.positions[i], Message: msg}
+	}
+	return errs
+}
+
+func (p *Parser) addError(pos token.Position, msg string) {
+	p.errors = append(p.errors, msg)
+	p.positions = append(p.positions, pos)
+}
+
 func (p *Parser) peekPrecedence() int {
 	if precedence, ok := precedences[p.peekToken.Type]; ok {
 		return precedence
@@ -181,6 +224,9 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 // <stmt> -> <let_stmt>
 //         | <return_stmt>
+//         | <struct_decl>
+//         | <enum_decl>
+//         | <throw_stmt>
 //         | <expression_stmt>
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
@@ -188,6 +234,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.STRUCT:
+		return p.parseStructDeclaration()
+	case token.ENUM:
+		return p.parseEnumDeclaration()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -195,7 +247,7 @@ func (p *Parser) parseStatement() ast.Statement {
 
 // Pratt parser methods (never advance the currToken passed the last token in the expression)
 
-// <let_stmt> -> LET IDENT ASSIGN <expr> SEMICOLON
+// <let_stmt> -> LET IDENT (COLON <type>)? ASSIGN <expr> SEMICOLON
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{
 		Token: p.currToken,
@@ -213,6 +265,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	p.nextToken() // eat ID
 
+	// optional annotation
+	if p.currTokenIs(token.COLON) {
+		p.nextToken() // eat ':'
+		stmt.Type = p.parseType()
+		if stmt.Type == nil {
+			return nil
+		}
+	}
+
 	// eat '='
 	if !p.match(token.ASSIGN) {
 		return nil
@@ -278,7 +339,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.currToken.Type]
 	if prefix == nil {
 		msg := fmt.Sprintf("No prefix parse function for %s found.", p.currToken.Type)
-		p.errors = append(p.errors, msg)
+		p.addError(p.currToken.Pos, msg)
 		return nil
 	}
 	leftExpr := prefix()
@@ -325,11 +386,16 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 // non-recursive
 //         | ID
+//         | <struct_lit>
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{
+	ident := &ast.Identifier{
 		Token: p.currToken,
 		Value: p.currToken.Lexeme,
 	}
+	if p.peekTokenIs(token.LBRACE) && p.isStructLiteralAhead() {
+		return p.parseStructLiteral(ident)
+	}
+	return ident
 }
 
 // non-recursive
@@ -340,14 +406,100 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	}
 	value, err := strconv.ParseInt(p.currToken.Lexeme, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Lexeme)
-		p.errors = append(p.errors, msg)
-		return nil
+		// a literal too large for an int64 is a big integer
+		n, ok := new(big.Int).SetString(p.currToken.Lexeme, 0)
+		if !ok {
+			msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Lexeme)
+			p.addError(p.currToken.Pos, msg)
+			return nil
+		}
+		expr.Big = n
+		return expr
 	}
 	expr.Value = value
 	return expr
 }
 
+//		   | FLOAT
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.currToken.Lexeme, 64)
+	if err != nil {
+		// ParseFloat fails on a literal too large for a float64
+		msg := fmt.Sprintf("could not parse %q as float", p.currToken.Lexeme)
+		p.addError(p.currToken.Pos, msg)
+		return nil
+	}
+	return &ast.FloatLiteral{Token: p.currToken, Value: value}
+}
+
+//		   | STRING
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Lexeme}
+}
+
+//		   | REGEX
+func (p *Parser) parseRegexLiteral() ast.Expression {
+	lexeme := p.currToken.Lexeme
+	end := strings.LastIndexByte(lexeme, '/')
+	expr := &ast.RegexLiteral{Token: p.currToken, Pattern: lexeme[1:end], Flags: lexeme[end+1:]}
+	for i, f := range expr.Flags {
+		if !strings.ContainsRune("imsU", f) || strings.ContainsRune(expr.Flags[:i], f) {
+			p.addError(p.currToken.Pos, fmt.Sprintf("invalid regex flag %q in %s", f, lexeme))
+			return nil
+		}
+	}
+	// the pattern is compiled again with its flags at run time
+	if _, err := regexp.Compile(expr.Pattern); err != nil {
+		msg := err.Error()
+		if syntaxErr, ok := err.(*syntax.Error); ok {
+			msg = string(syntaxErr.Code) // without the pattern
+		}
+		p.addError(p.currToken.Pos, fmt.Sprintf("invalid regex %s: %s", lexeme, msg))
+		return nil
+	}
+	return expr
+}
+
+//         | LBRACKET (<expr> (COMMA <expr>)*)? RBRACKET
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	return array
+}
+
+//         | LBRACE (<expr> COLON <expr> (COMMA <expr> COLON <expr>)*)? RBRACE
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken, Pairs: []*ast.KeyValue{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken() // eat '{' or ','
+		pair := &ast.KeyValue{Key: p.parseExpression(LOWEST)}
+		if !p.matchPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken() // eat ':'
+		pair.Value = p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, pair)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.matchPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	// eat '}'
+	p.nextToken()
+	return hash
+}
+
+// an illegal character, unterminated string or invalid escape
+func (p *Parser) parseIllegal() ast.Expression {
+	p.addError(p.currToken.Pos, fmt.Sprintf("illegal token %q", p.currToken.Lexeme))
+	return nil
+}
+
 //       TRUE | FALSE
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{
@@ -369,7 +521,8 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return expr
 }
 
-//		IF LPARAN <expr> RPARAN LBRACE <expr>+ RBRACE (ELSE LBRACE <expr>+ RBRACE)?
+//		IF LPARAN <cond> RPARAN LBRACE <expr>+ RBRACE (ELSE (LBRACE <expr>+ RBRACE | <if_expr>))?
+//  <cond> := <expr> | <let_cond>
 func (p *Parser) parseIfExpression() ast.Expression {
 	expr := &ast.IfExpression{Token: p.currToken}
 
@@ -378,7 +531,11 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if !p.match(token.LPAREN) {
 		return nil
 	}
-	expr.Condition = p.parseExpression(LOWEST)
+	if p.currTokenIs(token.LET) {
+		expr.Condition = p.parseLetCondition()
+	} else {
+		expr.Condition = p.parseExpression(LOWEST)
+	}
 	p.nextToken() // eat prev token
 	// eat ')'
 	if !p.match(token.RPAREN) {
@@ -390,20 +547,37 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		return nil
 	}
 	expr.IfArm = p.parseBlockStatement()
-	// eat '}'
-	if !p.match(token.RBRACE) {
+	// parseBlockStatement leaves us at the '}' (the last token of the expression
+	// when there is no else arm)
+	if !p.currTokenIs(token.RBRACE) {
+		p.match(token.RBRACE) // report the missing '}'
 		return nil
 	}
 
-	if p.currTokenIs(token.ELSE) {
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken() // eat '}'
 		p.nextToken() // eat ELSE
+
+		// 'else if' is sugar for 'else { if ... }'
+		if p.currTokenIs(token.IF) {
+			block := &ast.BlockStatement{Token: p.currToken}
+			stmt := &ast.ExpressionStatement{Token: p.currToken}
+			stmt.Expression = p.parseIfExpression()
+			if stmt.Expression == nil {
+				return nil
+			}
+			block.Statements = []ast.Statement{stmt}
+			expr.ElseArm = block
+			return expr
+		}
+
 		// eat '{'
 		if !p.match(token.LBRACE) {
 			return nil
 		}
 		expr.ElseArm = p.parseBlockStatement()
-		// eat '}'
-		if !p.match(token.RBRACE) {
+		if !p.currTokenIs(token.RBRACE) {
+			p.match(token.RBRACE) // report the missing '}'
 			return nil
 		}
 	}
@@ -411,7 +585,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expr
 }
 
-//    FUNCTION <params> LBRACE <expr>+ RBRACE
+//    FUNCTION <params> (COLON <type>)? LBRACE <expr>+ RBRACE
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	fun := &ast.FunctionLiteral{Token: p.currToken}
 
@@ -421,7 +595,16 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil // '(' is mandatory
 	}
 
-	fun.Parameters = p.parseFunctionParameters()
+	fun.Parameters, fun.ParameterTypes = p.parseFunctionParameters()
+
+	// optional return type annotation
+	if p.currTokenIs(token.COLON) {
+		p.nextToken() // eat ':'
+		fun.ReturnType = p.parseType()
+		if fun.ReturnType == nil {
+			return nil
+		}
+	}
 
 	// eat '{'
 	if !p.match(token.LBRACE) {
@@ -436,35 +619,50 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return fun
 }
 
-//  <params> := LPARAN (ID (COMMA ID)+)? RPARAN
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+//  <params> := LPARAN (<param> (COMMA <param>)+)? RPARAN
+//  <param>  := ID (COLON <type>)?
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.TypeExpr) {
 	var ids []*ast.Identifier
+	var types []ast.TypeExpr
 
 	// empty params
 	if p.currTokenIs(token.RPAREN) {
 		p.nextToken() // eat ')'
-		return ids
+		return ids, types
 	}
 
 	// first param
-	id := &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+	id, typ := p.parseFunctionParameter()
 	ids = append(ids, id)
-	p.nextToken() // eat ID
+	types = append(types, typ)
 
 	// loop while we see COMMA
 	for p.currTokenIs(token.COMMA) {
 		p.nextToken() // eat COMMA
-		id := &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+		id, typ := p.parseFunctionParameter()
 		ids = append(ids, id)
-		p.nextToken() // eat ID
+		types = append(types, typ)
 	}
 
 	// eat ')'
 	if !p.match(token.RPAREN) {
-		return nil
+		return nil, nil
 	}
 
-	return ids
+	return ids, types
+}
+
+func (p *Parser) parseFunctionParameter() (*ast.Identifier, ast.TypeExpr) {
+	id := &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+	p.nextToken() // eat ID
+
+	var typ ast.TypeExpr
+	if p.currTokenIs(token.COLON) {
+		p.nextToken() // eat ':'
+		typ = p.parseType()
+	}
+
+	return id, typ
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -514,14 +712,65 @@ func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 		Token:    p.currToken,
 		Function: left,
 	}
-	expr.Arguments = p.parseCallArguments()
+	expr.Arguments = p.parseExpressionList(token.RPAREN)
 	return expr
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
+//		   | <expr> DOT ID
+func (p *Parser) parseFieldAccessExpression(object ast.Expression) ast.Expression {
+	expr := &ast.FieldAccessExpression{
+		Token:  p.currToken,
+		Object: object,
+	}
+	// eat '.'
+	if !p.matchPeek(token.IDENT) {
+		return nil
+	}
+	expr.Field = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+	return expr
+}
+
+//		   | <expr> LBRACKET <expr> RBRACKET
+//		   | <expr> LBRACKET <expr>? COLON <expr>? RBRACKET
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.currToken
+	p.nextToken() // eat '['
+
+	var index ast.Expression
+	if !p.currTokenIs(token.COLON) {
+		index = p.parseExpression(LOWEST)
+		if index == nil {
+			return nil
+		}
+		if !p.peekTokenIs(token.COLON) {
+			if !p.matchPeek(token.RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+		}
+		p.nextToken() // eat the low bound
+	}
+
+	// the current token is ':'
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: index}
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken() // eat ':'
+		return slice
+	}
+	p.nextToken() // eat ':'
+	slice.High = p.parseExpression(LOWEST)
+	if slice.High == nil || !p.matchPeek(token.RBRACKET) {
+		return nil
+	}
+	return slice
+}
+
+// parseExpressionList parses the comma separated expressions of a call (or an array
+// literal), up to the closing end token
+func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 	args := []ast.Expression{}
 
-	if p.peekTokenIs(token.RPAREN) {
+	if p.peekTokenIs(end) {
 		p.nextToken() // eat "(' (protocol says that ')' is the current token after parse)
 		return args
 	}
@@ -537,9 +786,444 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		args = append(args, p.parseExpression(LOWEST))
 	}
 
-	if !p.matchPeek(token.RPAREN) {
+	if !p.matchPeek(end) {
 		return nil
 	}
 
 	return args
 }
+
+//
+// Records (structs)
+//
+
+// <struct_decl> := STRUCT ID LBRACE (<field> (COMMA <field>)*)? RBRACE SEMICOLON
+// <field>       := ID (ASSIGN <expr>)?
+func (p *Parser) parseStructDeclaration() *ast.StructDeclaration {
+	decl := &ast.StructDeclaration{Token: p.currToken}
+
+	// eat 'struct'
+	if !p.matchPeek(token.IDENT) {
+		return nil
+	}
+	decl.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+
+	// eat ID
+	if !p.matchPeek(token.LBRACE) {
+		return nil
+	}
+
+	decl.Fields = []*ast.StructField{}
+	if !p.peekTokenIs(token.RBRACE) {
+		field := p.parseStructField()
+		if field == nil {
+			return nil
+		}
+		decl.Fields = append(decl.Fields, field)
+
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken() // eat prev token
+			field := p.parseStructField()
+			if field == nil {
+				return nil
+			}
+			decl.Fields = append(decl.Fields, field)
+		}
+	}
+
+	// eat '}'
+	if !p.matchPeek(token.RBRACE) {
+		return nil
+	}
+
+	p.eatOptionalSemicolon()
+
+	return decl
+}
+
+// called with '{' or ',' as the current token, leaves the last token of the field current
+func (p *Parser) parseStructField() *ast.StructField {
+	if !p.matchPeek(token.IDENT) {
+		return nil
+	}
+	field := &ast.StructField{
+		Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme},
+	}
+
+	if p.peekTokenIs(token.ASSIGN) {
+		p.nextToken() // eat ID
+		p.nextToken() // eat '='
+		field.Default = p.parseExpression(LOWEST)
+	}
+
+	return field
+}
+
+// An identifier followed by '{' starts a struct literal if the brace is followed by
+// '}' or by 'ID :'. That is never the start of a block, because a block cannot
+// begin with a label (and an empty block is no expression).
+func (p *Parser) isStructLiteralAhead() bool {
+	// The lexer is a value type, so we can scan ahead on a copy of it. The
+	// copy starts at the token following peekToken ('{').
+	lookahead := *p.l
+	tok := lookahead.NextToken()
+	if tok.Type == token.RBRACE {
+		return true
+	}
+	return tok.Type == token.IDENT && lookahead.NextToken().Type == token.COLON
+}
+
+//	<struct_lit> := ID LBRACE (ID COLON <expr> (COMMA ID COLON <expr>)*)? RBRACE
+func (p *Parser) parseStructLiteral(name *ast.Identifier) ast.Expression {
+	lit := &ast.StructLiteral{Token: p.currToken, Name: name}
+
+	p.nextToken() // eat ID
+
+	lit.Fields = []*ast.FieldValue{}
+	if p.peekTokenIs(token.RBRACE) {
+		p.nextToken() // eat '{'
+		return lit
+	}
+
+	for {
+		// eat '{' or ','
+		if !p.matchPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.FieldValue{
+			Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme},
+		}
+		// eat ID
+		if !p.matchPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken() // eat ':'
+		field.Value = p.parseExpression(LOWEST)
+		lit.Fields = append(lit.Fields, field)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // eat prev token
+	}
+
+	// eat '}'
+	if !p.matchPeek(token.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
+//
+// Tagged unions (enums)
+//
+
+// <enum_decl> := ENUM ID LBRACE <variant> (COMMA <variant>)* RBRACE SEMICOLON
+// <variant>   := ID (LPARAN ID (COMMA ID)* RPARAN)?
+func (p *Parser) parseEnumDeclaration() *ast.EnumDeclaration {
+	decl := &ast.EnumDeclaration{Token: p.currToken}
+
+	// eat 'enum'
+	if !p.matchPeek(token.IDENT) {
+		return nil
+	}
+	decl.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+
+	// eat ID
+	if !p.matchPeek(token.LBRACE) {
+		return nil
+	}
+
+	decl.Variants = []*ast.EnumVariant{}
+	for {
+		// eat '{' or ','
+		if !p.matchPeek(token.IDENT) {
+			return nil
+		}
+		variant := &ast.EnumVariant{
+			Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme},
+		}
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken() // eat ID
+			variant.Fields = p.parseIdentifierList()
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		decl.Variants = append(decl.Variants, variant)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // eat prev token
+	}
+
+	// eat '}'
+	if !p.matchPeek(token.RBRACE) {
+		return nil
+	}
+
+	p.eatOptionalSemicolon()
+
+	return decl
+}
+
+// called with '(' as the current token, leaves ')' as the current token
+//  LPARAN ID (COMMA ID)* RPARAN
+func (p *Parser) parseIdentifierList() []*ast.Identifier {
+	ids := []*ast.Identifier{}
+	for {
+		// eat '(' or ','
+		if !p.matchPeek(token.IDENT) {
+			return nil
+		}
+		ids = append(ids, &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme})
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // eat ID
+	}
+
+	// eat ')'
+	if !p.matchPeek(token.RPAREN) {
+		return nil
+	}
+
+	return ids
+}
+
+//  <let_cond> := LET ID (LPARAN ID (COMMA ID)* RPARAN)? ASSIGN <expr>
+func (p *Parser) parseLetCondition() ast.Expression {
+	cond := &ast.LetCondition{Token: p.currToken}
+
+	// eat 'let'
+	if !p.matchPeek(token.IDENT) {
+		return nil
+	}
+	pattern := &ast.VariantPattern{
+		Token: p.currToken,
+		Name:  &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme},
+	}
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken() // eat ID
+		pattern.Bindings = p.parseIdentifierList()
+		if pattern.Bindings == nil {
+			return nil
+		}
+	}
+	cond.Pattern = pattern
+
+	// eat ID or ')'
+	if !p.matchPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken() // eat '='
+	cond.Value = p.parseExpression(LOWEST)
+
+	return cond
+}
+
+//
+// Exceptions
+//
+
+// <throw_stmt> := THROW <expr> SEMICOLON
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{
+		Token: p.currToken,
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	p.eatOptionalSemicolon()
+
+	return stmt
+}
+
+//	TRY <block> (CATCH LPARAN ID RPARAN <block>)? (FINALLY <block>)?
+//  where at least one of the CATCH and FINALLY arms must be present
+func (p *Parser) parseTryExpression() ast.Expression {
+	expr := &ast.TryExpression{Token: p.currToken}
+
+	// eat 'try'
+	if !p.matchPeek(token.LBRACE) {
+		return nil
+	}
+	expr.Body = p.parseBracedBlock()
+	if expr.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken() // eat '}'
+		// eat 'catch'
+		if !p.matchPeek(token.LPAREN) {
+			return nil
+		}
+		// eat '('
+		if !p.matchPeek(token.IDENT) {
+			return nil
+		}
+		expr.CatchParam = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+		// eat ID
+		if !p.matchPeek(token.RPAREN) {
+			return nil
+		}
+		// eat ')'
+		if !p.matchPeek(token.LBRACE) {
+			return nil
+		}
+		expr.Catch = p.parseBracedBlock()
+		if expr.Catch == nil {
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken() // eat '}'
+		// eat 'finally'
+		if !p.matchPeek(token.LBRACE) {
+			return nil
+		}
+		expr.Finally = p.parseBracedBlock()
+		if expr.Finally == nil {
+			return nil
+		}
+	}
+
+	if expr.Catch == nil && expr.Finally == nil {
+		p.addError(expr.Token.Pos, "expected catch or finally block after try block.")
+		return nil
+	}
+
+	return expr
+}
+
+// called with '{' as the current token, leaves the matching '}' as the current token
+func (p *Parser) parseBracedBlock() *ast.BlockStatement {
+	p.nextToken() // eat '{'
+	block := p.parseBlockStatement()
+	if !p.currTokenIs(token.RBRACE) {
+		p.match(token.RBRACE) // report the missing '}'
+		return nil
+	}
+	return block
+}
+
+//
+// Type expressions (recursive descent, not Pratt). Unlike the Pratt parser methods
+// these consume the whole production, leaving currToken at the token following the type.
+//
+
+// <type> := ID
+//         | LBRACKET <type> RBRACKET
+//         | LBRACE <type> COLON <type> RBRACE
+//         | FUNCTION LPAREN (<type> (COMMA <type>)*)? RPAREN ARROW <type>
+func (p *Parser) parseType() ast.TypeExpr {
+	switch p.currToken.Type {
+	case token.IDENT:
+		typ := &ast.NamedType{Token: p.currToken, Name: p.currToken.Lexeme}
+		p.nextToken() // eat ID
+		return typ
+	case token.LBRACKET:
+		return p.parseArrayType()
+	case token.LBRACE:
+		return p.parseHashType()
+	case token.FUNCTION:
+		return p.parseFunctionType()
+	default:
+		msg := fmt.Sprintf("expected type, got %s instead.", p.currToken.Type)
+		p.addError(p.currToken.Pos, msg)
+		return nil
+	}
+}
+
+//		LBRACKET <type> RBRACKET
+func (p *Parser) parseArrayType() ast.TypeExpr {
+	typ := &ast.ArrayType{Token: p.currToken}
+
+	p.nextToken() // eat '['
+	typ.Element = p.parseType()
+	if typ.Element == nil {
+		return nil
+	}
+	// eat ']'
+	if !p.match(token.RBRACKET) {
+		return nil
+	}
+
+	return typ
+}
+
+//		LBRACE <type> COLON <type> RBRACE
+func (p *Parser) parseHashType() ast.TypeExpr {
+	typ := &ast.HashType{Token: p.currToken}
+
+	p.nextToken() // eat '{'
+	typ.Key = p.parseType()
+	if typ.Key == nil {
+		return nil
+	}
+	// eat ':'
+	if !p.match(token.COLON) {
+		return nil
+	}
+	typ.Value = p.parseType()
+	if typ.Value == nil {
+		return nil
+	}
+	// eat '}'
+	if !p.match(token.RBRACE) {
+		return nil
+	}
+
+	return typ
+}
+
+//		FUNCTION LPAREN (<type> (COMMA <type>)*)? RPAREN ARROW <type>
+func (p *Parser) parseFunctionType() ast.TypeExpr {
+	typ := &ast.FunctionType{Token: p.currToken}
+
+	p.nextToken() // eat 'fn'
+	// eat '('
+	if !p.match(token.LPAREN) {
+		return nil
+	}
+
+	typ.Parameters = []ast.TypeExpr{}
+	if !p.currTokenIs(token.RPAREN) {
+		param := p.parseType()
+		if param == nil {
+			return nil
+		}
+		typ.Parameters = append(typ.Parameters, param)
+
+		for p.currTokenIs(token.COMMA) {
+			p.nextToken() // eat COMMA
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			typ.Parameters = append(typ.Parameters, param)
+		}
+	}
+
+	// eat ')'
+	if !p.match(token.RPAREN) {
+		return nil
+	}
+	// eat '->'
+	if !p.match(token.ARROW) {
+		return nil
+	}
+	typ.Return = p.parseType()
+	if typ.Return == nil {
+		return nil
+	}
+
+	return typ
+}
@@ -108,6 +108,22 @@ func TestIdentifierExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteral(t *testing.T) {
+	input := "9223372036854775808;"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if literal.Big == nil || literal.Big.String() != "9223372036854775808" {
+		t.Errorf("literal.Big not 9223372036854775808. got=%v", literal.Big)
+	}
+	if literal.String() != "9223372036854775808" {
+		t.Errorf("literal.String() wrong. got=%s", literal.String())
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -139,6 +155,93 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5;", 1.5},
+		{"2.5e-3;", 0.0025},
+		{"1e3;", 1000},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		literal, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", program.Statements[0])
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input[:len(tt.input)-1] {
+			t.Errorf("literal.String() wrong. got=%s", literal.String())
+		}
+	}
+
+	p := New(lexer.New("1e400"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0] != "could not parse \"1e400\" as float" {
+		t.Errorf("wrong errors for a float out of range. got=%q", errors)
+	}
+}
+
+func TestRegexLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		pattern  string
+		flags    string
+		expected string // the program
+	}{
+		{`/ab+c/i;`, "ab+c", "i", "/ab+c/i"},
+		{`/a\/b/;`, `a\/b`, "", `/a\/b/`},
+		{`x / /\d+/ms;`, `\d+`, "ms", `(x / /\d+/ms)`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%s, got=%s", tt.expected, program.String())
+		}
+		var literal *ast.RegexLiteral
+		switch exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(type) {
+		case *ast.RegexLiteral:
+			literal = exp
+		case *ast.InfixExpression:
+			literal, _ = exp.Right.(*ast.RegexLiteral)
+		}
+		if literal == nil {
+			t.Fatalf("no *ast.RegexLiteral in %s", program.String())
+		}
+		if literal.Pattern != tt.pattern || literal.Flags != tt.flags {
+			t.Errorf("wrong literal. want=%q %q, got=%q %q", tt.pattern, tt.flags, literal.Pattern, literal.Flags)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"/a/g", `invalid regex flag 'g' in /a/g`},
+		{"/a/ii", `invalid regex flag 'i' in /a/ii`},
+		{"/x(/", "invalid regex /x(/: missing closing )"},
+		{"/a**/", "invalid regex /a**/: invalid nested repetition operator"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("%s: wrong errors. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -329,6 +432,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!(true == true)",
 			"(!(true == true))",
 		},
+		{
+			"if (a) { b } c * d",
+			"if (a) { b }(c * d)",
+		},
+		{
+			"if (a) { b } else { c }; -d",
+			"if (a) { b } else { c }(-d)",
+		},
 	//	{
 	//		"a + add(b * c) + d",
 	//		"((a + add((b * c))) + d)",
@@ -672,6 +783,509 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let s: string = y;", "let s: string = y;"},
+		{"let xs: [int] = y;", "let xs: [int] = y;"},
+		{"let h: {string: [bool]} = y;", "let h: {string: [bool]} = y;"},
+		{"let f: fn(int) -> int = y;", "let f: fn(int) -> int = y;"},
+		{"let g: fn() -> fn(int, bool) -> int = y;", "let g: fn() -> fn(int, bool) -> int = y;"},
+		{"fn(a: int, b: string): bool { true }", "fn(a: int, b: string): bool { true }"},
+		{"fn(a, b: int) { a }", "fn(a, b: int) { a }"},
+		{"fn(): {string: int} { x }", "fn(): {string: int} { x }"},
+		{"fn(f: fn(int) -> int): fn(int) -> int { f }", "fn(f: fn(int) -> int): fn(int) -> int { f }"},
+		{"let add: fn(int, int) -> int = fn(x: int, y: int): int { x + y };",
+			"let add: fn(int, int) -> int = fn(x: int, y: int): int { (x + y) };"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFunctionLiteralTypeAnnotations(t *testing.T) {
+	input := `fn(x: int, y, f: fn(int) -> [int]): {int: bool} { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(function.Parameters) != 3 {
+		t.Fatalf("function literal parameters wrong. want 3, got=%d\n",
+			len(function.Parameters))
+	}
+
+	if _, ok := function.ParameterType(0).(*ast.NamedType); !ok {
+		t.Errorf("ParameterType(0) is not ast.NamedType. got=%T", function.ParameterType(0))
+	}
+	if function.ParameterType(1) != nil {
+		t.Errorf("ParameterType(1) is not nil. got=%T", function.ParameterType(1))
+	}
+	ft, ok := function.ParameterType(2).(*ast.FunctionType)
+	if !ok {
+		t.Fatalf("ParameterType(2) is not ast.FunctionType. got=%T", function.ParameterType(2))
+	}
+	if len(ft.Parameters) != 1 {
+		t.Fatalf("function type parameters wrong. want 1, got=%d", len(ft.Parameters))
+	}
+	if _, ok := ft.Return.(*ast.ArrayType); !ok {
+		t.Errorf("ft.Return is not ast.ArrayType. got=%T", ft.Return)
+	}
+	if function.ParameterType(3) != nil {
+		t.Errorf("ParameterType(3) is not nil. got=%T", function.ParameterType(3))
+	}
+
+	ht, ok := function.ReturnType.(*ast.HashType)
+	if !ok {
+		t.Fatalf("function.ReturnType is not ast.HashType. got=%T", function.ReturnType)
+	}
+	if ht.Key.String() != "int" || ht.Value.String() != "bool" {
+		t.Errorf("hash type wrong. got=%s", ht)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let x: = 5;", "expected type, got = instead."},
+		{"let x: [int = 5;", "expected next token to be ], got = instead."},
+		{"let x: {int} = 5;", "expected next token to be :, got } instead."},
+		{"let f: fn(int) int = y;", "expected next token to be ->, got IDENT instead."},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestStructDeclarationParsing(t *testing.T) {
+	input := `struct Point { x, y = 0 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	decl, ok := program.Statements[0].(*ast.StructDeclaration)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.StructDeclaration. got=%T",
+			program.Statements[0])
+	}
+	if decl.Name.Value != "Point" {
+		t.Errorf("decl.Name.Value not 'Point'. got=%s", decl.Name.Value)
+	}
+	if len(decl.Fields) != 2 {
+		t.Fatalf("decl.Fields does not contain 2 fields. got=%d", len(decl.Fields))
+	}
+	if decl.Fields[0].Name.Value != "x" || decl.Fields[0].Default != nil {
+		t.Errorf("decl.Fields[0] wrong. got=%s = %v", decl.Fields[0].Name, decl.Fields[0].Default)
+	}
+	if decl.Fields[1].Name.Value != "y" || !testIntegerLiteral(t, decl.Fields[1].Default, 0) {
+		t.Errorf("decl.Fields[1] wrong. got=%s = %v", decl.Fields[1].Name, decl.Fields[1].Default)
+	}
+}
+
+func TestStructLiteralParsing(t *testing.T) {
+	input := `Point{x: 1, y: 2 * 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	lit, ok := stmt.Expression.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.StructLiteral. got=%T", stmt.Expression)
+	}
+	if lit.Name.Value != "Point" {
+		t.Errorf("lit.Name.Value not 'Point'. got=%s", lit.Name.Value)
+	}
+	if len(lit.Fields) != 2 {
+		t.Fatalf("lit.Fields does not contain 2 fields. got=%d", len(lit.Fields))
+	}
+	if lit.Fields[0].Name.Value != "x" {
+		t.Errorf("lit.Fields[0].Name not 'x'. got=%s", lit.Fields[0].Name)
+	}
+	testIntegerLiteral(t, lit.Fields[0].Value, 1)
+	if lit.Fields[1].Name.Value != "y" {
+		t.Errorf("lit.Fields[1].Name not 'y'. got=%s", lit.Fields[1].Name)
+	}
+	testInfixExpression(t, lit.Fields[1].Value, 2, "*", 3)
+}
+
+func TestStructParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Empty {}", "struct Empty {  }"},
+		{"struct P { x }; P{}", "struct P { x }P{}"},
+		{"let p = Point{x: 1, y: a + b};", "let p = Point{x: 1, y: (a + b)};"},
+		{"p.x", "p.x"},
+		{"p.x + q.y * 2", "(p.x + (q.y * 2))"},
+		{"-p.x", "(-p.x)"},
+		{"a.b.c", "a.b.c"},
+		{"f(p).x", "f(p).x"},
+		{"p.f(1)", "p.f(1)"},
+		{"Point{x: 1}.x", "Point{x: 1}.x"},
+		{"Line{from: Point{x: 1, y: 2}, to: b}", "Line{from: Point{x: 1, y: 2}, to: b}"},
+		{"if (a) { b }", "if (a) { b }"},
+		{"fn(x) { p }", "fn(x) { p }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestEnumDeclarationParsing(t *testing.T) {
+	input := `enum Shape { Circle(r), Rect(w, h), Empty }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	decl, ok := program.Statements[0].(*ast.EnumDeclaration)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.EnumDeclaration. got=%T",
+			program.Statements[0])
+	}
+	if decl.Name.Value != "Shape" {
+		t.Errorf("decl.Name.Value not 'Shape'. got=%s", decl.Name.Value)
+	}
+
+	expected := []struct {
+		name   string
+		fields []string
+	}{
+		{"Circle", []string{"r"}},
+		{"Rect", []string{"w", "h"}},
+		{"Empty", []string{}},
+	}
+	if len(decl.Variants) != len(expected) {
+		t.Fatalf("decl.Variants does not contain %d variants. got=%d",
+			len(expected), len(decl.Variants))
+	}
+	for i, want := range expected {
+		variant := decl.Variants[i]
+		if variant.Name.Value != want.name {
+			t.Errorf("variant %d name wrong. want=%s, got=%s", i, want.name, variant.Name)
+		}
+		if len(variant.Fields) != len(want.fields) {
+			t.Fatalf("variant %s fields wrong. want=%d, got=%d",
+				want.name, len(want.fields), len(variant.Fields))
+		}
+		for j, f := range want.fields {
+			testIdentifier(t, variant.Fields[j], f)
+		}
+	}
+}
+
+func TestLetConditionParsing(t *testing.T) {
+	input := `if (let Rect(w, h) = shape) { w * h }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	cond, ok := exp.Condition.(*ast.LetCondition)
+	if !ok {
+		t.Fatalf("exp.Condition is not ast.LetCondition. got=%T", exp.Condition)
+	}
+	if cond.Pattern.Name.Value != "Rect" {
+		t.Errorf("cond.Pattern.Name not 'Rect'. got=%s", cond.Pattern.Name)
+	}
+	if len(cond.Pattern.Bindings) != 2 {
+		t.Fatalf("cond.Pattern.Bindings does not contain 2 bindings. got=%d",
+			len(cond.Pattern.Bindings))
+	}
+	testIdentifier(t, cond.Pattern.Bindings[0], "w")
+	testIdentifier(t, cond.Pattern.Bindings[1], "h")
+	testIdentifier(t, cond.Value, "shape")
+}
+
+func TestEnumParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Color { Red, Green, Blue };", "enum Color { Red, Green, Blue }"},
+		{"let s = Circle(2);", "let s = Circle(2);"},
+		{"if (let Empty = s) { 0 }", "if (let Empty = s) { 0 }"},
+		{"if (let Circle(_) = f(s)) { 1 } else { 2 }", "if (let Circle(_) = f(s)) { 1 } else { 2 }"},
+		{
+			"if (let Circle(r) = s) { r } else if (let Rect(w, h) = s) { w * h } else { 0 }",
+			"if (let Circle(r) = s) { r } else { if (let Rect(w, h) = s) { (w * h) } else { 0 } }",
+		},
+		{"if (a) { 1 } else if (b) { 2 }", "if (a) { 1 } else { if (b) { 2 } }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestThrowStatementParsing(t *testing.T) {
+	input := `throw 1 + 2;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	testInfixExpression(t, stmt.Value, 1, "+", 2)
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	input := `try { f(x) } catch (e) { e } finally { cleanup() }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+	}
+	if len(exp.Body.Statements) != 1 {
+		t.Errorf("exp.Body is not 1 statements. got=%d", len(exp.Body.Statements))
+	}
+	testIdentifier(t, exp.CatchParam, "e")
+	if len(exp.Catch.Statements) != 1 {
+		t.Errorf("exp.Catch is not 1 statements. got=%d", len(exp.Catch.Statements))
+	}
+	if len(exp.Finally.Statements) != 1 {
+		t.Errorf("exp.Finally is not 1 statements. got=%d", len(exp.Finally.Statements))
+	}
+}
+
+func TestExceptionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"throw x", "throw x;"},
+		{"try { a } catch (e) { b }", "try { a } catch (e) { b }"},
+		{"try { a } finally { b }", "try { a } finally { b }"},
+		{"let x = try { f() } catch (e) { 0 }; x", "let x = try { f() } catch (e) { 0 };x"},
+		{"try { a } catch (e) { throw e; } + 1", "(try { a } catch (e) { throw e; } + 1)"},
+		{"fn() { try { return 1; } finally { g() } }", "fn() { try { return 1; } finally { g() } }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"try { a }", "expected catch or finally block after try block."},
+		{"try { a } catch { b }", "expected next token to be (, got { instead."},
+		{"try { a } catch (1) { b }", "expected next token to be IDENT, got INT instead."},
+		{"try a", "expected next token to be {, got IDENT instead."},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	p := New(lexer.New(`"hello \"world\"\n";`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello \"world\"\n" {
+		t.Errorf("literal.Value not %q. got=%q", "hello \"world\"\n", literal.Value)
+	}
+	if literal.String() != `"hello \"world\"\n"` {
+		t.Errorf("literal.String() wrong. got=%s", literal.String())
+	}
+}
+
+func TestCollectionLiteralsAndIndexing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`s[1]`, `(s[1])`},
+		{`s[1 + 1]`, `(s[(1 + 1)])`},
+		{`s[1:2]`, `(s[1:2])`},
+		{`s[:n - 1]`, `(s[:(n - 1)])`},
+		{`s[1:]`, `(s[1:])`},
+		{`s[:]`, `(s[:])`},
+		{`"abc"[0]`, `("abc"[0])`},
+		{`-s[0]`, `(-(s[0]))`},
+		{`a * s[1][2]`, `(a * ((s[1])[2]))`},
+		{`f(x)[0]`, `(f(x)[0])`},
+		{`p.s[0:1].t`, `(p.s[0:1]).t`},
+		{`[]`, `[]`},
+		{`[1, 2 * 3, "x"]`, `[1, (2 * 3), "x"]`},
+		{`[[1], []][0][0]`, `(([[1], []][0])[0])`},
+		{`map([1, 2], fn(x) { x * 2 })`, `map([1, 2], fn(x) { (x * 2) })`},
+		{`{}`, `{}`},
+		{`{"a": 1, 2: [3], k: 1 + 1,}`, `{"a": 1, 2: [3], k: (1 + 1)}`},
+		{`{"a": {"b": 1}}["a"]["b"]`, `(({"a": {"b": 1}}["a"])["b"])`},
+		{`fn() { {"a": 1} }`, `fn() { {"a": 1} }`},
+		{`P{x: {}}`, `P{x: {}}`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`s[1`, "1:4: expected next token to be ], got EOF instead."},
+		{`s[1:2:3]`, "1:6: expected next token to be ], got : instead."},
+		{`[1, 2`, "1:6: expected next token to be ], got EOF instead."},
+		{`{"a" 1}`, "1:6: expected next token to be :, got INT instead."},
+		{`{"a": 1 "b": 2}`, "1:9: expected next token to be ,, got STRING instead."},
+		{`"abc`, "1:1: illegal token \"\\\"abc\""},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.SyntaxErrors()
+		if len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+	}
+}
+
+func TestSyntaxErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1;", "1:5: expected next token to be IDENT, got = instead."},
+		{"let x = 1;\n  try { a }", "2:3: expected catch or finally block after try block."},
+		{"fn(x) { x }(1, ]", "1:16: No prefix parse function for ] found."},
+		{"let f = fn(x: ) { x }", "1:15: expected type, got ) instead."},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errs := p.SyntaxErrors()
+		if len(errs) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+		if errs[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errs[0].Error())
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
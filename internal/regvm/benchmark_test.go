@@ -0,0 +1,87 @@
+package regvm
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/evaluator"
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The benchmarks compare the register VM (BenchmarkRegVM...) with the tree-walking
+// evaluator (BenchmarkEval...) on the same programs:
+//
+//	go test ./internal/regvm -run XXX -bench .
+
+const fibonacci = `
+let fibonacci = fn(x) {
+  if (x < 2) {
+    x
+  } else {
+    fibonacci(x - 1) + fibonacci(x - 2)
+  }
+};
+`
+
+var benchmarks = []struct {
+	name     string
+	input    string
+	expected int64
+}{
+	{"Fibonacci", fibonacci + "fibonacci(20)", 6765},
+	{
+		// a loop written as tail recursion
+		"Loop",
+		`let loop = fn(i, n, acc) { if (i > n) { acc } else { loop(i + 1, n, acc + i * i) } };
+		 loop(1, 2000, 0)`,
+		2668667000,
+	},
+	{
+		// builds a closure for every step and calls it through a chain of closures
+		"Closures",
+		`let compose = fn(f, g) { fn(x) { g(f(x)) } };
+		 let inc = fn(x) { x + 1 };
+		 let build = fn(n, f) { if (n == 0) { f } else { build(n - 1, compose(f, inc)) } };
+		 let repeat = fn(k, acc) { if (k == 0) { acc } else { repeat(k - 1, acc + build(50, inc)(0)) } };
+		 repeat(100, 0)`,
+		5100,
+	},
+}
+
+func BenchmarkRegVM(b *testing.B) {
+	for _, bm := range benchmarks {
+		program, err := Compile(parse(b, bm.input))
+		if err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				vm := New(program)
+				if err := vm.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+				checkBenchmarkResult(b, vm.LastValue(), bm.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	for _, bm := range benchmarks {
+		program := parse(b, bm.input)
+
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				result := evaluator.Eval(program, object.NewEnvironment())
+				checkBenchmarkResult(b, result, bm.expected)
+			}
+		})
+	}
+}
+
+func checkBenchmarkResult(b *testing.B, result object.Object, expected int64) {
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != expected {
+		b.Fatalf("wrong result. want=%d, got=%s", expected, result.Inspect())
+	}
+}
@@ -0,0 +1,136 @@
+package regvm
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+type Opcode byte
+
+// The operands A, B and C of an instruction are register numbers (relative to the
+// frame), unless noted otherwise. R[x] is register x, K[x] the constant x.
+const (
+	OpLoadK     Opcode = iota // R[A] = K[B]
+	OpLoadBool                // R[A] = B != 0
+	OpLoadNull                // R[A] = null
+	OpMove                    // R[A] = R[B]
+	OpGetGlobal               // R[A] = global B
+	OpSetGlobal               // global B = R[A]
+	OpGetFree                 // R[A] = free variable B of the closure
+	OpCurrent                 // R[A] = the closure being executed
+
+	OpAdd         // R[A] = R[B] + R[C]
+	OpSub         // R[A] = R[B] - R[C]
+	OpMul         // R[A] = R[B] * R[C]
+	OpDiv         // R[A] = R[B] / R[C]
+	OpEqual       // R[A] = R[B] == R[C]
+	OpNotEqual    // R[A] = R[B] != R[C]
+	OpGreaterThan // R[A] = R[B] > R[C]
+	OpLessThan    // R[A] = R[B] < R[C]
+	OpMinus       // R[A] = -R[B]
+	OpBang        // R[A] = !R[B]
+
+	OpJump          // jump to instruction A
+	OpJumpNotTruthy // if R[A] is falsy, jump to instruction B
+
+	OpClosure  // R[A] = a closure of the function K[B]
+	OpCall     // R[A] = R[B](R[B+1], ..., R[B+C])
+	OpTailCall // return R[B](R[B+1], ..., R[B+C]), in the frame of the caller
+	OpReturn   // return R[A]
+)
+
+var opcodeNames = map[Opcode]string{
+	OpLoadK:         "LOADK",
+	OpLoadBool:      "LOADBOOL",
+	OpLoadNull:      "LOADNULL",
+	OpMove:          "MOVE",
+	OpGetGlobal:     "GETGLOBAL",
+	OpSetGlobal:     "SETGLOBAL",
+	OpGetFree:       "GETFREE",
+	OpCurrent:       "CURRENT",
+	OpAdd:           "ADD",
+	OpSub:           "SUB",
+	OpMul:           "MUL",
+	OpDiv:           "DIV",
+	OpEqual:         "EQ",
+	OpNotEqual:      "NE",
+	OpGreaterThan:   "GT",
+	OpLessThan:      "LT",
+	OpMinus:         "NEG",
+	OpBang:          "NOT",
+	OpJump:          "JMP",
+	OpJumpNotTruthy: "JMPNOT",
+	OpClosure:       "CLOSURE",
+	OpCall:          "CALL",
+	OpTailCall:      "TAILCALL",
+	OpReturn:        "RETURN",
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP(%d)", op)
+}
+
+// Instruction is a three-address instruction
+type Instruction struct {
+	Op      Opcode
+	A, B, C int
+}
+
+func (ins Instruction) String() string {
+	return fmt.Sprintf("%-9s %d %d %d", ins.Op, ins.A, ins.B, ins.C)
+}
+
+// FreeVariable describes where a closure captures a free variable from, in the frame
+// creating the closure.
+type FreeVariable struct {
+	Kind  FreeKind
+	Index int // the register (CaptureLocal) or free variable (CaptureFree)
+}
+
+type FreeKind byte
+
+const (
+	CaptureLocal FreeKind = iota
+	CaptureFree
+	CaptureCurrent // the closure creating the closure
+)
+
+// Function is a compiled function literal (or the program)
+type Function struct {
+	Name          string
+	Code          []Instruction
+	Positions     []token.Position // Positions[i] is the source of Code[i]
+	NumParameters int
+	NumRegisters  int
+	Free          []FreeVariable
+}
+
+func (f *Function) Type() object.Type { return object.COMPILED_FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	return fmt.Sprintf("Function[%p]", f)
+}
+
+func (f *Function) String() string {
+	var out bytes.Buffer
+	for i, ins := range f.Code {
+		fmt.Fprintf(&out, "%04d %s\n", i, ins)
+	}
+	return out.String()
+}
+
+// Closure is a function together with the values of its free variables
+type Closure struct {
+	Fn   *Function
+	Free []object.Object
+}
+
+func (c *Closure) Type() object.Type { return object.CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
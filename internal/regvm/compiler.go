@@ -0,0 +1,466 @@
+package regvm
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Program is a compiled program: the code outside any function, the constants
+// (integers and functions) referenced by the instructions and the names of the globals.
+type Program struct {
+	Main      *Function
+	Constants []object.Object
+	Globals   []string
+}
+
+// The value of the last expression statement of the program is kept in register 0
+// of the main frame.
+const resultRegister = 0
+
+// funcState is the state of the function being compiled
+type funcState struct {
+	parent *funcState
+	fn     *Function
+
+	scopes    []map[string]int // names of the locals -> their registers, innermost last
+	self      string           // the name the function can call itself by
+	freeIndex map[string]int
+
+	nextReg int // the first free register
+}
+
+func (fs *funcState) alloc() int {
+	r := fs.nextReg
+	fs.nextReg++
+	if fs.nextReg > fs.fn.NumRegisters {
+		fs.fn.NumRegisters = fs.nextReg
+	}
+	return r
+}
+
+func (fs *funcState) define(name string, reg int) {
+	fs.scopes[len(fs.scopes)-1][name] = reg
+}
+
+type symbolKind int
+
+const (
+	globalSymbol symbolKind = iota
+	localSymbol
+	freeSymbol
+	selfSymbol
+)
+
+type compiler struct {
+	constants []object.Object
+	globals   map[string]int
+	undefined map[string]bool // the globals of lets not compiled yet
+	fs        *funcState
+	pos       token.Position
+}
+
+// Compile lowers program to register code. The values are integers, booleans and
+// functions: a program using other values (e.g. floats or strings), structs, enums or
+// exceptions fails to compile. The names bound by let statements in an arm are local
+// to the arm.
+func Compile(program *ast.Program) (*Program, error) {
+	c := &compiler{globals: map[string]int{}, undefined: map[string]bool{}}
+	c.fs = &funcState{fn: &Function{Name: "main"}, scopes: []map[string]int{{}}}
+	c.fs.alloc() // resultRegister
+	c.emit(OpLoadNull, resultRegister, 0, 0)
+
+	// The globals of the lets are allocated up front, so that a function can refer to
+	// a global defined after it. The main code cannot until the let is compiled.
+	for _, s := range program.Statements {
+		if let, ok := s.(*ast.LetStatement); ok {
+			if _, ok := c.globals[let.Name.Value]; !ok {
+				c.globals[let.Name.Value] = len(c.globals)
+				c.undefined[let.Name.Value] = true
+			}
+		}
+	}
+	for _, s := range program.Statements {
+		mark := c.fs.nextReg
+		if err := c.statement(s); err != nil {
+			return nil, err
+		}
+		c.fs.nextReg = mark
+	}
+	c.emit(OpReturn, resultRegister, 0, 0)
+
+	globals := make([]string, len(c.globals))
+	for name, index := range c.globals {
+		globals[index] = name
+	}
+	return &Program{Main: c.fs.fn, Constants: c.constants, Globals: globals}, nil
+}
+
+func (c *compiler) errorf(format string, a ...interface{}) error {
+	if !c.pos.IsValid() {
+		return fmt.Errorf(format, a...)
+	}
+	return fmt.Errorf("%s: %s", c.pos, fmt.Sprintf(format, a...))
+}
+
+func (c *compiler) emit(op Opcode, a, b, cc int) int {
+	fn := c.fs.fn
+	fn.Code = append(fn.Code, Instruction{Op: op, A: a, B: b, C: cc})
+	fn.Positions = append(fn.Positions, c.pos)
+	return len(fn.Code) - 1
+}
+
+func (c *compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *compiler) isMain() bool { return c.fs.parent == nil }
+
+func (c *compiler) statement(s ast.Statement) error {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		c.pos = s.Token.Pos
+		if c.isMain() {
+			return c.exprTo(s.Expression, resultRegister)
+		}
+		_, err := c.expr(s.Expression)
+		return err
+
+	case *ast.LetStatement:
+		c.pos = s.Token.Pos
+		return c.letStatement(s)
+
+	case *ast.ReturnStatement:
+		c.pos = s.Token.Pos
+		r, err := c.expr(s.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(OpReturn, r, 0, 0)
+		return nil
+
+	case *ast.ThrowStatement:
+		c.pos = s.Token.Pos
+		return c.errorf("throw statements are unsupported by regvm")
+
+	default:
+		return c.errorf("regvm: unsupported statement %T", s)
+	}
+}
+
+// letStatement binds the name to a register, or to a global in the program
+func (c *compiler) letStatement(s *ast.LetStatement) error {
+	name := s.Name.Value
+	fn, isFunction := s.Value.(*ast.FunctionLiteral)
+
+	if c.isMain() {
+		// A function literal can refer to itself (let-rec)
+		if isFunction {
+			c.defineGlobal(name)
+		}
+		r := c.fs.alloc()
+		if err := c.valueTo(s.Value, fn, name, r); err != nil {
+			return err
+		}
+		c.defineGlobal(name)
+		c.emit(OpSetGlobal, r, c.globals[name], 0)
+		return nil
+	}
+
+	r := c.fs.alloc()
+	if err := c.valueTo(s.Value, fn, name, r); err != nil {
+		return err
+	}
+	c.fs.define(name, r)
+	c.fs.nextReg = r + 1 // the register stays allocated
+	return nil
+}
+
+func (c *compiler) valueTo(value ast.Expression, fn *ast.FunctionLiteral, name string, dst int) error {
+	if fn != nil {
+		return c.functionLiteral(fn, name, dst)
+	}
+	return c.exprTo(value, dst)
+}
+
+// expr compiles node and returns the register holding its value: the register of a
+// local, or a newly allocated one.
+func (c *compiler) expr(node ast.Expression) (int, error) {
+	if ident, ok := node.(*ast.Identifier); ok {
+		if kind, index, ok := c.resolve(c.fs, ident.Value); ok && kind == localSymbol {
+			return index, nil
+		}
+	}
+	r := c.fs.alloc()
+	return r, c.exprTo(node, r)
+}
+
+// exprTo compiles node with its value stored in register dst
+func (c *compiler) exprTo(node ast.Expression, dst int) error {
+	mark := c.fs.nextReg
+	defer func() { c.fs.nextReg = mark }()
+
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(OpLoadK, dst, c.addConstant(object.IntegerLiteral(node)), 0)
+
+	case *ast.Boolean:
+		b := 0
+		if node.Value {
+			b = 1
+		}
+		c.emit(OpLoadBool, dst, b, 0)
+
+	case *ast.Identifier:
+		c.pos = node.Token.Pos
+		kind, index, ok := c.resolve(c.fs, node.Value)
+		if !ok {
+			return c.errorf("identifier not found: %s", node.Value)
+		}
+		switch kind {
+		case globalSymbol:
+			c.emit(OpGetGlobal, dst, index, 0)
+		case localSymbol:
+			if index != dst {
+				c.emit(OpMove, dst, index, 0)
+			}
+		case freeSymbol:
+			c.emit(OpGetFree, dst, index, 0)
+		case selfSymbol:
+			c.emit(OpCurrent, dst, 0, 0)
+		}
+
+	case *ast.PrefixExpression:
+		r, err := c.expr(node.Right)
+		if err != nil {
+			return err
+		}
+		c.pos = node.Token.Pos
+		switch node.Operator {
+		case "-":
+			c.emit(OpMinus, dst, r, 0)
+		case "!":
+			c.emit(OpBang, dst, r, 0)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		left, err := c.expr(node.Left)
+		if err != nil {
+			return err
+		}
+		right, err := c.expr(node.Right)
+		if err != nil {
+			return err
+		}
+		c.pos = node.Token.Pos
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op, dst, left, right)
+
+	case *ast.IfExpression:
+		return c.ifExpression(node, dst)
+
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(node, "", dst)
+
+	case *ast.CallExpression:
+		// the function and the arguments go in consecutive registers
+		base := c.fs.alloc()
+		if err := c.exprTo(node.Function, base); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.exprTo(a, c.fs.alloc()); err != nil {
+				return err
+			}
+		}
+		c.pos = node.Token.Pos
+		c.emit(OpCall, dst, base, len(node.Arguments))
+
+	case *ast.FloatLiteral:
+		c.pos = node.Token.Pos
+		return c.errorf("floats are unsupported by regvm")
+
+	case *ast.TryExpression:
+		c.pos = node.Token.Pos
+		return c.errorf("try expressions are unsupported by regvm")
+
+	default:
+		return c.errorf("regvm: unsupported expression %T", node)
+	}
+
+	return nil
+}
+
+var infixOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	">":  OpGreaterThan,
+	"<":  OpLessThan,
+}
+
+func (c *compiler) ifExpression(node *ast.IfExpression, dst int) error {
+	c.pos = node.Token.Pos
+	if _, ok := node.Condition.(*ast.LetCondition); ok {
+		return c.errorf("regvm: unsupported expression %T", node.Condition)
+	}
+
+	mark := c.fs.nextReg
+	cond, err := c.expr(node.Condition)
+	if err != nil {
+		return err
+	}
+	c.fs.nextReg = mark
+	jumpNotTruthy := c.emit(OpJumpNotTruthy, cond, 0, 0)
+
+	if err := c.blockTo(node.IfArm, dst); err != nil {
+		return err
+	}
+	jump := c.emit(OpJump, 0, 0, 0)
+
+	c.fs.fn.Code[jumpNotTruthy].B = len(c.fs.fn.Code)
+	if node.ElseArm == nil {
+		c.emit(OpLoadNull, dst, 0, 0)
+	} else if err := c.blockTo(node.ElseArm, dst); err != nil {
+		return err
+	}
+	c.fs.fn.Code[jump].A = len(c.fs.fn.Code)
+	return nil
+}
+
+// blockTo compiles a block used as an expression (an arm or a body) with the value of
+// its last expression statement (or null) stored in dst. Outside any function the let
+// statements of the block bind globals, otherwise locals of the block.
+func (c *compiler) blockTo(block *ast.BlockStatement, dst int) error {
+	mark := c.fs.nextReg
+	if !c.isMain() {
+		c.fs.scopes = append(c.fs.scopes, map[string]int{})
+	}
+	defer func() {
+		if !c.isMain() {
+			c.fs.scopes = c.fs.scopes[:len(c.fs.scopes)-1]
+		}
+		c.fs.nextReg = mark
+	}()
+
+	n := len(block.Statements)
+	for i, s := range block.Statements {
+		if es, ok := s.(*ast.ExpressionStatement); ok && i == n-1 {
+			c.pos = es.Token.Pos
+			return c.exprTo(es.Expression, dst)
+		}
+		statementMark := c.fs.nextReg
+		if err := c.statement(s); err != nil {
+			return err
+		}
+		if _, ok := s.(*ast.LetStatement); !ok || c.isMain() {
+			c.fs.nextReg = statementMark
+		}
+	}
+	c.emit(OpLoadNull, dst, 0, 0)
+	return nil
+}
+
+func (c *compiler) functionLiteral(node *ast.FunctionLiteral, name string, dst int) error {
+	c.pos = node.Token.Pos
+	fs := &funcState{
+		parent:    c.fs,
+		fn:        &Function{Name: name, NumParameters: len(node.Parameters)},
+		scopes:    []map[string]int{{}},
+		self:      name,
+		freeIndex: map[string]int{},
+	}
+	for _, p := range node.Parameters {
+		fs.define(p.Value, fs.alloc())
+	}
+
+	c.fs = fs
+	result := fs.alloc()
+	err := c.blockTo(node.Body, result)
+	if err == nil {
+		c.emit(OpReturn, result, 0, 0)
+		markTailCalls(fs.fn)
+	}
+	c.fs = fs.parent
+	if err != nil {
+		return err
+	}
+
+	c.pos = node.Token.Pos
+	c.emit(OpClosure, dst, c.addConstant(fs.fn), 0)
+	return nil
+}
+
+// markTailCalls replaces the calls of fn whose value is returned (by the next
+// instruction, after following jumps) with tail calls.
+func markTailCalls(fn *Function) {
+	for i, ins := range fn.Code {
+		if ins.Op != OpCall {
+			continue
+		}
+		next := i + 1
+		for next < len(fn.Code) && fn.Code[next].Op == OpJump {
+			next = fn.Code[next].A
+		}
+		if next < len(fn.Code) && fn.Code[next].Op == OpReturn && fn.Code[next].A == ins.A {
+			fn.Code[i].Op = OpTailCall
+		}
+	}
+}
+
+// defineGlobal allocates the global of a let in the main code, unless the name has one
+func (c *compiler) defineGlobal(name string) {
+	if _, ok := c.globals[name]; !ok {
+		c.globals[name] = len(c.globals)
+	}
+	delete(c.undefined, name)
+}
+
+// resolve looks name up in the function fs and the enclosing ones. A local of an
+// enclosing function becomes a free variable of every function in between.
+func (c *compiler) resolve(fs *funcState, name string) (symbolKind, int, bool) {
+	for i := len(fs.scopes) - 1; i >= 0; i-- {
+		if r, ok := fs.scopes[i][name]; ok {
+			return localSymbol, r, true
+		}
+	}
+	if fs.parent == nil {
+		index, ok := c.globals[name]
+		return globalSymbol, index, ok && (fs != c.fs || !c.undefined[name])
+	}
+	if name == fs.self {
+		return selfSymbol, 0, true
+	}
+	if index, ok := fs.freeIndex[name]; ok {
+		return freeSymbol, index, true
+	}
+
+	kind, index, ok := c.resolve(fs.parent, name)
+	if !ok || kind == globalSymbol {
+		return kind, index, ok
+	}
+
+	var free FreeVariable
+	switch kind {
+	case localSymbol:
+		free = FreeVariable{Kind: CaptureLocal, Index: index}
+	case freeSymbol:
+		free = FreeVariable{Kind: CaptureFree, Index: index}
+	case selfSymbol:
+		free = FreeVariable{Kind: CaptureCurrent}
+	}
+	fs.fn.Free = append(fs.fn.Free, free)
+	fs.freeIndex[name] = len(fs.fn.Free) - 1
+	return freeSymbol, len(fs.fn.Free) - 1, true
+}
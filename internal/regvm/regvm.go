@@ -0,0 +1,284 @@
+// Package regvm implements a register-based virtual machine for Monkey programs.
+//
+// Each function is compiled to three-address instructions operating on the virtual
+// registers of its frame: the parameters, the locals bound by let statements and the
+// temporaries of expressions are all registers. A call places the function and its
+// arguments in consecutive registers of the caller, so that the arguments are the
+// first registers of the callee's frame, without copying.
+package regvm
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// MaxFrames limits the depth of calls
+const MaxFrames = 1 << 16
+
+// There is only ever one null, true and false value
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+type frame struct {
+	cl   *Closure
+	pc   int // the next instruction
+	base int // the register file index of register 0 of the frame
+	ret  int // the register file index of the caller's register receiving the result
+}
+
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+	names     []string        // of the globals
+	regs      []object.Object // the register file (the registers of all frames)
+	frames    []frame
+	result    object.Object
+}
+
+func New(program *Program) *VM {
+	main := &Closure{Fn: program.Main}
+	vm := &VM{
+		constants: program.Constants,
+		globals:   make([]object.Object, len(program.Globals)),
+		names:     program.Globals,
+		regs:      make([]object.Object, 1024),
+	}
+	vm.frames = append(vm.frames, frame{cl: main})
+	vm.ensureRegisters(main.Fn.NumRegisters)
+	return vm
+}
+
+// LastValue is the value of the last expression statement of the program (or of its
+// return statement).
+func (vm *VM) LastValue() object.Object {
+	return vm.result
+}
+
+// Run executes the program
+func (vm *VM) Run() error {
+	f := &vm.frames[len(vm.frames)-1]
+	fn := f.cl.Fn
+	code := fn.Code
+	base := f.base
+	pc := 0
+	regs := vm.regs
+
+	// errorf returns an error positioned at the instruction being executed
+	errorf := func(format string, a ...interface{}) error {
+		return fmt.Errorf("%s: %s", fn.Positions[pc-1], fmt.Sprintf(format, a...))
+	}
+
+	for {
+		ins := code[pc]
+		pc++
+
+		switch ins.Op {
+		case OpLoadK:
+			regs[base+ins.A] = vm.constants[ins.B]
+
+		case OpLoadBool:
+			regs[base+ins.A] = nativeBoolToBooleanObject(ins.B != 0)
+
+		case OpLoadNull:
+			regs[base+ins.A] = Null
+
+		case OpMove:
+			regs[base+ins.A] = regs[base+ins.B]
+
+		case OpGetGlobal:
+			if vm.globals[ins.B] == nil {
+				// a function called before the let of a global it refers to
+				return errorf("identifier not found: %s", vm.names[ins.B])
+			}
+			regs[base+ins.A] = vm.globals[ins.B]
+
+		case OpSetGlobal:
+			vm.globals[ins.B] = regs[base+ins.A]
+
+		case OpGetFree:
+			regs[base+ins.A] = f.cl.Free[ins.B]
+
+		case OpCurrent:
+			regs[base+ins.A] = f.cl
+
+		case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual, OpGreaterThan, OpLessThan:
+			left, right := regs[base+ins.B], regs[base+ins.C]
+			if left.Type() != object.INTEGER_OBJ || right.Type() != object.INTEGER_OBJ {
+				val, err := binaryObjectOperation(ins.Op, left, right)
+				if err != "" {
+					return errorf("%s", err)
+				}
+				regs[base+ins.A] = val
+				break
+			}
+			switch ins.Op {
+			case OpAdd, OpSub, OpMul, OpDiv:
+				val, err := object.IntegerArithmetic(binaryOperators[ins.Op], left, right)
+				if err != nil {
+					return errorf("%s", err)
+				}
+				regs[base+ins.A] = val
+			case OpEqual:
+				regs[base+ins.A] = nativeBoolToBooleanObject(object.CompareIntegers(left, right) == 0)
+			case OpNotEqual:
+				regs[base+ins.A] = nativeBoolToBooleanObject(object.CompareIntegers(left, right) != 0)
+			case OpGreaterThan:
+				regs[base+ins.A] = nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0)
+			case OpLessThan:
+				regs[base+ins.A] = nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0)
+			}
+
+		case OpMinus:
+			operand := regs[base+ins.B]
+			if operand.Type() != object.INTEGER_OBJ {
+				return errorf("unknown operator: -%s", operand.Type())
+			}
+			regs[base+ins.A] = object.NegateInteger(operand)
+
+		case OpBang:
+			regs[base+ins.A] = nativeBoolToBooleanObject(!isTruthy(regs[base+ins.B]))
+
+		case OpJump:
+			pc = ins.A
+
+		case OpJumpNotTruthy:
+			if !isTruthy(regs[base+ins.A]) {
+				pc = ins.B
+			}
+
+		case OpClosure:
+			proto := vm.constants[ins.B].(*Function)
+			cl := &Closure{Fn: proto, Free: make([]object.Object, len(proto.Free))}
+			for i, free := range proto.Free {
+				switch free.Kind {
+				case CaptureLocal:
+					cl.Free[i] = regs[base+free.Index]
+				case CaptureFree:
+					cl.Free[i] = f.cl.Free[free.Index]
+				case CaptureCurrent:
+					cl.Free[i] = f.cl
+				}
+			}
+			regs[base+ins.A] = cl
+
+		case OpCall:
+			callee, ok := regs[base+ins.B].(*Closure)
+			if !ok {
+				return errorf("not a function: %s", regs[base+ins.B].Type())
+			}
+			if ins.C != callee.Fn.NumParameters {
+				return errorf("wrong number of arguments: want=%d, got=%d",
+					callee.Fn.NumParameters, ins.C)
+			}
+			if len(vm.frames) >= MaxFrames {
+				return errorf("stack overflow")
+			}
+
+			f.pc = pc
+			newBase := base + ins.B + 1
+			vm.frames = append(vm.frames, frame{cl: callee, base: newBase, ret: base + ins.A})
+			vm.ensureRegisters(newBase + callee.Fn.NumRegisters)
+
+			f = &vm.frames[len(vm.frames)-1]
+			fn, code, base, pc, regs = callee.Fn, callee.Fn.Code, newBase, 0, vm.regs
+
+		case OpTailCall:
+			callee, ok := regs[base+ins.B].(*Closure)
+			if !ok {
+				return errorf("not a function: %s", regs[base+ins.B].Type())
+			}
+			if ins.C != callee.Fn.NumParameters {
+				return errorf("wrong number of arguments: want=%d, got=%d",
+					callee.Fn.NumParameters, ins.C)
+			}
+
+			// the callee runs in the frame of the caller, with the arguments moved to
+			// the first registers
+			vm.ensureRegisters(base + callee.Fn.NumRegisters)
+			copy(vm.regs[base:], vm.regs[base+ins.B+1:base+ins.B+1+ins.C])
+
+			f.cl = callee
+			fn, code, pc, regs = callee.Fn, callee.Fn.Code, 0, vm.regs
+
+		case OpReturn:
+			val := regs[base+ins.A]
+			ret := f.ret
+
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == 0 {
+				vm.result = val
+				return nil
+			}
+
+			f = &vm.frames[len(vm.frames)-1]
+			fn, code, base, pc = f.cl.Fn, f.cl.Fn.Code, f.base, f.pc
+			regs[ret] = val
+
+		default:
+			return errorf("cannot execute opcode %s", ins.Op)
+		}
+	}
+}
+
+// ensureRegisters grows the register file to at least n registers
+func (vm *VM) ensureRegisters(n int) {
+	if n <= len(vm.regs) {
+		return
+	}
+	size := 2 * len(vm.regs)
+	for size < n {
+		size *= 2
+	}
+	regs := make([]object.Object, size)
+	copy(regs, vm.regs)
+	vm.regs = regs
+}
+
+var binaryOperators = map[Opcode]string{
+	OpAdd:         "+",
+	OpSub:         "-",
+	OpMul:         "*",
+	OpDiv:         "/",
+	OpEqual:       "==",
+	OpNotEqual:    "!=",
+	OpGreaterThan: ">",
+	OpLessThan:    "<",
+}
+
+// binaryObjectOperation is a binary operation on operands that are not both
+// integers. All such values are compared by identity.
+func binaryObjectOperation(op Opcode, left, right object.Object) (object.Object, string) {
+	switch {
+	case op == OpEqual:
+		return nativeBoolToBooleanObject(left == right), ""
+	case op == OpNotEqual:
+		return nativeBoolToBooleanObject(left != right), ""
+	case left.Type() != right.Type():
+		return nil, fmt.Sprintf("type mismatch: %s %s %s", left.Type(), binaryOperators[op], right.Type())
+	default:
+		return nil, fmt.Sprintf("unknown operator: %s %s %s", left.Type(), binaryOperators[op], right.Type())
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// null and false are falsy, everything else is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,343 @@
+package regvm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"-7 / 2", -3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"1 == true", false},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (true) { }", Null},
+		{"if (true) { let x = 5; x }", 5},
+		{"let f = fn(c) { if (c) { let x = 1; x } else { let y = 2; y } }; f(true) * 10 + f(false)", 12},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+		{"let f = fn() { let a = 1; let b = a + 1; let a = 10; a + b }; f()", 12},
+		{"let one = 1; one;", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"let f = fn(x) { return x; x + 10; }; f(10);", 10},
+		{"let f = fn(x) { let result = x + 10; return result; return 10; }; f(10);", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let g = 10; let sum = fn(a, b) { let c = a + b; c + g; }; sum(1, 2) + g;", 23},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn(a, b, c) { a * 100 + b * 10 + c }; f(1, f(0, 0, 2), 3)", 123},
+		{"let twice = fn(f, x) { f(f(x)) }; twice(fn(x) { x * 3 }, 2)", 18},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; newAdder(1, 2)(8);", 11},
+		{
+			`let newAdderOuter = fn(a, b) {
+			   let c = a + b;
+			   fn(d) {
+			     let e = d + c;
+			     fn(f) { e + f; };
+			   };
+			 };
+			 newAdderOuter(1, 2)(3)(8);`,
+			14,
+		},
+		{
+			`let newClosure = fn(a, b) {
+			   let one = fn() { a; };
+			   let two = fn() { b; };
+			   fn() { one() + two(); };
+			 };
+			 newClosure(9, 90)();`,
+			99,
+		},
+		{
+			`let wrapper = fn() {
+			   let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			   countDown(1);
+			 };
+			 wrapper();`,
+			0,
+		},
+		{
+			`let fact = fn(n) {
+			   let inner = fn() { if (n == 0) { 1 } else { n * fact(n - 1) } };
+			   inner()
+			 };
+			 fact(10)`,
+			3628800,
+		},
+		{
+			`let counter = fn(n) {
+			   fn() { if (n == 0) { 0 } else { 1 + counter(n - 1)() } }
+			 };
+			 counter(5)()`,
+			5,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// mutually recursive globals
+const evenOdd = `let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+`
+
+func TestRecursion(t *testing.T) {
+	tests := []vmTestCase{
+		{fibonacci + "fibonacci(15)", 610},
+		{"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(10000)", 50005000},
+		// tail calls run in constant stack space
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)", 1000000},
+		{"let count = fn(n, acc) { if (n == 0) { return acc; } return count(n - 1, acc + 1); }; count(1000000, 0)", 1000000},
+		{evenOdd + "even(1000000)", true},
+		{evenOdd + "odd(1000000)", false},
+		{
+			`let even = fn(n, odd) { if (n == 0) { true } else { odd(n - 1, even) } };
+			 let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1, odd) } };
+			 even(1000000, odd)`,
+			true,
+		},
+		{"let g = fn(a) { let b = a * 2; let c = b + 1; c }; let f = fn() { g(3) }; f() + 1", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"4294967296 * 4294967296 == 18446744073709551616", "true"},
+		{"(9223372036854775807 + 1) - 1 == 9223372036854775807", "true"},
+		{"let factorial = fn(n) { if (n == 0) { 1 } else { n * factorial(n - 1) } }; factorial(50)",
+			"30414093201713378043612608166064768844377641568960512000000000000"},
+	}
+
+	for _, tt := range tests {
+		program, err := Compile(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+		vm := New(program)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if got := vm.LastValue().Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong value. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"true + false;", "1:6: unknown operator: BOOLEAN + BOOLEAN"},
+		{"1 / 0", "1:3: division by zero"},
+		{"let x = 5; x(1)", "1:13: not a function: INTEGER"},
+		{"let f = fn(a, b) { a }; f(1)", "1:26: wrong number of arguments: want=2, got=1"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "1:22: stack overflow"},
+		{"let f = fn() { g() }; f(); let g = fn() { 1 };", "1:16: identifier not found: g"},
+	}
+
+	for _, tt := range tests {
+		program, err := Compile(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = New(program).Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q but resulted in none.", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "1:1: identifier not found: foobar"},
+		{"let f = fn() { if (true) { let x = 1; }; x }", "1:42: identifier not found: x"},
+		{"let x = y; let y = 1;", "1:9: identifier not found: y"},
+		{"struct P { x }", "regvm: unsupported statement *ast.StructDeclaration"},
+		{"let x = 1; x * 2.5", "1:16: floats are unsupported by regvm"},
+		{"let f = fn() { 1 }; try { f() } catch (e) { 2 }", "1:21: try expressions are unsupported by regvm"},
+		{"let f = fn() { throw 1; }", "1:16: throw statements are unsupported by regvm"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("expected compiler error for %q", tt.input)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("wrong compiler error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterAllocation(t *testing.T) {
+	program, err := Compile(parse(t, "fn(a, b) { let c = a + b; c * (a - b) }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	fn := program.Constants[0].(*Function)
+
+	// a: R0, b: R1, the result: R2, c: R3, a - b: R4
+	expected := `0000 ADD       3 0 1
+0001 SUB       4 0 1
+0002 MUL       2 3 4
+0003 RETURN    2 0 0
+`
+	if fn.String() != expected {
+		t.Errorf("wrong code.\nwant=%q\ngot =%q", expected, fn.String())
+	}
+	if fn.NumRegisters != 5 {
+		t.Errorf("wrong number of registers. want=5, got=%d", fn.NumRegisters)
+	}
+}
+
+func parse(t testing.TB, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program, err := Compile(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+
+		vm := New(program)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if err := testExpectedObject(tt.expected, vm.LastValue()); err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+		}
+	}
+}
+
+func testExpectedObject(expected interface{}, actual object.Object) error {
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+		}
+		if result.Value != int64(expected) {
+			return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok {
+			return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+		}
+		if result.Value != expected {
+			return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		}
+	case *object.Null:
+		if actual != Null {
+			return fmt.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	}
+	return nil
+}
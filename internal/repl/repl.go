@@ -3,8 +3,11 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"github.com/maxild/monkey/internal/evaluator"
 	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
 	"github.com/maxild/monkey/internal/parser"
+	"github.com/maxild/monkey/internal/stdlib"
 	"io"
 )
 
@@ -12,6 +15,12 @@ const PROMPT = ">> "
 
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
+	env := object.NewEnvironment()
+	// the user at the prompt is trusted with every capability
+	stdlib.Define(env, &stdlib.Host{
+		Capabilities: stdlib.Capabilities{stdlib.CapStdout, stdlib.CapClock, stdlib.CapRandom},
+		Stdout:       out,
+	})
 
 	for {
 		fmt.Printf(PROMPT)
@@ -30,8 +39,11 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		io.WriteString(out, program.String())
-		io.WriteString(out, "\n")
+		evaluated := evaluator.Eval(program, env)
+		if evaluated != nil {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
+		}
 	}
 }
 
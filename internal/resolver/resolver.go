@@ -0,0 +1,368 @@
+// Package resolver binds every identifier of a program to the variable it refers to,
+// and computes the variables captured by every function literal, so that a backend
+// can store variables in slots and build closures without looking names up in a chain
+// of environments at run time.
+//
+// The scoping rules are those of the compiler: a name must be defined before it is
+// used (a function literal bound by a let statement can refer to itself, and a
+// function can refer to a global bound by a later top-level let statement), the
+// bindings of a let condition are local to its arm, the parameter of a catch arm is
+// local to the arm, and the other let statements of an arm bind names of the
+// enclosing function (or globals).
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/token"
+)
+
+type Kind int
+
+const (
+	Global    Kind = iota // a slot of the globals
+	Local                 // a slot of the locals of the function
+	Parameter             // a parameter of the function (the first slots of the locals)
+	Free                  // a variable of an enclosing function captured by the closure
+	Self                  // the function itself, by the name it is bound to
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Global:
+		return "global"
+	case Local:
+		return "local"
+	case Parameter:
+		return "parameter"
+	case Free:
+		return "free"
+	default:
+		return "self"
+	}
+}
+
+// Variable is where the value of an identifier is stored
+type Variable struct {
+	Kind Kind
+	// Index is the slot of a global, local or parameter, or the index of a free
+	// variable in the captures of the function.
+	Index int
+	// Depth is the number of function literals between a free variable and its
+	// declaration (1 for a variable of the immediately enclosing function).
+	Depth int
+	Decl  *ast.Identifier // the identifier declaring the variable
+}
+
+func (v Variable) String() string {
+	switch v.Kind {
+	case Free:
+		return fmt.Sprintf("free %d (depth %d)", v.Index, v.Depth)
+	case Self:
+		return "self"
+	default:
+		return fmt.Sprintf("%s %d", v.Kind, v.Index)
+	}
+}
+
+// Function describes the storage of a function literal (or of the default of a struct
+// field, which is compiled as a function without parameters).
+type Function struct {
+	Name          string // the name it can call itself by ("" for none)
+	NumParameters int
+	NumLocals     int // the slots of the parameters and the locals
+	Captures      []Capture
+}
+
+// Capture is a free variable of a function: the variable of the enclosing function
+// whose value is copied into the closure when it is built.
+type Capture struct {
+	Name  string
+	Outer Variable // in the enclosing function
+}
+
+// Info is the result of resolving a program
+type Info struct {
+	// Identifiers holds the variable of every identifier that declares or refers to
+	// one (not the names of fields, or of variants in patterns).
+	Identifiers map[*ast.Identifier]Variable
+	Functions   map[*ast.FunctionLiteral]*Function
+	Defaults    map[*ast.StructField]*Function
+	NumGlobals  int
+}
+
+// Error is an identifier that is not defined, found at Pos in the source
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+// scope holds the names of the program, of a function or of a block (an arm binding
+// names of its own). A block allocates its slots in its owner function (or program).
+type scope struct {
+	outer *scope
+	names map[string]Variable
+	block bool
+	fn    *Function // nil for the program
+	slots int       // the number of slots allocated (not used by blocks)
+}
+
+func newScope(outer *scope, fn *Function, block bool) *scope {
+	return &scope{outer: outer, names: map[string]Variable{}, block: block, fn: fn}
+}
+
+func (s *scope) owner() *scope {
+	for s.block {
+		s = s.outer
+	}
+	return s
+}
+
+type resolver struct {
+	info      *Info
+	errors    []*Error
+	undefined map[string]bool // the globals of top-level lets not resolved yet
+}
+
+// Resolve resolves the identifiers of program, and returns the identifiers that are
+// not defined.
+func Resolve(program *ast.Program) (*Info, []*Error) {
+	r := &resolver{info: &Info{
+		Identifiers: map[*ast.Identifier]Variable{},
+		Functions:   map[*ast.FunctionLiteral]*Function{},
+		Defaults:    map[*ast.StructField]*Function{},
+	}, undefined: map[string]bool{}}
+
+	globals := newScope(nil, nil, false)
+	for _, s := range program.Statements {
+		if let, ok := s.(*ast.LetStatement); ok {
+			if _, ok := globals.names[let.Name.Value]; !ok {
+				r.define(let.Name, globals, Local)
+				r.undefined[let.Name.Value] = true
+			}
+		}
+	}
+	for _, s := range program.Statements {
+		r.statement(s, globals)
+	}
+	r.info.NumGlobals = globals.slots
+	return r.info, r.errors
+}
+
+// define binds the name of ident in s. Redefining a name of the same scope reuses its
+// slot.
+func (r *resolver) define(ident *ast.Identifier, s *scope, kind Kind) {
+	v, ok := s.names[ident.Value]
+	if !ok || (v.Kind != Global && v.Kind != Local && v.Kind != Parameter) {
+		owner := s.owner()
+		v = Variable{Index: owner.slots}
+		owner.slots++
+		if owner.fn != nil {
+			owner.fn.NumLocals = owner.slots
+		}
+	}
+
+	switch {
+	case s.owner().fn == nil:
+		v.Kind = Global
+	case kind == Parameter:
+		v.Kind = Parameter
+	default:
+		v.Kind = Local
+	}
+	if v.Kind == Global {
+		delete(r.undefined, ident.Value)
+	}
+	v.Decl = ident
+	s.names[ident.Value] = v
+	r.info.Identifiers[ident] = v
+}
+
+// lookup finds name in s or the enclosing scopes. A local of an enclosing function
+// becomes a free variable of every function in between.
+func (r *resolver) lookup(name string, s *scope) (Variable, bool) {
+	v, ok := s.names[name]
+	if ok || s.outer == nil {
+		return v, ok
+	}
+
+	v, ok = r.lookup(name, s.outer)
+	if !ok || s.block || v.Kind == Global {
+		return v, ok
+	}
+
+	depth := 1
+	if v.Kind == Free {
+		depth = v.Depth + 1
+	}
+	s.fn.Captures = append(s.fn.Captures, Capture{Name: name, Outer: v})
+	free := Variable{Kind: Free, Index: len(s.fn.Captures) - 1, Depth: depth, Decl: v.Decl}
+	s.names[name] = free
+	return free, true
+}
+
+func (r *resolver) use(ident *ast.Identifier, s *scope) {
+	v, ok := r.lookup(ident.Value, s)
+	if !ok || v.Kind == Global && s.owner().fn == nil && r.undefined[ident.Value] {
+		r.errors = append(r.errors, &Error{
+			Pos: ident.Token.Pos,
+			Msg: "identifier not found: " + ident.Value,
+		})
+		return
+	}
+	r.info.Identifiers[ident] = v
+}
+
+func (r *resolver) statement(stmt ast.Statement, s *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		// A function literal can refer to itself (let-rec), so the name is defined
+		// first. Other values see the previous binding.
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			r.define(stmt.Name, s, Local)
+			r.functionLiteral(fn, stmt.Name, s)
+			break
+		}
+		r.expression(stmt.Value, s)
+		r.define(stmt.Name, s, Local)
+
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue, s)
+
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression, s)
+
+	case *ast.ThrowStatement:
+		r.expression(stmt.Value, s)
+
+	case *ast.StructDeclaration:
+		for _, f := range stmt.Fields {
+			if f.Default == nil {
+				continue
+			}
+			fn := &Function{Name: stmt.Name.Value + "." + f.Name.Value}
+			r.info.Defaults[f] = fn
+			r.expression(f.Default, newScope(s, fn, false))
+		}
+		r.define(stmt.Name, s, Local)
+
+	case *ast.EnumDeclaration:
+		for _, v := range stmt.Variants {
+			r.define(v.Name, s, Local)
+		}
+	}
+}
+
+func (r *resolver) statements(b *ast.BlockStatement, s *scope) {
+	if b == nil {
+		return
+	}
+	for _, stmt := range b.Statements {
+		r.statement(stmt, s)
+	}
+}
+
+func (r *resolver) expression(e ast.Expression, s *scope) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		r.use(e, s)
+
+	case *ast.PrefixExpression:
+		r.expression(e.Right, s)
+
+	case *ast.InfixExpression:
+		r.expression(e.Left, s)
+		r.expression(e.Right, s)
+
+	case *ast.IfExpression:
+		if cond, ok := e.Condition.(*ast.LetCondition); ok {
+			r.expression(cond.Value, s)
+			// the fields are stored last to first (as the compiler pops them)
+			arm := newScope(s, nil, true)
+			for i := len(cond.Pattern.Bindings) - 1; i >= 0; i-- {
+				if b := cond.Pattern.Bindings[i]; b.Value != "_" {
+					r.define(b, arm, Local)
+				}
+			}
+			r.statements(e.IfArm, arm)
+		} else {
+			r.expression(e.Condition, s)
+			r.statements(e.IfArm, s)
+		}
+		r.statements(e.ElseArm, s)
+
+	case *ast.FunctionLiteral:
+		r.functionLiteral(e, nil, s)
+
+	case *ast.CallExpression:
+		r.expression(e.Function, s)
+		for _, a := range e.Arguments {
+			r.expression(a, s)
+		}
+
+	case *ast.StructLiteral:
+		r.use(e.Name, s)
+		for _, f := range e.Fields {
+			r.expression(f.Value, s)
+		}
+
+	case *ast.FieldAccessExpression:
+		r.expression(e.Object, s)
+
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			r.expression(el, s)
+		}
+
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			r.expression(pair.Key, s)
+			r.expression(pair.Value, s)
+		}
+
+	case *ast.IndexExpression:
+		r.expression(e.Left, s)
+		r.expression(e.Index, s)
+
+	case *ast.SliceExpression:
+		r.expression(e.Left, s)
+		if e.Low != nil {
+			r.expression(e.Low, s)
+		}
+		if e.High != nil {
+			r.expression(e.High, s)
+		}
+
+	case *ast.TryExpression:
+		r.statements(e.Body, s)
+		if e.Catch != nil {
+			arm := newScope(s, nil, true)
+			r.define(e.CatchParam, arm, Local)
+			r.statements(e.Catch, arm)
+		}
+		r.statements(e.Finally, s)
+
+	case *ast.BlockStatement:
+		r.statements(e, s)
+	}
+}
+
+// functionLiteral resolves the literal. A non-nil name is the identifier the literal
+// is bound to, which it can call itself by.
+func (r *resolver) functionLiteral(node *ast.FunctionLiteral, name *ast.Identifier, s *scope) {
+	fn := &Function{NumParameters: len(node.Parameters)}
+	r.info.Functions[node] = fn
+	body := newScope(s, fn, false)
+
+	if name != nil {
+		fn.Name = name.Value
+		body.names[name.Value] = Variable{Kind: Self, Decl: name}
+	}
+	for _, p := range node.Parameters {
+		r.define(p, body, Parameter)
+	}
+	r.statements(node.Body, body)
+}
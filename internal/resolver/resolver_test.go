@@ -0,0 +1,174 @@
+package resolver
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/parser"
+)
+
+func TestResolveVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // "name@pos: variable" of every identifier, in source order
+	}{
+		{
+			"let x = 1; let y = x; let x = 2; x",
+			[]string{"x@1:5: global 0", "y@1:16: global 1", "x@1:20: global 0", "x@1:27: global 0", "x@1:34: global 0"},
+		},
+		{
+			"let f = fn(a, b) { let c = a; c + b }",
+			[]string{"f@1:5: global 0", "a@1:12: parameter 0", "b@1:15: parameter 1",
+				"c@1:24: local 2", "a@1:28: parameter 0", "c@1:31: local 2", "b@1:35: parameter 1"},
+		},
+		{
+			"let f = fn(a) { let a = a + 1; a }",
+			[]string{"f@1:5: global 0", "a@1:12: parameter 0", "a@1:21: local 0", "a@1:25: parameter 0", "a@1:32: local 0"},
+		},
+		{
+			"let g = 1; let f = fn(n) { f(n - g) }",
+			[]string{"g@1:5: global 0", "f@1:16: global 1", "n@1:23: parameter 0",
+				"f@1:28: self", "n@1:30: parameter 0", "g@1:34: global 0"},
+		},
+		{
+			"fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			[]string{"a@1:4: parameter 0", "b@1:12: parameter 0", "c@1:20: parameter 0",
+				"a@1:25: free 0 (depth 2)", "b@1:29: free 1 (depth 1)", "c@1:33: parameter 0"},
+		},
+		{
+			"enum E { A(v), B }; fn(e) { if (let A(x) = e) { x } else { B } }",
+			[]string{"A@1:10: global 0", "B@1:16: global 1", "e@1:24: parameter 0",
+				"x@1:39: local 1", "e@1:44: parameter 0", "x@1:49: local 1", "B@1:60: global 1"},
+		},
+		{
+			"fn() { try { 1 } catch (e) { e } }",
+			[]string{"e@1:25: local 0", "e@1:30: local 0"},
+		},
+		{
+			"struct P { x = y }", // y is not defined
+			[]string{"P@1:8: global 0"},
+		},
+		{
+			"let d = 5; struct P { x = d }; P{}.x",
+			[]string{"d@1:5: global 0", "P@1:19: global 1", "d@1:27: global 0", "P@1:32: global 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info, _ := Resolve(program)
+
+		got := describe(info)
+		if strings.Join(got, "; ") != strings.Join(tt.expected, "; ") {
+			t.Errorf("%q: wrong variables.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCaptures(t *testing.T) {
+	input := `let counter = fn(start) {
+  let count = start;
+  let next = fn() { let n = count + step; fn() { n + count + next() } };
+  next
+};
+let step = 1;`
+
+	program := parse(t, input)
+	info, errors := Resolve(program)
+	if len(errors) != 0 {
+		t.Fatalf("wrong errors: %v", errors)
+	}
+
+	var functions []*Function
+	ast.Inspect(program, func(node ast.Node) bool {
+		if fn, ok := node.(*ast.FunctionLiteral); ok {
+			functions = append(functions, info.Functions[fn])
+		}
+		return true
+	})
+
+	tests := []struct {
+		name      string
+		numLocals int
+		captures  string
+	}{
+		{"counter", 3, ""},
+		{"next", 1, "count=local 1"},
+		{"", 0, "n=local 0, count=free 0 (depth 1), next=self"},
+	}
+
+	if len(functions) != len(tests) {
+		t.Fatalf("wrong number of functions. want=%d, got=%d", len(tests), len(functions))
+	}
+	for i, tt := range tests {
+		fn := functions[i]
+		captures := []string{}
+		for _, c := range fn.Captures {
+			captures = append(captures, c.Name+"="+c.Outer.String())
+		}
+		if fn.Name != tt.name || fn.NumLocals != tt.numLocals || strings.Join(captures, ", ") != tt.captures {
+			t.Errorf("function %d: want=%s %d [%s], got=%s %d [%s]", i,
+				tt.name, tt.numLocals, tt.captures, fn.Name, fn.NumLocals, strings.Join(captures, ", "))
+		}
+	}
+	if info.NumGlobals != 2 {
+		t.Errorf("wrong number of globals. want=2, got=%d", info.NumGlobals)
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum E { A(v) }; if (let A(x) = A(1)) { x }; x", "1:46: identifier not found: x"},
+		{"try { 1 } catch (e) { e }; e", "1:28: identifier not found: e"},
+		{"if (true) { let x = 1; }; x", ""},               // a plain arm binds names of the enclosing scope
+		{"let f = fn() { g() }; let g = fn() { 1 };", ""}, // a function can refer to a later global
+		{"let x = y; let y = 1;", "1:9: identifier not found: y"},
+		{"let x = x;", "1:9: identifier not found: x"},
+		{"P{}", "1:1: identifier not found: P"},
+	}
+
+	for _, tt := range tests {
+		_, errors := Resolve(parse(t, tt.input))
+		msgs := []string{}
+		for _, e := range errors {
+			msgs = append(msgs, e.Error())
+		}
+		if strings.Join(msgs, "; ") != tt.expected {
+			t.Errorf("%q: wrong errors. want=%q, got=%q", tt.input, tt.expected, msgs)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// describe lists the resolved identifiers of program in source order
+func describe(info *Info) []string {
+	var idents []*ast.Identifier
+	for ident := range info.Identifiers {
+		idents = append(idents, ident)
+	}
+	sort.Slice(idents, func(i, j int) bool {
+		a, b := idents[i].Token.Pos, idents[j].Token.Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	var lines []string
+	for _, ident := range idents {
+		lines = append(lines, ident.Value+"@"+ident.Token.Pos.String()+": "+info.Identifiers[ident].String())
+	}
+	return lines
+}
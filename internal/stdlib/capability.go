@@ -0,0 +1,59 @@
+package stdlib
+
+import (
+	"path"
+	"strings"
+)
+
+// The capabilities the builtins require
+const (
+	CapStdout = "io.stdout" // print
+	CapClock  = "clock"     // the time module (but format_duration)
+	CapRandom = "random"    // the random module
+
+	// the fs module, for a path in its root
+	CapFSRead  = "fs.read"
+	CapFSWrite = "fs.write"
+)
+
+// Capabilities are the capabilities granted to a program by its host. A capability is
+// a name, like "io.stdout" or "clock", or a name and a path separated by a colon, like
+// "fs.read:/data", which grants the access to the file or directory and everything
+// below it. The path is slash-separated and relative to the root of the fs module: it
+// starts with a slash. Nothing is granted by default.
+type Capabilities []string
+
+// Allows reports whether the capability name is granted (without a path)
+func (c Capabilities) Allows(name string) bool {
+	for _, granted := range c {
+		if granted == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPath reports whether the capability name is granted for p, a slash-separated
+// path in the root of the fs module: without a path, or for a path that is p or one of
+// its parents. A path that does not start with a slash is granted nothing, and grants
+// nothing.
+func (c Capabilities) AllowsPath(name, p string) bool {
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+	p = path.Clean(p)
+
+	for _, granted := range c {
+		if granted == name {
+			return true
+		}
+		if !strings.HasPrefix(granted, name+":/") {
+			continue
+		}
+		dir := path.Clean(granted[len(name)+1:])
+		if p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package stdlib
+
+import "testing"
+
+func TestCapabilities(t *testing.T) {
+	c := Capabilities{"io.stdout", "fs.read:/data", "fs.write:/tmp/out/"}
+
+	tests := []struct {
+		name, path string
+		expected   bool
+	}{
+		{"io.stdout", "", true},
+		{"clock", "", false},
+		{"fs.read", "/data", true},
+		{"fs.read", "/data/x/y.txt", true},
+		{"fs.read", "/database", false},
+		{"fs.read", "/data/../etc/passwd", false},
+		{"fs.read", "/", false},
+		{"fs.write", "/tmp/out/a", true},
+		{"fs.write", "/tmp/out", true},
+		{"fs.write", "/data/x", false},
+	}
+
+	for _, tt := range tests {
+		var allowed bool
+		if tt.path == "" {
+			allowed = c.Allows(tt.name)
+		} else {
+			allowed = c.AllowsPath(tt.name, tt.path)
+		}
+		if allowed != tt.expected {
+			t.Errorf("%s %q: want=%t, got=%t", tt.name, tt.path, tt.expected, allowed)
+		}
+	}
+
+	if !(Capabilities{"fs.read"}).AllowsPath("fs.read", "/anything") {
+		t.Errorf("a capability without a path should grant every path")
+	}
+	if (Capabilities{"fs.read:/data"}).Allows("fs.read") {
+		t.Errorf("a capability with a path should not grant the name alone")
+	}
+	// the paths are in the root of the fs module, not relative to a working directory
+	if (Capabilities{"fs.read:data"}).AllowsPath("fs.read", "/data/x") {
+		t.Errorf("a capability with a path that does not start with a slash should grant nothing")
+	}
+	if (Capabilities{"fs.read:/"}).AllowsPath("fs.read", "data/x") {
+		t.Errorf("a path that does not start with a slash should not be granted")
+	}
+	if !(Capabilities{"fs.read:/"}).AllowsPath("fs.read", "/data/x") {
+		t.Errorf("a capability for the root should grant every path")
+	}
+}
@@ -0,0 +1,355 @@
+package stdlib
+
+import (
+	"sort"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The collection builtins. The higher-order ones take the functions of the program
+// (closures, but also builtins and constructors) as arguments. They return new arrays
+// rather than updating their arguments.
+
+// map(array, f) returns the array of f(e) for the elements e of array
+func collectionMap(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("map", args, object.ARRAY_OBJ, functionType); err != nil {
+		return err
+	}
+	elements := args[0].(*object.Array).Elements
+	result := make([]object.Object, len(elements))
+	for i, e := range elements {
+		v := call(args[1], e)
+		if isError(v) {
+			return v
+		}
+		result[i] = v
+	}
+	return &object.Array{Elements: result}
+}
+
+// mapSize projects the array of map, and of filter (at most as long)
+func mapSize(args ...object.Object) int {
+	if len(args) != 2 || args[0].Type() != object.ARRAY_OBJ {
+		return 0
+	}
+	return object.SizeArray + len(args[0].(*object.Array).Elements)*object.SizeWord
+}
+
+// filter(array, f) returns the elements e of array for which f(e) is truthy
+func collectionFilter(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("filter", args, object.ARRAY_OBJ, functionType); err != nil {
+		return err
+	}
+	result := []object.Object{}
+	for _, e := range args[0].(*object.Array).Elements {
+		v := call(args[1], e)
+		if isError(v) {
+			return v
+		}
+		if isTruthy(v) {
+			result = append(result, e)
+		}
+	}
+	return &object.Array{Elements: result}
+}
+
+// reduce(array, f, initial) folds the elements of array from the left: it returns
+// f(...f(f(initial, e0), e1)..., en)
+func collectionReduce(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("reduce", args, object.ARRAY_OBJ, functionType, anyType); err != nil {
+		return err
+	}
+	acc := args[2]
+	for _, e := range args[0].(*object.Array).Elements {
+		acc = call(args[1], acc, e)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// any(array, f) reports whether f(e) is truthy for some element e of array. It stops
+// at the first such element.
+func collectionAny(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("any", args, object.ARRAY_OBJ, functionType); err != nil {
+		return err
+	}
+	for _, e := range args[0].(*object.Array).Elements {
+		v := call(args[1], e)
+		if isError(v) {
+			return v
+		}
+		if isTruthy(v) {
+			return object.TRUE
+		}
+	}
+	return object.FALSE
+}
+
+// all(array, f) reports whether f(e) is truthy for every element e of array. It stops
+// at the first element for which it is not.
+func collectionAll(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("all", args, object.ARRAY_OBJ, functionType); err != nil {
+		return err
+	}
+	for _, e := range args[0].(*object.Array).Elements {
+		v := call(args[1], e)
+		if isError(v) {
+			return v
+		}
+		if !isTruthy(v) {
+			return object.FALSE
+		}
+	}
+	return object.TRUE
+}
+
+// sort(array) returns the elements of array (all numbers, or all strings) in
+// increasing order, and sort(array, less) the elements in the order where a comes
+// before b if less(a, b) is truthy. The sort is stable.
+func collectionSort(call object.CallFunction, args ...object.Object) object.Object {
+	var argErr *object.Error
+	switch len(args) {
+	case 1:
+		argErr = checkCollectionArgs("sort", args, object.ARRAY_OBJ)
+	case 2:
+		argErr = checkCollectionArgs("sort", args, object.ARRAY_OBJ, functionType)
+	default:
+		argErr = newError("wrong number of arguments to sort: want=1 or 2, got=%d", len(args))
+	}
+	if argErr != nil {
+		return argErr
+	}
+
+	elements := args[0].(*object.Array).Elements
+	result := make([]object.Object, len(elements))
+	copy(result, elements)
+
+	var err object.Object // of the first comparison that failed
+	less := func(a, b object.Object) bool {
+		if err != nil {
+			return false
+		}
+		if len(args) == 1 {
+			var c int
+			c, err = compare(a, b)
+			return c < 0
+		}
+		v := call(args[1], a, b)
+		if isError(v) {
+			err = v
+			return false
+		}
+		return isTruthy(v)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return less(result[i], result[j]) })
+	if err != nil {
+		return err
+	}
+	return &object.Array{Elements: result}
+}
+
+// group_by(array, key) returns the hash mapping each key(e) of the elements e of array
+// to the array of the elements with that key, in the order of array
+func collectionGroupBy(call object.CallFunction, args ...object.Object) object.Object {
+	if err := checkCollectionArgs("group_by", args, object.ARRAY_OBJ, functionType); err != nil {
+		return err
+	}
+	groups := object.NewHash()
+	for _, e := range args[0].(*object.Array).Elements {
+		k := call(args[1], e)
+		if isError(k) {
+			return k
+		}
+		group, ok := groups.Get(k)
+		if !ok {
+			group = &object.Array{}
+		}
+		group.(*object.Array).Elements = append(group.(*object.Array).Elements, e)
+		if !groups.Set(k, group) {
+			return newError("group_by: unusable as hash key: %s", k.Type())
+		}
+	}
+	return groups
+}
+
+// zip(a, b) returns the array of the pairs [a[i], b[i]], as long as the shorter array
+func zip(args ...object.Object) object.Object {
+	if err := checkArgs("zip", args, object.ARRAY_OBJ, object.ARRAY_OBJ); err != nil {
+		return err
+	}
+	a, b := args[0].(*object.Array).Elements, args[1].(*object.Array).Elements
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	result := make([]object.Object, n)
+	for i := range result {
+		result[i] = &object.Array{Elements: []object.Object{a[i], b[i]}}
+	}
+	return &object.Array{Elements: result}
+}
+
+// maxRange is the maximum length of an array returned by range. A run with a byte
+// limit fails before building a range exceeding the bytes it has left.
+const maxRange = 1 << 24
+
+// range(end), range(start, end) and range(start, end, step) return the array of the
+// integers from start (0) up to, not including, end, by step (1)
+func rangeArray(args ...object.Object) object.Object {
+	start, step, length, err := rangeBounds(args)
+	if err != nil {
+		return err
+	}
+	if length > maxRange {
+		return newError("range: too many elements: %d (the maximum is %d)", length, maxRange)
+	}
+
+	result := make([]object.Object, length)
+	for i := range result {
+		result[i] = object.NewInteger(start + int64(i)*step)
+	}
+	return &object.Array{Elements: result}
+}
+
+func rangeSize(args ...object.Object) int {
+	_, _, length, err := rangeBounds(args)
+	if err != nil || length > maxRange {
+		return 0
+	}
+	return object.SizeArray + int(length)*(object.SizeWord+object.SizeInteger)
+}
+
+// rangeBounds returns the start, the step and the number of elements of the range of
+// the arguments
+func rangeBounds(args []object.Object) (start, step int64, length uint64, err *object.Error) {
+	bounds := [3]int64{0, 0, 1}
+	switch len(args) {
+	case 1, 2, 3:
+	default:
+		return 0, 0, 0, newError("wrong number of arguments to range: want=1 to 3, got=%d", len(args))
+	}
+	for i, arg := range args {
+		n, ok := arg.(*object.Integer)
+		if !ok {
+			return 0, 0, 0, newError("argument %d to range must be INTEGER, got %s", i+1, arg.Type())
+		}
+		bounds[i] = n.Value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return 0, 0, 0, newError("range: step must not be 0")
+	}
+	switch {
+	case step > 0 && start < end:
+		length = (uint64(end-start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		length = (uint64(start-end)-1)/uint64(-step) + 1
+	}
+	return start, step, length, nil
+}
+
+// flatten(array) returns the elements of array, with the elements that are arrays
+// replaced by their elements (flattening one level of nesting)
+func flatten(args ...object.Object) object.Object {
+	if err := checkArgs("flatten", args, object.ARRAY_OBJ); err != nil {
+		return err
+	}
+	result := []object.Object{}
+	for _, e := range args[0].(*object.Array).Elements {
+		if nested, ok := e.(*object.Array); ok {
+			result = append(result, nested.Elements...)
+		} else {
+			result = append(result, e)
+		}
+	}
+	return &object.Array{Elements: result}
+}
+
+func flattenSize(args ...object.Object) int {
+	if !hasTypes(args, object.ARRAY_OBJ) {
+		return 0
+	}
+	n := 0
+	for _, e := range args[0].(*object.Array).Elements {
+		if nested, ok := e.(*object.Array); ok {
+			n += len(nested.Elements)
+		} else {
+			n++
+		}
+	}
+	return object.SizeArray + n*object.SizeWord
+}
+
+// The pseudo types of the arguments checked by checkCollectionArgs
+const (
+	functionType object.Type = "FUNCTION"
+	anyType      object.Type = ""
+)
+
+// checkCollectionArgs is checkArgs, where functionType is any function value of the
+// program, and anyType is any value
+func checkCollectionArgs(builtin string, args []object.Object, types ...object.Type) *object.Error {
+	if len(args) != len(types) {
+		return newError("wrong number of arguments to %s: want=%d, got=%d", builtin, len(types), len(args))
+	}
+	for i, t := range types {
+		switch {
+		case t == anyType:
+		case t == functionType:
+			if !isFunction(args[i]) {
+				return newError("argument %d to %s must be a function, got %s", i+1, builtin, args[i].Type())
+			}
+		case args[i].Type() != t:
+			return newError("argument %d to %s must be %s, got %s", i+1, builtin, t, args[i].Type())
+		}
+	}
+	return nil
+}
+
+func isFunction(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Closure, *object.Builtin, *object.Constructor:
+		return true
+	}
+	return false
+}
+
+// compare compares two numbers or two strings
+func compare(a, b object.Object) (int, object.Object) {
+	if object.IsNumber(a) && object.IsNumber(b) {
+		return compareNumbers(a, b), nil
+	}
+	x, xOk := a.(*object.String)
+	y, yOk := b.(*object.String)
+	if !xOk || !yOk {
+		return 0, newError("sort: cannot compare %s and %s (pass a less function)", a.Type(), b.Type())
+	}
+	switch {
+	case x.Value < y.Value:
+		return -1, nil
+	case x.Value > y.Value:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestCollectionFunctions(t *testing.T) {
+	ints := func(values ...int64) *object.Array {
+		elements := make([]object.Object, len(values))
+		for i, v := range values {
+			elements[i] = object.NewInteger(v)
+		}
+		return &object.Array{Elements: elements}
+	}
+	// the functions passed to the builtins are builtins, called directly
+	call := func(fn object.Object, args ...object.Object) object.Object {
+		return fn.(*object.Builtin).Fn(args...)
+	}
+	fn := func(f func(args ...object.Object) object.Object) *object.Builtin {
+		return &object.Builtin{Name: "f", Fn: f}
+	}
+	double := fn(func(args ...object.Object) object.Object {
+		return object.NewInteger(args[0].(*object.Integer).Value * 2)
+	})
+	odd := fn(func(args ...object.Object) object.Object {
+		return nativeBool(args[0].(*object.Integer).Value%2 == 1)
+	})
+	add := fn(func(args ...object.Object) object.Object {
+		return object.NewInteger(args[0].(*object.Integer).Value + args[1].(*object.Integer).Value)
+	})
+	greater := fn(func(args ...object.Object) object.Object {
+		return nativeBool(object.CompareIntegers(args[0], args[1]) > 0)
+	})
+	fail := fn(func(args ...object.Object) object.Object { return newError("failed") })
+
+	tests := []struct {
+		fn       object.HigherOrderFunction
+		args     []object.Object
+		expected string // the inspected result, or the error message
+	}{
+		{collectionMap, []object.Object{ints(1, 2, 3), double}, "[2, 4, 6]"},
+		{collectionMap, []object.Object{ints(1), fail}, "failed"},
+		{collectionMap, []object.Object{ints(1)}, "wrong number of arguments to map: want=2, got=1"},
+		{collectionMap, []object.Object{object.NewInteger(1), double}, "argument 1 to map must be ARRAY, got INTEGER"},
+		{collectionFilter, []object.Object{ints(1, 2, 3), odd}, "[1, 3]"},
+		{collectionFilter, []object.Object{ints(2), odd}, "[]"},
+		{collectionReduce, []object.Object{ints(1, 2, 3), add, object.NewInteger(10)}, "16"},
+		{collectionAny, []object.Object{ints(2, 3), odd}, "true"},
+		{collectionAll, []object.Object{ints(1, 3), odd}, "true"},
+		{collectionAll, []object.Object{ints(1, 2), odd}, "false"},
+		{collectionAny, []object.Object{ints(1), fail}, "failed"},
+		{collectionSort, []object.Object{ints(2, 3, 1)}, "[1, 2, 3]"},
+		{collectionSort, []object.Object{ints(2, 3, 1), greater}, "[3, 2, 1]"},
+		{collectionSort, []object.Object{ints(2, 3, 1), fail}, "failed"},
+		{collectionSort, []object.Object{}, "wrong number of arguments to sort: want=1 or 2, got=0"},
+		{collectionGroupBy, []object.Object{ints(1, 2, 3), odd}, "{true: [1, 3], false: [2]}"},
+	}
+
+	for i, tt := range tests {
+		result := tt.fn(call, tt.args...)
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("test %d: want=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+
+	// sort returns a new array
+	array := ints(2, 1)
+	collectionSort(call, array)
+	if array.Inspect() != "[2, 1]" {
+		t.Errorf("sort should not change its argument. got=%s", array.Inspect())
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		args     []int64
+		expected string
+	}{
+		{[]int64{3}, "[0, 1, 2]"},
+		{[]int64{-2}, "[]"},
+		{[]int64{1, 4}, "[1, 2, 3]"},
+		{[]int64{0, 10, 3}, "[0, 3, 6, 9]"},
+		{[]int64{5, 0, -2}, "[5, 3, 1]"},
+		{[]int64{0, 5, -1}, "[]"},
+		{[]int64{-9223372036854775808, 9223372036854775807, 1}, "range: too many elements: 18446744073709551615 (the maximum is 16777216)"},
+		{[]int64{9223372036854775806, 9223372036854775807, 9223372036854775807}, "[9223372036854775806]"},
+	}
+
+	for _, tt := range tests {
+		args := make([]object.Object, len(tt.args))
+		for i, a := range tt.args {
+			args[i] = object.NewInteger(a)
+		}
+		result := rangeArray(args...)
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+			if size := rangeSize(args...); size != object.SizeOf(result) {
+				t.Errorf("range%v: wrong projected size. want=%d, got=%d", tt.args, object.SizeOf(result), size)
+			}
+		}
+		if actual != tt.expected {
+			t.Errorf("range%v: want=%q, got=%q", tt.args, tt.expected, actual)
+		}
+	}
+}
+
+func TestCollectionSizes(t *testing.T) {
+	one, two := object.NewInteger(1), object.NewInteger(2)
+	pair := &object.Array{Elements: []object.Object{one, two}}
+	nested := &object.Array{Elements: []object.Object{pair, one, pair}}
+
+	if want, got := object.SizeArray+5*object.SizeWord, flattenSize(nested); got != want {
+		t.Errorf("wrong projected size of flatten. want=%d, got=%d", want, got)
+	}
+	if want, got := object.SizeArray+3*object.SizeWord, mapSize(nested, object.NULL); got != want {
+		t.Errorf("wrong projected size of map. want=%d, got=%d", want, got)
+	}
+	if got := mapSize(one, object.NULL); got != 0 {
+		t.Errorf("wrong projected size of invalid arguments. want=0, got=%d", got)
+	}
+}
@@ -0,0 +1,303 @@
+package stdlib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The fs module reads and writes the files below a root directory given by the host.
+// Its paths are slash-separated and relative to the root (a leading slash is the
+// root); a path containing .. is rejected, even if it stays in the root. Reading
+// requires the capability fs.read and writing fs.write, which can be limited to a
+// directory of the root, e.g. fs.write:/reports.
+
+// FS is the file system of the fs module. Its names are slash-separated paths
+// relative to its root, cleaned and without .. elements, where "." is the root.
+//
+// FS has the shape of io/fs.FS, with ReadFile, ReadDir and Stat, and a WriteFile. The
+// io/fs package itself needs Go 1.16, newer than the Go this module supports, so an
+// io/fs file system (like fstest.MapFS) is used through an adapter of a few lines.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	ReadDir(name string) ([]os.FileInfo, error) // sorted by name
+	Stat(name string) (os.FileInfo, error)
+}
+
+// ErrEscape is the error of a path that escapes the root of a file system
+var ErrEscape = errors.New("path escapes the root directory")
+
+// maxWalk is the maximum number of paths returned by walk
+const maxWalk = 1 << 20
+
+func (h *Host) fsModule() *object.Module {
+	return module("fs", map[string]object.BuiltinFunction{
+		"read":   h.fsRead,
+		"write":  h.fsWrite,
+		"list":   h.fsList,
+		"exists": h.fsExists,
+		"stat":   h.fsStat,
+		"walk":   h.fsWalk,
+	})
+}
+
+// fsArgs checks the arguments of a builtin of the fs module, and the capability
+// (fs.read or fs.write) for the path, its first argument. It returns the cleaned path.
+func (h *Host) fsArgs(builtin, capability string, args []object.Object, types ...object.Type) (string, *object.Error) {
+	if err := checkArgs(builtin, args, types...); err != nil {
+		return "", err
+	}
+	p := stringValue(args[0])
+	if strings.ContainsAny(p, "\\\x00") {
+		return "", newError("%s: invalid path %q", builtin, p)
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return "", newError("%s: invalid path %q: .. is not allowed", builtin, p)
+		}
+	}
+	p = path.Clean("/" + p)
+	if !h.Capabilities.AllowsPath(capability, p) {
+		return "", newError("permission denied: %s requires the capability %s for %s", builtin, capability, p)
+	}
+	if h.FS == nil {
+		return "", newError("%s: no file system", builtin)
+	}
+	if p == "/" {
+		return ".", nil
+	}
+	return p[1:], nil
+}
+
+// fsError returns the error of a builtin for the error of the file system, without
+// the path of the root in the host
+func fsError(builtin, name string, err error) *object.Error {
+	var pathErr *os.PathError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = errors.New("no such file or directory")
+	case errors.As(err, &pathErr):
+		err = pathErr.Err
+	}
+	return newError("%s: %s: %s", builtin, name, err)
+}
+
+// read(path) returns the content of the file
+func (h *Host) fsRead(args ...object.Object) object.Object {
+	name, err := h.fsArgs("fs.read", CapFSRead, args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	data, readErr := h.FS.ReadFile(name)
+	if readErr != nil {
+		return fsError("fs.read", name, readErr)
+	}
+	return &object.String{Value: string(data)}
+}
+
+// write(path, content) creates or truncates the file and writes the string content to
+// it. The directory of the file must exist.
+func (h *Host) fsWrite(args ...object.Object) object.Object {
+	name, err := h.fsArgs("fs.write", CapFSWrite, args, object.STRING_OBJ, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	if writeErr := h.FS.WriteFile(name, []byte(stringValue(args[1]))); writeErr != nil {
+		return fsError("fs.write", name, writeErr)
+	}
+	return nil
+}
+
+// list(path) returns the names of the entries of the directory, sorted
+func (h *Host) fsList(args ...object.Object) object.Object {
+	name, err := h.fsArgs("fs.list", CapFSRead, args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	entries, readErr := h.FS.ReadDir(name)
+	if readErr != nil {
+		return fsError("fs.list", name, readErr)
+	}
+	names := make([]object.Object, len(entries))
+	for i, e := range entries {
+		names[i] = &object.String{Value: e.Name()}
+	}
+	return &object.Array{Elements: names}
+}
+
+// exists(path) reports whether the file or directory exists
+func (h *Host) fsExists(args ...object.Object) object.Object {
+	name, err := h.fsArgs("fs.exists", CapFSRead, args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	_, statErr := h.FS.Stat(name)
+	if errors.Is(statErr, os.ErrNotExist) {
+		return object.FALSE
+	}
+	if statErr != nil {
+		return fsError("fs.exists", name, statErr)
+	}
+	return object.TRUE
+}
+
+// stat(path) returns the hash {"name": string, "size": integer (bytes), "dir":
+// boolean, "modified": integer (ms since the Unix epoch)} of the file or directory
+func (h *Host) fsStat(args ...object.Object) object.Object {
+	name, err := h.fsArgs("fs.stat", CapFSRead, args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	info, statErr := h.FS.Stat(name)
+	if statErr != nil {
+		return fsError("fs.stat", name, statErr)
+	}
+	stat := object.NewHash()
+	stat.Set(&object.String{Value: "name"}, &object.String{Value: info.Name()})
+	stat.Set(&object.String{Value: "size"}, object.NewInteger(info.Size()))
+	stat.Set(&object.String{Value: "dir"}, nativeBool(info.IsDir()))
+	stat.Set(&object.String{Value: "modified"}, object.NewInteger(milliseconds(info.ModTime())))
+	return stat
+}
+
+// walk(path) returns the paths of the files and directories below the directory, in
+// lexical order, a directory before its entries. It does not follow symbolic links.
+func (h *Host) fsWalk(args ...object.Object) object.Object {
+	name, err := h.fsArgs("fs.walk", CapFSRead, args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+
+	paths := []object.Object{}
+	var walk func(dir string) *object.Error
+	walk = func(dir string) *object.Error {
+		entries, readErr := h.FS.ReadDir(dir)
+		if readErr != nil {
+			return fsError("fs.walk", dir, readErr)
+		}
+		for _, e := range entries {
+			if len(paths) == maxWalk {
+				return newError("fs.walk: too many entries (the maximum is %d)", maxWalk)
+			}
+			p := path.Join(dir, e.Name())
+			paths = append(paths, &object.String{Value: p})
+			if e.IsDir() {
+				if err := walk(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(name); err != nil {
+		return err
+	}
+	return &object.Array{Elements: paths}
+}
+
+// DirFS returns the file system of the directory root of the host. A path resolving,
+// through symbolic links, outside of the root fails with ErrEscape. The check is made
+// before every operation, so a concurrent change of the tree by the host can defeat it.
+func DirFS(root string) (FS, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: root, Err: errors.New("not a directory")}
+	}
+	return dirFS(real), nil
+}
+
+// dirFS is the real path of the root
+type dirFS string
+
+// resolve returns the real path of name, which must be in the root. The file does not
+// need to exist (to be created), but its directory does.
+func (d dirFS) resolve(op, name string) (string, error) {
+	full := filepath.Join(string(d), filepath.FromSlash(name))
+	real, err := filepath.EvalSymlinks(full)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Lstat(full); err == nil {
+			// a dangling symbolic link, possibly to a file outside of the root
+			return "", &os.PathError{Op: op, Path: name, Err: ErrEscape}
+		}
+		dir, err := filepath.EvalSymlinks(filepath.Dir(full))
+		if err != nil {
+			return "", &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		real = filepath.Join(dir, filepath.Base(full))
+	} else if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+
+	root := string(d)
+	if real != root && !strings.HasPrefix(real, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+		return "", &os.PathError{Op: op, Path: name, Err: ErrEscape}
+	}
+	return real, nil
+}
+
+func (d dirFS) ReadFile(name string) ([]byte, error) {
+	real, err := d.resolve("read", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(real)
+	return data, relativeError(name, err)
+}
+
+func (d dirFS) WriteFile(name string, data []byte) error {
+	real, err := d.resolve("write", name)
+	if err != nil {
+		return err
+	}
+	return relativeError(name, ioutil.WriteFile(real, data, 0644))
+}
+
+func (d dirFS) ReadDir(name string) ([]os.FileInfo, error) {
+	real, err := d.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(real)
+	return entries, relativeError(name, err)
+}
+
+func (d dirFS) Stat(name string) (os.FileInfo, error) {
+	real, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(real)
+	return info, relativeError(name, err)
+}
+
+// relativeError replaces the path of the host in a *os.PathError by name
+func relativeError(name string, err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return &os.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+	return err
+}
+
+func unwrapPathError(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+	return err
+}
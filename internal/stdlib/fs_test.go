@@ -0,0 +1,148 @@
+package stdlib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestFSFunctions(t *testing.T) {
+	fs := NewMemFS(map[string]string{
+		"config.json":        `{"debug": true}`,
+		"reports/2024/q1.md": "# Q1",
+		"reports/summary.md": "",
+	})
+	h := &Host{Capabilities: Capabilities{"fs.read", "fs.write:/reports"}, FS: fs}
+	str := func(s string) object.Object { return &object.String{Value: s} }
+
+	tests := []struct {
+		result   func() object.Object
+		expected string // the inspected result, or the error message
+	}{
+		{func() object.Object { return h.fsRead(str("config.json")) }, `{"debug": true}`},
+		{func() object.Object { return h.fsRead(str("/reports/./2024//q1.md")) }, "# Q1"},
+		{func() object.Object { return h.fsList(str("/")) }, "[config.json, reports]"},
+		{func() object.Object { return h.fsList(str("reports")) }, "[2024, summary.md]"},
+		{func() object.Object { return h.fsExists(str("reports/2024")) }, "true"},
+		{func() object.Object { return h.fsExists(str("reports/2025")) }, "false"},
+		{func() object.Object { return h.fsStat(str("reports/2024/q1.md")) }, "{name: q1.md, size: 4, dir: false, modified: 0}"},
+		{func() object.Object { return h.fsWalk(str("")) }, "[config.json, reports, reports/2024, reports/2024/q1.md, reports/summary.md]"},
+		{func() object.Object { return h.fsWrite(str("reports/2024/q2.md"), str("# Q2")) }, "null"},
+		{func() object.Object { return h.fsWalk(str("reports/2024")) }, "[reports/2024/q1.md, reports/2024/q2.md]"},
+		{func() object.Object { return h.fsRead(str("reports/2024/q2.md")) }, "# Q2"},
+
+		{func() object.Object { return h.fsRead(str("../etc/passwd")) }, `fs.read: invalid path "../etc/passwd": .. is not allowed`},
+		{func() object.Object { return h.fsRead(str("reports/../config.json")) }, `fs.read: invalid path "reports/../config.json": .. is not allowed`},
+		{func() object.Object { return h.fsRead(str(`reports\q1.md`)) }, `fs.read: invalid path "reports\\q1.md"`},
+		{func() object.Object { return h.fsRead(str("missing.txt")) }, "fs.read: missing.txt: no such file or directory"},
+		{func() object.Object { return h.fsRead(str("reports")) }, "fs.read: reports: is a directory"},
+		{func() object.Object { return h.fsList(str("config.json")) }, "fs.list: config.json: not a directory"},
+		{func() object.Object { return h.fsWrite(str("reports/2025/q1.md"), str("")) }, "fs.write: reports/2025/q1.md: no such file or directory"},
+		{func() object.Object { return h.fsWrite(str("config.json"), str("{}")) }, "permission denied: fs.write requires the capability fs.write for /config.json"},
+		{func() object.Object { return h.fsWrite(str("reports/x"), object.NewInteger(1)) }, "argument 2 to fs.write must be STRING, got INTEGER"},
+		{func() object.Object { return (&Host{}).fsExists(str("config.json")) }, "permission denied: fs.exists requires the capability fs.read for /config.json"},
+		{func() object.Object { return (&Host{Capabilities: Capabilities{"fs.read"}}).fsRead(str("a")) }, "fs.read: no file system"},
+	}
+
+	for i, tt := range tests {
+		result := tt.result()
+		var actual string
+		if result == nil {
+			actual = "null"
+		} else if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("tests[%d]: want=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "monkey-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "root")
+	for _, dir := range []string{root, filepath.Join(root, "data"), filepath.Join(tmp, "outside")} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "data", "a.txt"):    "a",
+		filepath.Join(tmp, "outside", "secret"): "secret",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "inside"):   filepath.Join(root, "data"),
+		filepath.Join(root, "escape"):   filepath.Join(tmp, "outside"),
+		filepath.Join(root, "secret"):   filepath.Join(tmp, "outside", "secret"),
+		filepath.Join(root, "dangling"): filepath.Join(tmp, "outside", "new"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, name); err != nil {
+			t.Skipf("no symbolic links: %s", err)
+		}
+	}
+
+	fs, err := DirFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Host{Capabilities: Capabilities{"fs.read", "fs.write"}, FS: fs}
+	str := func(s string) object.Object { return &object.String{Value: s} }
+
+	tests := []struct {
+		result   object.Object
+		expected string
+	}{
+		{h.fsRead(str("data/a.txt")), "a"},
+		{h.fsRead(str("inside/a.txt")), "a"},
+		{h.fsWrite(str("data/b.txt"), str("b")), "null"},
+		{h.fsWalk(str("/")), "[dangling, data, data/a.txt, data/b.txt, escape, inside, secret]"},
+		{h.fsRead(str("secret")), "fs.read: secret: path escapes the root directory"},
+		{h.fsRead(str("escape/secret")), "fs.read: escape/secret: path escapes the root directory"},
+		{h.fsList(str("escape")), "fs.list: escape: path escapes the root directory"},
+		{h.fsWrite(str("escape/new"), str("x")), "fs.write: escape/new: path escapes the root directory"},
+		{h.fsWrite(str("dangling"), str("x")), "fs.write: dangling: path escapes the root directory"},
+		{h.fsWrite(str("secret"), str("x")), "fs.write: secret: path escapes the root directory"},
+		{h.fsExists(str("escape")), "fs.exists: escape: path escapes the root directory"},
+		{h.fsRead(str("data/missing")), "fs.read: data/missing: no such file or directory"},
+		{h.fsWrite(str("missing/b.txt"), str("b")), "fs.write: missing/b.txt: no such file or directory"},
+	}
+	for i, tt := range tests {
+		var actual string
+		if tt.result == nil {
+			actual = "null"
+		} else if err, ok := tt.result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = tt.result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("tests[%d]: want=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmp, "outside", "new")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside of the root: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(tmp, "outside", "secret")); string(data) != "secret" {
+		t.Errorf("a file outside of the root was overwritten: %q", data)
+	}
+	if _, err := DirFS(filepath.Join(root, "data", "a.txt")); err == nil {
+		t.Errorf("DirFS of a file should fail")
+	}
+}
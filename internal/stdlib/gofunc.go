@@ -0,0 +1,92 @@
+package stdlib
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// GoFunction returns a builtin calling the Go function fn, whose parameters and
+// results are converted as described by object.FromGo and object.ToGo. fn may be
+// variadic, and returns nothing, a value, an error, or a value and an error. A non-nil
+// error, or a panic, is a runtime error of the program.
+func GoFunction(name string, fn interface{}) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("cannot register %s: not a function: %T", name, fn)
+	}
+
+	t := v.Type()
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	switch {
+	case t.NumOut() > 2, t.NumOut() == 2 && !returnsError:
+		return nil, fmt.Errorf("cannot register %s: %s must return at most a value and an error", name, t)
+	}
+
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		in, err := goArguments(name, t, args)
+		if err != nil {
+			return err
+		}
+
+		out, panicked := callGo(v, in)
+		if panicked != nil {
+			return newError("%s: panic: %v", name, panicked)
+		}
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return newError("%s", err)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return nil
+		}
+
+		result, convErr := object.FromGo(out[0].Interface())
+		if convErr != nil {
+			return newError("result of %s: %s", name, convErr)
+		}
+		return result
+	}}, nil
+}
+
+// goArguments converts the arguments of a call to the parameters of the function type t
+func goArguments(name string, t reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, newError("wrong number of arguments to %s: want at least %d, got=%d", name, numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, newError("wrong number of arguments to %s: want=%d, got=%d", name, numIn, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var pt reflect.Type
+		if t.IsVariadic() && i >= numIn-1 {
+			pt = t.In(numIn - 1).Elem()
+		} else {
+			pt = t.In(i)
+		}
+
+		v, err := object.ToGo(arg, pt)
+		if err != nil {
+			return nil, newError("argument %d to %s: %s", i+1, name, err)
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+// callGo calls fn, and recovers from a panic
+func callGo(fn reflect.Value, in []reflect.Value) (out []reflect.Value, panicked interface{}) {
+	defer func() {
+		panicked = recover()
+	}()
+	return fn.Call(in), nil
+}
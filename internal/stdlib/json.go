@@ -0,0 +1,529 @@
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The json module converts between JSON text and Monkey values:
+//
+//	JSON       Monkey
+//	null       null
+//	true       true
+//	1          integer (a big integer if it does not fit in an int64)
+//	1.5, 1e3   float (a number with a fraction or an exponent)
+//	"s"        string
+//	[...]      array
+//	{...}      hash with string keys, in the order of the text
+//
+// json.stringify also accepts hashes with integer keys (written as strings), and
+// structs (objects with the fields in the order of their declaration). A text written
+// by json.stringify is read back by json.parse as the same value.
+var jsonFunctions = map[string]object.BuiltinFunction{
+	"parse":     jsonParse,
+	"stringify": jsonStringify,
+}
+
+// maxJSONDepth is the maximum nesting of arrays and objects
+const maxJSONDepth = 1000
+
+// parse(s) returns the value of the JSON text s. An error is positioned at the line and
+// column (in bytes) of s where the text is invalid.
+func jsonParse(args ...object.Object) object.Object {
+	if err := checkArgs("json.parse", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+	d := &jsonDecoder{s: stringValue(args[0])}
+	v, err := d.value(0)
+	if err == nil {
+		d.skipSpace()
+		if d.pos < len(d.s) {
+			err = d.unexpected("after the top-level value")
+		}
+	}
+	if err != nil {
+		return newError("json.parse: %s", err)
+	}
+	return v
+}
+
+// jsonDecoder reads a value from the JSON text s, starting at pos
+type jsonDecoder struct {
+	s   string
+	pos int
+}
+
+// jsonError is a decoding error at an offset of the text
+type jsonError struct {
+	line, column int
+	msg          string
+}
+
+func (e *jsonError) Error() string { return fmt.Sprintf("%d:%d: %s", e.line, e.column, e.msg) }
+
+func (d *jsonDecoder) errorf(offset int, format string, a ...interface{}) *jsonError {
+	line := 1 + strings.Count(d.s[:offset], "\n")
+	column := offset - strings.LastIndex(d.s[:offset], "\n")
+	return &jsonError{line: line, column: column, msg: fmt.Sprintf(format, a...)}
+}
+
+// unexpected is the error for the character at pos (or the end of the text)
+func (d *jsonDecoder) unexpected(context string) *jsonError {
+	if d.pos == len(d.s) {
+		return d.errorf(d.pos, "unexpected end of input %s", context)
+	}
+	r, _ := utf8.DecodeRuneInString(d.s[d.pos:])
+	return d.errorf(d.pos, "unexpected character %q %s", r, context)
+}
+
+func (d *jsonDecoder) skipSpace() {
+	for d.pos < len(d.s) {
+		switch d.s[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *jsonDecoder) value(depth int) (object.Object, *jsonError) {
+	d.skipSpace()
+	if d.pos == len(d.s) {
+		return nil, d.unexpected("looking for a value")
+	}
+	switch c := d.s[d.pos]; {
+	case c == '{':
+		return d.object(depth)
+	case c == '[':
+		return d.array(depth)
+	case c == '"':
+		s, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: s}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		return d.number()
+	case strings.HasPrefix(d.s[d.pos:], "true"):
+		d.pos += len("true")
+		return object.TRUE, nil
+	case strings.HasPrefix(d.s[d.pos:], "false"):
+		d.pos += len("false")
+		return object.FALSE, nil
+	case strings.HasPrefix(d.s[d.pos:], "null"):
+		d.pos += len("null")
+		return object.NULL, nil
+	}
+	return nil, d.unexpected("looking for a value")
+}
+
+func (d *jsonDecoder) object(depth int) (object.Object, *jsonError) {
+	if depth == maxJSONDepth {
+		return nil, d.errorf(d.pos, "exceeded the maximum nesting depth (%d)", maxJSONDepth)
+	}
+	d.pos++ // eat '{'
+	hash := object.NewHash()
+
+	d.skipSpace()
+	if d.pos < len(d.s) && d.s[d.pos] == '}' {
+		d.pos++
+		return hash, nil
+	}
+	for {
+		d.skipSpace()
+		if d.pos == len(d.s) || d.s[d.pos] != '"' {
+			return nil, d.unexpected("looking for an object key")
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		d.skipSpace()
+		if d.pos == len(d.s) || d.s[d.pos] != ':' {
+			return nil, d.unexpected("after an object key")
+		}
+		d.pos++ // eat ':'
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(&object.String{Value: key}, value)
+
+		d.skipSpace()
+		if d.pos < len(d.s) && d.s[d.pos] == ',' {
+			d.pos++
+			continue
+		}
+		if d.pos < len(d.s) && d.s[d.pos] == '}' {
+			d.pos++
+			return hash, nil
+		}
+		return nil, d.unexpected("after an object value")
+	}
+}
+
+func (d *jsonDecoder) array(depth int) (object.Object, *jsonError) {
+	if depth == maxJSONDepth {
+		return nil, d.errorf(d.pos, "exceeded the maximum nesting depth (%d)", maxJSONDepth)
+	}
+	d.pos++ // eat '['
+	elements := []object.Object{}
+
+	d.skipSpace()
+	if d.pos < len(d.s) && d.s[d.pos] == ']' {
+		d.pos++
+		return &object.Array{Elements: elements}, nil
+	}
+	for {
+		e, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, e)
+
+		d.skipSpace()
+		if d.pos < len(d.s) && d.s[d.pos] == ',' {
+			d.pos++
+			continue
+		}
+		if d.pos < len(d.s) && d.s[d.pos] == ']' {
+			d.pos++
+			return &object.Array{Elements: elements}, nil
+		}
+		return nil, d.unexpected("after an array element")
+	}
+}
+
+// string reads a string, from its opening quote
+func (d *jsonDecoder) string() (string, *jsonError) {
+	d.pos++ // eat '"'
+	var out strings.Builder
+	for d.pos < len(d.s) {
+		c := d.s[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return out.String(), nil
+		case c < 0x20:
+			return "", d.errorf(d.pos, "invalid control character %q in string", c)
+		case c != '\\':
+			out.WriteByte(c)
+			d.pos++
+			continue
+		}
+
+		start := d.pos
+		if d.pos+1 == len(d.s) {
+			break
+		}
+		d.pos += 2 // eat the backslash and the escaped character
+		switch esc := d.s[d.pos-1]; esc {
+		case '"', '\\', '/':
+			out.WriteByte(esc)
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'u':
+			r, ok := d.hex4()
+			if !ok {
+				return "", d.errorf(start, "invalid escape %q in string", d.s[start:d.pos])
+			}
+			if utf16.IsSurrogate(r) {
+				// a character outside of the Basic Multilingual Plane is a pair of
+				// escaped surrogates
+				high := r
+				r = utf8.RuneError
+				if strings.HasPrefix(d.s[d.pos:], `\u`) {
+					saved := d.pos
+					d.pos += 2
+					if low, ok := d.hex4(); ok {
+						r = utf16.DecodeRune(high, low)
+					}
+					if r == utf8.RuneError {
+						d.pos = saved
+					}
+				}
+			}
+			out.WriteRune(r)
+		default:
+			return "", d.errorf(start, "invalid escape %q in string", d.s[start:d.pos])
+		}
+	}
+	return "", d.errorf(d.pos, "unexpected end of input in string")
+}
+
+// hex4 reads the 4 hexadecimal digits of a \u escape
+func (d *jsonDecoder) hex4() (rune, bool) {
+	if d.pos+4 > len(d.s) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(d.s[d.pos:d.pos+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	d.pos += 4
+	return rune(n), true
+}
+
+// number reads an integer, or a float if the number has a fraction or an exponent
+func (d *jsonDecoder) number() (object.Object, *jsonError) {
+	start := d.pos
+	digits := func() int {
+		n := 0
+		for d.pos < len(d.s) && d.s[d.pos] >= '0' && d.s[d.pos] <= '9' {
+			d.pos++
+			n++
+		}
+		return n
+	}
+
+	if d.s[d.pos] == '-' {
+		d.pos++
+	}
+	intStart := d.pos
+	if digits() == 0 {
+		return nil, d.unexpected("in a number")
+	}
+	if d.s[intStart] == '0' && d.pos-intStart > 1 {
+		return nil, d.errorf(intStart, "invalid number %q: leading zero", d.s[start:d.pos])
+	}
+	isFloat := false
+	if d.pos < len(d.s) && d.s[d.pos] == '.' {
+		isFloat = true
+		d.pos++
+		if digits() == 0 {
+			return nil, d.unexpected("in the fraction of a number")
+		}
+	}
+	if d.pos < len(d.s) && (d.s[d.pos] == 'e' || d.s[d.pos] == 'E') {
+		isFloat = true
+		d.pos++
+		if d.pos < len(d.s) && (d.s[d.pos] == '+' || d.s[d.pos] == '-') {
+			d.pos++
+		}
+		if digits() == 0 {
+			return nil, d.unexpected("in the exponent of a number")
+		}
+	}
+
+	text := d.s[start:d.pos]
+	if isFloat {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, d.errorf(start, "number %s out of range", text)
+		}
+		return &object.Float{Value: f}, nil
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return object.NewInteger(i), nil
+	}
+	n, _ := new(big.Int).SetString(text, 10)
+	return object.NewBigInteger(n), nil
+}
+
+// stringify(value) returns the JSON text of value, stringify(value, indent) the text
+// with the elements of arrays and objects on their own lines, indented by indent (a
+// number of spaces, or a string), and stringify(value, indent, options) the text
+// written with the options of the hash options:
+//
+//	"sort_keys": true    the keys of the objects in sorted order, not in the order of
+//	                     the hashes
+func jsonStringify(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments to json.stringify: want=1 to 3, got=%d", len(args))
+	}
+	e := &jsonEncoder{}
+	if len(args) > 1 {
+		switch indent := args[1].(type) {
+		case *object.Integer:
+			if indent.Value < 0 || indent.Value > 16 {
+				return newError("json.stringify: invalid indent %d", indent.Value)
+			}
+			e.indent = strings.Repeat(" ", int(indent.Value))
+		case *object.String:
+			e.indent = indent.Value
+		default:
+			return newError("argument 2 to json.stringify must be INTEGER or STRING, got %s", args[1].Type())
+		}
+	}
+	if len(args) > 2 {
+		options, ok := args[2].(*object.Hash)
+		if !ok {
+			return newError("argument 3 to json.stringify must be HASH, got %s", args[2].Type())
+		}
+		var err *object.Error
+		options.Each(func(k, v object.Object) {
+			switch {
+			case err != nil:
+			case k.Inspect() == "sort_keys" && k.Type() == object.STRING_OBJ:
+				e.sortKeys = isTruthy(v)
+			default:
+				err = newError("json.stringify: unknown option %s", k.Inspect())
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := e.value(args[0], 0); err != nil {
+		return newError("json.stringify: %s", err)
+	}
+	return &object.String{Value: e.out.String()}
+}
+
+type jsonEncoder struct {
+	out      strings.Builder
+	indent   string // "" for the compact text
+	sortKeys bool
+}
+
+// a member of a JSON object
+type jsonMember struct {
+	key   string
+	value object.Object
+}
+
+func (e *jsonEncoder) value(v object.Object, depth int) error {
+	if depth > maxJSONDepth {
+		return fmt.Errorf("exceeded the maximum nesting depth (%d)", maxJSONDepth)
+	}
+	switch v := v.(type) {
+	case *object.Null:
+		e.out.WriteString("null")
+	case *object.Boolean:
+		e.out.WriteString(strconv.FormatBool(v.Value))
+	case *object.Integer, *object.BigInteger:
+		e.out.WriteString(v.Inspect())
+	case *object.Float:
+		if math.IsInf(v.Value, 0) || math.IsNaN(v.Value) {
+			return fmt.Errorf("unsupported value: %s", v.Inspect())
+		}
+		e.out.WriteString(object.FormatFloat(v.Value))
+	case *object.String:
+		e.string(v.Value)
+
+	case *object.Array:
+		e.out.WriteByte('[')
+		for i, element := range v.Elements {
+			if i > 0 {
+				e.out.WriteByte(',')
+			}
+			e.newline(depth + 1)
+			if err := e.value(element, depth+1); err != nil {
+				return fmt.Errorf("element %d: %s", i, err)
+			}
+		}
+		if len(v.Elements) > 0 {
+			e.newline(depth)
+		}
+		e.out.WriteByte(']')
+
+	case *object.Hash:
+		members := make([]jsonMember, 0, v.Len())
+		var err error
+		v.Each(func(k, value object.Object) {
+			switch k := k.(type) {
+			case *object.String:
+				members = append(members, jsonMember{k.Value, value})
+			case *object.Integer, *object.BigInteger:
+				members = append(members, jsonMember{k.Inspect(), value})
+			default:
+				if err == nil {
+					err = fmt.Errorf("unsupported hash key: %s", k.Type())
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return e.object(members, depth)
+
+	case *object.Struct:
+		members := make([]jsonMember, len(v.Def.Fields))
+		for i, name := range v.Def.Fields {
+			members[i] = jsonMember{name, v.Fields[name]}
+		}
+		return e.object(members, depth)
+
+	default:
+		return fmt.Errorf("unsupported value: %s", v.Type())
+	}
+	return nil
+}
+
+func (e *jsonEncoder) object(members []jsonMember, depth int) error {
+	if e.sortKeys {
+		sort.SliceStable(members, func(i, j int) bool { return members[i].key < members[j].key })
+	}
+	e.out.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			e.out.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		e.string(m.key)
+		e.out.WriteByte(':')
+		if e.indent != "" {
+			e.out.WriteByte(' ')
+		}
+		if err := e.value(m.value, depth+1); err != nil {
+			return fmt.Errorf("key %q: %s", m.key, err)
+		}
+	}
+	if len(members) > 0 {
+		e.newline(depth)
+	}
+	e.out.WriteByte('}')
+	return nil
+}
+
+// newline starts a line indented at depth (in the indented text)
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.out.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		e.out.WriteString(e.indent)
+	}
+}
+
+// string writes s quoted, with the quotes, backslashes and control characters escaped
+func (e *jsonEncoder) string(s string) {
+	e.out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			e.out.WriteByte('\\')
+			e.out.WriteRune(r)
+		case r == '\n':
+			e.out.WriteString(`\n`)
+		case r == '\r':
+			e.out.WriteString(`\r`)
+		case r == '\t':
+			e.out.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(&e.out, `\u%04x`, r)
+		default:
+			e.out.WriteRune(r) // an invalid byte is written as U+FFFD
+		}
+	}
+	e.out.WriteByte('"')
+}
@@ -0,0 +1,150 @@
+package stdlib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the inspected value, or the error message
+	}{
+		{`null`, "null"},
+		{` true `, "true"},
+		{`false`, "false"},
+		{`0`, "0"},
+		{`-42`, "-42"},
+		{`123456789012345678901234567890`, "123456789012345678901234567890"},
+		{`1.5`, "1.5"},
+		{`-0.25e2`, "-25.0"},
+		{`1E400`, "json.parse: 1:1: number 1E400 out of range"},
+		{`"a\"b\\c\/d\n\u00e9\ud83d\ude00"`, "a\"b\\c/d\né😀"},
+		{`"\ud83d"`, "\uFFFD"},
+		{`[]`, "[]"},
+		{`[1, [2, "x"], {}]`, "[1, [2, x], {}]"},
+		{`{"b": 1, "a": {"c": [true, null]}, "b": 2}`, "{b: 2, a: {c: [true, null]}}"},
+		// errors
+		{``, "json.parse: 1:1: unexpected end of input looking for a value"},
+		{`[1, 2`, "json.parse: 1:6: unexpected end of input after an array element"},
+		{`[1, 2,]`, "json.parse: 1:7: unexpected character ']' looking for a value"},
+		{"{\n  \"a\": 1,\n  b: 2\n}", "json.parse: 3:3: unexpected character 'b' looking for an object key"},
+		{`{"a" 1}`, "json.parse: 1:6: unexpected character '1' after an object key"},
+		{`{"a": 1 "b": 2}`, "json.parse: 1:9: unexpected character '\"' after an object value"},
+		{`01`, "json.parse: 1:1: invalid number \"01\": leading zero"},
+		{`1.`, "json.parse: 1:3: unexpected end of input in the fraction of a number"},
+		{`-`, "json.parse: 1:2: unexpected end of input in a number"},
+		{`1e+x`, "json.parse: 1:4: unexpected character 'x' in the exponent of a number"},
+		{`"abc`, "json.parse: 1:5: unexpected end of input in string"},
+		{"\"a\tb\"", "json.parse: 1:3: invalid control character '\\t' in string"},
+		{`"\x"`, "json.parse: 1:2: invalid escape \"\\\\x\" in string"},
+		{`"\u12"`, "json.parse: 1:2: invalid escape \"\\\\u\" in string"},
+		{`nul`, "json.parse: 1:1: unexpected character 'n' looking for a value"},
+		{`1 2`, "json.parse: 1:3: unexpected character '2' after the top-level value"},
+	}
+
+	for _, tt := range tests {
+		result := jsonParse(&object.String{Value: tt.input})
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("json.parse(%q): want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	deep := ""
+	for i := 0; i <= maxJSONDepth; i++ {
+		deep += "["
+	}
+	if err, ok := jsonParse(&object.String{Value: deep}).(*object.Error); !ok ||
+		err.Message != "json.parse: 1:1001: exceeded the maximum nesting depth (1000)" {
+		t.Errorf("wrong error for a deep nesting. got=%s", err.Inspect())
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	parse := func(s string) object.Object { return jsonParse(&object.String{Value: s}) }
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	sortKeys := object.NewHash()
+	sortKeys.Set(str("sort_keys"), object.TRUE)
+	unknown := object.NewHash()
+	unknown.Set(str("order"), str("sorted"))
+	intKeys := object.NewHash()
+	intKeys.Set(object.NewInteger(2), str("b"))
+	intKeys.Set(object.NewInteger(1), str("a"))
+	boolKeys := object.NewHash()
+	boolKeys.Set(object.TRUE, str("a"))
+	point := &object.Struct{
+		Def:    &object.StructDef{Name: "Point", Fields: []string{"y", "x"}},
+		Fields: map[string]object.Object{"x": object.NewInteger(1), "y": object.NewInteger(2)},
+	}
+
+	tests := []struct {
+		args     []object.Object
+		expected string // the text, or the error message
+	}{
+		{[]object.Object{object.NULL}, `null`},
+		{[]object.Object{parse(`{"b": [1, 2.5, "x\ny\u0001\"é"], "a": {}, "c": []}`)},
+			`{"b":[1,2.5,"x\ny\u0001\"é"],"a":{},"c":[]}`},
+		{[]object.Object{parse(`{"b": [1, {"c": null}], "a": true}`), object.NewInteger(2)},
+			"{\n  \"b\": [\n    1,\n    {\n      \"c\": null\n    }\n  ],\n  \"a\": true\n}"},
+		{[]object.Object{parse(`[1]`), str("\t")}, "[\n\t1\n]"},
+		{[]object.Object{parse(`{"b": 1, "a": {"d": 1, "c": 2}}`), object.NewInteger(0), sortKeys},
+			`{"a":{"c":2,"d":1},"b":1}`},
+		{[]object.Object{parse(`1.0`)}, `1.0`},
+		{[]object.Object{parse(`1e21`)}, `1e+21`},
+		{[]object.Object{intKeys}, `{"2":"b","1":"a"}`},
+		{[]object.Object{point}, `{"y":2,"x":1}`},
+		// errors
+		{[]object.Object{}, "wrong number of arguments to json.stringify: want=1 to 3, got=0"},
+		{[]object.Object{object.NULL, object.NewInteger(-1)}, "json.stringify: invalid indent -1"},
+		{[]object.Object{object.NULL, object.TRUE}, "argument 2 to json.stringify must be INTEGER or STRING, got BOOLEAN"},
+		{[]object.Object{object.NULL, object.NewInteger(0), unknown}, "json.stringify: unknown option order"},
+		{[]object.Object{&object.Float{Value: 1}, object.NewInteger(0), object.NULL},
+			"argument 3 to json.stringify must be HASH, got NULL"},
+		{[]object.Object{boolKeys}, "json.stringify: unsupported hash key: BOOLEAN"},
+		{[]object.Object{&object.Array{Elements: []object.Object{object.NULL, &object.Builtin{Name: "f"}}}},
+			"json.stringify: element 1: unsupported value: BUILTIN"},
+		{[]object.Object{&object.Float{Value: math.Inf(1)}}, "json.stringify: unsupported value: inf"},
+	}
+
+	for _, tt := range tests {
+		result := jsonStringify(tt.args...)
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("json.stringify%v: want=%q, got=%q", tt.args, tt.expected, actual)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		`{"id":123456789012345678901,"ratio":0.1,"big":1e+300,"small":-5e-324,"whole":3.0,"tags":["a","b"],"nested":{"ok":true,"none":null}}`,
+		`["\u0000","\u001f","\\","\"","😀","\u2028"]`,
+		`[]`,
+		`{}`,
+	}
+
+	for _, input := range inputs {
+		value := jsonParse(&object.String{Value: input})
+		text := jsonStringify(value)
+		again := jsonParse(text)
+		if again.Inspect() != value.Inspect() {
+			t.Errorf("round trip of %s: want=%s, got=%s", input, value.Inspect(), again.Inspect())
+		}
+		if text := jsonStringify(again).Inspect(); text != jsonStringify(value).Inspect() {
+			t.Errorf("round trip of %s: the texts differ. got=%s", input, text)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package stdlib
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The math module. Its functions take integers and floats: the ones that compute
+// exactly on integers (abs, min, max, and pow with a non-negative integer exponent)
+// return an integer for integer arguments, the others a float. floor and ceil return
+// the integer nearest to their argument.
+var mathFunctions = map[string]object.BuiltinFunction{
+	"sqrt":  mathFloatFunction("math.sqrt", math.Sqrt),
+	"sin":   mathFloatFunction("math.sin", math.Sin),
+	"cos":   mathFloatFunction("math.cos", math.Cos),
+	"pow":   mathPow,
+	"floor": mathRound("math.floor", math.Floor),
+	"ceil":  mathRound("math.ceil", math.Ceil),
+	"abs":   mathAbs,
+	"min":   mathExtremum("math.min", -1),
+	"max":   mathExtremum("math.max", 1),
+}
+
+// the constants of the math module
+var mathConstants = map[string]object.Object{
+	"pi":  &object.Float{Value: math.Pi},
+	"inf": &object.Float{Value: math.Inf(1)},
+	"nan": &object.Float{Value: math.NaN()},
+}
+
+func mathModule() *object.Module {
+	m := module("math", mathFunctions)
+	for name, value := range mathConstants {
+		m.Members[name] = value
+	}
+	return m
+}
+
+// maxPowBits is the maximum size of an integer returned by pow
+const maxPowBits = 1 << 20
+
+// mathFloatFunction returns the builtin computing f on the value of its argument as a
+// float
+func mathFloatFunction(builtin string, f func(float64) float64) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := checkNumbers(builtin, args, 1); err != nil {
+			return err
+		}
+		return &object.Float{Value: f(object.FloatValue(args[0]))}
+	}
+}
+
+// pow(x, y) returns x to the power y: an integer if both are integers and y is not
+// negative, else a float
+func mathPow(args ...object.Object) object.Object {
+	if err := checkNumbers("math.pow", args, 2); err != nil {
+		return err
+	}
+	x, y := args[0], args[1]
+	if x.Type() != object.INTEGER_OBJ || y.Type() != object.INTEGER_OBJ ||
+		object.CompareIntegers(y, object.NewInteger(0)) < 0 {
+		return &object.Float{Value: math.Pow(object.FloatValue(x), object.FloatValue(y))}
+	}
+
+	base, exp := integerValue(x), integerValue(y)
+	// the result has at least exp * (bits(|base|) - 1) bits (0, 1 and -1 stay small)
+	if base.CmpAbs(big.NewInt(1)) > 0 &&
+		(!exp.IsInt64() || exp.Int64() > maxPowBits/int64(base.BitLen()-1)) {
+		return newError("math.pow: result too large: %s ** %s", x.Inspect(), y.Inspect())
+	}
+	return object.NewBigInteger(new(big.Int).Exp(base, exp, nil))
+}
+
+// mathRound returns the builtin rounding its argument to an integer with round
+func mathRound(builtin string, round func(float64) float64) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := checkNumbers(builtin, args, 1); err != nil {
+			return err
+		}
+		f, ok := args[0].(*object.Float)
+		if !ok {
+			return args[0]
+		}
+		r := round(f.Value)
+		if math.IsInf(r, 0) || math.IsNaN(r) {
+			return newError("%s: cannot convert %s to an integer", builtin, f.Inspect())
+		}
+		if r >= math.MinInt64 && r < math.MaxInt64 {
+			return object.NewInteger(int64(r))
+		}
+		i, _ := big.NewFloat(r).Int(nil)
+		return object.NewBigInteger(i)
+	}
+}
+
+// abs(x) returns the absolute value of x
+func mathAbs(args ...object.Object) object.Object {
+	if err := checkNumbers("math.abs", args, 1); err != nil {
+		return err
+	}
+	switch x := args[0].(type) {
+	case *object.Float:
+		return &object.Float{Value: math.Abs(x.Value)}
+	default:
+		if object.CompareIntegers(x, object.NewInteger(0)) < 0 {
+			return object.NegateInteger(x)
+		}
+		return x
+	}
+}
+
+// mathExtremum returns the builtin returning the least (sign -1) or the greatest
+// (sign 1) of its arguments, or of the elements of its array argument. The result is
+// nan if one of them is.
+func mathExtremum(builtin string, sign int) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) == 1 {
+			if a, ok := args[0].(*object.Array); ok {
+				if len(a.Elements) == 0 {
+					return newError("%s: empty array", builtin)
+				}
+				args = a.Elements
+			}
+		}
+		if len(args) == 0 {
+			return newError("wrong number of arguments to %s: want at least 1, got=0", builtin)
+		}
+		result := args[0]
+		for i, arg := range args {
+			if !object.IsNumber(arg) {
+				return newError("argument %d to %s must be INTEGER or FLOAT, got %s", i+1, builtin, arg.Type())
+			}
+			if f, ok := arg.(*object.Float); ok && math.IsNaN(f.Value) {
+				return arg
+			}
+			if compareNumbers(arg, result) == sign {
+				result = arg
+			}
+		}
+		return result
+	}
+}
+
+// checkNumbers checks that there are n arguments, all of them integers or floats
+func checkNumbers(builtin string, args []object.Object, n int) *object.Error {
+	if len(args) != n {
+		return newError("wrong number of arguments to %s: want=%d, got=%d", builtin, n, len(args))
+	}
+	for i, arg := range args {
+		if !object.IsNumber(arg) {
+			return newError("argument %d to %s must be INTEGER or FLOAT, got %s", i+1, builtin, arg.Type())
+		}
+	}
+	return nil
+}
+
+// compareNumbers compares two integers exactly, and else the values as floats
+func compareNumbers(a, b object.Object) int {
+	if a.Type() == object.INTEGER_OBJ && b.Type() == object.INTEGER_OBJ {
+		return object.CompareIntegers(a, b)
+	}
+	x, y := object.FloatValue(a), object.FloatValue(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// integerValue returns the value of an integer as a big.Int (not to be modified)
+func integerValue(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.BigInteger); ok {
+		return i.Value
+	}
+	return big.NewInt(obj.(*object.Integer).Value)
+}
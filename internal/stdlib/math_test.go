@@ -0,0 +1,56 @@
+package stdlib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestMathFunctions(t *testing.T) {
+	num := func(i int64) object.Object { return object.NewInteger(i) }
+	float := func(f float64) object.Object { return &object.Float{Value: f} }
+
+	tests := []struct {
+		fn       string
+		args     []object.Object
+		expected string // the inspected result, or the error message
+	}{
+		{"sqrt", []object.Object{num(2)}, "1.4142135623730951"},
+		{"sqrt", []object.Object{float(-1)}, "nan"},
+		{"sqrt", []object.Object{}, "wrong number of arguments to math.sqrt: want=1, got=0"},
+		{"pow", []object.Object{num(0), num(0)}, "1"},
+		{"pow", []object.Object{num(-1), num(1 << 62)}, "1"},
+		{"pow", []object.Object{num(-3), num(3)}, "-27"},
+		{"pow", []object.Object{num(3), float(0.5)}, "1.7320508075688772"},
+		{"pow", []object.Object{num(2), num(1<<20 + 1)}, "math.pow: result too large: 2 ** 1048577"},
+		{"pow", []object.Object{num(2), object.TRUE}, "argument 2 to math.pow must be INTEGER or FLOAT, got BOOLEAN"},
+		{"floor", []object.Object{float(2.5)}, "2"},
+		{"floor", []object.Object{float(1e20)}, "100000000000000000000"},
+		{"ceil", []object.Object{float(-0.5)}, "0"},
+		{"ceil", []object.Object{float(math.Inf(-1))}, "math.ceil: cannot convert -inf to an integer"},
+		{"abs", []object.Object{num(math.MinInt64)}, "9223372036854775808"},
+		{"abs", []object.Object{float(math.Inf(-1))}, "inf"},
+		{"min", []object.Object{num(2), float(2), num(1)}, "1"},
+		{"min", []object.Object{num(2), float(2)}, "2"},
+		{"max", []object.Object{float(-1), num(-2)}, "-1.0"},
+		{"max", []object.Object{&object.Array{}}, "math.max: empty array"},
+		{"max", []object.Object{}, "wrong number of arguments to math.max: want at least 1, got=0"},
+		{"min", []object.Object{num(1), &object.String{Value: "0"}}, "argument 2 to math.min must be INTEGER or FLOAT, got STRING"},
+		{"sin", []object.Object{float(math.Pi / 2)}, "1.0"},
+		{"cos", []object.Object{num(0)}, "1.0"},
+	}
+
+	for _, tt := range tests {
+		result := mathFunctions[tt.fn](tt.args...)
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("math.%s%v: want=%q, got=%q", tt.fn, tt.args, tt.expected, actual)
+		}
+	}
+}
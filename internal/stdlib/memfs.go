@@ -0,0 +1,124 @@
+package stdlib
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a file system in memory, for tests. The modification time of its files
+// and directories is the Unix epoch. It is safe for concurrent use.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte // the files, and the directories (nil)
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// NewMemFS returns a file system with the files, by their slash-separated path, and
+// their directories. A path ending with a slash is an empty directory.
+func NewMemFS(files map[string]string) *MemFS {
+	fs := &MemFS{files: map[string][]byte{".": nil}}
+	for name, content := range files {
+		dir := strings.HasSuffix(name, "/")
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			fs.files[parent] = nil
+		}
+		if dir {
+			fs.files[name] = nil
+		} else {
+			fs.files[name] = []byte(content)
+		}
+	}
+	return fs
+}
+
+func (fs *MemFS) ReadFile(name string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[name]
+	switch {
+	case !ok:
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	case data == nil:
+		return nil, &os.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return append([]byte{}, data...), nil
+}
+
+func (fs *MemFS) WriteFile(name string, data []byte) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if current, ok := fs.files[name]; ok && current == nil {
+		return &os.PathError{Op: "write", Path: name, Err: errIsDir}
+	}
+	if dir, ok := fs.files[path.Dir(name)]; !ok {
+		return &os.PathError{Op: "write", Path: name, Err: os.ErrNotExist}
+	} else if dir != nil {
+		return &os.PathError{Op: "write", Path: name, Err: errNotDir}
+	}
+	fs.files[name] = append([]byte{}, data...)
+	return nil
+}
+
+func (fs *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[name]
+	switch {
+	case !ok:
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+	case data != nil:
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	entries := []os.FileInfo{}
+	for p, data := range fs.files {
+		if p != "." && path.Dir(p) == name {
+			entries = append(entries, memFileInfo{name: path.Base(p), size: len(data), dir: data == nil})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memFileInfo{name: path.Base(name), size: len(data), dir: data == nil}, nil
+}
+
+// memFileInfo is the os.FileInfo of a file or directory of a MemFS
+type memFileInfo struct {
+	name string
+	size int
+	dir  bool
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return int64(fi.size) }
+func (fi memFileInfo) ModTime() time.Time { return time.Unix(0, 0) }
+func (fi memFileInfo) IsDir() bool        { return fi.dir }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func (fi memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
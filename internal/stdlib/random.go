@@ -0,0 +1,129 @@
+package stdlib
+
+import (
+	"math/rand"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The random module. Its functions require the capability random.
+
+// Rand is the source of the random module. A *rand.Rand with a fixed seed,
+// rand.New(rand.NewSource(seed)), gives the same values in every run; it is not safe
+// for concurrent runs.
+type Rand interface {
+	// Int63n returns a random integer in [0, n), for n > 0
+	Int63n(n int64) int64
+}
+
+// float53 is the number of random bits of the floats returned by random.float
+const float53 = 1 << 53
+
+func (h *Host) randomModule() *object.Module {
+	return module("random", map[string]object.BuiltinFunction{
+		"int":     h.randomInt,
+		"float":   h.randomFloat,
+		"choice":  h.randomChoice,
+		"shuffle": h.randomShuffle,
+	})
+}
+
+// int63n returns a random integer in [0, n) from the source, or the recorded one
+func (h *Host) int63n(n int64) (int64, *object.Error) {
+	e := Event{Op: "random", Arg: n}
+	if h.Replay != nil {
+		v, err := h.Replay.replay(e)
+		if err == nil && (v < 0 || v >= n) {
+			return 0, newError("replay: recorded random integer %d is not in [0, %d)", v, n)
+		}
+		return v, err
+	}
+
+	if h.Rand != nil {
+		e.Value = h.Rand.Int63n(n)
+	} else {
+		e.Value = rand.Int63n(n)
+	}
+	h.Record.record(e)
+	return e.Value, nil
+}
+
+// int(min, max) returns a random integer in [min, max)
+func (h *Host) randomInt(args ...object.Object) object.Object {
+	if err := h.require("random.int", CapRandom); err != nil {
+		return err
+	}
+	if err := checkArgs("random.int", args, object.INTEGER_OBJ, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	min, minOk := args[0].(*object.Integer)
+	max, maxOk := args[1].(*object.Integer)
+	if !minOk || !maxOk || max.Value <= min.Value || max.Value-min.Value <= 0 {
+		return newError("random.int: invalid range [%s, %s)", args[0].Inspect(), args[1].Inspect())
+	}
+	r, err := h.int63n(max.Value - min.Value)
+	if err != nil {
+		return err
+	}
+	return object.NewInteger(min.Value + r)
+}
+
+// float() returns a random float in [0, 1)
+func (h *Host) randomFloat(args ...object.Object) object.Object {
+	if err := h.require("random.float", CapRandom); err != nil {
+		return err
+	}
+	if err := checkArgs("random.float", args); err != nil {
+		return err
+	}
+
+	r, err := h.int63n(float53)
+	if err != nil {
+		return err
+	}
+	return &object.Float{Value: float64(r) / float53}
+}
+
+// choice(array) returns a random element of the array
+func (h *Host) randomChoice(args ...object.Object) object.Object {
+	if err := h.require("random.choice", CapRandom); err != nil {
+		return err
+	}
+	if err := checkArgs("random.choice", args, object.ARRAY_OBJ); err != nil {
+		return err
+	}
+
+	elements := args[0].(*object.Array).Elements
+	if len(elements) == 0 {
+		return newError("random.choice: empty array")
+	}
+	i, err := h.int63n(int64(len(elements)))
+	if err != nil {
+		return err
+	}
+	return elements[i]
+}
+
+// shuffle(array) returns the elements of the array in a random order
+func (h *Host) randomShuffle(args ...object.Object) object.Object {
+	if err := h.require("random.shuffle", CapRandom); err != nil {
+		return err
+	}
+	if err := checkArgs("random.shuffle", args, object.ARRAY_OBJ); err != nil {
+		return err
+	}
+
+	elements := args[0].(*object.Array).Elements
+	result := make([]object.Object, len(elements))
+	copy(result, elements)
+	// Fisher-Yates
+	for i := len(result) - 1; i > 0; i-- {
+		j, err := h.int63n(int64(i + 1))
+		if err != nil {
+			return err
+		}
+		result[i], result[j] = result[j], result[i]
+	}
+	return &object.Array{Elements: result}
+}
@@ -0,0 +1,124 @@
+package stdlib
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestRandomFunctions(t *testing.T) {
+	ints := func(is ...int64) *object.Array {
+		elements := make([]object.Object, len(is))
+		for i, v := range is {
+			elements[i] = object.NewInteger(v)
+		}
+		return &object.Array{Elements: elements}
+	}
+	numbers := ints(1, 2, 3, 4, 5, 6, 7, 8)
+
+	// the same seed gives the same values
+	run := func(seed int64) string {
+		h := &Host{Capabilities: Capabilities{CapRandom}, Rand: rand.New(rand.NewSource(seed))}
+		values := []object.Object{
+			h.randomInt(object.NewInteger(-5), object.NewInteger(5)),
+			h.randomFloat(),
+			h.randomChoice(numbers),
+			h.randomShuffle(numbers),
+		}
+		return (&object.Array{Elements: values}).Inspect()
+	}
+	if a, b := run(7), run(7); a != b {
+		t.Errorf("different values for the same seed: %s and %s", a, b)
+	}
+	if a, b := run(7), run(8); a == b {
+		t.Errorf("same values for different seeds: %s", a)
+	}
+
+	h := &Host{Capabilities: Capabilities{CapRandom}, Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 100; i++ {
+		if n := h.randomInt(object.NewInteger(-2), object.NewInteger(1)).(*object.Integer).Value; n < -2 || n >= 1 {
+			t.Fatalf("random.int(-2, 1) out of range: %d", n)
+		}
+		if f := h.randomFloat().(*object.Float).Value; f < 0 || f >= 1 {
+			t.Fatalf("random.float() out of range: %g", f)
+		}
+	}
+	shuffled := h.randomShuffle(numbers).(*object.Array)
+	if sorted := collectionSort(nil, shuffled).Inspect(); sorted != numbers.Inspect() {
+		t.Errorf("shuffle lost elements: %s", shuffled.Inspect())
+	}
+	if numbers.Inspect() != "[1, 2, 3, 4, 5, 6, 7, 8]" {
+		t.Errorf("shuffle changed its argument: %s", numbers.Inspect())
+	}
+
+	errors := []struct {
+		result   object.Object
+		expected string
+	}{
+		{h.randomInt(object.NewInteger(3), object.NewInteger(3)), "random.int: invalid range [3, 3)"},
+		{h.randomChoice(ints()), "random.choice: empty array"},
+		{h.randomShuffle(object.NewInteger(1)), "argument 1 to random.shuffle must be ARRAY, got INTEGER"},
+		{h.randomFloat(object.NULL), "wrong number of arguments to random.float: want=0, got=1"},
+		{(&Host{}).randomChoice(numbers), "permission denied: random.choice requires the capability random"},
+	}
+	for _, tt := range errors {
+		if err, ok := tt.result.(*object.Error); !ok || err.Message != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%s", tt.expected, tt.result.Inspect())
+		}
+	}
+}
+
+func TestRandomReplay(t *testing.T) {
+	numbers := &object.Array{Elements: []object.Object{object.NewInteger(1), object.NewInteger(2), object.NewInteger(3)}}
+	run := func(h *Host) string {
+		h.Capabilities = Capabilities{CapRandom}
+		values := []object.Object{
+			h.randomInt(object.NewInteger(0), object.NewInteger(1000000)),
+			h.randomShuffle(numbers),
+			h.randomFloat(),
+		}
+		return (&object.Array{Elements: values}).Inspect()
+	}
+
+	// recorded with an unseeded source
+	recording := &Recording{}
+	want := run(&Host{Record: recording})
+	if len(recording.Events) != 4 { // int, shuffle (2), float
+		t.Fatalf("wrong number of events: %v", recording.Events)
+	}
+	if got := run(&Host{Replay: &Recording{Events: recording.Events}, Rand: rand.New(rand.NewSource(1))}); got != want {
+		t.Errorf("wrong replay. want=%s, got=%s", want, got)
+	}
+
+	replay := &Recording{Events: recording.Events}
+	h := &Host{Capabilities: Capabilities{CapRandom}, Replay: replay}
+	tests := []struct {
+		result   object.Object
+		expected string
+	}{
+		{h.randomInt(object.NewInteger(0), object.NewInteger(10)), "replay: event 0 is random(10), but random(1000000) was recorded"},
+		{h.randomInt(object.NewInteger(0), object.NewInteger(1000000)), ""},
+		{h.randomFloat(), "replay: event 1 is random(9007199254740992), but random(3) was recorded"},
+	}
+	for _, tt := range tests {
+		err, isErr := tt.result.(*object.Error)
+		switch {
+		case tt.expected == "" && isErr:
+			t.Errorf("unexpected error: %s", err.Message)
+		case tt.expected != "" && (!isErr || err.Message != tt.expected):
+			t.Errorf("wrong error. want=%q, got=%s", tt.expected, tt.result.Inspect())
+		}
+	}
+
+	exhausted := &Host{Capabilities: Capabilities{CapRandom}, Replay: &Recording{}}
+	if err, ok := exhausted.randomFloat().(*object.Error); !ok ||
+		err.Message != "replay: no recorded event for random(9007199254740992) (the recording has 0 events)" {
+		t.Errorf("wrong error for an exhausted recording. got=%v", err)
+	}
+	outOfRange := &Host{Capabilities: Capabilities{CapRandom}, Replay: &Recording{Events: []Event{{Op: "random", Arg: 2, Value: 5}}}}
+	if err, ok := outOfRange.randomChoice(&object.Array{Elements: numbers.Elements[:2]}).(*object.Error); !ok ||
+		err.Message != "replay: recorded random integer 5 is not in [0, 2)" {
+		t.Errorf("wrong error for an out of range value. got=%v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package stdlib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// Recording is the log of the nondeterministic values a run got from its clock and
+// its random source, in order. Recorded by one run (Host.Record), it can be fed to
+// another run of the same program (Host.Replay), which then gets the same values
+// without using the sources, so that a failing run is reproduced exactly. The events
+// can be saved, e.g. as JSON, to replay them in another process.
+//
+// A replay consumes the recording: to replay it again, replay a new Recording with the
+// same events. Concurrent runs sharing a recording interleave their events.
+type Recording struct {
+	Events []Event
+
+	mu   sync.Mutex
+	next int // the next event to replay
+}
+
+// Event is a value got from a source
+type Event struct {
+	Op    string `json:"op"`    // the builtin: time.now, time.sleep or random
+	Arg   int64  `json:"arg"`   // the duration slept (in ns), the bound of a random integer
+	Value int64  `json:"value"` // the time (ns since the Unix epoch), the random integer
+}
+
+func (e Event) String() string {
+	switch e.Op {
+	case "time.now":
+		return e.Op
+	case "time.sleep":
+		return fmt.Sprintf("%s(%s)", e.Op, time.Duration(e.Arg))
+	}
+	return fmt.Sprintf("%s(%d)", e.Op, e.Arg)
+}
+
+// record appends an event, if r is not nil
+func (r *Recording) record(e Event) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Events = append(r.Events, e)
+}
+
+// replay returns the value of the next event, which must be for the same operation
+// (e.Op and e.Arg) as the one being replayed
+func (r *Recording) replay(e Event) (int64, *object.Error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next == len(r.Events) {
+		return 0, newError("replay: no recorded event for %s (the recording has %d events)", e, len(r.Events))
+	}
+	recorded := r.Events[r.next]
+	if recorded.Op != e.Op || recorded.Arg != e.Arg {
+		return 0, newError("replay: event %d is %s, but %s was recorded", r.next, e, recorded)
+	}
+	r.next++
+	return recorded.Value, nil
+}
@@ -0,0 +1,125 @@
+package stdlib
+
+import (
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The regex module. Its functions take a regex, a literal like /(\d+)-(\d+)/ or the
+// result of compile, or a string pattern, compiled on every call, as their first
+// argument:
+//
+//	regex.match(/^\d+$/, "42")                                // true
+//	regex.find_all(/(?P<key>\w+)=(\d+)/, "a=1 b=2")[1]["key"] // b
+//	regex.replace(/(\w+)@(\w+)/, "me@host", "${2}: $1")       // host: me
+var regexFunctions = map[string]object.BuiltinFunction{
+	"compile":  regexCompile,
+	"match":    regexMatch,
+	"find_all": regexFindAll,
+	"replace":  regexReplace,
+}
+
+// checkRegexArgs checks the arguments of a builtin of the regex module: a regex or a
+// string pattern, and then the types. It returns the regex.
+func checkRegexArgs(builtin string, args []object.Object, types ...object.Type) (*object.Regex, *object.Error) {
+	if len(args) != len(types)+1 {
+		return nil, newError("wrong number of arguments to %s: want=%d, got=%d", builtin, len(types)+1, len(args))
+	}
+	for i, t := range types {
+		if args[i+1].Type() != t {
+			return nil, newError("argument %d to %s must be %s, got %s", i+2, builtin, t, args[i+1].Type())
+		}
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Regex:
+		return arg, nil
+	case *object.String:
+		re, err := object.NewRegex(arg.Value, "")
+		if err != nil {
+			return nil, newError("%s: invalid regex %q: %s", builtin, arg.Value, err)
+		}
+		return re, nil
+	}
+	return nil, newError("argument 1 to %s must be REGEX or STRING, got %s", builtin, args[0].Type())
+}
+
+// compile(pattern) returns the regex of the pattern, and compile(pattern, flags) with
+// the flags (like "i" for /pattern/i)
+func regexCompile(args ...object.Object) object.Object {
+	var flags string
+	switch len(args) {
+	case 1:
+		if err := checkArgs("regex.compile", args, object.STRING_OBJ); err != nil {
+			return err
+		}
+	case 2:
+		if err := checkArgs("regex.compile", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+			return err
+		}
+		flags = stringValue(args[1])
+	default:
+		return newError("wrong number of arguments to regex.compile: want=1 or 2, got=%d", len(args))
+	}
+
+	re, err := object.NewRegex(stringValue(args[0]), flags)
+	if err != nil {
+		return newError("regex.compile: invalid regex /%s/%s: %s", stringValue(args[0]), flags, err)
+	}
+	return re
+}
+
+// match(re, s) reports whether re matches s, anywhere unless anchored by ^ or $
+func regexMatch(args ...object.Object) object.Object {
+	re, err := checkRegexArgs("regex.match", args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	return nativeBool(re.Value.MatchString(stringValue(args[1])))
+}
+
+// find_all(re, s) returns the matches of re in s, from left to right and not
+// overlapping. A match of a regex without groups is its string. A match of a regex
+// with groups is a hash of the strings of the match, by their number (0 for the whole
+// match, 1 for the first group, ...) and by the names of the named groups (?P<name>...);
+// a group that did not take part in the match is null.
+func regexFindAll(args ...object.Object) object.Object {
+	re, err := checkRegexArgs("regex.find_all", args, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+
+	s := stringValue(args[1])
+	names := re.Value.SubexpNames()
+	matches := re.Value.FindAllStringSubmatchIndex(s, -1)
+	result := make([]object.Object, len(matches))
+	for i, m := range matches {
+		if len(names) == 1 {
+			result[i] = &object.String{Value: s[m[0]:m[1]]}
+			continue
+		}
+		groups := object.NewHash()
+		for g, name := range names {
+			var value object.Object = object.NULL
+			if m[2*g] >= 0 {
+				value = &object.String{Value: s[m[2*g]:m[2*g+1]]}
+			}
+			groups.Set(object.NewInteger(int64(g)), value)
+			if name != "" {
+				groups.Set(&object.String{Value: name}, value)
+			}
+		}
+		result[i] = groups
+	}
+	return &object.Array{Elements: result}
+}
+
+// replace(re, s, replacement) replaces the matches of re in s by the replacement, where
+// $1 or ${1} is the text of the first group, ${name} of the group named name, and $$
+// is a dollar sign. ($1x is the group named 1x: write ${1}x.)
+func regexReplace(args ...object.Object) object.Object {
+	re, err := checkRegexArgs("regex.replace", args, object.STRING_OBJ, object.STRING_OBJ)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: re.Value.ReplaceAllString(stringValue(args[1]), stringValue(args[2]))}
+}
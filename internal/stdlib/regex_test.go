@@ -0,0 +1,57 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestRegexFunctions(t *testing.T) {
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	regex := func(pattern, flags string) object.Object {
+		re, err := object.NewRegex(pattern, flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return re
+	}
+	date := regex(`(?P<year>\d{4})-(?P<month>\d\d)(-\d\d)?`, "")
+
+	tests := []struct {
+		result   object.Object
+		expected string // the inspected result, or the error message
+	}{
+		{regexCompile(str("a+b"), str("iU")), "/a+b/iU"},
+		{regexMatch(regex("^a+$", "i"), str("aAa")), "true"},
+		{regexMatch(str("^a+$"), str("aAa")), "false"},
+		{regexMatch(regex("^b", "m"), str("a\nb")), "true"},
+		{regexFindAll(date, str("2024-01-31, 1999-12")),
+			"[{0: 2024-01-31, 1: 2024, year: 2024, 2: 01, month: 01, 3: -31}, {0: 1999-12, 1: 1999, year: 1999, 2: 12, month: 12, 3: null}]"},
+		{regexFindAll(str("a*"), str("baaa")), "[, aaa]"},
+		{regexFindAll(str("x"), str("abc")), "[]"},
+		{regexReplace(date, str("on 2024-01-31"), str("${month}/${year}")), "on 01/2024"},
+		{regexReplace(str("(a)(b)"), str("ab"), str("$2$1x ${1}x $1x $$1")), "b ax  $1"},
+		{regexReplace(str("é"), str("café"), str("e")), "cafe"},
+
+		{regexCompile(str("a"), str("ii")), "regex.compile: invalid regex /a/ii: duplicate flag 'i'"},
+		{regexCompile(str("[z-a]")), "regex.compile: invalid regex /[z-a]/: invalid character class range"},
+		{regexCompile(str("a"), str("i"), str("m")), "wrong number of arguments to regex.compile: want=1 or 2, got=3"},
+		{regexCompile(object.NewInteger(1)), "argument 1 to regex.compile must be STRING, got INTEGER"},
+		{regexMatch(str("a")), "wrong number of arguments to regex.match: want=2, got=1"},
+		{regexMatch(str("a"), object.NewInteger(1)), "argument 2 to regex.match must be STRING, got INTEGER"},
+		{regexFindAll(str("(?<"), str("")), `regex.find_all: invalid regex "(?<": invalid or unsupported Perl syntax`},
+		{regexReplace(object.NULL, str(""), str("")), "argument 1 to regex.replace must be REGEX or STRING, got NULL"},
+	}
+
+	for i, tt := range tests {
+		var actual string
+		if err, ok := tt.result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = tt.result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("tests[%d]: want=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package stdlib implements the builtins of Monkey programs: the functions and modules
+// bound in the global scope. The builtins reaching outside of the program (printing,
+// the clock, randomness, files) are not ambient: a builtin called without the
+// capability it requires fails with a permission error.
+package stdlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// Host is what the embedding program provides to the builtins
+type Host struct {
+	Capabilities Capabilities
+	Stdout       io.Writer        // nil to discard the output
+	Now          func() time.Time // nil for the Now of the Clock
+	Clock        Clock            // nil for the system clock
+	Rand         Rand             // nil for the global source of math/rand
+	FS           FS               // the root of the fs module, nil for none
+
+	// Context is the context of the run, which interrupts a sleep when it is done
+	// (nil for none)
+	Context context.Context
+
+	// Record, if not nil, records the values got from the clock and the random
+	// source. Replay, if not nil, replays them instead of using the sources.
+	Record *Recording
+	Replay *Recording
+}
+
+// Global is a name bound by the builtins
+type Global struct {
+	Name  string
+	Value object.Object
+}
+
+// Globals returns the builtins of a program run by the host, in a fixed order
+func Globals(h *Host) []Global {
+	return []Global{
+		{"print", &object.Builtin{Name: "print", Fn: h.print}},
+		{"len", &object.Builtin{Name: "len", Fn: length}},
+		{"map", &object.Builtin{Name: "map", HigherOrder: collectionMap, Size: mapSize}},
+		{"filter", &object.Builtin{Name: "filter", HigherOrder: collectionFilter, Size: mapSize}},
+		{"reduce", &object.Builtin{Name: "reduce", HigherOrder: collectionReduce}},
+		{"any", &object.Builtin{Name: "any", HigherOrder: collectionAny}},
+		{"all", &object.Builtin{Name: "all", HigherOrder: collectionAll}},
+		{"sort", &object.Builtin{Name: "sort", HigherOrder: collectionSort}},
+		{"group_by", &object.Builtin{Name: "group_by", HigherOrder: collectionGroupBy}},
+		{"zip", &object.Builtin{Name: "zip", Fn: zip}},
+		{"range", &object.Builtin{Name: "range", Fn: rangeArray, Size: rangeSize}},
+		{"flatten", &object.Builtin{Name: "flatten", Fn: flatten, Size: flattenSize}},
+		{"strings", sized(module("strings", stringsFunctions), stringsSizes)},
+		{"json", module("json", jsonFunctions)},
+		{"math", mathModule()},
+		{"time", h.timeModule()},
+		{"random", h.randomModule()},
+		{"fs", h.fsModule()},
+		{"regex", module("regex", regexFunctions)},
+	}
+}
+
+// Define binds the builtins in env (for the evaluator)
+func Define(env *object.Environment, h *Host) {
+	for _, g := range Globals(h) {
+		env.Set(g.Name, g.Value)
+	}
+}
+
+func module(name string, functions map[string]object.BuiltinFunction) *object.Module {
+	m := &object.Module{Name: name, Members: map[string]object.Object{}}
+	for fn, impl := range functions {
+		m.Members[fn] = &object.Builtin{Name: name + "." + fn, Fn: impl}
+	}
+	return m
+}
+
+// sized sets the projected sizes of the results of the functions of m
+func sized(m *object.Module, sizes map[string]object.SizeFunction) *object.Module {
+	for fn, size := range sizes {
+		m.Members[fn].(*object.Builtin).Size = size
+	}
+	return m
+}
+
+// require returns a permission error if the capability is not granted to the host
+func (h *Host) require(builtin, capability string) *object.Error {
+	if h.Capabilities.Allows(capability) {
+		return nil
+	}
+	return newError("permission denied: %s requires the capability %s", builtin, capability)
+}
+
+// print writes its arguments, separated by spaces, and a newline
+func (h *Host) print(args ...object.Object) object.Object {
+	if err := h.require("print", CapStdout); err != nil {
+		return err
+	}
+	if h.Stdout == nil {
+		return nil
+	}
+
+	values := make([]string, len(args))
+	for i, a := range args {
+		values[i] = a.Inspect()
+	}
+	if _, err := io.WriteString(h.Stdout, strings.Join(values, " ")+"\n"); err != nil {
+		return newError("print: %s", err)
+	}
+	return nil
+}
+
+// checkArgs checks the number and the types of the arguments of a builtin
+func checkArgs(builtin string, args []object.Object, types ...object.Type) *object.Error {
+	if len(args) != len(types) {
+		return newError("wrong number of arguments to %s: want=%d, got=%d", builtin, len(types), len(args))
+	}
+	for i, t := range types {
+		if args[i].Type() != t {
+			return newError("argument %d to %s must be %s, got %s", i+1, builtin, t, args[i].Type())
+		}
+	}
+	return nil
+}
+
+// hasTypes reports whether the arguments have the types (for the projection of the
+// size of a result, which leaves the errors to the builtin)
+func hasTypes(args []object.Object, types ...object.Type) bool {
+	if len(args) != len(types) {
+		return false
+	}
+	for i, t := range types {
+		if args[i].Type() != t {
+			return false
+		}
+	}
+	return true
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
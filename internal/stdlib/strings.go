@@ -0,0 +1,255 @@
+package stdlib
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The strings module. Like the indexes of strings, the indexes of its functions count
+// runes (characters), not bytes. The number of characters of a string is len(s).
+var stringsFunctions = map[string]object.BuiltinFunction{
+	"split":    stringsSplit,
+	"join":     stringsJoin,
+	"trim":     stringsTrim,
+	"replace":  stringsReplace,
+	"contains": stringsContains,
+	"index":    stringsIndex,
+	"upper":    stringsUpper,
+	"lower":    stringsLower,
+	"format":   stringsFormat,
+}
+
+// The projected sizes of the results that can be much bigger than the arguments, so
+// that a run with a byte limit fails before building them
+var stringsSizes = map[string]object.SizeFunction{
+	"split":   splitSize,
+	"join":    joinSize,
+	"replace": replaceSize,
+	"format":  formatSize,
+}
+
+// len returns the number of elements of a sequence (the characters of a string)
+func length(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to len: want=1, got=%d", len(args))
+	}
+	n, ok := object.Len(args[0])
+	if !ok {
+		return newError("argument 1 to len not supported, got %s", args[0].Type())
+	}
+	return object.NewInteger(int64(n))
+}
+
+// split(s, sep) returns the substrings of s between the separators (the characters of
+// s for an empty separator)
+func stringsSplit(args ...object.Object) object.Object {
+	if err := checkArgs("strings.split", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+	parts := strings.Split(stringValue(args[0]), stringValue(args[1]))
+	elements := make([]object.Object, len(parts))
+	for i, p := range parts {
+		elements[i] = &object.String{Value: p}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func splitSize(args ...object.Object) int {
+	if !hasTypes(args, object.STRING_OBJ, object.STRING_OBJ) {
+		return 0
+	}
+	s, sep := stringValue(args[0]), stringValue(args[1])
+	n := utf8.RuneCountInString(s)
+	if sep != "" {
+		n = strings.Count(s, sep) + 1
+	}
+	return object.SizeArray + n*(object.SizeWord+object.SizeString) + len(s)
+}
+
+// join(strings, sep) concatenates the strings of the array, separated by sep
+func stringsJoin(args ...object.Object) object.Object {
+	if err := checkArgs("strings.join", args, object.ARRAY_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+	elements := args[0].(*object.Array).Elements
+	parts := make([]string, len(elements))
+	for i, e := range elements {
+		s, ok := e.(*object.String)
+		if !ok {
+			return newError("argument 1 to strings.join must be an array of STRING, got %s at index %d", e.Type(), i)
+		}
+		parts[i] = s.Value
+	}
+	return &object.String{Value: strings.Join(parts, stringValue(args[1]))}
+}
+
+func joinSize(args ...object.Object) int {
+	if !hasTypes(args, object.ARRAY_OBJ, object.STRING_OBJ) {
+		return 0
+	}
+	elements := args[0].(*object.Array).Elements
+	if len(elements) == 0 {
+		return object.SizeString
+	}
+	n := (len(elements) - 1) * len(stringValue(args[1]))
+	for _, e := range elements {
+		if s, ok := e.(*object.String); ok {
+			n += len(s.Value)
+		}
+	}
+	return object.SizeString + n
+}
+
+// trim(s) removes the leading and trailing white space of s, and trim(s, chars) the
+// leading and trailing characters that are in chars
+func stringsTrim(args ...object.Object) object.Object {
+	switch len(args) {
+	case 1:
+		if err := checkArgs("strings.trim", args, object.STRING_OBJ); err != nil {
+			return err
+		}
+		return &object.String{Value: strings.TrimSpace(stringValue(args[0]))}
+	case 2:
+		if err := checkArgs("strings.trim", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+			return err
+		}
+		return &object.String{Value: strings.Trim(stringValue(args[0]), stringValue(args[1]))}
+	}
+	return newError("wrong number of arguments to strings.trim: want=1 or 2, got=%d", len(args))
+}
+
+// replace(s, old, new) replaces every occurrence of old in s by new
+func stringsReplace(args ...object.Object) object.Object {
+	if err := checkArgs("strings.replace", args, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ReplaceAll(stringValue(args[0]), stringValue(args[1]), stringValue(args[2]))}
+}
+
+func replaceSize(args ...object.Object) int {
+	if !hasTypes(args, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ) {
+		return 0
+	}
+	s, old, new := stringValue(args[0]), stringValue(args[1]), stringValue(args[2])
+	return object.SizeString + len(s) + strings.Count(s, old)*(len(new)-len(old))
+}
+
+// contains(s, sub) reports whether sub is in s
+func stringsContains(args ...object.Object) object.Object {
+	if err := checkArgs("strings.contains", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return nativeBool(strings.Contains(stringValue(args[0]), stringValue(args[1])))
+}
+
+// index(s, sub) returns the index of the first occurrence of sub in s, or -1
+func stringsIndex(args ...object.Object) object.Object {
+	if err := checkArgs("strings.index", args, object.STRING_OBJ, object.STRING_OBJ); err != nil {
+		return err
+	}
+	s := stringValue(args[0])
+	i := strings.Index(s, stringValue(args[1]))
+	if i < 0 {
+		return object.NewInteger(-1)
+	}
+	return object.NewInteger(int64(utf8.RuneCountInString(s[:i])))
+}
+
+func stringsUpper(args ...object.Object) object.Object {
+	if err := checkArgs("strings.upper", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToUpper(stringValue(args[0]))}
+}
+
+func stringsLower(args ...object.Object) object.Object {
+	if err := checkArgs("strings.lower", args, object.STRING_OBJ); err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ToLower(stringValue(args[0]))}
+}
+
+// format(f, args...) replaces the verbs of f by the arguments: %d by an integer, %s by
+// a string, %v by any value (as printed), and %% by a percent sign
+func stringsFormat(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to strings.format: want at least 1, got=0")
+	}
+	f, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument 1 to strings.format must be STRING, got %s", args[0].Type())
+	}
+
+	var out strings.Builder
+	next := 1
+	s := f.Value
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return newError("strings.format: missing verb at the end of the format")
+		}
+		verb := s[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		var want object.Type
+		switch verb {
+		case 'd':
+			want = object.INTEGER_OBJ
+		case 's':
+			want = object.STRING_OBJ
+		case 'v':
+		default:
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			return newError("strings.format: unknown verb %%%c", r)
+		}
+		if next == len(args) {
+			return newError("strings.format: missing argument for %%%c", verb)
+		}
+		arg := args[next]
+		next++
+		if want != "" && arg.Type() != want {
+			return newError("strings.format: %%%c needs %s, got %s (argument %d)", verb, want, arg.Type(), next)
+		}
+		out.WriteString(arg.Inspect())
+	}
+	if next != len(args) {
+		return newError("strings.format: %d arguments, but %d verbs", len(args)-1, next-1)
+	}
+	return &object.String{Value: out.String()}
+}
+
+// formatSize projects the length of the result from the lengths of the format and of
+// the arguments as printed
+func formatSize(args ...object.Object) int {
+	if len(args) == 0 || args[0].Type() != object.STRING_OBJ {
+		return 0
+	}
+	n := len(stringValue(args[0]))
+	for _, arg := range args[1:] {
+		if s, ok := arg.(*object.String); ok {
+			n += len(s.Value)
+		} else {
+			n += len(arg.Inspect())
+		}
+	}
+	return object.SizeString + n
+}
+
+func stringValue(obj object.Object) string {
+	return obj.(*object.String).Value
+}
+
+func nativeBool(b bool) *object.Boolean {
+	if b {
+		return object.TRUE
+	}
+	return object.FALSE
+}
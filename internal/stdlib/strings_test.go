@@ -0,0 +1,104 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+func TestStringsFunctions(t *testing.T) {
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	strs := func(ss ...string) object.Object {
+		elements := make([]object.Object, len(ss))
+		for i, s := range ss {
+			elements[i] = str(s)
+		}
+		return &object.Array{Elements: elements}
+	}
+	num := func(i int64) object.Object { return object.NewInteger(i) }
+
+	tests := []struct {
+		fn       string
+		args     []object.Object
+		expected string // the inspected result, or the error message
+	}{
+		{"split", []object.Object{str("a,b,,c"), str(",")}, "[a, b, , c]"},
+		{"split", []object.Object{str("hé"), str("")}, "[h, é]"},
+		{"join", []object.Object{strs("a", "b", "c"), str("-")}, "a-b-c"},
+		{"join", []object.Object{strs(), str("-")}, ""},
+		{"join", []object.Object{&object.Array{Elements: []object.Object{str("a"), num(1)}}, str("")},
+			"argument 1 to strings.join must be an array of STRING, got INTEGER at index 1"},
+		{"trim", []object.Object{str(" \tab \n")}, "ab"},
+		{"trim", []object.Object{str("--ab-"), str("-")}, "ab"},
+		{"trim", []object.Object{}, "wrong number of arguments to strings.trim: want=1 or 2, got=0"},
+		{"replace", []object.Object{str("a.b.c"), str("."), str("::")}, "a::b::c"},
+		{"contains", []object.Object{str("monkey"), str("key")}, "true"},
+		{"contains", []object.Object{str("monkey"), str("dog")}, "false"},
+		{"contains", []object.Object{str("monkey"), num(1)}, "argument 2 to strings.contains must be STRING, got INTEGER"},
+		{"index", []object.Object{str("héllo"), str("l")}, "2"},
+		{"index", []object.Object{str("hello"), str("z")}, "-1"},
+		{"upper", []object.Object{str("abc")}, "ABC"},
+		{"lower", []object.Object{str("ÀBC")}, "àbc"},
+		{"format", []object.Object{str("%s is %d (%v), 100%%"), str("x"), num(5), strs("a")}, "x is 5 ([a]), 100%"},
+		{"format", []object.Object{}, "wrong number of arguments to strings.format: want at least 1, got=0"},
+		{"format", []object.Object{str("%d"), str("x")}, "strings.format: %d needs INTEGER, got STRING (argument 2)"},
+		{"format", []object.Object{str("%d %d"), num(1)}, "strings.format: missing argument for %d"},
+		{"format", []object.Object{str("%d"), num(1), num(2)}, "strings.format: 2 arguments, but 1 verbs"},
+		{"format", []object.Object{str("%x"), num(1)}, "strings.format: unknown verb %x"},
+		{"format", []object.Object{str("50%")}, "strings.format: missing verb at the end of the format"},
+	}
+
+	for _, tt := range tests {
+		result := stringsFunctions[tt.fn](tt.args...)
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("strings.%s%v: want=%q, got=%q", tt.fn, tt.args, tt.expected, actual)
+		}
+	}
+}
+
+func TestLen(t *testing.T) {
+	if n := length(&object.String{Value: "héllo"}); n.Inspect() != "5" {
+		t.Errorf("wrong length. want=5, got=%s", n.Inspect())
+	}
+	if err, ok := length(object.TRUE).(*object.Error); !ok || err.Message != "argument 1 to len not supported, got BOOLEAN" {
+		t.Errorf("wrong error. got=%s", err.Inspect())
+	}
+}
+
+// The projected size of a result is the size of the result (or more)
+func TestStringsSizes(t *testing.T) {
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	strs := &object.Array{Elements: []object.Object{str("ab"), str("cde"), str("")}}
+
+	tests := []struct {
+		fn   string
+		args []object.Object
+	}{
+		{"replace", []object.Object{str("abcabc"), str("b"), str("xyz")}},
+		{"replace", []object.Object{str("abc"), str(""), str("--")}},
+		{"replace", []object.Object{str("aaaa"), str("aa"), str("")}},
+		{"join", []object.Object{strs, str(", ")}},
+		{"join", []object.Object{&object.Array{}, str(", ")}},
+		{"format", []object.Object{str("%s=%v (%d%%)"), str("x"), strs, object.NewInteger(50)}},
+		{"split", []object.Object{str("a,b,,c"), str(",")}},
+		{"split", []object.Object{str("héllo"), str("")}},
+	}
+
+	for i, tt := range tests {
+		result := stringsFunctions[tt.fn](tt.args...)
+		projected := stringsSizes[tt.fn](tt.args...)
+		if size := object.SizeOf(result); projected < size {
+			t.Errorf("tests[%d]: strings.%s: projected size too small. want>=%d, got=%d", i, tt.fn, size, projected)
+		}
+	}
+
+	if n := replaceSize(str("a"), object.NewInteger(1), str("b")); n != 0 {
+		t.Errorf("wrong projected size of invalid arguments. want=0, got=%d", n)
+	}
+}
@@ -0,0 +1,169 @@
+package stdlib
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// The time module. Times are integers, the milliseconds since the Unix epoch, and
+// durations the milliseconds between two times, so that the arithmetic on times and
+// durations is the integer arithmetic:
+//
+//	let deadline = time.now() + 5 * time.second;
+//	time.sleep(time.minute / 2);
+//	print(time.format_duration(time.since(start)));  // e.g. 1m30.5s
+//
+// The functions reading or waiting for the clock require the capability clock.
+
+// Clock is the clock of the time module. Sleep waits for d, or until ctx is done,
+// when it returns the error of ctx.
+type Clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// the durations in the time module
+var timeConstants = map[string]object.Object{
+	"millisecond": object.NewInteger(1),
+	"second":      object.NewInteger(1000),
+	"minute":      object.NewInteger(60 * 1000),
+	"hour":        object.NewInteger(60 * 60 * 1000),
+}
+
+func (h *Host) timeModule() *object.Module {
+	m := module("time", map[string]object.BuiltinFunction{
+		"now":             h.timeNow,
+		"sleep":           h.timeSleep,
+		"since":           h.timeSince,
+		"format_duration": timeFormatDuration,
+	})
+	for name, value := range timeConstants {
+		m.Members[name] = value
+	}
+	return m
+}
+
+// now returns the time of the clock, or the recorded time
+func (h *Host) now() (time.Time, *object.Error) {
+	e := Event{Op: "time.now"}
+	if h.Replay != nil {
+		ns, err := h.Replay.replay(e)
+		return time.Unix(0, ns), err
+	}
+
+	var t time.Time
+	switch {
+	case h.Now != nil:
+		t = h.Now()
+	case h.Clock != nil:
+		t = h.Clock.Now()
+	default:
+		t = time.Now()
+	}
+	e.Value = t.UnixNano()
+	h.Record.record(e)
+	return t, nil
+}
+
+// timeNow returns the number of milliseconds since the Unix epoch
+func (h *Host) timeNow(args ...object.Object) object.Object {
+	if err := h.require("time.now", CapClock); err != nil {
+		return err
+	}
+	if err := checkArgs("time.now", args); err != nil {
+		return err
+	}
+
+	now, err := h.now()
+	if err != nil {
+		return err
+	}
+	return object.NewInteger(milliseconds(now))
+}
+
+// sleep(d) waits for d milliseconds, or until the context of the run is done. A
+// replayed sleep does not wait.
+func (h *Host) timeSleep(args ...object.Object) object.Object {
+	if err := h.require("time.sleep", CapClock); err != nil {
+		return err
+	}
+	if err := checkArgs("time.sleep", args, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok || ms.Value < 0 || ms.Value > math.MaxInt64/int64(time.Millisecond) {
+		return newError("time.sleep: invalid duration %s", args[0].Inspect())
+	}
+
+	d := time.Duration(ms.Value) * time.Millisecond
+	e := Event{Op: "time.sleep", Arg: int64(d)}
+	if h.Replay != nil {
+		if _, err := h.Replay.replay(e); err != nil {
+			return err
+		}
+		return nil
+	}
+	ctx := h.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var err error
+	if h.Clock != nil {
+		err = h.Clock.Sleep(ctx, d)
+	} else {
+		err = sleep(ctx, d)
+	}
+	if err != nil {
+		return newError("time.sleep: %s", err) // the run is aborted
+	}
+	h.Record.record(e)
+	return nil
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// since(t) returns the milliseconds elapsed since the time t
+func (h *Host) timeSince(args ...object.Object) object.Object {
+	if err := h.require("time.since", CapClock); err != nil {
+		return err
+	}
+	if err := checkArgs("time.since", args, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+
+	now, err := h.now()
+	if err != nil {
+		return err
+	}
+	result, _ := object.IntegerArithmetic("-", object.NewInteger(milliseconds(now)), args[0])
+	return result
+}
+
+// format_duration(d) returns the duration of d milliseconds as a string like 1h2m3.5s
+func timeFormatDuration(args ...object.Object) object.Object {
+	if err := checkArgs("time.format_duration", args, object.INTEGER_OBJ); err != nil {
+		return err
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok || ms.Value > math.MaxInt64/int64(time.Millisecond) || ms.Value < math.MinInt64/int64(time.Millisecond) {
+		return newError("time.format_duration: duration out of range: %s", args[0].Inspect())
+	}
+	return &object.String{Value: (time.Duration(ms.Value) * time.Millisecond).String()}
+}
+
+func milliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
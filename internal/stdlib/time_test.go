@@ -0,0 +1,132 @@
+package stdlib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// fakeClock is a clock whose sleeps advance its time instead of waiting
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func TestTimeFunctions(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1500, 0)}
+	h := &Host{Capabilities: Capabilities{CapClock}, Clock: clock}
+	ms := func(v int64) object.Object { return object.NewInteger(v) }
+
+	tests := []struct {
+		result   func() object.Object
+		expected string // the inspected result, or the error message
+	}{
+		{func() object.Object { return h.timeNow() }, "1500000"},
+		{func() object.Object { return h.timeSleep(ms(2500)) }, "null"},
+		{func() object.Object { return h.timeNow() }, "1502500"},
+		{func() object.Object { return h.timeSince(ms(1000000)) }, "502500"},
+		{func() object.Object { return h.timeSleep(ms(-1)) }, "time.sleep: invalid duration -1"},
+		{func() object.Object { return h.timeSleep(&object.Float{Value: 1}) }, "argument 1 to time.sleep must be INTEGER, got FLOAT"},
+		{func() object.Object { return timeFormatDuration(ms(3723500)) }, "1h2m3.5s"},
+		{func() object.Object { return timeFormatDuration(ms(-1)) }, "-1ms"},
+		{func() object.Object { return timeFormatDuration(ms(1 << 62)) }, "time.format_duration: duration out of range: 4611686018427387904"},
+		{func() object.Object { return (&Host{}).timeSleep(ms(1)) }, "permission denied: time.sleep requires the capability clock"},
+	}
+
+	for i, tt := range tests {
+		result := tt.result()
+		var actual string
+		if result == nil {
+			actual = "null"
+		} else if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+		if actual != tt.expected {
+			t.Errorf("tests[%d]: want=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+
+	// a sleep is interrupted when the context of the run is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Context = ctx
+	if err, ok := h.timeSleep(ms(1000)).(*object.Error); !ok || err.Message != "time.sleep: context canceled" {
+		t.Errorf("expected an interrupted sleep. got=%v", err)
+	}
+	if now := h.timeNow().Inspect(); now != "1502500" {
+		t.Errorf("wrong time after an interrupted sleep. want=1502500, got=%s", now)
+	}
+	h.Clock = nil
+	start := time.Now()
+	if err, ok := h.timeSleep(ms(10000)).(*object.Error); !ok || err.Message != "time.sleep: context canceled" {
+		t.Errorf("expected an interrupted sleep of the system clock. got=%v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the sleep was not interrupted: %s", elapsed)
+	}
+	h.Clock = clock
+
+	// Now takes precedence over the clock
+	h.Now = func() time.Time { return time.Unix(1, 0) }
+	if now := h.timeNow().Inspect(); now != "1000" {
+		t.Errorf("wrong time. want=1000, got=%s", now)
+	}
+}
+
+func TestTimeReplay(t *testing.T) {
+	recording := &Recording{}
+	h := &Host{Capabilities: Capabilities{CapClock}, Clock: &fakeClock{now: time.Unix(10, 0)}, Record: recording}
+	h.timeNow()
+	h.timeSleep(object.NewInteger(5))
+	h.timeSince(object.NewInteger(0))
+
+	expected := "[time.now time.sleep(5ms) time.now]"
+	if got := fmtEvents(recording.Events); got != expected {
+		t.Fatalf("wrong events. want=%s, got=%s", expected, got)
+	}
+
+	// the replay neither reads the clock nor waits
+	replayed := &Host{Capabilities: Capabilities{CapClock}, Clock: &fakeClock{}, Replay: &Recording{Events: recording.Events}}
+	if now := replayed.timeNow().Inspect(); now != "10000" {
+		t.Errorf("wrong replayed time. want=10000, got=%s", now)
+	}
+	if result := replayed.timeSleep(object.NewInteger(5)); result != nil {
+		t.Errorf("unexpected result of the replayed sleep: %s", result.Inspect())
+	}
+	if since := replayed.timeSince(object.NewInteger(0)).Inspect(); since != "10005" {
+		t.Errorf("wrong replayed duration. want=10005, got=%s", since)
+	}
+	if now := replayed.Clock.Now(); !now.IsZero() {
+		t.Errorf("the replay used the clock: %s", now)
+	}
+
+	diverged := &Host{Capabilities: Capabilities{CapClock}, Replay: &Recording{Events: recording.Events}}
+	if err, ok := diverged.timeSleep(object.NewInteger(5)).(*object.Error); !ok ||
+		err.Message != "replay: event 0 is time.sleep(5ms), but time.now was recorded" {
+		t.Errorf("wrong error for a diverging replay. got=%v", err)
+	}
+}
+
+func fmtEvents(events []Event) string {
+	s := "["
+	for i, e := range events {
+		if i > 0 {
+			s += " "
+		}
+		s += e.String()
+	}
+	return s + "]"
+}
@@ -1,10 +1,29 @@
 package token
 
+import "fmt"
+
 type Type string
 
 type Token struct {
 	Type   Type
 	Lexeme string
+	Pos    Position // where the lexeme starts in the input
+}
+
+// Position is a 1-based line and column (counted in bytes) in the source text.
+// The zero value means "unknown position" (e.g. for tokens built by hand in tests).
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -14,6 +33,9 @@ const (
 	// Identifiers + literals
 	IDENT = "IDENT" // add, foobar, x, y, ...
 	INT   = "INT"   // 1343456
+	FLOAT = "FLOAT" // 1.5, 2e-3
+	STRING = "STRING" // "foo bar"
+	REGEX = "REGEX" // /ab+c/i
 
 	// Operators
 	ASSIGN   = "="
@@ -29,15 +51,22 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	ARROW = "->" // fn(int) -> int
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -46,6 +75,12 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	STRUCT   = "STRUCT"
+	ENUM     = "ENUM"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 )
 
 var keywords = map[string]Type {
@@ -56,6 +91,12 @@ var keywords = map[string]Type {
 	"if": IF,
 	"else": ELSE,
 	"return": RETURN,
+	"struct": STRUCT,
+	"enum": ENUM,
+	"throw": THROW,
+	"try": TRY,
+	"catch": CATCH,
+	"finally": FINALLY,
 }
 
 func LookupIdent(ident string) Type {
@@ -0,0 +1,967 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Error is a type error found at Pos in the source.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+// Info holds the principal types inferred by the checker.
+type Info struct {
+	Lets      map[*ast.LetStatement]*Scheme // generalized type of every let binding
+	Functions map[*ast.FunctionLiteral]Type // type of every function literal
+}
+
+// Checker infers types for a program. Names that are defined outside the program
+// (e.g. builtins) must be declared before calling Check.
+type Checker struct {
+	globals  *scope
+	structs  map[string]*structType
+	enums    map[string]*Con
+	variants map[string]*variantType
+	level    int
+	nextID   int
+	returns  []Type           // return type of the enclosing function literals (innermost last)
+	pending  map[*Scheme]bool // the top-level lets declared up front, not inferred yet
+	info     *Info
+	errors   []*Error
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		globals:  newScope(nil),
+		structs:  map[string]*structType{},
+		enums:    map[string]*Con{},
+		variants: map[string]*variantType{},
+		pending:  map[*Scheme]bool{},
+		info: &Info{
+			Lets:      map[*ast.LetStatement]*Scheme{},
+			Functions: map[*ast.FunctionLiteral]Type{},
+		},
+	}
+}
+
+// Check infers the types of program and returns every type error found.
+func Check(program *ast.Program) (*Info, []*Error) {
+	return NewChecker().Check(program)
+}
+
+// Declare makes name visible to the checked program with the given scheme.
+func (c *Checker) Declare(name string, s *Scheme) {
+	c.globals.define(name, s)
+}
+
+// NewVar returns a fresh type variable (e.g. for building schemes passed to Declare).
+func (c *Checker) NewVar() *Var {
+	c.nextID++
+	return &Var{ID: c.nextID, level: c.level}
+}
+
+// Check infers the types of program. As in the compiler, a function can refer to a
+// top-level let after it: the statements from the function to the let are inferred
+// together (see inferGroup).
+func (c *Checker) Check(program *ast.Program) (*Info, []*Error) {
+	env := newScope(c.globals)
+	stmts := program.Statements
+	firstLets := c.firstLets(stmts)
+	for i := 0; i < len(stmts); {
+		end := groupEnd(stmts, i, firstLets)
+		if end == i {
+			c.inferStatement(stmts[i], env)
+		} else {
+			c.inferGroup(stmts[i:end+1], env)
+		}
+		i = end + 1
+	}
+	return c.info, c.errors
+}
+
+// firstLets returns the index of the first top-level let of every name the program
+// defines (and that is not declared outside the program)
+func (c *Checker) firstLets(stmts []ast.Statement) map[string]int {
+	first := map[string]int{}
+	for i, s := range stmts {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		if _, ok := first[let.Name.Value]; ok {
+			continue
+		}
+		if _, ok := c.globals.lookup(let.Name.Value); !ok {
+			first[let.Name.Value] = i
+		}
+	}
+	return first
+}
+
+// groupEnd returns the index of the last statement of the group starting at stmts[i]:
+// the statements up to the last let that a statement of the group refers to before it
+// (e.g. a function calling a function defined after it)
+func groupEnd(stmts []ast.Statement, i int, firstLets map[string]int) int {
+	end := i
+	for j := i; j <= end; j++ {
+		ast.Inspect(stmts[j], func(node ast.Node) bool {
+			if id, ok := node.(*ast.Identifier); ok {
+				if k, ok := firstLets[id.Value]; ok && k > end {
+					end = k
+				}
+			}
+			return true
+		})
+	}
+	return end
+}
+
+func (c *Checker) errorf(pos token.Position, format string, args ...interface{}) {
+	c.errors = append(c.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+//
+// Inference (algorithm J with levels for efficient generalization)
+//
+
+func (c *Checker) inferStatement(stmt ast.Statement, env *scope) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.inferLet(stmt, env)
+		return Null
+	case *ast.ReturnStatement:
+		t := c.infer(stmt.ReturnValue, env)
+		if len(c.returns) > 0 {
+			want := c.returns[len(c.returns)-1]
+			if !c.unify(want, t) {
+				c.errorf(stmt.Token.Pos, "type mismatch: cannot return %s from function returning %s",
+					Format(t), Format(want))
+			}
+		}
+		return c.NewVar() // control never reaches past a return
+	case *ast.ExpressionStatement:
+		return c.infer(stmt.Expression, env)
+	case *ast.StructDeclaration:
+		c.declareStruct(stmt, env)
+		return Null
+	case *ast.EnumDeclaration:
+		c.declareEnum(stmt, env)
+		return Null
+	case *ast.ThrowStatement:
+		c.infer(stmt.Value, env)
+		return c.NewVar() // control never reaches past a throw
+	}
+	return c.NewVar()
+}
+
+func (c *Checker) inferLet(stmt *ast.LetStatement, env *scope) {
+	if stmt.Name == nil {
+		return
+	}
+
+	c.level++
+	t := c.inferLetValue(stmt, env, c.selfVar(stmt, env))
+	c.level--
+
+	c.bindLet(stmt, t, env)
+}
+
+// selfVar declares the name of a let-bound function for its body: it can call itself
+// (monomorphic recursion). It returns nil for other values.
+func (c *Checker) selfVar(stmt *ast.LetStatement, env *scope) *Var {
+	if _, ok := stmt.Value.(*ast.FunctionLiteral); !ok {
+		return nil
+	}
+	self := c.NewVar()
+	env.define(stmt.Name.Value, &Scheme{Type: self})
+	return self
+}
+
+// inferLetValue infers the type of the value of a let, unified with self (the type the
+// name is declared with before the value, if any)
+func (c *Checker) inferLetValue(stmt *ast.LetStatement, env *scope, self *Var) Type {
+	t := c.infer(stmt.Value, env)
+	if self != nil && !c.unify(self, t) {
+		c.errorf(stmt.Name.Token.Pos, "type mismatch: %s is used as %s, but has type %s",
+			stmt.Name.Value, Format(self), Format(t))
+	}
+	if stmt.Type != nil {
+		want := c.fromTypeExpr(stmt.Type)
+		if !c.unify(want, t) {
+			c.errorf(stmt.Name.Token.Pos, "type mismatch: cannot use %s as %s in let %s",
+				Format(t), Format(want), stmt.Name.Value)
+		}
+	}
+	return t
+}
+
+// bindLet generalizes the type of a let and binds its name
+func (c *Checker) bindLet(stmt *ast.LetStatement, t Type, env *scope) {
+	s := c.generalize(t)
+	env.define(stmt.Name.Value, s)
+	c.info.Lets[stmt] = s
+}
+
+// inferGroup infers top-level statements referring to lets after them (e.g. mutually
+// recursive functions). The names of the lets are declared up front, monomorphic in
+// the group, and generalized after it. Like the compiler, it reports the use of a name
+// outside a function before its let.
+func (c *Checker) inferGroup(stmts []ast.Statement, env *scope) {
+	c.level++
+	selves := map[*ast.LetStatement]*Var{}
+	for _, s := range stmts {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		if _, ok := env.lookup(let.Name.Value); !ok {
+			selves[let] = c.NewVar()
+			scheme := &Scheme{Type: selves[let]}
+			env.define(let.Name.Value, scheme)
+			c.pending[scheme] = true
+		}
+	}
+
+	var lets []*ast.LetStatement
+	var types []Type
+	for _, s := range stmts {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			c.inferStatement(s, env)
+			continue
+		}
+		self, ok := selves[let]
+		if !ok {
+			self = c.selfVar(let, env)
+		}
+		t := c.inferLetValue(let, env, self)
+		env.define(let.Name.Value, &Scheme{Type: t})
+		lets = append(lets, let)
+		types = append(types, t)
+	}
+	c.level--
+
+	for i, let := range lets {
+		c.bindLet(let, types[i], env)
+	}
+}
+
+func (c *Checker) inferBlock(block *ast.BlockStatement, env *scope) Type {
+	if block == nil {
+		return c.NewVar()
+	}
+	env = newScope(env)
+	var t Type = Null
+	for _, s := range block.Statements {
+		t = c.inferStatement(s, env)
+	}
+	return t
+}
+
+func (c *Checker) infer(node ast.Expression, env *scope) Type {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.FloatLiteral:
+		return Float
+	case *ast.StringLiteral:
+		return String
+	case *ast.RegexLiteral:
+		return Regex
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		s, ok := env.lookup(node.Value)
+		if !ok || c.pending[s] && len(c.returns) == 0 {
+			c.errorf(node.Token.Pos, "identifier not found: %s", node.Value)
+			return c.NewVar()
+		}
+		return c.instantiate(s)
+	case *ast.PrefixExpression:
+		return c.inferPrefix(node, env)
+	case *ast.InfixExpression:
+		return c.inferInfix(node, env)
+	case *ast.IfExpression:
+		return c.inferIf(node, env)
+	case *ast.FunctionLiteral:
+		return c.inferFunction(node, env)
+	case *ast.CallExpression:
+		return c.inferCall(node, env)
+	case *ast.StructLiteral:
+		return c.inferStructLiteral(node, env)
+	case *ast.FieldAccessExpression:
+		return c.inferFieldAccess(node, env)
+	case *ast.ArrayLiteral:
+		return c.inferArray(node, env)
+	case *ast.HashLiteral:
+		return c.inferHash(node, env)
+	case *ast.IndexExpression:
+		return c.inferIndex(node, env)
+	case *ast.SliceExpression:
+		return c.inferSlice(node, env)
+	case *ast.TryExpression:
+		return c.inferTry(node, env)
+	}
+	// unknown (or missing because of parser errors) expression
+	return c.NewVar()
+}
+
+func (c *Checker) inferPrefix(node *ast.PrefixExpression, env *scope) Type {
+	right := c.infer(node.Right, env)
+	switch node.Operator {
+	case "!":
+		return Bool // every value is either truthy or falsy
+	case "-":
+		if Prune(right) == Float {
+			return Float
+		}
+		if !c.unify(Int, right) {
+			c.errorf(node.Token.Pos, "unknown operator: -%s", Format(right))
+		}
+		return Int
+	}
+	return c.NewVar()
+}
+
+func (c *Checker) inferInfix(node *ast.InfixExpression, env *scope) Type {
+	left := c.infer(node.Left, env)
+	right := c.infer(node.Right, env)
+
+	// an int and a float are converted to floats
+	mixed := isMixedNumbers(left, right)
+	switch node.Operator {
+	case "+":
+		t := operandType(left, right)
+		if !mixed {
+			c.checkOperands(node, left, right, t)
+		}
+		return t
+	case "-", "*", "/":
+		t := numberType(left, right)
+		if !mixed {
+			c.checkOperands(node, left, right, t)
+		}
+		return t
+	case "<", ">":
+		if !mixed {
+			c.checkOperands(node, left, right, operandType(left, right))
+		}
+		return Bool
+	case "==", "!=":
+		if !mixed && !c.unify(left, right) {
+			c.errorf(node.Token.Pos, "type mismatch: %s %s %s",
+				Format(left), node.Operator, Format(right))
+		}
+		return Bool
+	}
+	return c.NewVar()
+}
+
+// operandType is the type of the operands of + and the comparisons, which are defined
+// on numbers and strings: int, unless an operand is known to be a string or a float
+func operandType(left, right Type) Type {
+	if Prune(left) == String || Prune(right) == String {
+		return String
+	}
+	return numberType(left, right)
+}
+
+// numberType is the type of the operands of the arithmetic: int, unless an operand is
+// known to be a float
+func numberType(left, right Type) Type {
+	if Prune(left) == Float || Prune(right) == Float {
+		return Float
+	}
+	return Int
+}
+
+// isMixedNumbers reports whether one operand is known to be an int and the other a
+// float
+func isMixedNumbers(left, right Type) bool {
+	l, r := Prune(left), Prune(right)
+	return l == Int && r == Float || l == Float && r == Int
+}
+
+// inferArray infers [a, b, ...], whose elements have the same type
+func (c *Checker) inferArray(node *ast.ArrayLiteral, env *scope) Type {
+	elem := c.NewVar()
+	for i, e := range node.Elements {
+		if t := c.infer(e, env); !c.unify(elem, t) {
+			c.errorf(node.Token.Pos, "type mismatch: cannot use %s as %s in element %d of array",
+				Format(t), Format(elem), i)
+		}
+	}
+	return Array(elem)
+}
+
+// inferHash infers {k: v, ...}, whose keys have the same type, as have the values
+func (c *Checker) inferHash(node *ast.HashLiteral, env *scope) Type {
+	key, val := c.NewVar(), c.NewVar()
+	for _, pair := range node.Pairs {
+		if t := c.infer(pair.Key, env); !c.unify(key, t) {
+			c.errorf(node.Token.Pos, "type mismatch: cannot use %s as %s in key of hash", Format(t), Format(key))
+		}
+		if t := c.infer(pair.Value, env); !c.unify(val, t) {
+			c.errorf(node.Token.Pos, "type mismatch: cannot use %s as %s in value of hash", Format(t), Format(val))
+		}
+	}
+	return Hash(key, val)
+}
+
+// inferIndex infers s[i], on a string (a string of one character), an array, or a
+// hash (known to be one from its earlier uses). A container of an unknown type can be
+// any of them.
+func (c *Checker) inferIndex(node *ast.IndexExpression, env *scope) Type {
+	left := c.infer(node.Left, env)
+	index := c.infer(node.Index, env)
+	if _, ok := Prune(left).(*Var); ok {
+		// a string, an array or a hash: the container and its index are left
+		// unconstrained, as there is no type of the values that can be indexed
+		return c.NewVar()
+	}
+	if h, ok := Prune(left).(*Con); ok && h.Name == hashName {
+		if !c.unify(h.Args[0], index) {
+			c.errorf(node.Token.Pos, "type mismatch: cannot use %s as %s in index of hash",
+				Format(index), Format(h.Args[0]))
+		}
+		return h.Args[1]
+	}
+	if !c.unify(Int, index) {
+		c.errorf(node.Token.Pos, "index must be int, got %s", Format(index))
+	}
+	if Prune(left) == String {
+		return String
+	}
+	elem := c.NewVar()
+	if !c.unify(Array(elem), left) {
+		c.errorf(node.Token.Pos, "index operator not supported: %s", Format(left))
+	}
+	return elem
+}
+
+// inferSlice infers s[low:high], on a string or an array
+func (c *Checker) inferSlice(node *ast.SliceExpression, env *scope) Type {
+	left := c.infer(node.Left, env)
+	for _, bound := range []ast.Expression{node.Low, node.High} {
+		if bound == nil {
+			continue
+		}
+		if t := c.infer(bound, env); !c.unify(Int, t) {
+			c.errorf(node.Token.Pos, "slice bound must be int, got %s", Format(t))
+		}
+	}
+	if Prune(left) == String {
+		return String
+	}
+	if _, ok := Prune(left).(*Var); ok {
+		return left // a string or an array
+	}
+	if !c.unify(Array(c.NewVar()), left) {
+		c.errorf(node.Token.Pos, "slice operator not supported: %s", Format(left))
+	}
+	return left
+}
+
+// checkOperands requires both operands of node to have type want
+func (c *Checker) checkOperands(node *ast.InfixExpression, left, right, want Type) {
+	if !c.unify(left, right) {
+		c.errorf(node.Token.Pos, "type mismatch: %s %s %s",
+			Format(left), node.Operator, Format(right))
+		return
+	}
+	if !c.unify(want, left) {
+		c.errorf(node.Token.Pos, "unknown operator: %s %s %s",
+			Format(left), node.Operator, Format(right))
+	}
+}
+
+func (c *Checker) inferIf(node *ast.IfExpression, env *scope) Type {
+	armEnv := env
+	if cond, ok := node.Condition.(*ast.LetCondition); ok {
+		armEnv = c.inferLetCondition(cond, env)
+	} else {
+		// The condition is not required to be a bool, Monkey has truthy/falsy values
+		c.infer(node.Condition, env)
+	}
+	t := c.inferBlock(node.IfArm, armEnv)
+	if node.ElseArm == nil {
+		return Null
+	}
+	e := c.inferBlock(node.ElseArm, env)
+	if !c.unify(t, e) {
+		c.errorf(node.Token.Pos, "type mismatch: if arms have types %s and %s",
+			Format(t), Format(e))
+	}
+	return t
+}
+
+// Thrown values are not tracked by the type system, so the catch parameter can be
+// any (but just one) type.
+func (c *Checker) inferTry(node *ast.TryExpression, env *scope) Type {
+	t := c.inferBlock(node.Body, env)
+	if node.Catch != nil {
+		catchEnv := newScope(env)
+		catchEnv.define(node.CatchParam.Value, &Scheme{Type: c.NewVar()})
+		e := c.inferBlock(node.Catch, catchEnv)
+		if !c.unify(t, e) {
+			c.errorf(node.Token.Pos, "type mismatch: try and catch arms have types %s and %s",
+				Format(t), Format(e))
+		}
+	}
+	if node.Finally != nil {
+		c.inferBlock(node.Finally, env) // the value is discarded
+	}
+	return t
+}
+
+func (c *Checker) inferFunction(node *ast.FunctionLiteral, env *scope) Type {
+	env = newScope(env)
+	params := []Type{}
+	for i, p := range node.Parameters {
+		var t Type = c.NewVar()
+		if ann := node.ParameterType(i); ann != nil {
+			t = c.fromTypeExpr(ann)
+		}
+		env.define(p.Value, &Scheme{Type: t})
+		params = append(params, t)
+	}
+
+	var ret Type = c.NewVar()
+	if node.ReturnType != nil {
+		ret = c.fromTypeExpr(node.ReturnType)
+	}
+
+	c.returns = append(c.returns, ret)
+	body := c.inferBlock(node.Body, env)
+	c.returns = c.returns[:len(c.returns)-1]
+
+	if !c.unify(ret, body) {
+		c.errorf(node.Token.Pos, "type mismatch: function body has type %s, want %s",
+			Format(body), Format(ret))
+	}
+
+	t := &Func{Params: params, Return: ret}
+	c.info.Functions[node] = t
+	return t
+}
+
+func (c *Checker) inferCall(node *ast.CallExpression, env *scope) Type {
+	callee := Prune(c.infer(node.Function, env))
+	args := []Type{}
+	for _, a := range node.Arguments {
+		args = append(args, c.infer(a, env))
+	}
+
+	switch f := callee.(type) {
+	case *Func:
+		if len(f.Params) != len(args) {
+			c.errorf(node.Token.Pos, "wrong number of arguments: want=%d, got=%d",
+				len(f.Params), len(args))
+		}
+		for i := 0; i < len(f.Params) && i < len(args); i++ {
+			if !c.unify(f.Params[i], args[i]) {
+				c.errorf(node.Token.Pos, "type mismatch: cannot use %s as %s in argument %d",
+					Format(args[i]), Format(f.Params[i]), i+1)
+			}
+		}
+		return f.Return
+	case *Var:
+		ret := c.NewVar()
+		want := &Func{Params: args, Return: ret}
+		if !c.unify(f, want) {
+			// f occurs in its own arguments, e.g. f(f)
+			c.errorf(node.Token.Pos, "infinite type: cannot call %s as %s", Format(f), Format(want))
+		}
+		return ret
+	}
+
+	c.errorf(node.Token.Pos, "not a function: %s", Format(callee))
+	return c.NewVar()
+}
+
+//
+// Records (structs)
+//
+
+// A struct is a nominal type. Its fields are monomorphic: every value of the
+// struct type shares the same field types throughout the program.
+type structType struct {
+	con    *Con
+	fields map[string]Type
+}
+
+func (c *Checker) declareStruct(decl *ast.StructDeclaration, env *scope) {
+	if decl.Name == nil {
+		return
+	}
+	st := &structType{con: &Con{Name: decl.Name.Value}, fields: map[string]Type{}}
+	c.structs[decl.Name.Value] = st
+
+	for _, f := range decl.Fields {
+		v := c.NewVar()
+		v.level = 0 // never generalized
+		st.fields[f.Name.Value] = v
+		if f.Default != nil {
+			t := c.infer(f.Default, env)
+			if !c.unify(v, t) {
+				c.errorf(f.Name.Token.Pos, "type mismatch: cannot use %s as %s in field %s of %s",
+					Format(t), Format(v), f.Name.Value, decl.Name.Value)
+			}
+		}
+	}
+}
+
+func (c *Checker) inferStructLiteral(lit *ast.StructLiteral, env *scope) Type {
+	st, ok := c.structs[lit.Name.Value]
+	if !ok {
+		c.errorf(lit.Token.Pos, "unknown struct %s", lit.Name.Value)
+		for _, f := range lit.Fields {
+			c.infer(f.Value, env)
+		}
+		return c.NewVar()
+	}
+
+	// unknown and missing fields are reported by package checker
+	for _, f := range lit.Fields {
+		t := c.infer(f.Value, env)
+		want, ok := st.fields[f.Name.Value]
+		if ok && !c.unify(want, t) {
+			c.errorf(f.Name.Token.Pos, "type mismatch: cannot use %s as %s in field %s of %s",
+				Format(t), Format(want), f.Name.Value, lit.Name.Value)
+		}
+	}
+	return st.con
+}
+
+func (c *Checker) inferFieldAccess(node *ast.FieldAccessExpression, env *scope) Type {
+	object := Prune(c.infer(node.Object, env))
+	if node.Field == nil {
+		return c.NewVar()
+	}
+	name := node.Field.Value
+
+	switch t := object.(type) {
+	case *Con:
+		if st, ok := c.structs[t.Name]; ok && st.con == t {
+			if f, ok := st.fields[name]; ok {
+				return f
+			}
+			c.errorf(node.Field.Token.Pos, "no field %s in struct %s", name, t.Name)
+			return c.NewVar()
+		}
+		c.errorf(node.Field.Token.Pos, "type %s has no field %s", Format(t), name)
+	case *Var:
+		// If only one struct has the field, the object must be of that struct type
+		var candidate *structType
+		for _, st := range c.structs {
+			if _, ok := st.fields[name]; ok {
+				if candidate != nil {
+					return c.NewVar() // ambiguous
+				}
+				candidate = st
+			}
+		}
+		if candidate == nil {
+			c.errorf(node.Field.Token.Pos, "no struct has a field %s", name)
+			return c.NewVar()
+		}
+		c.unify(t, candidate.con)
+		return candidate.fields[name]
+	}
+	return c.NewVar()
+}
+
+//
+// Tagged unions (enums)
+//
+
+// Like struct fields, the fields of a variant are monomorphic.
+type variantType struct {
+	enum   *Con
+	fields []Type
+}
+
+// declareEnum binds every variant name to its constructor
+func (c *Checker) declareEnum(decl *ast.EnumDeclaration, env *scope) {
+	if decl.Name == nil {
+		return
+	}
+	enum := &Con{Name: decl.Name.Value}
+	c.enums[decl.Name.Value] = enum
+
+	for _, v := range decl.Variants {
+		vt := &variantType{enum: enum}
+		for range v.Fields {
+			f := c.NewVar()
+			f.level = 0 // never generalized
+			vt.fields = append(vt.fields, f)
+		}
+		c.variants[v.Name.Value] = vt
+
+		if len(vt.fields) == 0 {
+			env.define(v.Name.Value, &Scheme{Type: enum})
+		} else {
+			env.define(v.Name.Value, &Scheme{Type: &Func{Params: vt.fields, Return: enum}})
+		}
+	}
+}
+
+// inferLetCondition returns the scope of the if arm, where the pattern variables are bound
+func (c *Checker) inferLetCondition(cond *ast.LetCondition, env *scope) *scope {
+	t := c.infer(cond.Value, env)
+	armEnv := newScope(env)
+
+	name := cond.Pattern.Name.Value
+	vt, ok := c.variants[name]
+	if !ok {
+		c.errorf(cond.Pattern.Token.Pos, "unknown variant %s", name)
+		for _, b := range cond.Pattern.Bindings {
+			armEnv.define(b.Value, &Scheme{Type: c.NewVar()})
+		}
+		return armEnv
+	}
+
+	if !c.unify(vt.enum, t) {
+		c.errorf(cond.Token.Pos, "type mismatch: cannot match %s against variant %s of %s",
+			Format(t), name, vt.enum.Name)
+	}
+	for i, b := range cond.Pattern.Bindings {
+		var ft Type = c.NewVar()
+		if i < len(vt.fields) {
+			ft = vt.fields[i]
+		}
+		if b.Value != "_" {
+			armEnv.define(b.Value, &Scheme{Type: ft})
+		}
+	}
+	return armEnv
+}
+
+// fromTypeExpr translates an annotation into a type
+func (c *Checker) fromTypeExpr(t ast.TypeExpr) Type {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		switch t.Name {
+		case "int":
+			return Int
+		case "float":
+			return Float
+		case "bool":
+			return Bool
+		case "string":
+			return String
+		case "regex":
+			return Regex
+		case "null":
+			return Null
+		}
+		if st, ok := c.structs[t.Name]; ok {
+			return st.con
+		}
+		if enum, ok := c.enums[t.Name]; ok {
+			return enum
+		}
+		c.errorf(t.Token.Pos, "unknown type: %s", t.Name)
+	case *ast.ArrayType:
+		return Array(c.fromTypeExpr(t.Element))
+	case *ast.HashType:
+		return Hash(c.fromTypeExpr(t.Key), c.fromTypeExpr(t.Value))
+	case *ast.FunctionType:
+		params := []Type{}
+		for _, p := range t.Parameters {
+			params = append(params, c.fromTypeExpr(p))
+		}
+		return &Func{Params: params, Return: c.fromTypeExpr(t.Return)}
+	}
+	return c.NewVar()
+}
+
+//
+// Unification
+//
+
+func (c *Checker) unify(a, b Type) bool {
+	a, b = Prune(a), Prune(b)
+
+	if v, ok := a.(*Var); ok {
+		if v == b {
+			return true
+		}
+		if occursIn(v, b) {
+			return false // infinite type
+		}
+		adjustLevels(b, v.level)
+		v.Instance = b
+		return true
+	}
+	if _, ok := b.(*Var); ok {
+		return c.unify(b, a)
+	}
+
+	switch a := a.(type) {
+	case *Con:
+		b, ok := b.(*Con)
+		if !ok || a.Name != b.Name || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i := range a.Args {
+			if !c.unify(a.Args[i], b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *Func:
+		b, ok := b.(*Func)
+		if !ok || len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !c.unify(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return c.unify(a.Return, b.Return)
+	}
+	return false
+}
+
+func occursIn(v *Var, t Type) bool {
+	switch t := Prune(t).(type) {
+	case *Var:
+		return v == t
+	case *Con:
+		for _, a := range t.Args {
+			if occursIn(v, a) {
+				return true
+			}
+		}
+	case *Func:
+		for _, p := range t.Params {
+			if occursIn(v, p) {
+				return true
+			}
+		}
+		return occursIn(v, t.Return)
+	}
+	return false
+}
+
+// adjustLevels makes sure no variable in t outlives the level of the variable it is bound to
+func adjustLevels(t Type, level int) {
+	switch t := Prune(t).(type) {
+	case *Var:
+		if t.level > level {
+			t.level = level
+		}
+	case *Con:
+		for _, a := range t.Args {
+			adjustLevels(a, level)
+		}
+	case *Func:
+		for _, p := range t.Params {
+			adjustLevels(p, level)
+		}
+		adjustLevels(t.Return, level)
+	}
+}
+
+//
+// Let-polymorphism
+//
+
+// generalize quantifies the variables of t that were introduced inside the current let
+func (c *Checker) generalize(t Type) *Scheme {
+	s := &Scheme{Type: t}
+	seen := map[*Var]bool{}
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := Prune(t).(type) {
+		case *Var:
+			if t.level > c.level && !seen[t] {
+				seen[t] = true
+				s.Vars = append(s.Vars, t)
+			}
+		case *Con:
+			for _, a := range t.Args {
+				collect(a)
+			}
+		case *Func:
+			for _, p := range t.Params {
+				collect(p)
+			}
+			collect(t.Return)
+		}
+	}
+	collect(t)
+	return s
+}
+
+// instantiate replaces the quantified variables of s with fresh variables
+func (c *Checker) instantiate(s *Scheme) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	fresh := map[*Var]Type{}
+	for _, v := range s.Vars {
+		fresh[v] = c.NewVar()
+	}
+	var copy func(t Type) Type
+	copy = func(t Type) Type {
+		switch t := Prune(t).(type) {
+		case *Var:
+			if f, ok := fresh[t]; ok {
+				return f
+			}
+			return t
+		case *Con:
+			if len(t.Args) == 0 {
+				return t
+			}
+			args := []Type{}
+			for _, a := range t.Args {
+				args = append(args, copy(a))
+			}
+			return &Con{Name: t.Name, Args: args}
+		case *Func:
+			params := []Type{}
+			for _, p := range t.Params {
+				params = append(params, copy(p))
+			}
+			return &Func{Params: params, Return: copy(t.Return)}
+		}
+		return t
+	}
+	return copy(s.Type)
+}
+
+//
+// Scopes
+//
+
+type scope struct {
+	vars  map[string]*Scheme
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{vars: map[string]*Scheme{}, outer: outer}
+}
+
+func (s *scope) define(name string, scheme *Scheme) {
+	s.vars[name] = scheme
+}
+
+func (s *scope) lookup(name string) (*Scheme, bool) {
+	for ; s != nil; s = s.outer {
+		if scheme, ok := s.vars[name]; ok {
+			return scheme, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,382 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/parser"
+)
+
+func TestLetBindingTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // type of the last let binding
+	}{
+		{"let x = 5;", "int"},
+		{"let b = !5;", "bool"},
+		{"let b = 1 < 2 == true;", "bool"},
+		{"let x: int = 5;", "int"},
+		{"let id = fn(x) { x };", "fn('a) -> 'a"},
+		{"let k = fn(x, y) { x };", "fn('a, 'b) -> 'a"},
+		{"let add = fn(x, y) { x + y };", "fn(int, int) -> int"},
+		{"let id = fn(x) { x }; let y = id(5);", "int"},
+		{"let apply = fn(f, x) { f(x) };", "fn(fn('a) -> 'b, 'a) -> 'b"},
+		{"let compose = fn(f, g) { fn(x) { f(g(x)) } };",
+			"fn(fn('a) -> 'b, fn('c) -> 'a) -> fn('c) -> 'b"},
+		{"let max = fn(a, b) { if (a > b) { a } else { b } };", "fn(int, int) -> int"},
+		{"let fact = fn(n) { if (n == 0) { return 1; } n * fact(n - 1) };", "fn(int) -> int"},
+		{"let f = fn(x: bool): bool { x };", "fn(bool) -> bool"},
+		{"let f = fn(g: fn(int) -> bool) { g };", "fn(fn(int) -> bool) -> fn(int) -> bool"},
+		{"let f = fn(xs: [int], h: {string: bool}) { h };", "fn([int], {string: bool}) -> {string: bool}"},
+		{"let f = fn(x) { if (x) { 1 } };", "fn('a) -> null"},
+		{`let s = "mon" + "key";`, "string"},
+		{`let c = "abc"[1];`, "string"},
+		{`let f = fn(s: string) { s[1:] + "!" };`, "fn(string) -> string"},
+		{`let less = fn(a, b) { a < b + "" };`, "fn(string, string) -> bool"},
+		{"let xs = [1, 2 * 3];", "[int]"},
+		{"let xs = [[true], []];", "[[bool]]"},
+		// the parameter can be a string, an array or a hash
+		{"let first = fn(xs) { xs[0] };", "fn('a) -> 'b"},
+		{`let get = fn(h, k) { h[k] }; let v = get({"a": 1}, "a") + 1;`, "int"},
+		{`let tail = fn(s) { s[1:] }; let t = tail("abc") + "!";`, "string"},
+		{"let first = fn(xs: [int]) { xs[0] };", "fn([int]) -> int"},
+		{"let pair = fn(x) { [x, x] };", "fn('a) -> ['a]"},
+		{`let h = {"a": 1, "b": 2};`, "{string: int}"},
+		{`let h = {}; let v = h;`, "{'a: 'b}"},
+		{`let h = {1: [true]}; let v = h[2];`, "[bool]"},
+		{"let x = 1.5;", "float"},
+		{"let x = -1.5 * 2;", "float"},
+		{"let x = 7 / 2;", "int"},
+		{"let b = 1 < 1.5;", "bool"},
+		{"let b = 1 == 1.0;", "bool"},
+		{"let half = fn(x) { x / 2.0 };", "fn(float) -> float"},
+		{"let f = fn(x: float, n: int) { x * n };", "fn(float, int) -> float"},
+		{"let re = /a+/i;", "regex"},
+		{"let f = fn(r: regex) { [r, /b/] };", "fn(regex) -> [regex]"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info, errs := Check(program)
+		if len(errs) != 0 {
+			t.Errorf("unexpected type errors for %q: %v", tt.input, errs)
+			continue
+		}
+
+		last := program.Statements[len(program.Statements)-1].(*ast.LetStatement)
+		actual := info.Lets[last].String()
+		if actual != tt.expected {
+			t.Errorf("wrong type for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestLetPolymorphism(t *testing.T) {
+	input := `
+let id = fn(x) { x };
+let a = id(1);
+let b = id(true);
+let f = fn(g) { g(1) + 1 };
+let c = f(id);
+`
+	program := parse(t, input)
+	info, errs := Check(program)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected type errors: %v", errs)
+	}
+
+	expected := []string{"fn('a) -> 'a", "int", "bool", "fn(fn(int) -> int) -> int", "int"}
+	for i, want := range expected {
+		stmt := program.Statements[i].(*ast.LetStatement)
+		if got := info.Lets[stmt].String(); got != want {
+			t.Errorf("let %s wrong type. want=%q, got=%q", stmt.Name.Value, want, got)
+		}
+	}
+}
+
+func TestForwardReferences(t *testing.T) {
+	input := `
+let f = fn(n) { if (n == 0) { 0 } else { g(n - 1) } };
+let g = fn(n) { f(n) };
+f(3);
+let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+let first = fn(x) { second(x) };
+let second = fn(x) { x };
+let a = first(1);
+let b = first("a");
+`
+	program := parse(t, input)
+	info, errs := Check(program)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected type errors: %v", errs)
+	}
+
+	expected := map[string]string{
+		"f":      "fn(int) -> int",
+		"g":      "fn(int) -> int",
+		"even":   "fn(int) -> bool",
+		"odd":    "fn(int) -> bool",
+		"first":  "fn('a) -> 'a",
+		"second": "fn('a) -> 'a",
+		"a":      "int",
+		"b":      "string",
+	}
+	for _, s := range program.Statements {
+		stmt, ok := s.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if got := info.Lets[stmt].String(); got != expected[stmt.Name.Value] {
+			t.Errorf("let %s wrong type. want=%q, got=%q", stmt.Name.Value, expected[stmt.Name.Value], got)
+		}
+	}
+}
+
+func TestFunctionLiteralTypes(t *testing.T) {
+	input := `fn(x) { fn(y) { x == y } }`
+
+	program := parse(t, input)
+	info, errs := Check(program)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected type errors: %v", errs)
+	}
+
+	outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	inner := outer.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+	if got := Format(info.Functions[outer]); got != "fn('a) -> fn('a) -> bool" {
+		t.Errorf("outer function wrong type. got=%q", got)
+	}
+	if got := Format(info.Functions[inner]); got != "fn('a) -> bool" {
+		t.Errorf("inner function wrong type. got=%q", got)
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true + 1;", "1:6: type mismatch: bool + int"},
+		{"true + false;", "1:6: unknown operator: bool + bool"},
+		{"5 == true;", "1:3: type mismatch: int == bool"},
+		{"-true;", "1:1: unknown operator: -bool"},
+		{"let x = 5;\nx(1);", "2:2: not a function: int"},
+		{"let add = fn(a, b) { a + b };\nadd(1);", "2:4: wrong number of arguments: want=2, got=1"},
+		{"let add = fn(a, b) { a + b };\nadd(1, true);", "2:4: type mismatch: cannot use bool as int in argument 2"},
+		{"let x: bool = 5;", "1:5: type mismatch: cannot use int as bool in let x"},
+		{"let f = fn(x): bool { x + 1 };", "1:9: type mismatch: function body has type int, want bool"},
+		{"fn(x) { if (x) { return 1; } return true; }", "1:30: type mismatch: cannot return bool from function returning int"},
+		{"if (true) { 1 } else { false }", "1:1: type mismatch: if arms have types int and bool"},
+		{"foo + 1;", "1:1: identifier not found: foo"},
+		// a let after a statement can be referred to by a function only
+		{"let x = y; let y = 1;", "1:9: identifier not found: y"},
+		{"let f = fn() { y }; if (true) { y }; let y = 1;", "1:33: identifier not found: y"},
+		{"let f = fn() { g(1, 2) }; let g = fn(x) { x };", "1:31: type mismatch: g is used as fn(int, int) -> 'a, but has type fn('a) -> 'a"},
+		{"let f = fn(x) { f(1, 2) };", "1:5: type mismatch: f is used as fn(int, int) -> 'a, but has type fn('a) -> 'b"},
+		{"let x: foo = 1;", "1:8: unknown type: foo"},
+		{"let id = fn(x) { x }; id(1) + id(true);", "1:29: type mismatch: int + bool"},
+		{"fn(f) { f(f) }", "1:10: infinite type: cannot call 'a as fn('a) -> 'b"},
+		{`"a" + 1;`, "1:5: type mismatch: string + int"},
+		{`"abc"[true];`, "1:6: index must be int, got bool"},
+		{"[1, true];", "1:1: type mismatch: cannot use bool as int in element 1 of array"},
+		{`{"a": 1, "b": true};`, "1:1: type mismatch: cannot use bool as int in value of hash"},
+		{`{"a": 1, 2: 2};`, "1:1: type mismatch: cannot use int as string in key of hash"},
+		{`let h = {"a": 1}; h[1];`, "1:20: type mismatch: cannot use int as string in index of hash"},
+		{`1.5 + "a";`, "1:5: type mismatch: float + string"},
+		{"let x: int = 1.5;", "1:5: type mismatch: cannot use float as int in let x"},
+		{"[1, 1.5];", "1:1: type mismatch: cannot use float as int in element 1 of array"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		_, errs := Check(program)
+		if len(errs) == 0 {
+			t.Errorf("expected a type error for %q, got none", tt.input)
+			continue
+		}
+		if errs[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errs[0].Error())
+		}
+	}
+}
+
+func TestStructTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // type of the last let binding
+	}{
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2};", "Point"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; let x = p.x;", "int"},
+		{"struct Point { x, y = true }; let p = Point{x: 1}; let y = p.y;", "bool"},
+		{"struct Point { x, y }; let getX = fn(p) { p.x };", "fn(Point) -> 'a"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; let getX = fn(p) { p.x };", "fn(Point) -> int"},
+		{"struct Point { x, y }; let f = fn(p: Point) { p };", "fn(Point) -> Point"},
+		{"struct Box { v }; let b = Box{v: fn(x) { x + 1 }}; let r = b.v(2);", "int"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info, errs := Check(program)
+		if len(errs) != 0 {
+			t.Errorf("unexpected type errors for %q: %v", tt.input, errs)
+			continue
+		}
+
+		last := program.Statements[len(program.Statements)-1].(*ast.LetStatement)
+		actual := info.Lets[last].String()
+		if actual != tt.expected {
+			t.Errorf("wrong type for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestStructTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct P { x }; P{x: 1}; P{x: true};", "1:28: type mismatch: cannot use bool as int in field x of P"},
+		{"struct P { x = 1 }; P{x: true};", "1:23: type mismatch: cannot use bool as int in field x of P"},
+		{"struct P { x }; let p = P{x: 1}; p.y;", "1:36: no field y in struct P"},
+		{"let n = 5; n.x;", "1:14: type int has no field x"},
+		{"fn(a) { a.x };", "1:11: no struct has a field x"},
+		{"Q{x: 1};", "1:1: unknown struct Q"},
+		{"struct P { x }; P{x: 1}.x + true;", "1:27: type mismatch: int + bool"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		_, errs := Check(program)
+		if len(errs) == 0 {
+			t.Errorf("expected a type error for %q, got none", tt.input)
+			continue
+		}
+		if errs[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errs[0].Error())
+		}
+	}
+}
+
+func TestEnumTypes(t *testing.T) {
+	shape := "enum Shape { Circle(r), Rect(w, h), Empty };"
+
+	tests := []struct {
+		input    string
+		expected string // type of the last let binding
+	}{
+		{shape + "let s = Circle(1);", "Shape"},
+		{shape + "let e = Empty;", "Shape"},
+		{shape + "let mk = Rect;", "fn('a, 'b) -> Shape"},
+		{shape + "let s = Rect(2, 3); let mk = Rect;", "fn(int, int) -> Shape"},
+		{shape + "let area = fn(s) { if (let Circle(r) = s) { r * r } else if (let Rect(w, h) = s) { w * h } else { 0 } };",
+			"fn(Shape) -> int"},
+		{shape + "let f = fn(s: Shape) { if (let Rect(_, h) = s) { h } else { 0 } };", "fn(Shape) -> int"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info, errs := Check(program)
+		if len(errs) != 0 {
+			t.Errorf("unexpected type errors for %q: %v", tt.input, errs)
+			continue
+		}
+
+		last := program.Statements[len(program.Statements)-1].(*ast.LetStatement)
+		actual := info.Lets[last].String()
+		if actual != tt.expected {
+			t.Errorf("wrong type for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestEnumTypeErrors(t *testing.T) {
+	shape := "enum Shape { Circle(r), Empty };\n"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{shape + "Circle(1, 2);", "2:7: wrong number of arguments: want=1, got=2"},
+		{shape + "Circle(1); Circle(true);", "2:18: type mismatch: cannot use bool as int in argument 1"},
+		{shape + "if (let Circle(r) = 5) { r }", "2:5: type mismatch: cannot match int against variant Circle of Shape"},
+		{shape + "if (let Circle(r) = Empty) { r + 1 }; if (let Circle(r) = Empty) { !r }; Circle(true);",
+			"2:80: type mismatch: cannot use bool as int in argument 1"},
+		{shape + "if (let Square(r) = Empty) { r }", "2:9: unknown variant Square"},
+		{shape + "if (let Empty = Empty) { 1 }; Empty(1);", "2:36: not a function: Shape"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		_, errs := Check(program)
+		if len(errs) == 0 {
+			t.Errorf("expected a type error for %q, got none", tt.input)
+			continue
+		}
+		if errs[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errs[0].Error())
+		}
+	}
+}
+
+func TestExceptionTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // type of the last let binding
+	}{
+		{"let f = fn(x) { if (x < 0) { throw x; } x };", "fn(int) -> int"},
+		{"let x = try { 1 } catch (e) { 2 };", "int"},
+		{"let x = try { 1 } finally { true };", "int"},
+		{"let f = fn(g) { try { g() } catch (e) { e } };", "fn(fn() -> 'a) -> 'a"},
+		{"let f = fn() { try { return 1; } finally { 0 } };", "fn() -> int"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info, errs := Check(program)
+		if len(errs) != 0 {
+			t.Errorf("unexpected type errors for %q: %v", tt.input, errs)
+			continue
+		}
+
+		last := program.Statements[len(program.Statements)-1].(*ast.LetStatement)
+		actual := info.Lets[last].String()
+		if actual != tt.expected {
+			t.Errorf("wrong type for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	program := parse(t, "try { 1 } catch (e) { true }")
+	_, errs := Check(program)
+	if len(errs) != 1 || errs[0].Error() != "1:1: type mismatch: try and catch arms have types int and bool" {
+		t.Errorf("wrong errors for try with mismatched arms. got=%v", errs)
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	c := NewChecker()
+	a := c.NewVar()
+	c.Declare("len", &Scheme{Vars: []*Var{a}, Type: &Func{Params: []Type{Array(a)}, Return: Int}})
+
+	program := parse(t, "let f = fn(xs) { len(xs) + 1 };")
+	info, errs := c.Check(program)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected type errors: %v", errs)
+	}
+	stmt := program.Statements[0].(*ast.LetStatement)
+	if got := info.Lets[stmt].String(); got != "fn(['a]) -> int" {
+		t.Errorf("wrong type. got=%q", got)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
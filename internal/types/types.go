@@ -0,0 +1,159 @@
+// Package types implements Hindley-Milner type inference for Monkey programs.
+//
+// Monkey itself is dynamically typed, so the checker is an optional pass that can be
+// run on a parsed ast.Program to catch errors (e.g. `true + 1` or calling an integer)
+// before the program is executed. Optional annotations (see ast.TypeExpr) are taken
+// into account as extra constraints.
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a (mono)type. It is either a type variable, a type constructor
+// application (int, bool, [T], ...) or a function type.
+type Type interface {
+	String() string
+	typ()
+}
+
+// Var is a type variable. Unification binds a variable by setting its Instance,
+// so always call Prune on a type before inspecting it.
+type Var struct {
+	ID       int
+	Instance Type // nil while the variable is unbound
+	level    int  // let-nesting level used for generalization
+}
+
+func (v *Var) typ() {}
+func (v *Var) String() string {
+	if v.Instance != nil {
+		return v.Instance.String()
+	}
+	return fmt.Sprintf("t%d", v.ID)
+}
+
+// Con is a type constructor applied to zero or more type arguments.
+type Con struct {
+	Name string
+	Args []Type
+}
+
+func (c *Con) typ() {}
+func (c *Con) String() string {
+	switch {
+	case c.Name == arrayName && len(c.Args) == 1:
+		return "[" + c.Args[0].String() + "]"
+	case c.Name == hashName && len(c.Args) == 2:
+		return "{" + c.Args[0].String() + ": " + c.Args[1].String() + "}"
+	case len(c.Args) == 0:
+		return c.Name
+	}
+	args := []string{}
+	for _, a := range c.Args {
+		args = append(args, a.String())
+	}
+	return c.Name + "<" + strings.Join(args, ", ") + ">"
+}
+
+// Func is the type of a function taking len(Params) arguments. Monkey functions are
+// not curried, so the arity is part of the type.
+type Func struct {
+	Params []Type
+	Return Type
+}
+
+func (f *Func) typ() {}
+func (f *Func) String() string {
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+const (
+	arrayName = "array"
+	hashName  = "hash"
+)
+
+// The built-in types
+var (
+	Int    = &Con{Name: "int"}
+	Float  = &Con{Name: "float"}
+	Bool   = &Con{Name: "bool"}
+	String = &Con{Name: "string"}
+	Regex  = &Con{Name: "regex"}
+	Null   = &Con{Name: "null"} // the value of e.g. an `if` without an else arm
+)
+
+func Array(elem Type) *Con    { return &Con{Name: arrayName, Args: []Type{elem}} }
+func Hash(key, val Type) *Con { return &Con{Name: hashName, Args: []Type{key, val}} }
+
+// Scheme is a polytype: a type where Vars are universally quantified. Let-bound
+// values get a scheme, so `let id = fn(x) { x }` can be used at many types.
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+func (s *Scheme) String() string { return Format(s.Type) }
+
+// Prune follows the chain of bound type variables and returns the representative type.
+func Prune(t Type) Type {
+	if v, ok := t.(*Var); ok && v.Instance != nil {
+		v.Instance = Prune(v.Instance) // path compression
+		return v.Instance
+	}
+	return t
+}
+
+// Format returns a readable version of t where the unbound type variables
+// are named 'a, 'b, 'c, ... in order of appearance.
+func Format(t Type) string {
+	names := map[*Var]string{}
+	var format func(t Type) string
+	format = func(t Type) string {
+		switch t := Prune(t).(type) {
+		case *Var:
+			name, ok := names[t]
+			if !ok {
+				name = varName(len(names))
+				names[t] = name
+			}
+			return name
+		case *Con:
+			switch {
+			case t.Name == arrayName && len(t.Args) == 1:
+				return "[" + format(t.Args[0]) + "]"
+			case t.Name == hashName && len(t.Args) == 2:
+				return "{" + format(t.Args[0]) + ": " + format(t.Args[1]) + "}"
+			case len(t.Args) == 0:
+				return t.Name
+			}
+			args := []string{}
+			for _, a := range t.Args {
+				args = append(args, format(a))
+			}
+			return t.Name + "<" + strings.Join(args, ", ") + ">"
+		case *Func:
+			params := []string{}
+			for _, p := range t.Params {
+				params = append(params, format(p))
+			}
+			return "fn(" + strings.Join(params, ", ") + ") -> " + format(t.Return)
+		}
+		return t.String()
+	}
+	return format(t)
+}
+
+// 'a, 'b, ..., 'z, 'a1, 'b1, ...
+func varName(i int) string {
+	name := "'" + string(rune('a'+i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return name
+}
@@ -0,0 +1,22 @@
+package vm
+
+import (
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/object"
+)
+
+// Frame is the activation record of a call: the closure being executed, the offset
+// of the current instruction and where its locals start on the stack.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,119 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+// Limits bound the resources a run may use (see RunContext). A zero field is no limit.
+type Limits struct {
+	Steps int64 // the instructions executed
+	Depth int   // the nested calls (the frames are limited to MaxFrames anyway)
+	Bytes int64 // an estimate of the size of the values allocated
+}
+
+// The resources checked by RunContext, as reported by LimitError.Limit
+const (
+	LimitSteps   = "steps"
+	LimitDepth   = "depth"
+	LimitBytes   = "bytes"
+	LimitContext = "context" // the context is done
+)
+
+// LimitError is returned by RunContext when a run is aborted: its context is done or
+// it exceeded one of its limits. Unlike a runtime error, it cannot be caught by a try
+// expression.
+type LimitError struct {
+	Limit string
+	Max   int64          // the limit exceeded (0 for LimitContext)
+	Pos   token.Position // of the instruction being executed
+	Err   error          // the error of the context, for LimitContext
+}
+
+func (e *LimitError) Error() string {
+	var msg string
+	if e.Limit == LimitContext {
+		msg = "aborted: " + e.Err.Error()
+	} else {
+		msg = fmt.Sprintf("%s limit exceeded (%d)", e.Limit, e.Max)
+	}
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the error of the context (e.g. context.DeadlineExceeded)
+func (e *LimitError) Unwrap() error { return e.Err }
+
+// contextCheckInterval is the number of instructions (a power of 2) executed between
+// checks of the context
+const contextCheckInterval = 1 << 10
+
+// RunContext executes the program like Run within the limits, and while ctx is not
+// done. A run that is aborted returns a *LimitError.
+func (vm *VM) RunContext(ctx context.Context, limits Limits) error {
+	vm.ctx = ctx
+	vm.limits = limits
+	vm.maxSteps = limits.Steps
+	if vm.maxSteps <= 0 {
+		vm.maxSteps = math.MaxInt64
+	}
+	return vm.Run()
+}
+
+// checkSteps counts an instruction, and checks the step limit and, from time to time,
+// the context
+func (vm *VM) checkSteps() *object.Error {
+	vm.steps++
+	if vm.steps > vm.maxSteps {
+		return vm.exceed(LimitSteps, vm.limits.Steps)
+	}
+	if vm.steps%contextCheckInterval == 0 {
+		return vm.checkContext()
+	}
+	return nil
+}
+
+// checkContext aborts the run if its context is done
+func (vm *VM) checkContext() *object.Error {
+	if vm.ctx == nil {
+		return nil
+	}
+	if err := vm.ctx.Err(); err != nil {
+		vm.abort = &LimitError{Limit: LimitContext, Pos: vm.position(), Err: err}
+		return &object.Error{Message: vm.abort.Error()}
+	}
+	return nil
+}
+
+// checkDepth checks the depth limit before a call
+func (vm *VM) checkDepth() *object.Error {
+	if vm.limits.Depth > 0 && vm.framesIndex > vm.limits.Depth {
+		return vm.exceed(LimitDepth, int64(vm.limits.Depth))
+	}
+	return nil
+}
+
+// alloc counts the allocation of a value of the estimated size, and checks the byte
+// limit
+func (vm *VM) alloc(size int) *object.Error {
+	if vm.limits.Bytes <= 0 {
+		return nil
+	}
+	vm.allocated += int64(size)
+	if vm.allocated > vm.limits.Bytes {
+		return vm.exceed(LimitBytes, vm.limits.Bytes)
+	}
+	return nil
+}
+
+// exceed aborts the run. The returned error unwinds the frames without being handled.
+func (vm *VM) exceed(limit string, max int64) *object.Error {
+	vm.abort = &LimitError{Limit: limit, Max: max, Pos: vm.position()}
+	return &object.Error{Message: vm.abort.Error()}
+}
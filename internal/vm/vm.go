@@ -0,0 +1,847 @@
+// Package vm implements the stack virtual machine executing the bytecode of package
+// compiler.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/code"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/token"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+// There is only ever one null, true and false value
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+// handler is the handler of an active try expression (see OpPushHandler)
+type handler struct {
+	frameIndex int // of the frame executing the try expression
+	sp         int // the stack pointer when the try expression was entered
+	ip         int // offset of the handler
+}
+
+type VM struct {
+	constants []object.Object
+	names     []string
+
+	stack      []object.Object
+	sp         int // Always points to the next free slot. Top of stack is stack[sp-1]
+	lastPopped object.Object
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler
+
+	// the budget of the run (see RunContext)
+	ctx       context.Context
+	limits    Limits
+	maxSteps  int64
+	steps     int64
+	allocated int64
+	abort     *LimitError // set when the run is aborted
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+		names:     bytecode.Names,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+
+		maxSteps: math.MaxInt64,
+	}
+}
+
+// NewWithGlobalsStore returns a VM using s for the values of the globals, so that
+// they survive from one program to the next (in a REPL).
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// RuntimeError is returned by Run for an error, or a thrown value, that was not caught
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Err.Pos.IsValid() {
+		return e.Err.Pos.String() + ": " + e.Err.Message
+	}
+	return e.Err.Message
+}
+
+// LastPoppedStackElem is the value of the last expression statement executed (or of
+// a return statement of the program).
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// Run executes the program. An uncaught error is returned as a *RuntimeError.
+func (vm *VM) Run() error {
+	if err := vm.run(0); err != nil {
+		if vm.abort != nil {
+			return vm.abort
+		}
+		return &RuntimeError{Err: err}
+	}
+	return nil
+}
+
+// run executes instructions until the frame at index depth returns (or, for the
+// program, runs out of instructions). An error that is not caught by a try expression
+// of these frames is returned.
+func (vm *VM) run(depth int) *object.Error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > depth {
+		frame := vm.currentFrame()
+		ins = frame.Instructions()
+		if frame.ip >= len(ins)-1 {
+			// the end of the program (a function ends with OpReturnValue)
+			vm.framesIndex--
+			continue
+		}
+
+		frame.ip++
+		ip = frame.ip
+		op = code.Opcode(ins[ip])
+
+		err := vm.checkSteps()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpMinus:
+			operand := vm.pop()
+			if !object.IsNumber(operand) {
+				err = vm.newError("unknown operator: -%s", operand.Type())
+				break
+			}
+			result := object.Negate(operand)
+			if err = vm.alloc(object.SizeOf(result)); err != nil {
+				break
+			}
+			err = vm.push(result)
+
+		case code.OpBang:
+			err = vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+
+		case code.OpTrue:
+			err = vm.push(True)
+
+		case code.OpFalse:
+			err = vm.push(False)
+
+		case code.OpNull:
+			err = vm.push(Null)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if !isTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			if global := vm.globals[globalIndex]; global != nil {
+				err = vm.push(global)
+			} else {
+				// a function called before the let of a global it refers to
+				err = vm.undefinedGlobal()
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err = vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpCurrentClosure:
+			err = vm.push(frame.cl)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err = vm.callFunction(int(numArgs))
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+
+			err = vm.tailCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			frame := vm.popFrame()
+			if vm.framesIndex == 0 {
+				// a return statement of the program
+				vm.lastPopped = returnValue
+				break
+			}
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(returnValue)
+
+		case code.OpStructDef:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.push(vm.newStructDef(vm.constants[constIndex].(*object.StructDef)))
+
+		case code.OpStruct:
+			obj := vm.pop()
+			def, ok := obj.(*object.StructDef)
+			if !ok {
+				err = vm.newError("not a struct: %s", obj.Type())
+				break
+			}
+			if err = vm.alloc(object.SizeStruct + len(def.Fields)*object.SizeField); err != nil {
+				break
+			}
+			err = vm.push(&object.Struct{Def: def, Fields: map[string]object.Object{}})
+
+		case code.OpInitField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			val := vm.pop()
+			s := vm.stack[vm.sp-1].(*object.Struct)
+			name := vm.names[nameIndex]
+			if !s.Def.HasField(name) {
+				err = vm.newError("unknown field %s in struct %s", name, s.Def.Name)
+				break
+			}
+			s.Fields[name] = val
+
+		case code.OpEndStruct:
+			err = vm.initDefaultFields(vm.stack[vm.sp-1].(*object.Struct))
+
+		case code.OpGetField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.executeGetField(vm.pop(), vm.names[nameIndex])
+
+		case code.OpIndex:
+			index := vm.pop()
+			err = vm.executeIndex(vm.pop(), index)
+
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			err = vm.executeSlice(vm.pop(), low, high)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if err = vm.alloc(object.SizeArray + numElements*object.SizeWord); err != nil {
+				break
+			}
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var hash *object.Hash
+			if hash, err = vm.buildHash(vm.stack[vm.sp-numElements : vm.sp]); err != nil {
+				break
+			}
+			vm.sp = vm.sp - numElements
+			err = vm.push(hash)
+
+		case code.OpMatchVariant:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			numBindings := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			err = vm.executeMatchVariant(vm.pop(), vm.names[nameIndex], int(numBindings))
+
+		case code.OpThrow:
+			val := vm.pop()
+			if thrown, ok := val.(*object.Error); ok {
+				err = thrown // rethrown (as is) by a finally arm, or from a catch arm
+				break
+			}
+			err = vm.newError("uncaught exception: %s", val.Inspect())
+			err.Thrown = val
+
+		case code.OpPushHandler:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			vm.handlers = append(vm.handlers, handler{frameIndex: vm.framesIndex - 1, sp: vm.sp, ip: pos})
+
+		case code.OpPopHandler:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpCaught:
+			if caught := vm.stack[vm.sp-1].(*object.Error); caught.Thrown != nil {
+				vm.stack[vm.sp-1] = caught.Thrown
+			}
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			name := fmt.Sprintf("%d", op)
+			if def != nil {
+				name = def.Name
+			}
+			err = vm.newError("cannot execute opcode %s", name)
+		}
+
+		if err != nil && (vm.abort != nil || !vm.handle(err, depth)) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handle transfers control to the innermost handler of the frames from depth up, with
+// err on top of the stack. It reports false if there is no such handler.
+func (vm *VM) handle(err *object.Error, depth int) bool {
+	n := len(vm.handlers)
+	if n == 0 || vm.handlers[n-1].frameIndex < depth {
+		return false
+	}
+
+	h := vm.handlers[n-1]
+	vm.handlers = vm.handlers[:n-1]
+
+	vm.framesIndex = h.frameIndex + 1
+	vm.sp = h.sp
+	vm.stack[vm.sp] = err
+	vm.sp++
+	vm.currentFrame().ip = h.ip - 1
+	return true
+}
+
+// call calls fn with args from within an instruction, and returns its value. An error
+// that is not caught inside fn is returned, to be handled by the calling instruction.
+func (vm *VM) call(fn object.Object, args []object.Object) (object.Object, *object.Error) {
+	depth, sp := vm.framesIndex, vm.sp
+
+	err := vm.push(fn)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = vm.push(args[i])
+	}
+	if err == nil {
+		err = vm.callFunction(len(args))
+	}
+	if err == nil && vm.framesIndex > depth {
+		err = vm.run(depth)
+	}
+	if err != nil {
+		vm.framesIndex = depth
+		vm.sp = sp
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= StackSize {
+		return vm.newError("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		result, ok := object.FloatInfix(binaryOperators[op], left, right)
+		if !ok {
+			return vm.newError("unknown operator: %s %s %s", leftType, binaryOperators[op], rightType)
+		}
+		if err := vm.alloc(object.SizeOf(result)); err != nil {
+			return err
+		}
+		return vm.push(result)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		result, ok := object.StringInfix(binaryOperators[op], left.(*object.String), right.(*object.String))
+		if !ok {
+			return vm.newError("unknown operator: %s %s %s", leftType, binaryOperators[op], rightType)
+		}
+		if err := vm.alloc(object.SizeOf(result)); err != nil {
+			return err
+		}
+		return vm.push(result)
+	// all other values are compared by identity (true, false and null are singletons)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case leftType != rightType:
+		return vm.newError("type mismatch: %s %s %s", leftType, binaryOperators[op], rightType)
+	default:
+		return vm.newError("unknown operator: %s %s %s", leftType, binaryOperators[op], rightType)
+	}
+}
+
+// buildHash builds the hash of a hash literal from its keys and values
+func (vm *VM) buildHash(elements []object.Object) (*object.Hash, *object.Error) {
+	if err := vm.alloc(object.SizeHash + len(elements)/2*object.SizeEntry); err != nil {
+		return nil, err
+	}
+	hash := object.NewHash()
+	for i := 0; i < len(elements); i += 2 {
+		if !hash.Set(elements[i], elements[i+1]) {
+			return nil, vm.newError("unusable as hash key: %s", elements[i].Type())
+		}
+	}
+	return hash, nil
+}
+
+func (vm *VM) executeIndex(left, index object.Object) *object.Error {
+	result, err := object.Index(left, index)
+	if err != nil {
+		return vm.newError("%s", err)
+	}
+	// only the character of a string is a new value
+	if _, ok := left.(*object.String); ok {
+		if err := vm.alloc(object.SizeOf(result)); err != nil {
+			return err
+		}
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) executeSlice(left, low, high object.Object) *object.Error {
+	result, err := object.Slice(left, low, high)
+	if err != nil {
+		return vm.newError("%s", err)
+	}
+	size := object.SizeOf(result)
+	if a, ok := result.(*object.Array); ok {
+		size = object.SizeArray + len(a.Elements)*object.SizeWord // the elements of left
+	}
+	if err := vm.alloc(size); err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) *object.Error {
+	switch op {
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		result, err := object.IntegerArithmetic(binaryOperators[op], left, right)
+		if err != nil {
+			return vm.newError("%s", err)
+		}
+		if err := vm.alloc(object.SizeOf(result)); err != nil {
+			return err
+		}
+		return vm.push(result)
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0))
+	default:
+		return vm.newError("unknown operator: %s %s %s", left.Type(), binaryOperators[op], right.Type())
+	}
+}
+
+func (vm *VM) callFunction(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+
+	case *object.Constructor:
+		if numArgs != len(callee.Fields) {
+			return vm.newError("wrong number of arguments: want=%d, got=%d",
+				len(callee.Fields), numArgs)
+		}
+		if err := vm.alloc(object.SizeVariant + numArgs*object.SizeWord); err != nil {
+			return err
+		}
+		values := make([]object.Object, numArgs)
+		copy(values, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(&object.Variant{Enum: callee.Enum, Name: callee.Name, Values: values})
+
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+
+	default:
+		return vm.newError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return vm.newError("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	if err := vm.checkDepth(); err != nil {
+		return err
+	}
+	basePointer := vm.sp - numArgs
+	if vm.framesIndex >= MaxFrames || basePointer+cl.Fn.NumLocals >= StackSize {
+		return vm.newError("stack overflow")
+	}
+
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// callBuiltin calls the builtin with the arguments on the stack, and replaces them (and
+// the builtin) with the result. An error is positioned at the call. The projected size
+// of the result is allocated before the call, so that a builtin does not build a value
+// exceeding the byte limit, and the rest of its size after the call.
+func (vm *VM) callBuiltin(b *object.Builtin, numArgs int) *object.Error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	projected := 0
+	if b.Size != nil {
+		projected = b.Size(args...)
+		if err := vm.alloc(projected); err != nil {
+			return err
+		}
+	}
+	result := b.Call(vm.callValue, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case nil:
+		return vm.push(Null)
+	case *object.Error:
+		// a builtin interrupted by the context (e.g. time.sleep) aborts the run
+		if err := vm.checkContext(); err != nil {
+			return err
+		}
+		if !result.Pos.IsValid() {
+			result.Pos = vm.position()
+		}
+		return result
+	default:
+		if size := object.SizeOf(result) - projected; size > 0 {
+			if err := vm.alloc(size); err != nil {
+				return err
+			}
+		}
+		return vm.push(result)
+	}
+}
+
+// callValue is the object.CallFunction of the higher-order builtins
+func (vm *VM) callValue(fn object.Object, args ...object.Object) object.Object {
+	result, err := vm.call(fn, args)
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// tailCall calls the closure on the stack in the frame of the current function, which
+// returns the value of the call. Other callees are called as usual.
+func (vm *VM) tailCall(numArgs int) *object.Error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return vm.callFunction(numArgs)
+	}
+	if numArgs != cl.Fn.NumParameters {
+		return vm.newError("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	// the closure and the arguments replace those of the current function
+	basePointer := vm.currentFrame().basePointer
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return vm.newError("stack overflow")
+	}
+	copy(vm.stack[basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	vm.frames[vm.framesIndex-1] = NewFrame(cl, basePointer)
+	vm.sp = basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) *object.Error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return vm.newError("not a function: %+v", constant)
+	}
+
+	if err := vm.alloc(object.SizeClosure + numFree*object.SizeWord); err != nil {
+		return err
+	}
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+//
+// Records (structs)
+//
+
+// newStructDef builds a struct definition from its template, with the initializers
+// of the fields with a default taken from the stack.
+func (vm *VM) newStructDef(template *object.StructDef) *object.StructDef {
+	def := &object.StructDef{
+		Name:         template.Name,
+		Fields:       template.Fields,
+		Initializers: map[string]*object.Closure{},
+	}
+	for i := len(def.Fields) - 1; i >= 0; i-- {
+		name := def.Fields[i]
+		if _, ok := template.Initializers[name]; ok {
+			def.Initializers[name] = vm.pop().(*object.Closure)
+		}
+	}
+	return def
+}
+
+// initDefaultFields sets the fields a struct literal omits to their defaults
+func (vm *VM) initDefaultFields(s *object.Struct) *object.Error {
+	for _, name := range s.Def.Fields {
+		if _, ok := s.Fields[name]; ok {
+			continue
+		}
+		initializer, ok := s.Def.Initializers[name]
+		if !ok {
+			return vm.newError("missing field %s in %s literal", name, s.Def.Name)
+		}
+		val, err := vm.call(initializer, nil)
+		if err != nil {
+			return err
+		}
+		s.Fields[name] = val
+	}
+	return nil
+}
+
+func (vm *VM) executeGetField(obj object.Object, name string) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Struct:
+		if val, ok := obj.Fields[name]; ok {
+			return vm.push(val)
+		}
+		return vm.newError("no field %s in struct %s", name, obj.Def.Name)
+	case *object.Module:
+		if val, ok := obj.Members[name]; ok {
+			return vm.push(val)
+		}
+		return vm.newError("no member %s in module %s", name, obj.Name)
+	default:
+		return vm.newError("type %s has no field %s", obj.Type(), name)
+	}
+}
+
+//
+// Tagged unions (enums)
+//
+
+// executeMatchVariant pushes false if val is not the variant name. Otherwise it pushes
+// the fields of the variant to bind (none for code.NoBindings) followed by true.
+func (vm *VM) executeMatchVariant(val object.Object, name string, numBindings int) *object.Error {
+	variant, ok := val.(*object.Variant)
+	if !ok || variant.Name != name {
+		return vm.push(False)
+	}
+
+	if numBindings != code.NoBindings {
+		if numBindings != len(variant.Values) {
+			return vm.newError("wrong number of fields in pattern %s: want=%d, got=%d",
+				name, len(variant.Values), numBindings)
+		}
+		for _, v := range variant.Values {
+			if err := vm.push(v); err != nil {
+				return err
+			}
+		}
+	}
+	return vm.push(True)
+}
+
+//
+// Helpers
+//
+
+// newError returns an error positioned at the source of the current instruction
+func (vm *VM) newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{
+		Message: fmt.Sprintf(format, a...),
+		Pos:     vm.position(),
+	}
+}
+
+// undefinedGlobal is the error of reading a global whose let has not been executed
+func (vm *VM) undefinedGlobal() *object.Error {
+	frame := vm.currentFrame()
+	if ident, ok := frame.cl.Fn.SourceMap.LookupNode(frame.ip).(*ast.Identifier); ok {
+		return vm.newError("identifier not found: %s", ident.Value)
+	}
+	return vm.newError("identifier not found")
+}
+
+// position returns the position of the source of the current instruction
+func (vm *VM) position() token.Position {
+	frame := vm.currentFrame()
+	return frame.cl.Fn.SourceMap.Lookup(frame.ip)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// null and false are falsy, everything else is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,663 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/evaluator"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/object"
+	"github.com/maxild/monkey/internal/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"-7 / 2", -3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"1 == true", false},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (true) { }", Null},
+		{"if (true) { let x = 5; }", Null},
+		{"if (true) { let x = 5; x }", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"let f = fn(x) { return x; x + 10; }; f(10);", 10},
+		{"let f = fn(x) { let result = x + 10; return result; return 10; }; f(10);", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let noReturn = fn() { let x = 1; }; noReturn();", Null},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let globalNum = 10; let sum = fn(a, b) { let c = a + b; c + globalNum; }; sum(1, 2) + globalNum;", 23},
+		{"fn(x) { x; }(5)", 5},
+		{"let add = fn(a: int, b: int): int { a + b }; add(1, 2)", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let newClosure = fn(a) { fn() { a; }; };
+			 let closure = newClosure(99);
+			 closure();`,
+			99,
+		},
+		{
+			`let newAdder = fn(a, b) { fn(c) { a + b + c }; };
+			 let adder = newAdder(1, 2);
+			 adder(8);`,
+			11,
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+			   let c = a + b;
+			   fn(d) {
+			     let e = d + c;
+			     fn(f) { e + f; };
+			   };
+			 };
+			 let newAdderInner = newAdderOuter(1, 2)
+			 let adder = newAdderInner(3);
+			 adder(8);`,
+			14,
+		},
+		{
+			`let a = 1;
+			 let newAdderOuter = fn(b) {
+			   fn(c) {
+			     fn(d) { a + b + c + d };
+			   };
+			 };
+			 let newAdderInner = newAdderOuter(2)
+			 let adder = newAdderInner(3);
+			 adder(8);`,
+			14,
+		},
+		{
+			`let newClosure = fn(a, b) {
+			   let one = fn() { a; };
+			   let two = fn() { b; };
+			   fn() { one() + two(); };
+			 };
+			 let closure = newClosure(9, 90);
+			 closure();`,
+			99,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			 countDown(1);`,
+			0,
+		},
+		{
+			`let wrapper = fn() {
+			   let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			   countDown(1);
+			 };
+			 wrapper();`,
+			0,
+		},
+		{
+			`let fibonacci = fn(x) {
+			   if (x == 0) { return 0; }
+			   if (x == 1) { return 1; }
+			   fibonacci(x - 1) + fibonacci(x - 2);
+			 };
+			 fibonacci(15);`,
+			610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// A function can refer to a global defined after it, as in the evaluator. The top-level
+// code cannot, and neither can a function called before the let of the global.
+func TestForwardGlobals(t *testing.T) {
+	tests := []string{
+		`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+		 let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+		 [even(10), odd(7), even(3)]`,
+		"let f = fn() { x * 2 }; let x = 21; f()",
+		"let f = fn() { fn() { x } }; let g = f(); let x = 1; g()",
+		"let f = fn() { g() }; f(); let g = fn() { 1 };",
+		"let f = fn() { x }; let x = 1; let x = x + f(); x",
+	}
+
+	for _, input := range tests {
+		want := evaluator.Eval(parse(t, input), object.NewEnvironment()).Inspect()
+
+		comp := compiler.New()
+		if err := comp.Compile(parse(t, input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", input, err)
+		}
+		vm := New(comp.Bytecode())
+		var got string
+		if err := vm.Run(); err != nil {
+			got = "ERROR: " + err.Error()
+		} else {
+			got = vm.LastPoppedStackElem().Inspect()
+		}
+
+		if got != want {
+			t.Errorf("%q: the evaluator and the vm differ. want=%s, got=%s", input, want, got)
+		}
+	}
+}
+
+// mutually recursive globals
+const evenOdd = `let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+`
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		// a million levels of recursion run in constant stack space
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)", 1000000},
+		{"let count = fn(n, acc) { if (n == 0) { return acc; } return count(n - 1, acc + 1); }; count(1000000, 0)", 1000000},
+		{evenOdd + "even(1000000)", true},
+		{evenOdd + "odd(1000000)", false},
+		{
+			`let even = fn(n, odd) { if (n == 0) { true } else { odd(n - 1, even) } };
+			 let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1, odd) } };
+			 even(1000000, odd)`,
+			true,
+		},
+		{"enum L { Cons(h, t), Nil }; let len = fn(l, acc) { if (let Cons(h, t) = l) { len(t, acc + 1) } else { acc } }; len(Cons(1, Cons(2, Nil)), 0)", 2},
+		// the callee has more locals than the caller
+		{"let g = fn(a) { let b = a * 2; let c = b + 1; c }; let f = fn() { g(3) }; f() + 1", 8},
+		// tail calls of constructors, and in the initializer of a default
+		{"enum S { C(r) }; let f = fn() { C(5) }; if (let C(r) = f()) { r }", 5},
+		{"let g = fn(n) { n * 2 }; struct P { x = g(4) }; P{}.x", 8},
+		// the handler of the try expression stays active during the call
+		{"let g = fn() { throw 1; }; let f = fn() { try { return g(); } catch (e) { e + 10 } }; f()", 11},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + p.y", 3},
+		{"struct Point { x, y = 10 }; Point{x: 1}.y", 10},
+		{"struct Point { x, y = 10 }; Point{x: 1, y: 2}.y", 2},
+		{"struct Line { from, to }; struct P { x }; Line{from: P{x: 1}, to: P{x: 5}}.to.x", 5},
+		{"struct Box { f }; let b = Box{f: fn(x) { x * 2 }}; b.f(21)", 42},
+		{"let d = 3; struct P { x = d * 2 }; P{}.x", 6},
+		{"let mk = fn(d) { struct P { x = d + 1 }; P{} }; mk(4).x + mk(10).x", 16},
+		{"struct P { x }; let p = P{x: 1}; p == p", true},
+		{"struct P { x }; P{x: 1} == P{x: 1}", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEnums(t *testing.T) {
+	shape := `
+enum Shape { Circle(r), Rect(w, h), Empty }
+let area = fn(s) {
+  if (let Circle(r) = s) {
+    3 * r * r
+  } else if (let Rect(w, h) = s) {
+    w * h
+  } else {
+    0
+  }
+};
+`
+	tests := []vmTestCase{
+		{shape + "area(Circle(2))", 12},
+		{shape + "area(Rect(2, 3))", 6},
+		{shape + "area(Empty)", 0},
+		{shape + "if (let Rect(_, h) = Rect(1, 7)) { h }", 7},
+		{shape + "if (let Rect = Rect(1, 7)) { 1 } else { 2 }", 1},
+		{shape + "if (let Circle(r) = Rect(1, 7)) { r }", Null},
+		{shape + "if (let Circle(r) = 5) { r } else { 2 }", 2},
+		{shape + "Empty == Empty", true},
+		{shape + "let r = 1; if (let Circle(r) = Circle(5)) { r }; r", 1},
+		{shape + "let f = fn(s) { if (let Circle(r) = s) { fn() { r * 2 } } }; f(Circle(4))()", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 5; 1 } catch (e) { e * 2 }", 10},
+		{"try { 1 + true } catch (e) { 2 }", 2},
+		{"let x = try { throw 3; } catch (e) { e }; x + 1", 4},
+		// unwinds through calls
+		{"let f = fn(n) { if (n == 0) { throw 42; } f(n - 1) + 1 }; try { f(10) } catch (e) { e }", 42},
+		{"let g = fn() { throw 1; 2 }; let h = fn() { g() + 10 }; try { h() } catch (e) { e + 100 }", 101},
+		{"let f = fn() { try { throw 1; } catch (e) { e } }; 10 + f()", 11},
+		// nested, rethrow
+		{"try { try { throw 1; } catch (e) { throw e + 1; } } catch (e) { e + 1 }", 3},
+		{"try { try { throw 1; } finally { 5 } } catch (e) { e }", 1},
+		// the value of finally is discarded
+		{"try { 1 } finally { 2 }", 1},
+		{"try { throw 1; } catch (e) { 2 } finally { 3 }", 2},
+		// return through finally
+		{"let f = fn() { try { return 1; } finally { 2 } }; f()", 1},
+		{"let f = fn() { try { return 1; } finally { return 2; } }; f()", 2},
+		{"let f = fn() { try { throw 1; } finally { return 2; } }; f()", 2},
+		{"let f = fn() { try { throw 1; } catch (e) { return e + 10; } 99 }; f()", 11},
+		{"let f = fn() { try { 1 } catch (e) { 2 } }; f()", 1},
+		{"let f = fn() { try { try { return 1; } finally { 2 } } catch (e) { 3 } }; f()", 1},
+		// a handler left by a return does not catch later errors
+		{"let f = fn() { try { return 1; } catch (e) { 2 } }; try { f(); throw 3; } catch (e) { e * 10 }", 30},
+		// thrown from a default initializer
+		{"struct P { x = fn() { throw 7; }() }; try { P{} } catch (e) { e }", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFinallyAlwaysRuns(t *testing.T) {
+	input := `
+let run = fn(k, mode) {
+  try {
+    if (mode == 0) { return k; }
+    if (mode == 1) { throw k; }
+    k
+  } finally {
+    throw 100 + k;
+  }
+};
+`
+	// the throw in finally replaces normal completion, return and throw
+	for mode := 0; mode < 3; mode++ {
+		runVmTests(t, []vmTestCase{
+			{input + fmt.Sprintf("try { run(7, %d) } catch (e) { e }", mode), 107},
+		})
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"true + false;", "1:6: unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "1:20: unknown operator: BOOLEAN + BOOLEAN"},
+		{"1 / 0", "1:3: division by zero"},
+		{"let x = 5; x(1)", "1:13: not a function: INTEGER"},
+		{"let f = fn(a, b) { a }; f(1)", "1:26: wrong number of arguments: want=2, got=1"},
+		{"let f = fn(x) { x + true }; f(1)", "1:19: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() { throw 5; }; f(); 10", "1:16: uncaught exception: 5"},
+		{"struct P { x }; P{y: 1}", "1:19: unknown field y in struct P"},
+		{"struct P { x, y }; P{x: 1}", "1:20: missing field y in P literal"},
+		{"struct P { x }; P{x: 1}.y", "1:25: no field y in struct P"},
+		{"let n = 1; n.x", "1:14: type %s has no field x"},
+		{"let P = 1; P{x: 1}", "1:12: not a struct: INTEGER"},
+		{"enum E { A(x) }; A(1, 2)", "1:19: wrong number of arguments: want=1, got=2"},
+		{"enum E { A(x, y) }; if (let A(x) = A(1, 2)) { x }", "1:29: wrong number of fields in pattern A: want=2, got=1"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "1:27: stack overflow"},
+		{"let g = fn(a) { a }; let f = fn() { g(1, 2) }; f()", "1:38: wrong number of arguments: want=1, got=2"},
+		{`"a" - "b"`, "1:5: unknown operator: STRING - STRING"},
+		{`"a" + 1`, "1:5: type mismatch: STRING + INTEGER"},
+		{`"héllo"[5]`, "1:9: index out of range: 5 with length 5"},
+		{`"abc"[-1]`, "1:6: index out of range: -1 with length 3"},
+		{`"abc"[true]`, "1:6: index must be INTEGER, got BOOLEAN"},
+		{`"abc"[2:1]`, "1:6: slice bounds out of range: [2:1] with length 3"},
+		{`"abc"[:4]`, "1:6: slice bounds out of range: [:4] with length 3"},
+		{`5[0]`, "1:2: index operator not supported: INTEGER"},
+		{`[1, 2][2]`, "1:7: index out of range: 2 with length 2"},
+		{`[1, 2][-1]`, "1:7: index out of range: -1 with length 2"},
+		{`[1, 2][1:3]`, "1:7: slice bounds out of range: [1:3] with length 2"},
+		{`[1, true + 1]`, "1:10: type mismatch: BOOLEAN + INTEGER"},
+		{`{[1]: 2}`, "1:1: unusable as hash key: ARRAY"},
+		{`{"a": 1}[[]]`, "1:9: unusable as hash key: ARRAY"},
+		{`1.5 + "a"`, "1:5: type mismatch: FLOAT + STRING"},
+		{`{1.5: 1}`, "1:1: unusable as hash key: FLOAT"},
+		{`/a/ + 1`, "1:5: type mismatch: REGEX + INTEGER"},
+		{`{/a/: 1}`, "1:1: unusable as hash key: REGEX"},
+	}
+
+	for _, tt := range tests {
+		expected := tt.expected
+		if expected == "1:14: type %s has no field x" {
+			expected = fmt.Sprintf(expected, object.INTEGER_OBJ)
+		}
+
+		program := parse(t, tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q but resulted in none.", tt.input)
+			continue
+		}
+		if err.Error() != expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", expected, err)
+		}
+	}
+}
+
+func TestUncaughtException(t *testing.T) {
+	program := parse(t, "throw 5;")
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+	if err := testIntegerObject(5, rerr.Err.Thrown); err != nil {
+		t.Errorf("wrong thrown value: %s", err)
+	}
+}
+
+func TestCaughtRuntimeError(t *testing.T) {
+	program := parse(t, "try { 1 / 0 } catch (e) { e }")
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := vm.LastPoppedStackElem().Inspect(); got != "ERROR: 1:9: division by zero" {
+		t.Errorf("wrong caught error. got=%q", got)
+	}
+}
+
+// The evaluator and the VM agree on the values of programs
+func TestInspectedValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y = 0 }; Point{x: 1}", "Point{x: 1, y: 0}"},
+		{"enum Shape { Rect(w, h) }; Rect(2, 3)", "Rect(2, 3)"},
+		{"enum Shape { Empty }; Empty", "Empty"},
+		// integers are promoted to big integers on overflow
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"4294967296 * 4294967296 == 18446744073709551616", "true"},
+		{"100000000000000000000 / 3 > 100000000000000000000 / 4", "true"},
+		{"(9223372036854775807 + 1) - 1 == 9223372036854775807", "true"},
+		{"let factorial = fn(n) { if (n == 0) { 1 } else { n * factorial(n - 1) } }; factorial(50)",
+			"30414093201713378043612608166064768844377641568960512000000000000"},
+		// strings, indexed and sliced by runes
+		{`"mon" + "key"`, "monkey"},
+		{`"a\tb\n\"c\"\\"`, "a\tb\n\"c\"\\"},
+		{`"abc" == "ab" + "c"`, "true"},
+		{`"abc" != "abc"`, "false"},
+		{`"abc" < "abd"`, "true"},
+		{`"b" > "abc"`, "true"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[1:4]`, "éll"},
+		{`"héllo"[:2]`, "hé"},
+		{`"héllo"[3:]`, "lo"},
+		{`"héllo"[:]`, "héllo"},
+		{`"日本語"[2:3]`, "語"},
+		{`let s = "abc"; let i = 1; s[i + 1]`, "c"},
+		{`"abc"[3:3]`, ""},
+		// arrays
+		{`[]`, "[]"},
+		{`[1, 2 * 3, "x", [true]]`, "[1, 6, x, [true]]"},
+		{`let a = [1, 2, 3]; a[0] + a[2]`, "4"},
+		{`[[1, 2], [3]][0][1]`, "2"},
+		{`let a = [1, 2, 3, 4]; [a[1:3], a[:1], a[3:], a[:]]`, "[[2, 3], [1], [4], [1, 2, 3, 4]]"},
+		{`let f = fn(x) { [x, x + 1] }; f(1)`, "[1, 2]"},
+		// hashes
+		{`{}`, "{}"},
+		{`{"b": 1, "a": 2, "b": 3}`, "{b: 3, a: 2}"},
+		{`let k = "x"; {k: 1, 1 + 1: [2], true: {}}`, "{x: 1, 2: [2], true: {}}"},
+		{`let h = {"a": {"b": 5}}; h["a"]["b"]`, "5"},
+		{`{1: "one"}[2]`, "null"},
+		// floats, and integers converted to floats
+		{`1.5`, "1.5"},
+		{`-2.5e3`, "-2500.0"},
+		{`0.1 + 0.2`, "0.30000000000000004"},
+		{`3.0 * 2`, "6.0"},
+		{`7 / 2`, "3"},
+		{`7 / 2.0`, "3.5"},
+		{`1 - 0.5`, "0.5"},
+		{`1.0 / 0`, "inf"},
+		{`0.0 / 0`, "nan"},
+		{`1 == 1.0`, "true"},
+		{`1 < 1.5`, "true"},
+		{`2.5 > 3`, "false"},
+		{`let f = fn(x) { x * 2 }; [f(1), f(1.5)]`, "[2, 3.0]"},
+		// regexes, and the division
+		{`/a\/b+/iU`, "/a\\/b+/iU"},
+		{`let a = 8; let b = 2; [a / b / 2, /x/]`, "[2, /x/]"},
+		{`let f = fn() { /\d/ }; f() == f()`, "true"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// A builtin with a projected size over the byte limit is not called
+func TestBuiltinSize(t *testing.T) {
+	called := false
+	big := &object.Builtin{
+		Name: "big",
+		Fn: func(args ...object.Object) object.Object {
+			called = true
+			return &object.String{}
+		},
+		Size: func(args ...object.Object) int { return 1 << 40 },
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.Define("big")
+	comp := compiler.NewWithState(symbolTable, nil, nil)
+	if err := comp.Compile(parse(t, "let s = \"abc\"; big(s)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	globals := make([]object.Object, GlobalsSize)
+	globals[0] = big
+
+	err := NewWithGlobalsStore(comp.Bytecode(), globals).RunContext(context.Background(), Limits{Bytes: 1 << 20})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || err.Error() != "1:19: bytes limit exceeded (1048576)" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if called {
+		t.Errorf("the builtin was called")
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	var err error
+	switch expected := expected.(type) {
+	case int:
+		err = testIntegerObject(int64(expected), actual)
+	case bool:
+		err = testBooleanObject(expected, actual)
+	case *object.Null:
+		if actual != Null {
+			err = fmt.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	}
+	if err != nil {
+		t.Errorf("%q: %s", input, err)
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package monkey
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var updateAPI = flag.Bool("update-api", false, "update testdata/api.txt with the current API")
+
+// TestAPI fails when the exported API of the package changes. A compatible change
+// (an addition) is accepted by updating testdata/api.txt with go test -update-api.
+func TestAPI(t *testing.T) {
+	api := exportedAPI(t)
+	golden := filepath.Join("testdata", "api.txt")
+
+	if *updateAPI {
+		if err := ioutil.WriteFile(golden, []byte(strings.Join(api, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	current := map[string]bool{}
+	for _, decl := range api {
+		current[decl] = true
+	}
+	for _, decl := range expected {
+		if !current[decl] {
+			t.Errorf("removed or changed: %s", decl)
+		}
+		delete(current, decl)
+	}
+	for _, decl := range api {
+		if current[decl] {
+			t.Errorf("added (run go test -update-api if it is intended): %s", decl)
+		}
+	}
+}
+
+// exportedAPI returns the exported declarations of the package, one per line: the
+// functions and methods, the fields of the structs, and the constants and variables
+func exportedAPI(t *testing.T) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var api []string
+	print := func(node interface{}) string {
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, fset, node); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+
+	for _, file := range pkgs["monkey"].Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if !decl.Name.IsExported() {
+					continue
+				}
+				recv := ""
+				if decl.Recv != nil {
+					typ := decl.Recv.List[0].Type
+					if star, ok := typ.(*ast.StarExpr); ok {
+						typ = star.X
+					}
+					if !typ.(*ast.Ident).IsExported() {
+						continue
+					}
+					recv = "(" + print(decl.Recv.List[0].Type) + ") "
+				}
+				api = append(api, "func "+recv+decl.Name.Name+strings.TrimPrefix(print(decl.Type), "func"))
+
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if !spec.Name.IsExported() {
+							continue
+						}
+						st, ok := spec.Type.(*ast.StructType)
+						if !ok {
+							api = append(api, "type "+spec.Name.Name+" "+print(spec.Type))
+							continue
+						}
+						api = append(api, "type "+spec.Name.Name+" struct")
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								if name.IsExported() {
+									api = append(api, "type "+spec.Name.Name+" struct, "+name.Name+" "+print(field.Type))
+								}
+							}
+						}
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if name.IsExported() {
+								api = append(api, decl.Tok.String()+" "+name.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	sort.Strings(api)
+	return api
+}
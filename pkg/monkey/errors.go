@@ -0,0 +1,54 @@
+package monkey
+
+import (
+	"fmt"
+
+	"github.com/maxild/monkey/internal/vm"
+)
+
+// RuntimeError is an error of a program, or a value it threw, that it did not catch
+type RuntimeError struct {
+	Pos     Position
+	Message string
+	Thrown  Value // the value thrown by a throw statement (null for other errors)
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+// The resources checked by a run, as reported by LimitError.Limit
+const (
+	LimitSteps   = vm.LimitSteps
+	LimitDepth   = vm.LimitDepth
+	LimitBytes   = vm.LimitBytes
+	LimitContext = vm.LimitContext // the context of the run is done
+)
+
+// LimitError is the error of a run that is aborted, because its context is done or it
+// exceeded one of its limits. Unlike a RuntimeError, it cannot be caught by the program.
+type LimitError struct {
+	Limit string
+	Max   int64    // the limit exceeded (0 for LimitContext)
+	Pos   Position // of the instruction being executed
+	Err   error    // the error of the context, for LimitContext
+}
+
+func (e *LimitError) Error() string {
+	var msg string
+	if e.Limit == LimitContext {
+		msg = "aborted: " + e.Err.Error()
+	} else {
+		msg = fmt.Sprintf("%s limit exceeded (%d)", e.Limit, e.Max)
+	}
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + msg
+	}
+	return msg
+}
+
+// Unwrap returns the error of the context (e.g. context.DeadlineExceeded)
+func (e *LimitError) Unwrap() error { return e.Err }
@@ -0,0 +1,140 @@
+package monkey_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/maxild/monkey/pkg/monkey"
+)
+
+func Example() {
+	program, diags := monkey.Parse(`
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+print(fib(10));
+fib(20)
+`)
+	if len(diags) > 0 {
+		fmt.Println(diags)
+		return
+	}
+
+	value, err := monkey.Run(context.Background(), program, monkey.Options{
+		Capabilities: []string{"io.stdout"},
+		Stdout:       os.Stdout,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(value)
+	// Output:
+	// 55
+	// 6765
+}
+
+func ExampleParse() {
+	_, diags := monkey.Parse("let x 5;")
+	for _, d := range diags {
+		fmt.Println(d)
+	}
+	// Output:
+	// 1:7: expected next token to be =, got INT instead.
+	// 1:8: No prefix parse function for ; found.
+}
+
+func ExampleOptions_functions() {
+	program, _ := monkey.Parse(`status(404)`)
+	value, err := monkey.Run(context.Background(), program, monkey.Options{
+		Functions: map[string]interface{}{
+			"status": func(code int) (string, error) {
+				if code == 404 {
+					return "Not Found", nil
+				}
+				return "", fmt.Errorf("unknown status %d", code)
+			},
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var status string
+	if err := value.Decode(&status); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(status)
+	// Output:
+	// Not Found
+}
+
+func ExampleLimitError() {
+	program, _ := monkey.Parse(`let loop = fn(n) { loop(n + 1) }; loop(0)`)
+	_, err := monkey.Run(context.Background(), program, monkey.Options{
+		Limits: monkey.Limits{Steps: 1000},
+	})
+
+	var limitErr *monkey.LimitError
+	if errors.As(err, &limitErr) {
+		fmt.Println("aborted:", limitErr.Limit)
+	}
+	// Output:
+	// aborted: steps
+}
+
+func ExampleCompiled_Run() {
+	program, _ := monkey.Parse(`time.now() / 1000`)
+	compiled, err := monkey.Compile(program, monkey.Options{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// the clock is not granted
+	_, err = compiled.Run(context.Background())
+	fmt.Println(err)
+	// Output:
+	// 1:9: permission denied: time.now requires the capability clock
+}
+
+func ExampleOptions_replay() {
+	program, _ := monkey.Parse(`random.shuffle(range(8))`)
+	opts := monkey.Options{Capabilities: []string{"random"}}
+
+	// record the random integers of a run
+	recording := &monkey.Recording{}
+	opts.Record = recording
+	first, _ := monkey.Run(context.Background(), program, opts)
+
+	// and feed them back to another run, which then gets the same result
+	opts.Record = nil
+	opts.Replay = &monkey.Recording{Events: recording.Events}
+	again, _ := monkey.Run(context.Background(), program, opts)
+	fmt.Println(len(recording.Events), first.String() == again.String())
+	// Output:
+	// 7 true
+}
+
+func ExampleOptions_fs() {
+	program, _ := monkey.Parse(`
+let names = map(fs.list("notes"), fn(name) { "notes/" + name });
+fs.write("out/all.txt", strings.join(map(names, fs.read), "\n"));
+len(names)`)
+	opts := monkey.Options{
+		Capabilities: []string{"fs.read:/notes", "fs.write:/out"},
+		FS:           monkey.MemFS(map[string]string{"notes/a.txt": "a", "notes/b.txt": "b", "out/": ""}),
+	}
+	result, err := monkey.Run(context.Background(), program, opts)
+	fmt.Println(result, err)
+
+	// out is written, but not readable, by the program
+	program, _ = monkey.Parse(`fs.read("out/all.txt")`)
+	_, err = monkey.Run(context.Background(), program, opts)
+	fmt.Println(err)
+	// Output:
+	// 2 <nil>
+	// 1:8: permission denied: fs.read requires the capability fs.read for /out/all.txt
+}
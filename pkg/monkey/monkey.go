@@ -0,0 +1,254 @@
+// Package monkey is the API for embedding Monkey in Go programs. It parses, compiles and
+// runs Monkey programs on the virtual machine, within limits and with the capabilities
+// granted by the host, and converts values between Monkey and Go.
+//
+//	program, diags := monkey.Parse(src)
+//	if len(diags) > 0 { ... }
+//	value, err := monkey.Run(ctx, program, monkey.Options{
+//		Limits:       monkey.Limits{Steps: 1e6},
+//		Capabilities: []string{"io.stdout"},
+//		Stdout:       os.Stdout,
+//	})
+//
+// The exported API of this package is stable: it only changes in compatible ways.
+package monkey
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/maxild/monkey/internal/ast"
+	"github.com/maxild/monkey/internal/checker"
+	"github.com/maxild/monkey/internal/compiler"
+	"github.com/maxild/monkey/internal/interp"
+	"github.com/maxild/monkey/internal/lexer"
+	"github.com/maxild/monkey/internal/parser"
+	"github.com/maxild/monkey/internal/stdlib"
+	"github.com/maxild/monkey/internal/token"
+	"github.com/maxild/monkey/internal/vm"
+)
+
+// Position is a position in the source of a program. Lines and columns start at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	return token.Position{Line: p.Line, Column: p.Column}.String()
+}
+
+func position(pos token.Position) Position {
+	return Position{Line: pos.Line, Column: pos.Column}
+}
+
+// Diagnostic is an error of a program found before it runs: a syntax error, an error
+// found by the checks of Parse (like an unknown field), or an error found by the
+// compiler (like an undefined name)
+type Diagnostic struct {
+	Pos     Position
+	Message string
+}
+
+func (d Diagnostic) Error() string {
+	if d.Pos.IsValid() {
+		return d.Pos.String() + ": " + d.Message
+	}
+	return d.Message
+}
+
+// Program is a parsed program
+type Program struct {
+	program *ast.Program
+}
+
+// String returns the source of the program, as printed from its syntax tree
+func (p *Program) String() string {
+	return p.program.String()
+}
+
+// Parse parses the source of a program, and checks the declarations and the uses of
+// its structs and enums (e.g. a missing field in a struct literal). The program is nil
+// if there are diagnostics.
+func Parse(src string) (*Program, []Diagnostic) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.SyntaxErrors(); len(errs) > 0 {
+		diags := make([]Diagnostic, len(errs))
+		for i, err := range errs {
+			diags[i] = Diagnostic{Pos: position(err.Pos), Message: err.Message}
+		}
+		return nil, diags
+	}
+
+	var diags []Diagnostic
+	for _, d := range checker.Check(program) {
+		if d.Severity == checker.Error {
+			diags = append(diags, Diagnostic{Pos: position(d.Pos), Message: d.Msg})
+		}
+	}
+	if len(diags) > 0 {
+		return nil, diags
+	}
+	return &Program{program: program}, nil
+}
+
+// Limits bound the resources used by a run. A zero field is no limit.
+type Limits struct {
+	Steps int64 // the instructions executed
+	Depth int   // the nested calls
+	Bytes int64 // an estimate of the size of the values allocated
+}
+
+// Options configure the compilation and the runs of a program
+type Options struct {
+	Limits Limits
+
+	// Capabilities are granted to the builtins, e.g. "io.stdout", "clock" or
+	// "random". A builtin called without the capability it requires fails with a
+	// permission error.
+	Capabilities []string
+	Stdout       io.Writer // written by print (nil to discard the output)
+	Clock        Clock     // of the time module (nil for the system clock)
+	Rand         Rand      // of the random module (nil for the global source of math/rand)
+	FS           FS        // the root of the fs module (nil for no file system)
+
+	// Record, if not nil, records the values the runs get from the clock and the
+	// random source. Replay, if not nil, feeds the recorded values back to the runs
+	// instead of using the sources, so that a failing run can be reproduced exactly:
+	// a replayed run that diverges from the recording fails with a RuntimeError.
+	Record *Recording
+	Replay *Recording
+
+	// Functions are bound by name in the global scope of the program. Each is a Go
+	// function whose arguments and results are converted like by FromGo and
+	// Value.Decode, and which may return an error as its last result.
+	Functions map[string]interface{}
+}
+
+// Clock is the clock of the time module. Sleep waits for d, or until ctx (the context
+// of the run) is done, when it returns the error of ctx and the run is aborted.
+type Clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Rand is the source of the random module. A *rand.Rand with a fixed seed,
+// rand.New(rand.NewSource(seed)), gives the same values in every run; it is not safe
+// for concurrent runs.
+type Rand interface {
+	// Int63n returns a random integer in [0, n), for n > 0
+	Int63n(n int64) int64
+}
+
+// FS is the file system of the fs module, whose functions read and write the files
+// below its root, with the capabilities fs.read and fs.write (e.g. "fs.write:/out"
+// for the directory out of the root). Its names are slash-separated paths relative to
+// the root, cleaned and without .. elements, where "." is the root.
+//
+// FS has the shape of io/fs.FS, with a WriteFile; an io/fs file system is adapted
+// with a few lines.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	ReadDir(name string) ([]os.FileInfo, error) // sorted by name
+	Stat(name string) (os.FileInfo, error)
+}
+
+// DirFS returns the file system of the directory root. A path resolving, through
+// symbolic links, outside of the root fails.
+func DirFS(root string) (FS, error) {
+	return stdlib.DirFS(root)
+}
+
+// MemFS returns a file system in memory with the files, by their slash-separated path,
+// for tests. A path ending with a slash is an empty directory.
+func MemFS(files map[string]string) FS {
+	return stdlib.NewMemFS(files)
+}
+
+// Recording is the log of the values the runs of a program got from the clock and the
+// random source, in order (see Options.Record). Its events can be saved, e.g. as JSON,
+// to replay them in another process. A replay consumes the recording: to replay it
+// again, replay a new Recording with the same events.
+type Recording = stdlib.Recording
+
+// Event is a value of a Recording
+type Event = stdlib.Event
+
+// Compiled is a compiled program. It can be run several times, also concurrently.
+type Compiled struct {
+	program *interp.Program
+}
+
+// Compile compiles the program for the options. An error of the program is returned
+// as a Diagnostic.
+func Compile(program *Program, opts Options) (*Compiled, error) {
+	it := interp.New(interp.Config{
+		Limits:       interp.Limits(opts.Limits),
+		Capabilities: opts.Capabilities,
+		Stdout:       opts.Stdout,
+		Clock:        opts.Clock,
+		Rand:         opts.Rand,
+		FS:           opts.FS,
+		Record:       opts.Record,
+		Replay:       opts.Replay,
+	})
+	for name, fn := range opts.Functions {
+		if err := it.Register(name, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	compiled, err := it.Compile(program.program)
+	if err != nil {
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			return nil, Diagnostic{Pos: position(compileErr.Pos), Message: compileErr.Message}
+		}
+		return nil, err
+	}
+	return &Compiled{program: compiled}, nil
+}
+
+// Run runs the program while ctx is not done, and returns its value: the value of its
+// last expression statement (or of its return statement). An error of the program
+// that is not caught is returned as a *RuntimeError, and a run that is aborted as a
+// *LimitError.
+func (c *Compiled) Run(ctx context.Context) (Value, error) {
+	result, err := c.program.Run(ctx)
+	if err != nil {
+		return Value{}, runError(err)
+	}
+	return Value{obj: result}, nil
+}
+
+// Run compiles and runs the program (see Compile and Compiled.Run)
+func Run(ctx context.Context, program *Program, opts Options) (Value, error) {
+	compiled, err := Compile(program, opts)
+	if err != nil {
+		return Value{}, err
+	}
+	return compiled.Run(ctx)
+}
+
+// runError converts an error of the virtual machine
+func runError(err error) error {
+	switch err := err.(type) {
+	case *vm.RuntimeError:
+		runtimeErr := &RuntimeError{Pos: position(err.Err.Pos), Message: err.Err.Message}
+		if err.Err.Thrown != nil {
+			runtimeErr.Thrown = Value{obj: err.Err.Thrown}
+		}
+		return runtimeErr
+	case *vm.LimitError:
+		return &LimitError{Limit: err.Limit, Max: err.Max, Pos: position(err.Pos), Err: err.Err}
+	}
+	return err
+}
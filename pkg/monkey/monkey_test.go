@@ -0,0 +1,188 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	program, diags := Parse("let x = 1;\nlet = 2;")
+	if program != nil {
+		t.Errorf("expected no program")
+	}
+	if len(diags) == 0 {
+		t.Fatalf("expected diagnostics")
+	}
+	if diags[0].Pos != (Position{Line: 2, Column: 5}) {
+		t.Errorf("wrong position. got=%s", diags[0].Pos)
+	}
+	if diags[0].Error() != "2:5: expected next token to be IDENT, got = instead." {
+		t.Errorf("wrong diagnostic. got=%q", diags[0].Error())
+	}
+
+	program, diags = Parse("let x = 1; x")
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if program.String() != "let x = 1;x" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+
+	// the errors of the struct literals are found before the program runs
+	program, diags = Parse("struct P { x, y }\nP{x: 1, z: 2, x: 3}")
+	if program != nil {
+		t.Errorf("expected no program")
+	}
+	expected := []string{
+		"2:9: unknown field z in struct P",
+		"2:15: duplicate field x in P literal",
+		"2:1: missing field y in P literal",
+	}
+	actual := []string{}
+	for _, d := range diags {
+		actual = append(actual, d.Error())
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong diagnostics. want=%q, got=%q", expected, actual)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	program := parse(t, "let x = 1;\nx + y")
+	_, err := Compile(program, Options{})
+	diag, ok := err.(Diagnostic)
+	if !ok {
+		t.Fatalf("expected a Diagnostic. got=%#v", err)
+	}
+	if diag.Pos != (Position{Line: 2, Column: 5}) || diag.Message != "identifier not found: y" {
+		t.Errorf("wrong diagnostic. got=%s", diag)
+	}
+
+	// the functions are bound in the global scope
+	compiled, err := Compile(parse(t, "x() + 1"), Options{Functions: map[string]interface{}{"x": func() int { return 2 }}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		value, err := compiled.Run(context.Background())
+		if err != nil || value.String() != "3" {
+			t.Errorf("wrong result. got=%v, %v", value, err)
+		}
+	}
+
+	if _, err := Compile(program, Options{Functions: map[string]interface{}{"f": 1}}); err == nil {
+		t.Errorf("expected an error for a function that is not a Go function")
+	}
+}
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	opts := Options{
+		Limits:       Limits{Steps: 10000},
+		Capabilities: []string{"io.stdout"},
+		Stdout:       &out,
+		Functions: map[string]interface{}{
+			"words": func() []string { return []string{"a", "b"} },
+		},
+	}
+
+	value, err := Run(context.Background(), parse(t, "print(words()); words()"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Kind() != Array || out.String() != "[a, b]\n" {
+		t.Errorf("wrong result. got=%s (%s), output=%q", value, value.Kind(), out.String())
+	}
+	var words []string
+	if err := value.Decode(&words); err != nil || !reflect.DeepEqual(words, []string{"a", "b"}) {
+		t.Errorf("wrong decoded value. got=%v, %v", words, err)
+	}
+
+	_, err = Run(context.Background(), parse(t, "fn(x) { x(x) }(fn(x) { x(x) })"), opts)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitSteps || err.Error() != "1:26: steps limit exceeded (10000)" {
+		t.Errorf("wrong limit error. got=%#v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Run(ctx, parse(t, "fn(x) { x(x) }(fn(x) { x(x) })"), Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error. got=%v", err)
+	}
+
+	_, err = Run(context.Background(), parse(t, "let f = fn() { throw 42; }; f()"), opts)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a *RuntimeError. got=%#v", err)
+	}
+	if runtimeErr.Pos != (Position{Line: 1, Column: 16}) || runtimeErr.Thrown.String() != "42" {
+		t.Errorf("wrong runtime error. got=%s, thrown %s", runtimeErr, runtimeErr.Thrown)
+	}
+
+	_, err = Run(context.Background(), parse(t, "time.now()"), opts)
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "permission denied: time.now requires the capability clock" {
+		t.Errorf("wrong permission error. got=%v", err)
+	}
+	if runtimeErr.Thrown.Kind() != Null {
+		t.Errorf("a runtime error should not have a thrown value. got=%s", runtimeErr.Thrown)
+	}
+}
+
+func TestValues(t *testing.T) {
+	type point struct{ X, Y int }
+	tests := []struct {
+		value   interface{}
+		kind    Kind
+		inspect string
+		natural interface{}
+	}{
+		{nil, Null, "null", nil},
+		{true, Boolean, "true", true},
+		{7, Integer, "7", int64(7)},
+		{0.25, Float, "0.25", 0.25},
+		{"s", String, "s", "s"},
+		{[]int{1}, Array, "[1]", []interface{}{int64(1)}},
+		{map[string]bool{"k": false}, Hash, "{k: false}", map[string]interface{}{"k": false}},
+		{point{1, 2}, Struct, "point{X: 1, Y: 2}", map[string]interface{}{"X": int64(1), "Y": int64(2)}},
+	}
+
+	for _, tt := range tests {
+		v, err := FromGo(tt.value)
+		if err != nil {
+			t.Errorf("%v: %s", tt.value, err)
+			continue
+		}
+		if v.Kind() != tt.kind || v.String() != tt.inspect {
+			t.Errorf("%v: wrong value. want=%s %s, got=%s %s", tt.value, tt.kind, tt.inspect, v.Kind(), v)
+		}
+		if !reflect.DeepEqual(v.Interface(), tt.natural) {
+			t.Errorf("%v: wrong Go value. want=%#v, got=%#v", tt.value, tt.natural, v.Interface())
+		}
+	}
+
+	if (Value{}).Kind() != Null {
+		t.Errorf("the zero Value should be null")
+	}
+
+	v, _ := FromGo(300)
+	var b uint8
+	if err := v.Decode(&b); err == nil || err.Error() != "monkey: integer 300 overflows uint8" {
+		t.Errorf("wrong decode error. got=%v", err)
+	}
+	if err := v.Decode(b); err == nil {
+		t.Errorf("expected an error decoding to a non-pointer")
+	}
+}
+
+func parse(t *testing.T, src string) *Program {
+	t.Helper()
+	program, diags := Parse(src)
+	if len(diags) > 0 {
+		t.Fatalf("parse %q: %v", src, diags)
+	}
+	return program
+}
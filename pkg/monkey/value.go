@@ -0,0 +1,143 @@
+package monkey
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/maxild/monkey/internal/object"
+)
+
+// Kind is the kind of a Value
+type Kind int
+
+const (
+	Null Kind = iota
+	Boolean
+	Integer
+	String
+	Array
+	Hash
+	Struct
+	Variant
+	Function
+	Other
+	Float // after Other, so that the values of the other kinds do not change
+)
+
+var kindNames = [...]string{
+	Null:     "null",
+	Boolean:  "boolean",
+	Integer:  "integer",
+	String:   "string",
+	Array:    "array",
+	Hash:     "hash",
+	Struct:   "struct",
+	Variant:  "variant",
+	Function: "function",
+	Other:    "other",
+	Float:    "float",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Value is a Monkey value. The zero Value is null.
+type Value struct {
+	obj object.Object
+}
+
+// FromGo converts a Go value to a Monkey value:
+//
+//	Go                                   Monkey
+//	bool                                 boolean
+//	int, int8, ..., uint64, *big.Int     integer
+//	float32, float64                     float
+//	string                               string
+//	slice, array                         array
+//	map                                  hash
+//	struct (its exported fields)         struct
+//	nil pointer, interface, slice, map   null
+//	Value                                the value itself
+//
+// A pointer converts like the value it points to. A struct field is named by its
+// `monkey` tag, or else by the Go name of the field.
+func FromGo(v interface{}) (Value, error) {
+	if v, ok := v.(Value); ok {
+		return v, nil
+	}
+	obj, err := object.FromGo(v)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{obj: obj}, nil
+}
+
+func (v Value) object() object.Object {
+	if v.obj == nil {
+		return object.NULL
+	}
+	return v.obj
+}
+
+// Kind returns the kind of the value
+func (v Value) Kind() Kind {
+	switch v.object().Type() {
+	case object.NULL_OBJ:
+		return Null
+	case object.BOOLEAN_OBJ:
+		return Boolean
+	case object.INTEGER_OBJ:
+		return Integer
+	case object.FLOAT_OBJ:
+		return Float
+	case object.STRING_OBJ:
+		return String
+	case object.ARRAY_OBJ:
+		return Array
+	case object.HASH_OBJ:
+		return Hash
+	case object.STRUCT_OBJ:
+		return Struct
+	case object.VARIANT_OBJ:
+		return Variant
+	case object.CLOSURE_OBJ, object.FUNCTION_OBJ, object.BUILTIN_OBJ, object.CONSTRUCTOR_OBJ:
+		return Function
+	}
+	return Other
+}
+
+// String returns the value as printed by the print builtin
+func (v Value) String() string {
+	return v.object().Inspect()
+}
+
+// Decode converts the value to the Go value pointed to by target, the reverse of
+// FromGo. An integer that does not fit in the Go type is an error. Decoded to an
+// interface{}, a value is a bool, int64 (or *big.Int), float64, string,
+// []interface{}, map[string]interface{} (map[interface{}]interface{} if not all its
+// keys are strings) or nil.
+func (v Value) Decode(target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("monkey: Decode of a non-pointer %T", target)
+	}
+	goValue, err := object.ToGo(v.object(), ptr.Type().Elem())
+	if err != nil {
+		return fmt.Errorf("monkey: %s", err)
+	}
+	ptr.Elem().Set(goValue)
+	return nil
+}
+
+// Interface returns the value decoded to an interface{} (see Decode)
+func (v Value) Interface() interface{} {
+	var i interface{}
+	if err := v.Decode(&i); err != nil {
+		return nil
+	}
+	return i
+}